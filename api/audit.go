@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/barpilot/gosba/audit"
+)
+
+// recordAuditedPlan records the given service and plan on the request's audit
+// entry, if the request is being audited
+func recordAuditedPlan(r *http.Request, serviceID string, planID string) {
+	if entry, ok := audit.GetEntry(r.Context()); ok {
+		entry.ServiceID = serviceID
+		entry.PlanID = planID
+	}
+}
+
+// recordAuditedParameterChanges records the differences between the given
+// (already redacted) parameters on the request's audit entry, if the request
+// is being audited
+func recordAuditedParameterChanges(
+	r *http.Request,
+	oldParams map[string]interface{},
+	newParams map[string]interface{},
+) {
+	if entry, ok := audit.GetEntry(r.Context()); ok {
+		entry.ParameterChanges = audit.DiffParameters(oldParams, newParams)
+	}
+}
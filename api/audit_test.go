@@ -0,0 +1,176 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/barpilot/gosba/audit"
+	"github.com/barpilot/gosba/http/filter"
+	"github.com/barpilot/gosba/http/filters"
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/services/fake"
+	memoryStorage "github.com/barpilot/gosba/storage/memory"
+	fakeAsync "github.com/deis/async/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func getTestAuditedServer() (*server, audit.Store, error) {
+	fakeModule, err := fake.New()
+	if err != nil {
+		return nil, nil, err
+	}
+	fakeCatalog, err := fakeModule.GetCatalog()
+	if err != nil {
+		return nil, nil, err
+	}
+	store := memoryStorage.NewStore(fakeCatalog)
+	auditStore := store.(audit.Store)
+	config := NewConfigWithDefaults()
+	config.AuditSink = audit.NewStoreSink(auditStore)
+	s, err := NewServer(
+		config,
+		store,
+		fakeAsync.NewEngine(),
+		filter.NewChain(filters.NewBasicAuthFilter("username", "password")),
+		fakeCatalog,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.(*server), auditStore, nil
+}
+
+func TestProvisioningIsAudited(t *testing.T) {
+	s, auditStore, err := getTestAuditedServer()
+	assert.Nil(t, err)
+	instanceID := getDisposableInstanceID()
+	req, err := getProvisionRequest(
+		instanceID,
+		map[string]string{
+			"accepts_incomplete": "true",
+		},
+		&ProvisioningRequest{
+			ServiceID: fake.ServiceID,
+			PlanID:    fake.StandardPlanID,
+			Parameters: map[string]interface{}{
+				"someParameter": "foo",
+			},
+		},
+	)
+	assert.Nil(t, err)
+	req.SetBasicAuth("username", "password")
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	entries, err := auditStore.GetAuditEntries()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	if len(entries) == 1 {
+		entry := entries[0]
+		assert.Equal(t, audit.OperationProvision, entry.Operation)
+		assert.Equal(t, "username", entry.PlatformIdentity)
+		assert.Equal(t, instanceID, entry.InstanceID)
+		assert.Equal(t, fake.ServiceID, entry.ServiceID)
+		assert.Equal(t, fake.StandardPlanID, entry.PlanID)
+		assert.Equal(t, http.StatusAccepted, entry.StatusCode)
+		assert.Equal(
+			t,
+			[]audit.ParameterChange{
+				{
+					Name: "someParameter",
+					New:  "foo",
+				},
+			},
+			entry.ParameterChanges,
+		)
+	}
+}
+
+func TestUnauthenticatedRequestsAreAudited(t *testing.T) {
+	s, auditStore, err := getTestAuditedServer()
+	assert.Nil(t, err)
+	req, err := getProvisionRequest(
+		getDisposableInstanceID(),
+		map[string]string{
+			"accepts_incomplete": "true",
+		},
+		&ProvisioningRequest{
+			ServiceID: fake.ServiceID,
+			PlanID:    fake.StandardPlanID,
+		},
+	)
+	assert.Nil(t, err)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	entries, err := auditStore.GetAuditEntries()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	if len(entries) == 1 {
+		assert.Equal(t, http.StatusUnauthorized, entries[0].StatusCode)
+		// The handler was never reached, so nothing is known of the body
+		assert.Empty(t, entries[0].ServiceID)
+		assert.Empty(t, entries[0].ParameterChanges)
+	}
+}
+
+func TestUpdatingIsAuditedWithParameterChanges(t *testing.T) {
+	s, auditStore, err := getTestAuditedServer()
+	assert.Nil(t, err)
+	svc, ok := s.catalog.GetService(fake.ServiceID)
+	assert.True(t, ok)
+	plan, ok := svc.GetPlan(fake.StandardPlanID)
+	assert.True(t, ok)
+	pps := plan.GetSchemas().ServiceInstances.ProvisioningParametersSchema
+	instanceID := getDisposableInstanceID()
+	err = s.store.WriteInstance(service.Instance{
+		InstanceID: instanceID,
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Status:     service.InstanceStateProvisioned,
+		ProvisioningParameters: &service.ProvisioningParameters{
+			Parameters: service.Parameters{
+				Schema: &pps,
+				Data: map[string]interface{}{
+					"someParameter": "foo",
+				},
+			},
+		},
+	})
+	assert.Nil(t, err)
+	req, err := getUpdateRequest(
+		instanceID,
+		map[string]string{
+			"accepts_incomplete": "true",
+		},
+		&UpdatingRequest{
+			ServiceID: fake.ServiceID,
+			Parameters: map[string]interface{}{
+				"someParameter": "bar",
+			},
+		},
+	)
+	assert.Nil(t, err)
+	req.SetBasicAuth("username", "password")
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	entries, err := auditStore.GetAuditEntries()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	if len(entries) == 1 {
+		assert.Equal(t, audit.OperationUpdate, entries[0].Operation)
+		assert.Equal(
+			t,
+			[]audit.ParameterChange{
+				{
+					Name: "someParameter",
+					Old:  "foo",
+					New:  "bar",
+				},
+			},
+			entries[0].ParameterChanges,
+		)
+	}
+}
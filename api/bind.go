@@ -1,12 +1,14 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"reflect"
 	"time"
 
+	"github.com/barpilot/gosba/lifecycle"
 	"github.com/barpilot/gosba/service"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
@@ -43,6 +45,8 @@ func (s *server) bind(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordAuditedPlan(r, instance.ServiceID, instance.PlanID)
+
 	if instance.Status != service.InstanceStateProvisioned {
 		log.WithFields(logFields).Debug(
 			"bad binding request: the instance to bind to is not in a provisioned state",
@@ -134,6 +138,7 @@ func (s *server) bind(w http.ResponseWriter, r *http.Request) {
 			Data:   bindingRequest.Parameters,
 		},
 	}
+	recordAuditedParameterChanges(r, nil, bindingParameters.Redacted())
 
 	binding, ok, err := s.store.GetBinding(bindingID)
 	if err != nil {
@@ -223,6 +228,7 @@ func (s *server) bind(w http.ResponseWriter, r *http.Request) {
 	)
 	if err != nil {
 		s.handleBindingError(
+			r.Context(),
 			binding,
 			err,
 			"error executing service-specific binding logic",
@@ -246,6 +252,7 @@ func (s *server) bind(w http.ResponseWriter, r *http.Request) {
 	binding.Status = service.BindingStateBound
 	if err = s.store.WriteBinding(binding); err != nil {
 		s.handleBindingError(
+			r.Context(),
 			binding,
 			err,
 			"error persisting binding",
@@ -254,6 +261,12 @@ func (s *server) bind(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.events().SendBindingEvent(
+		r.Context(),
+		lifecycle.EventTypeBindingBound,
+		binding,
+	)
+
 	// The binding is completed at this point. The only remaining errors that can
 	// occur are errors in preparing or sending the response. Such errors do not
 	// need to affect the binding's state.
@@ -293,6 +306,7 @@ func (s *server) bind(w http.ResponseWriter, r *http.Request) {
 // so we log that failure and kill the process. Barring such a failure, a nicely
 // formatted error message is logged.
 func (s *server) handleBindingError(
+	ctx context.Context,
 	binding service.Binding,
 	e error,
 	msg string,
@@ -316,6 +330,7 @@ func (s *server) handleBindingError(
 			"binding error: error persisting binding with updated status",
 		)
 	}
+	s.events().SendBindingEvent(ctx, lifecycle.EventTypeBindingFailed, binding)
 	if e != nil {
 		logFields["error"] = e
 	}
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/barpilot/gosba/lifecycle"
 	"github.com/barpilot/gosba/service"
 	"github.com/barpilot/gosba/services/fake"
 	"github.com/stretchr/testify/assert"
@@ -361,3 +362,37 @@ func getBindingRequest(
 	}
 	return req, nil
 }
+
+func TestBrandNewBindingSendsLifecycleEvent(t *testing.T) {
+	s, m, err := getTestServer()
+	assert.Nil(t, err)
+	ch := make(chan lifecycle.Event, 1)
+	s.apiServerConfig.Operation.EventSink = lifecycle.NewChannelSink(ch)
+	m.ServiceManager.BindBehavior = func(
+		service.Instance,
+		service.BindingParameters,
+	) (service.BindingDetails, error) {
+		return nil, nil
+	}
+	instanceID := getDisposableInstanceID()
+	err = s.store.WriteInstance(service.Instance{
+		InstanceID: instanceID,
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Status:     service.InstanceStateProvisioned,
+	})
+	assert.Nil(t, err)
+	bindingID := getDisposableBindingID()
+	req, err := getBindingRequest(instanceID, bindingID, &BindingRequest{})
+	assert.Nil(t, err)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, 1, len(ch))
+	if len(ch) == 1 {
+		event := <-ch
+		assert.Equal(t, lifecycle.EventTypeBindingBound, event.Type)
+		assert.Equal(t, bindingID, event.Binding.BindingID)
+		assert.Equal(t, instanceID, event.Binding.InstanceID)
+	}
+}
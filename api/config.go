@@ -1,15 +1,52 @@
 package api
 
+import (
+	"github.com/barpilot/gosba/audit"
+	"github.com/barpilot/gosba/lifecycle"
+	"github.com/barpilot/gosba/wait"
+)
+
 // Config represents configuration options for the API server
 type Config struct {
 	Port        int
 	TLSCertPath string
 	TLSKeyPath  string
+	// AuditSink, if set, receives an audit entry for every request that
+	// provisions, updates, deprovisions, binds, unbinds, or retries
+	AuditSink audit.Sink
+	// Operation governs how operations are carried out, both by the API server
+	// and by the asynchronous jobs of any broker the server belongs to
+	Operation OperationConfig
 }
 
 // NewConfigWithDefaults returns a Config object with default values already
 // applied. Callers are then free to set custom values for the remaining fields
 // and/or override default values.
 func NewConfigWithDefaults() Config {
-	return Config{Port: 8080}
+	return Config{
+		Port:      8080,
+		Operation: NewOperationConfigWithDefaults(),
+	}
+}
+
+// OperationConfig represents configuration options the API server shares with
+// the asynchronous jobs of the broker it belongs to. Brokers obtain these from
+// their API server (see OperationConfigProvider) so that the two never
+// disagree.
+type OperationConfig struct {
+	// Wait governs how often, and for how long, deferred operations wait on
+	// related instances
+	Wait wait.Config
+	// EventSink, if set, receives an event whenever a request or an async job
+	// changes the state of an instance or binding
+	EventSink lifecycle.Sink
+}
+
+// NewOperationConfigWithDefaults returns an OperationConfig object with
+// default values already applied. Callers are then free to set custom values
+// for the remaining fields and/or override default values.
+func NewOperationConfigWithDefaults() OperationConfig {
+	return OperationConfig{
+		Wait: wait.NewConfigWithDefaults(),
+	}
 }
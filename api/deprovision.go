@@ -6,7 +6,9 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/barpilot/gosba/lifecycle"
 	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/wait"
 	"github.com/deis/async"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
@@ -92,6 +94,11 @@ func (s *server) deprovision(w http.ResponseWriter, r *http.Request) {
 				fmt.Errorf("pre-deprovision fatal error, store inconsistency %s", err),
 			)
 		}
+		s.events().SendInstanceEvent(
+			r.Context(),
+			lifecycle.EventTypeInstanceDeleted,
+			instance,
+		)
 		s.writeResponse(w, http.StatusOK, generateEmptyResponse())
 		return
 	}
@@ -102,6 +109,20 @@ func (s *server) deprovision(w http.ResponseWriter, r *http.Request) {
 		)
 		s.writeResponse(w, http.StatusAccepted, generateDeprovisionAcceptedResponse())
 		return
+	case service.InstanceStateDeprovisioningFailed:
+		// Re-sending a deprovisioning request for an instance that failed to
+		// deprovision resumes deprovisioning from the step that failed
+		if _, err = s.resumeFailedOperation(r.Context(), instance); err != nil {
+			logFields["error"] = err
+			log.WithFields(logFields).Error(
+				"deprovisioning error: error resuming failed deprovisioning",
+			)
+			s.writeResponse(w, http.StatusInternalServerError, generateEmptyResponse())
+			return
+		}
+		s.writeResponse(w, http.StatusAccepted, generateDeprovisionAcceptedResponse())
+		log.WithFields(logFields).Debug("failed deprovisioning resumed")
+		return
 	case service.InstanceStateProvisioned:
 	case service.InstanceStateProvisioningFailed:
 	case service.InstanceStateUpdatingFailed:
@@ -158,13 +179,14 @@ func (s *server) deprovision(w http.ResponseWriter, r *http.Request) {
 		return
 	} else if childCount > 0 {
 		instance.Status = service.InstanceStateDeprovisioningDeferred
+		instance.WaitDeadline =
+			s.apiServerConfig.Operation.Wait.Children.GetDeadline(time.Now())
 		logFields["provisionedChildren"] = childCount
-		task = async.NewDelayedTask(
+		task = wait.NewCheckTask(
 			"checkChildrenStatuses",
-			map[string]string{
-				"instanceID": instanceID,
-			},
-			time.Minute*1,
+			instanceID,
+			0,
+			s.apiServerConfig.Operation.Wait.Children,
 		)
 		log.WithFields(logFields).Debug("children not deprovisioned, waiting")
 	} else {
@@ -181,6 +203,16 @@ func (s *server) deprovision(w http.ResponseWriter, r *http.Request) {
 		)
 	}
 
+	instance.LastCompletedStep = ""
+	instance.StepExecutions = nil
+	instance.FailedStep = ""
+	instance.StatusDescription = ""
+	operationStarted := time.Now()
+	instance.OperationStarted = &operationStarted
+	instance.OperationDeadline = getOperationDeadline(
+		instance.Plan,
+		operationStarted,
+	)
 	if err = s.store.WriteInstance(instance); err != nil {
 		logFields["error"] = err
 		log.WithFields(logFields).Error(
@@ -200,6 +232,8 @@ func (s *server) deprovision(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.events().SendInstanceStatusEvent(r.Context(), instance)
+
 	// If we get all the way to here, we've been successful!
 	s.writeResponse(w, http.StatusAccepted, generateDeprovisionAcceptedResponse())
 
@@ -0,0 +1,14 @@
+package api
+
+import (
+	"github.com/barpilot/gosba/lifecycle"
+)
+
+// events returns an emitter that relays events on behalf of this server's
+// tenant to the configured event sink, if any
+func (s *server) events() lifecycle.Emitter {
+	return lifecycle.Emitter{
+		Sink:   s.apiServerConfig.Operation.EventSink,
+		Tenant: s.tenantName,
+	}
+}
@@ -1,6 +1,10 @@
 package fake
 
-import "context"
+import (
+	"context"
+
+	"github.com/barpilot/gosba/api"
+)
 
 // RunFunction describes a function used to provide pluggable runtime behavior
 // to the fake implementation of the api.Server interface
@@ -9,12 +13,16 @@ type RunFunction func(context.Context) error
 // Server is a fake implementation of api.Server used for testing
 type Server struct {
 	RunBehavior RunFunction
+	// OperationConfig is returned to brokers that ask for the configuration
+	// the server carries out operations with
+	OperationConfig api.OperationConfig
 }
 
 // NewServer returns a new, fake implementation of api.Server used for testing
 func NewServer() *Server {
 	return &Server{
-		RunBehavior: defaultRunBehavior,
+		RunBehavior:     defaultRunBehavior,
+		OperationConfig: api.NewOperationConfigWithDefaults(),
 	}
 }
 
@@ -24,6 +32,11 @@ func (s *Server) Run(ctx context.Context) error {
 	return s.RunBehavior(ctx)
 }
 
+// GetOperationConfig returns the OperationConfig the server was created with
+func (s *Server) GetOperationConfig() api.OperationConfig {
+	return s.OperationConfig
+}
+
 func defaultRunBehavior(ctx context.Context) error {
 	<-ctx.Done()
 	return ctx.Err()
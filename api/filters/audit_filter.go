@@ -0,0 +1,99 @@
+package filters
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/barpilot/gosba/audit"
+	"github.com/barpilot/gosba/http/filter"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// NewAuditFilter returns an implementation of the filter.Filter interface
+// that records every mutating OSB (or admin) request, and its outcome, to the
+// given sink. A request is recorded if the route that matched it is named
+// after one of the operations of the audit package (e.g. "provision"). Other
+// requests pass through unrecorded.
+// Handlers may add details that only they know (e.g. parameter changes) to
+// the entry carried by the request's context. The given tenant name is
+// recorded with each entry and may be empty.
+//
+// This filter depends on route variables and should therefore only be used
+// to wrap handlers that are registered with a router.
+func NewAuditFilter(sink audit.Sink, tenant string) filter.Filter {
+	return filter.NewGenericFilter(
+		func(handle http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				vars := mux.Vars(r)
+				operation, ok := getAuditOperation(mux.CurrentRoute(r))
+				if !ok {
+					handle(w, r)
+					return
+				}
+				entry := &audit.Entry{
+					Timestamp:  time.Now(),
+					Tenant:     tenant,
+					Operation:  operation,
+					Method:     r.Method,
+					Path:       r.URL.Path,
+					InstanceID: vars["instance_id"],
+					BindingID:  vars["binding_id"],
+					// Deprovisioning and unbinding requests convey these as query
+					// parameters. Other handlers find them in the request body.
+					ServiceID: r.URL.Query().Get("service_id"),
+					PlanID:    r.URL.Query().Get("plan_id"),
+				}
+				entry.PlatformIdentity, _, _ = r.BasicAuth()
+				header := r.Header.Get(audit.OriginatingIdentityHeader)
+				if header != "" {
+					identity, err := audit.ParseOriginatingIdentity(header)
+					if err != nil {
+						log.WithField("error", err).Warn(
+							"audit filter: error parsing originating identity",
+						)
+					}
+					entry.OriginatingIdentity = identity
+				}
+				sw := &statusRecordingResponseWriter{
+					ResponseWriter: w,
+					statusCode:     http.StatusOK,
+				}
+				// Call the original handler
+				handle(sw, r.WithContext(audit.WithEntry(r.Context(), entry)))
+				entry.StatusCode = sw.statusCode
+				audit.Record(r.Context(), sink, *entry)
+			}
+		},
+	)
+}
+
+// auditedOperations indexes the operations that are recorded by name
+var auditedOperations = map[string]audit.Operation{
+	string(audit.OperationProvision):   audit.OperationProvision,
+	string(audit.OperationUpdate):      audit.OperationUpdate,
+	string(audit.OperationDeprovision): audit.OperationDeprovision,
+	string(audit.OperationBind):        audit.OperationBind,
+	string(audit.OperationUnbind):      audit.OperationUnbind,
+	string(audit.OperationRetry):       audit.OperationRetry,
+}
+
+// getAuditOperation returns the operation that requests matched by the given
+// route represent, if they are to be recorded
+func getAuditOperation(route *mux.Route) (audit.Operation, bool) {
+	if route == nil {
+		return "", false
+	}
+	operation, ok := auditedOperations[route.GetName()]
+	return operation, ok
+}
+
+type statusRecordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (s *statusRecordingResponseWriter) WriteHeader(statusCode int) {
+	s.statusCode = statusCode
+	s.ResponseWriter.WriteHeader(statusCode)
+}
@@ -0,0 +1,113 @@
+package filters
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/barpilot/gosba/audit"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func getTestAuditRouter(sink audit.Sink) *mux.Router {
+	auditFilter := NewAuditFilter(sink, "foo")
+	router := mux.NewRouter()
+	router.HandleFunc(
+		"/v2/service_instances/{instance_id}/service_bindings/{binding_id}",
+		auditFilter.GetHandler(func(w http.ResponseWriter, r *http.Request) {
+			entry, ok := audit.GetEntry(r.Context())
+			if ok {
+				entry.ServiceID = "bat"
+			}
+			w.WriteHeader(http.StatusCreated)
+		}),
+	).Methods(http.MethodPut).Name(string(audit.OperationBind))
+	router.HandleFunc(
+		"/v2/service_instances/{instance_id}/last_operation",
+		auditFilter.GetHandler(func(http.ResponseWriter, *http.Request) {}),
+	).Methods(http.MethodGet)
+	// A mutating route that isn't named after an operation
+	router.HandleFunc(
+		"/admin/service_instances/{instance_id}/foo",
+		auditFilter.GetHandler(func(http.ResponseWriter, *http.Request) {}),
+	).Methods(http.MethodPost)
+	return router
+}
+
+func TestAuditFilterRecordsMutatingRequests(t *testing.T) {
+	entries := []audit.Entry{}
+	router := getTestAuditRouter(audit.SinkFunc(
+		func(_ context.Context, entry audit.Entry) error {
+			entries = append(entries, entry)
+			return nil
+		},
+	))
+	req, err := http.NewRequest(
+		http.MethodPut,
+		"/v2/service_instances/bar/service_bindings/baz?plan_id=qux",
+		nil,
+	)
+	assert.Nil(t, err)
+	req.SetBasicAuth("platform", "password")
+	req.Header.Set(
+		audit.OriginatingIdentityHeader,
+		"cloudfoundry "+
+			base64.StdEncoding.EncodeToString([]byte(`{"user_id":"jdoe"}`)),
+	)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, 1, len(entries))
+	if len(entries) == 1 {
+		entry := entries[0]
+		assert.False(t, entry.Timestamp.IsZero())
+		assert.Equal(t, "foo", entry.Tenant)
+		assert.Equal(t, audit.OperationBind, entry.Operation)
+		assert.Equal(t, http.MethodPut, entry.Method)
+		assert.Equal(
+			t,
+			"/v2/service_instances/bar/service_bindings/baz",
+			entry.Path,
+		)
+		assert.Equal(t, "platform", entry.PlatformIdentity)
+		assert.Equal(
+			t,
+			&audit.OriginatingIdentity{
+				Platform: "cloudfoundry",
+				Value: map[string]interface{}{
+					"user_id": "jdoe",
+				},
+			},
+			entry.OriginatingIdentity,
+		)
+		assert.Equal(t, "bar", entry.InstanceID)
+		assert.Equal(t, "baz", entry.BindingID)
+		assert.Equal(t, "bat", entry.ServiceID)
+		assert.Equal(t, "qux", entry.PlanID)
+		assert.Equal(t, http.StatusCreated, entry.StatusCode)
+	}
+}
+
+func TestAuditFilterIgnoresRequestsOfUnnamedRoutes(t *testing.T) {
+	recorded := false
+	router := getTestAuditRouter(audit.SinkFunc(
+		func(context.Context, audit.Entry) error {
+			recorded = true
+			return nil
+		},
+	))
+	for method, path := range map[string]string{
+		http.MethodGet:  "/v2/service_instances/bar/last_operation",
+		http.MethodPost: "/admin/service_instances/bar/foo",
+	} {
+		req, err := http.NewRequest(method, path, nil)
+		assert.Nil(t, err)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+	assert.False(t, recorded)
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/barpilot/gosba/http/filter"
+	"github.com/barpilot/gosba/tenant"
+	"github.com/deis/async"
+	"github.com/gorilla/mux"
+)
+
+// NewMultiTenantServer returns an HTTP router that serves the OSB API on
+// behalf of each of the given tenants. Requests are routed to a tenant either
+// by host, if the tenant specifies one, or by the /tenants/{tenant} path
+// prefix. Every tenant is served using its own catalog, storage, codec, and
+// filter chain while tasks of all tenants are submitted to the one async
+// engine.
+func NewMultiTenantServer(
+	apiServerConfig Config,
+	asyncEngine async.Engine,
+	tenants ...tenant.Tenant,
+) (Server, error) {
+	s := &server{
+		apiServerConfig: apiServerConfig,
+		asyncEngine:     asyncEngine,
+	}
+
+	router := mux.NewRouter()
+	router.StrictSlash(true)
+	router.HandleFunc(
+		"/healthz",
+		s.multiTenantHealthCheck, // Filter chain not applied to this reqeust
+	).Methods(http.MethodGet)
+
+	tenantNames := map[string]struct{}{}
+	for _, t := range tenants {
+		if t.Name == "" {
+			return nil, fmt.Errorf("tenant name must not be empty")
+		}
+		if _, ok := tenantNames[t.Name]; ok {
+			return nil, fmt.Errorf(`duplicate tenant name "%s" detected`, t.Name)
+		}
+		tenantNames[t.Name] = struct{}{}
+		store, err := t.GetStore()
+		if err != nil {
+			return nil, fmt.Errorf(
+				`error getting store of tenant "%s": %s`,
+				t.Name,
+				err,
+			)
+		}
+		filterChain := t.FilterChain
+		if filterChain == nil {
+			filterChain = filter.NewChain()
+		}
+		ts, err := newServer(
+			apiServerConfig,
+			store,
+			tenant.NewEngine(asyncEngine, t.Name),
+			filterChain,
+			t.Catalog,
+			t.Name,
+		)
+		if err != nil {
+			return nil, fmt.Errorf(
+				`error creating api server for tenant "%s": %s`,
+				t.Name,
+				err,
+			)
+		}
+		if t.Host != "" {
+			router.Host(t.Host).Handler(ts.router)
+		} else {
+			prefix := fmt.Sprintf("/tenants/%s", t.Name)
+			router.PathPrefix(prefix + "/").Handler(
+				http.StripPrefix(prefix, ts.router),
+			)
+		}
+		s.tenantServers = append(s.tenantServers, ts)
+	}
+	s.router = router
+
+	s.listenAndServe = s.defaultListenAndServe
+
+	return s, nil
+}
+
+func (s *server) multiTenantHealthCheck(
+	w http.ResponseWriter,
+	_ *http.Request,
+) {
+	for _, ts := range s.tenantServers {
+		if err := ts.store.TestConnection(); err != nil {
+			s.writeResponse(w, http.StatusInternalServerError, responseEmptyJSON)
+			return
+		}
+	}
+	s.writeResponse(w, http.StatusOK, responseEmptyJSON)
+}
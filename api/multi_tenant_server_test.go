@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/barpilot/gosba/lifecycle"
+	"github.com/barpilot/gosba/services/fake"
+	memoryStorage "github.com/barpilot/gosba/storage/memory"
+	"github.com/barpilot/gosba/tenant"
+	fakeAsync "github.com/deis/async/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiTenantServerRoutesByPathPrefix(t *testing.T) {
+	s, err := getTestMultiTenantServer("a", "b")
+	assert.Nil(t, err)
+	for _, path := range []string{
+		"/tenants/a/v2/catalog",
+		"/tenants/b/v2/catalog",
+	} {
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		assert.Nil(t, err)
+		rr := httptest.NewRecorder()
+		s.router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+	req, err := http.NewRequest(http.MethodGet, "/tenants/c/v2/catalog", nil)
+	assert.Nil(t, err)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestMultiTenantServerWithDuplicateTenantNames(t *testing.T) {
+	_, err := getTestMultiTenantServer("a", "a")
+	assert.NotNil(t, err)
+}
+
+func TestMultiTenantServerAppliesOperationConfigToTenants(t *testing.T) {
+	config := NewConfigWithDefaults()
+	config.Operation.EventSink =
+		lifecycle.NewChannelSink(make(chan lifecycle.Event))
+	s, err := getTestMultiTenantServerWithConfig(config, "a", "b")
+	assert.Nil(t, err)
+	assert.Equal(t, config.Operation, s.GetOperationConfig())
+	for _, ts := range s.tenantServers {
+		assert.Equal(t, config.Operation.EventSink, ts.events().Sink)
+		assert.Equal(t, ts.tenantName, ts.events().Tenant)
+	}
+}
+
+func getTestMultiTenantServer(tenantNames ...string) (*server, error) {
+	return getTestMultiTenantServerWithConfig(
+		NewConfigWithDefaults(),
+		tenantNames...,
+	)
+}
+
+func getTestMultiTenantServerWithConfig(
+	config Config,
+	tenantNames ...string,
+) (*server, error) {
+	fakeModule, err := fake.New()
+	if err != nil {
+		return nil, err
+	}
+	fakeCatalog, err := fakeModule.GetCatalog()
+	if err != nil {
+		return nil, err
+	}
+	tenants := make([]tenant.Tenant, len(tenantNames))
+	for i, tenantName := range tenantNames {
+		tenants[i] = tenant.Tenant{
+			Name:    tenantName,
+			Catalog: fakeCatalog,
+			Store:   memoryStorage.NewStore(fakeCatalog),
+		}
+	}
+	s, err := NewMultiTenantServer(
+		config,
+		fakeAsync.NewEngine(),
+		tenants...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s.(*server), nil
+}
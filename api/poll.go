@@ -3,6 +3,8 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/barpilot/gosba/service"
 	"github.com/gorilla/mux"
@@ -69,6 +71,34 @@ func (s *server) poll(
 
 	logFields["status"] = instance.Status
 
+	// Platforms stop polling once a plan's maximum polling duration has
+	// elapsed, so an operation that is still incomplete by then is reported as
+	// failed. The broker will fail it as well before executing its next step.
+	if isOperationOverdue(instance) {
+		switch instance.Status {
+		case service.InstanceStateProvisioningDeferred,
+			service.InstanceStateProvisioning,
+			service.InstanceStateUpdating,
+			service.InstanceStateDeprovisioningDeferred,
+			service.InstanceStateDeprovisioning:
+			log.WithFields(logFields).Debug(
+				"operation has exceeded the maximum polling duration",
+			)
+			s.writeResponse(
+				w,
+				http.StatusOK,
+				generateOperationStateResponse(
+					OperationStateFailed,
+					fmt.Sprintf(
+						"%s did not complete within the maximum polling duration",
+						capitalize(operation),
+					),
+				),
+			)
+			return
+		}
+	}
+
 	if operation == OperationProvisioning {
 		switch instance.Status {
 		case service.InstanceStateProvisioningDeferred:
@@ -77,22 +107,54 @@ func (s *server) poll(
 			)
 			// We'll still send an "in progress" response because the OSB spec doesn't
 			// currently define a "deferred" state
-			s.writeResponse(w, http.StatusOK, generateOperationInProgressResponse())
+			s.writeResponse(
+				w,
+				http.StatusOK,
+				generateOperationStateResponse(
+					OperationStateInProgress,
+					getWaitDescription(
+						instance,
+						"parent instance to be provisioned",
+					),
+				),
+			)
 		case service.InstanceStateProvisioning:
 			log.WithFields(logFields).Debug(
 				"provisioning is in progress",
 			)
-			s.writeResponse(w, http.StatusOK, generateOperationInProgressResponse())
+			setRetryAfter(w, operation, instance)
+			s.writeResponse(
+				w,
+				http.StatusOK,
+				generateOperationStateResponse(
+					OperationStateInProgress,
+					getProgressDescription(operation, instance),
+				),
+			)
 		case service.InstanceStateProvisioned:
 			log.WithFields(logFields).Debug(
 				"provisioning is complete",
 			)
-			s.writeResponse(w, http.StatusOK, generateOperationSucceededResponse())
+			s.writeResponse(
+				w,
+				http.StatusOK,
+				generateOperationStateResponse(
+					OperationStateSucceeded,
+					getSuccessDescription(operation),
+				),
+			)
 		case service.InstanceStateProvisioningFailed:
 			log.WithFields(logFields).Debug(
 				"provisioning has failed",
 			)
-			s.writeResponse(w, http.StatusOK, generateOperationFailedResponse())
+			s.writeResponse(
+				w,
+				http.StatusOK,
+				generateOperationStateResponse(
+					OperationStateFailed,
+					getFailureDescription(operation, instance),
+				),
+			)
 		default:
 			log.WithFields(logFields).Error(
 				"polling error: instance is in an unknown or invalid state",
@@ -108,17 +170,39 @@ func (s *server) poll(
 			log.WithFields(logFields).Debug(
 				"updating is in progress",
 			)
-			s.writeResponse(w, http.StatusOK, generateOperationInProgressResponse())
+			setRetryAfter(w, operation, instance)
+			s.writeResponse(
+				w,
+				http.StatusOK,
+				generateOperationStateResponse(
+					OperationStateInProgress,
+					getProgressDescription(operation, instance),
+				),
+			)
 		case service.InstanceStateProvisioned:
 			log.WithFields(logFields).Debug(
 				"updating is complete",
 			)
-			s.writeResponse(w, http.StatusOK, generateOperationSucceededResponse())
+			s.writeResponse(
+				w,
+				http.StatusOK,
+				generateOperationStateResponse(
+					OperationStateSucceeded,
+					getSuccessDescription(operation),
+				),
+			)
 		case service.InstanceStateUpdatingFailed:
 			log.WithFields(logFields).Debug(
 				"updating has failed",
 			)
-			s.writeResponse(w, http.StatusOK, generateOperationFailedResponse())
+			s.writeResponse(
+				w,
+				http.StatusOK,
+				generateOperationStateResponse(
+					OperationStateFailed,
+					getFailureDescription(operation, instance),
+				),
+			)
 		default:
 			log.WithFields(logFields).Error(
 				"polling error: instance is in an unknown or invalid state",
@@ -135,22 +219,182 @@ func (s *server) poll(
 		)
 		// We'll still send an "in progress" response because the OSB spec doesn't
 		// currently define a "deferred" state
-		s.writeResponse(w, http.StatusOK, generateOperationInProgressResponse())
+		s.writeResponse(
+			w,
+			http.StatusOK,
+			generateOperationStateResponse(
+				OperationStateInProgress,
+				getWaitDescription(
+					instance,
+					"child instances to be deprovisioned",
+				),
+			),
+		)
 	case service.InstanceStateDeprovisioning:
 		log.WithFields(logFields).Debug(
 			"deprovisioning is in progress",
 		)
-		s.writeResponse(w, http.StatusOK, generateOperationInProgressResponse())
+		setRetryAfter(w, operation, instance)
+		s.writeResponse(
+			w,
+			http.StatusOK,
+			generateOperationStateResponse(
+				OperationStateInProgress,
+				getProgressDescription(operation, instance),
+			),
+		)
 	case service.InstanceStateDeprovisioningFailed:
 		log.WithFields(logFields).Debug(
 			"deprovisioning has failed",
 		)
-		s.writeResponse(w, http.StatusOK, generateOperationFailedResponse())
+		s.writeResponse(
+			w,
+			http.StatusOK,
+			generateOperationStateResponse(
+				OperationStateFailed,
+				getFailureDescription(operation, instance),
+			),
+		)
 	default:
 		log.WithFields(logFields).Error(
 			"polling error: instance is in an unknown or invalid state",
 		)
 		s.writeResponse(w, http.StatusInternalServerError, generateEmptyResponse())
 	}
+}
+
+// getWaitDescription returns a description of a deferred operation that
+// states what the operation is waiting on and how much longer the broker will
+// wait before failing the operation
+func getWaitDescription(
+	instance service.Instance,
+	waitingOn string,
+) string {
+	if instance.WaitDeadline == nil {
+		return fmt.Sprintf("Waiting for %s", waitingOn)
+	}
+	remaining := time.Until(*instance.WaitDeadline).Round(time.Second)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return fmt.Sprintf(
+		"Waiting for %s; will stop waiting in %s",
+		waitingOn,
+		remaining,
+	)
+}
+
+// stepChain is satisfied by service.Provisioner, service.Updater, and
+// service.Deprovisioner alike
+type stepChain interface {
+	GetFirstStepName() (string, bool)
+	GetNextStepName(name string) (string, bool)
+}
+
+func getStepChain(
+	operation string,
+	instance service.Instance,
+) (stepChain, error) {
+	if instance.Service == nil || instance.Plan == nil {
+		return nil, fmt.Errorf(
+			`service or plan not resolved for instance "%s"`,
+			instance.InstanceID,
+		)
+	}
+	serviceManager := instance.Service.GetServiceManager()
+	switch operation {
+	case OperationProvisioning:
+		return serviceManager.GetProvisioner(instance.Plan)
+	case OperationUpdating:
+		return serviceManager.GetUpdater(instance.Plan)
+	default:
+		return serviceManager.GetDeprovisioner(instance.Plan)
+	}
+}
+
+// getCurrentStepName returns the name of the step that follows the last step
+// the given instance completed
+func getCurrentStepName(
+	chain stepChain,
+	instance service.Instance,
+) (string, bool) {
+	if instance.LastCompletedStep == "" {
+		return chain.GetFirstStepName()
+	}
+	return chain.GetNextStepName(instance.LastCompletedStep)
+}
 
+// getProgressDescription returns a description of an in-progress operation
+// that states which step is currently executing and where that step falls in
+// the operation's chain of steps
+func getProgressDescription(
+	operation string,
+	instance service.Instance,
+) string {
+	inProgress := fmt.Sprintf("%s is in progress", capitalize(operation))
+	chain, err := getStepChain(operation, instance)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"instanceID": instance.InstanceID,
+			"operation":  operation,
+			"error":      err,
+		}).Warn("polling error: error retrieving chain of steps for operation")
+		return inProgress
+	}
+	currentStepName, ok := getCurrentStepName(chain, instance)
+	if !ok {
+		return inProgress
+	}
+	var currentStep, totalSteps int
+	stepName, ok := chain.GetFirstStepName()
+	for ok {
+		totalSteps++
+		if stepName == currentStepName {
+			currentStep = totalSteps
+		}
+		stepName, ok = chain.GetNextStepName(stepName)
+	}
+	return fmt.Sprintf(
+		`%s is in progress: executing step "%s" (step %d of %d)`,
+		capitalize(operation),
+		currentStepName,
+		currentStep,
+		totalSteps,
+	)
+}
+
+func getSuccessDescription(operation string) string {
+	return fmt.Sprintf("%s has completed successfully", capitalize(operation))
+}
+
+// getFailureDescription returns a description of a failed operation that is
+// safe to show to end users. The instance's status reason is deliberately
+// never included since it may contain sensitive, internal details. Modules
+// may supply a friendlier message by failing with a service.UserFacingError.
+func getFailureDescription(
+	operation string,
+	instance service.Instance,
+) string {
+	if instance.StatusDescription != "" {
+		return fmt.Sprintf(
+			"%s has failed: %s",
+			capitalize(operation),
+			instance.StatusDescription,
+		)
+	}
+	if instance.FailedStep != "" {
+		return fmt.Sprintf(
+			`%s has failed at step "%s"`,
+			capitalize(operation),
+			instance.FailedStep,
+		)
+	}
+	return fmt.Sprintf("%s has failed", capitalize(operation))
+}
+
+func capitalize(str string) string {
+	if str == "" {
+		return str
+	}
+	return strings.ToUpper(str[:1]) + str[1:]
 }
@@ -1,10 +1,12 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/barpilot/gosba/service"
 	"github.com/barpilot/gosba/services/fake"
@@ -49,7 +51,9 @@ func TestPollingWithInstanceProvisioning(t *testing.T) {
 	rr := httptest.NewRecorder()
 	s.router.ServeHTTP(rr, req)
 	assert.Equal(t, http.StatusOK, rr.Code)
-	assert.Equal(t, responseInProgress, rr.Body.Bytes())
+	res := getOperationStateResponse(t, rr.Body.Bytes())
+	assert.Equal(t, OperationStateInProgress, res.State)
+	assert.NotEmpty(t, res.Description)
 }
 
 func TestPollingWithInstanceProvisioned(t *testing.T) {
@@ -68,7 +72,9 @@ func TestPollingWithInstanceProvisioned(t *testing.T) {
 	rr := httptest.NewRecorder()
 	s.router.ServeHTTP(rr, req)
 	assert.Equal(t, http.StatusOK, rr.Code)
-	assert.Equal(t, responseSucceeded, rr.Body.Bytes())
+	res := getOperationStateResponse(t, rr.Body.Bytes())
+	assert.Equal(t, OperationStateSucceeded, res.State)
+	assert.Equal(t, "Provisioning has completed successfully", res.Description)
 }
 
 func TestPollingWithInstanceProvisioningFailed(t *testing.T) {
@@ -87,7 +93,9 @@ func TestPollingWithInstanceProvisioningFailed(t *testing.T) {
 	rr := httptest.NewRecorder()
 	s.router.ServeHTTP(rr, req)
 	assert.Equal(t, http.StatusOK, rr.Code)
-	assert.Equal(t, responseFailed, rr.Body.Bytes())
+	res := getOperationStateResponse(t, rr.Body.Bytes())
+	assert.Equal(t, OperationStateFailed, res.State)
+	assert.NotEmpty(t, res.Description)
 }
 
 func TestPollingWithInstanceDeprovisioning(t *testing.T) {
@@ -106,7 +114,9 @@ func TestPollingWithInstanceDeprovisioning(t *testing.T) {
 	rr := httptest.NewRecorder()
 	s.router.ServeHTTP(rr, req)
 	assert.Equal(t, http.StatusOK, rr.Code)
-	assert.Equal(t, responseInProgress, rr.Body.Bytes())
+	res := getOperationStateResponse(t, rr.Body.Bytes())
+	assert.Equal(t, OperationStateInProgress, res.State)
+	assert.NotEmpty(t, res.Description)
 }
 
 func TestPollingWithInstanceGone(t *testing.T) {
@@ -140,7 +150,9 @@ func TestPollingWithInstanceDeprovisioningFailed(t *testing.T) {
 	rr := httptest.NewRecorder()
 	s.router.ServeHTTP(rr, req)
 	assert.Equal(t, http.StatusOK, rr.Code)
-	assert.Equal(t, responseFailed, rr.Body.Bytes())
+	res := getOperationStateResponse(t, rr.Body.Bytes())
+	assert.Equal(t, OperationStateFailed, res.State)
+	assert.NotEmpty(t, res.Description)
 }
 
 func getPollingRequest(instanceID, operation string) (*http.Request, error) {
@@ -159,3 +171,131 @@ func getPollingRequest(instanceID, operation string) (*http.Request, error) {
 	}
 	return req, nil
 }
+
+func TestPollingWithInstanceProvisioningDeferred(t *testing.T) {
+	s, _, err := getTestServer()
+	assert.Nil(t, err)
+	instanceID := getDisposableInstanceID()
+	waitDeadline := time.Now().Add(time.Hour)
+	err = s.store.WriteInstance(service.Instance{
+		InstanceID:   instanceID,
+		ServiceID:    fake.ServiceID,
+		PlanID:       fake.StandardPlanID,
+		Status:       service.InstanceStateProvisioningDeferred,
+		WaitDeadline: &waitDeadline,
+	})
+	assert.Nil(t, err)
+	req, err := getPollingRequest(instanceID, OperationProvisioning)
+	assert.Nil(t, err)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	res := getOperationStateResponse(t, rr.Body.Bytes())
+	assert.Equal(t, OperationStateInProgress, res.State)
+	assert.Contains(t, res.Description, "parent instance to be provisioned")
+	assert.Contains(t, res.Description, "will stop waiting in")
+}
+
+func TestPollingWithInstanceProvisioningReportsCurrentStep(t *testing.T) {
+	s, _, err := getTestServer()
+	assert.Nil(t, err)
+	instanceID := getDisposableInstanceID()
+	err = s.store.WriteInstance(service.Instance{
+		InstanceID: instanceID,
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Status:     service.InstanceStateProvisioning,
+	})
+	assert.Nil(t, err)
+	req, err := getPollingRequest(instanceID, OperationProvisioning)
+	assert.Nil(t, err)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	res := getOperationStateResponse(t, rr.Body.Bytes())
+	assert.Equal(
+		t,
+		`Provisioning is in progress: executing step "run" (step 1 of 1)`,
+		res.Description,
+	)
+}
+
+func TestPollingWithInstanceProvisioningFailedWithUserFacingError(
+	t *testing.T,
+) {
+	s, _, err := getTestServer()
+	assert.Nil(t, err)
+	instanceID := getDisposableInstanceID()
+	err = s.store.WriteInstance(service.Instance{
+		InstanceID:        instanceID,
+		ServiceID:         fake.ServiceID,
+		PlanID:            fake.StandardPlanID,
+		Status:            service.InstanceStateProvisioningFailed,
+		StatusReason:      "secret internal details",
+		StatusDescription: "quota exceeded",
+		FailedStep:        "run",
+	})
+	assert.Nil(t, err)
+	req, err := getPollingRequest(instanceID, OperationProvisioning)
+	assert.Nil(t, err)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	res := getOperationStateResponse(t, rr.Body.Bytes())
+	assert.Equal(t, OperationStateFailed, res.State)
+	assert.Equal(t, "Provisioning has failed: quota exceeded", res.Description)
+	assert.NotContains(t, rr.Body.String(), "secret")
+}
+
+func getOperationStateResponse(
+	t *testing.T,
+	body []byte,
+) operationStateResponse {
+	res := operationStateResponse{}
+	assert.Nil(t, json.Unmarshal(body, &res))
+	return res
+}
+
+func TestPollingWithInstanceProvisioningSetsRetryAfter(t *testing.T) {
+	s, _, err := getTestServer()
+	assert.Nil(t, err)
+	instanceID := getDisposableInstanceID()
+	err = s.store.WriteInstance(service.Instance{
+		InstanceID: instanceID,
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Status:     service.InstanceStateProvisioning,
+	})
+	assert.Nil(t, err)
+	req, err := getPollingRequest(instanceID, OperationProvisioning)
+	assert.Nil(t, err)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "30", rr.Header().Get("Retry-After"))
+}
+
+func TestPollingWithInstanceProvisioningPastMaximumPollingDuration(
+	t *testing.T,
+) {
+	s, _, err := getTestServer()
+	assert.Nil(t, err)
+	instanceID := getDisposableInstanceID()
+	operationDeadline := time.Now().Add(-time.Minute)
+	err = s.store.WriteInstance(service.Instance{
+		InstanceID:        instanceID,
+		ServiceID:         fake.ServiceID,
+		PlanID:            fake.StandardPlanID,
+		Status:            service.InstanceStateProvisioning,
+		OperationDeadline: &operationDeadline,
+	})
+	assert.Nil(t, err)
+	req, err := getPollingRequest(instanceID, OperationProvisioning)
+	assert.Nil(t, err)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	res := getOperationStateResponse(t, rr.Body.Bytes())
+	assert.Equal(t, OperationStateFailed, res.State)
+	assert.Empty(t, rr.Header().Get("Retry-After"))
+}
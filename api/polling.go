@@ -0,0 +1,89 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/barpilot/gosba/service"
+)
+
+// getOperationDeadline returns the time after which an operation against the
+// given plan that started at the given time is considered to have failed. If
+// the plan does not limit how long operations may take, nil is returned.
+func getOperationDeadline(plan service.Plan, started time.Time) *time.Time {
+	if plan == nil {
+		return nil
+	}
+	maxPollingDuration := plan.GetProperties().MaximumPollingDuration
+	if maxPollingDuration <= 0 {
+		return nil
+	}
+	deadline := started.Add(time.Duration(maxPollingDuration) * time.Second)
+	return &deadline
+}
+
+func isOperationOverdue(instance service.Instance) bool {
+	return instance.OperationDeadline != nil &&
+		time.Now().After(*instance.OperationDeadline)
+}
+
+// getExpectedStepDuration returns roughly how long the named step is expected
+// to take to execute. If the step doesn't say, the plan's expected step
+// duration is used instead.
+func getExpectedStepDuration(
+	chain stepChain,
+	stepName string,
+	plan service.Plan,
+) time.Duration {
+	var step interface{}
+	switch c := chain.(type) {
+	case service.Provisioner:
+		step, _ = c.GetStep(stepName)
+	case service.Updater:
+		step, _ = c.GetStep(stepName)
+	case service.Deprovisioner:
+		step, _ = c.GetStep(stepName)
+	}
+	if s, ok := step.(service.ExpectedDurationStep); ok &&
+		s.GetExpectedDuration() > 0 {
+		return s.GetExpectedDuration()
+	}
+	if plan != nil {
+		return plan.GetProperties().ExpectedStepDuration
+	}
+	return 0
+}
+
+// setRetryAfter advises the platform, using the Retry-After header, how long
+// to wait before polling again for the status of an in-progress operation.
+// The advice is based on the expected duration of the step currently
+// executing and never extends beyond the operation's deadline.
+func setRetryAfter(
+	w http.ResponseWriter,
+	operation string,
+	instance service.Instance,
+) {
+	chain, err := getStepChain(operation, instance)
+	if err != nil {
+		return
+	}
+	currentStepName, ok := getCurrentStepName(chain, instance)
+	if !ok {
+		return
+	}
+	retryAfter := getExpectedStepDuration(chain, currentStepName, instance.Plan)
+	if retryAfter <= 0 {
+		return
+	}
+	if instance.OperationDeadline != nil &&
+		time.Until(*instance.OperationDeadline) < retryAfter {
+		retryAfter = time.Until(*instance.OperationDeadline)
+	}
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", seconds))
+}
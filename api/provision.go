@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -9,6 +10,8 @@ import (
 	"time"
 
 	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/storage"
+	"github.com/barpilot/gosba/wait"
 	"github.com/deis/async"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
@@ -79,6 +82,12 @@ func (s *server) provision(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordAuditedPlan(
+		r,
+		provisioningRequest.ServiceID,
+		provisioningRequest.PlanID,
+	)
+
 	serviceID := provisioningRequest.ServiceID
 	if serviceID == "" {
 		logFields["field"] = "service_id"
@@ -153,6 +162,7 @@ func (s *server) provision(w http.ResponseWriter, r *http.Request) {
 			Data:   provisioningRequest.Parameters,
 		},
 	}
+	recordAuditedParameterChanges(r, nil, provisioningParameters.Redacted())
 
 	// Unpack the generic bits of the parameter map...
 	// Alias
@@ -194,6 +204,24 @@ func (s *server) provision(w http.ResponseWriter, r *http.Request) {
 			case service.InstanceStateProvisioned:
 				s.writeResponse(w, http.StatusOK, generateEmptyResponse())
 				return
+			case service.InstanceStateProvisioningFailed:
+				// Re-sending an identical request for an instance that failed to
+				// provision resumes provisioning from the step that failed
+				if _, err = s.resumeFailedOperation(r.Context(), instance); err != nil {
+					logFields["error"] = err
+					log.WithFields(logFields).Error(
+						"provisioning error: error resuming failed provisioning",
+					)
+					s.writeResponse(
+						w,
+						http.StatusInternalServerError,
+						generateEmptyResponse(),
+					)
+					return
+				}
+				s.writeResponse(w, http.StatusAccepted, generateProvisionAcceptedResponse())
+				log.WithFields(logFields).Debug("failed provisioning resumed")
+				return
 			default:
 				// TODO: Write a more detailed response
 				s.writeResponse(w, http.StatusConflict, generateConflictResponse())
@@ -237,6 +265,7 @@ func (s *server) provision(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	created := time.Now()
 	instance = service.Instance{
 		InstanceID:             instanceID,
 		Alias:                  alias,
@@ -245,7 +274,9 @@ func (s *server) provision(w http.ResponseWriter, r *http.Request) {
 		ProvisioningParameters: provisioningParameters,
 		Status:                 service.InstanceStateProvisioning,
 		ParentAlias:            parentAlias,
-		Created:                time.Now(),
+		Created:                created,
+		OperationStarted:       &created,
+		OperationDeadline:      getOperationDeadline(plan, created),
 	}
 
 	var task async.Task
@@ -259,12 +290,13 @@ func (s *server) provision(w http.ResponseWriter, r *http.Request) {
 		return
 	} else if waitForParent {
 		instance.Status = service.InstanceStateProvisioningDeferred
-		task = async.NewDelayedTask(
+		instance.WaitDeadline =
+			s.apiServerConfig.Operation.Wait.Parent.GetDeadline(time.Now())
+		task = wait.NewCheckTask(
 			"checkParentStatus",
-			map[string]string{
-				"instanceID": instanceID,
-			},
-			time.Minute*1,
+			instanceID,
+			0,
+			s.apiServerConfig.Operation.Wait.Parent,
 		)
 		log.WithFields(logFields).Debug("parent not provisioned, waiting")
 	} else {
@@ -282,10 +314,33 @@ func (s *server) provision(w http.ResponseWriter, r *http.Request) {
 
 	if err = s.store.WriteInstance(instance); err != nil {
 		logFields["error"] = err
-		log.WithFields(logFields).Error(
-			"provisioning error: error persisting new instance",
-		)
-		s.writeResponse(w, http.StatusInternalServerError, generateEmptyResponse())
+		var aliasInUseErr *storage.AliasInUseError
+		var invalidParentAliasErr *storage.InvalidParentAliasError
+		switch {
+		case errors.As(err, &aliasInUseErr):
+			log.WithFields(logFields).Debug(
+				"bad provisioning request: alias is already in use",
+			)
+			s.writeResponse(
+				w,
+				http.StatusConflict,
+				generateAliasInUseResponse(aliasInUseErr.Alias),
+			)
+		case errors.As(err, &invalidParentAliasErr):
+			log.WithFields(logFields).Debug(
+				"bad provisioning request: instance cannot be its own parent",
+			)
+			s.writeResponse(
+				w,
+				http.StatusBadRequest,
+				generateParentSelfReferenceResponse(),
+			)
+		default:
+			log.WithFields(logFields).Error(
+				"provisioning error: error persisting new instance",
+			)
+			s.writeResponse(w, http.StatusInternalServerError, generateEmptyResponse())
+		}
 		return
 	}
 
@@ -299,6 +354,8 @@ func (s *server) provision(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.events().SendInstanceStatusEvent(r.Context(), instance)
+
 	// If we get all the way to here, we've been successful!
 	s.writeResponse(w, http.StatusAccepted, generateProvisionAcceptedResponse())
 
@@ -9,6 +9,7 @@ import (
 
 	"github.com/barpilot/gosba/service"
 	"github.com/barpilot/gosba/services/fake"
+	"github.com/barpilot/gosba/storage"
 	fakeAsync "github.com/deis/async/fake"
 	"github.com/stretchr/testify/assert"
 )
@@ -315,6 +316,69 @@ func TestKickOffNewAsyncProvisioning(t *testing.T) {
 	assert.Equal(t, responseProvisioningAccepted, rr.Body.Bytes())
 }
 
+// rejectingStore is a storage.Store that refuses every instance write with a
+// fixed error
+type rejectingStore struct {
+	storage.Store
+	err error
+}
+
+func (r rejectingStore) WriteInstance(service.Instance) error {
+	return r.err
+}
+
+func TestProvisioningWithAliasInUse(t *testing.T) {
+	s, _, err := getTestServer()
+	assert.Nil(t, err)
+	const alias = "some-alias"
+	s.store = rejectingStore{
+		Store: s.store,
+		err:   storage.NewAliasInUseError(alias, getDisposableInstanceID()),
+	}
+	req, err := getProvisionRequest(
+		getDisposableInstanceID(),
+		map[string]string{
+			"accepts_incomplete": "true",
+		},
+		&ProvisioningRequest{
+			ServiceID: fake.ServiceID,
+			PlanID:    fake.StandardPlanID,
+		},
+	)
+	assert.Nil(t, err)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, generateAliasInUseResponse(alias), rr.Body.Bytes())
+	assert.Empty(t, s.asyncEngine.(*fakeAsync.Engine).SubmittedTasks)
+}
+
+func TestProvisioningWithSelfReferencingParent(t *testing.T) {
+	s, _, err := getTestServer()
+	assert.Nil(t, err)
+	instanceID := getDisposableInstanceID()
+	s.store = rejectingStore{
+		Store: s.store,
+		err:   storage.NewInvalidParentAliasError(instanceID, "some-alias"),
+	}
+	req, err := getProvisionRequest(
+		instanceID,
+		map[string]string{
+			"accepts_incomplete": "true",
+		},
+		&ProvisioningRequest{
+			ServiceID: fake.ServiceID,
+			PlanID:    fake.StandardPlanID,
+		},
+	)
+	assert.Nil(t, err)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, generateParentSelfReferenceResponse(), rr.Body.Bytes())
+	assert.Empty(t, s.asyncEngine.(*fakeAsync.Engine).SubmittedTasks)
+}
+
 func getProvisionRequest(
 	instanceID string,
 	queryParams map[string]string,
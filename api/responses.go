@@ -81,28 +81,39 @@ func generateDeprovisionAcceptedResponse() []byte {
 	return responseDeprovisioningAccepted
 }
 
-var responseInProgress = []byte(
-	fmt.Sprintf(`{ "state": "%s" }`, OperationStateInProgress),
-)
-
-func generateOperationInProgressResponse() []byte {
-	return responseInProgress
+func generateOperationAcceptedResponse(operation string) []byte {
+	switch operation {
+	case OperationUpdating:
+		return generateUpdateAcceptedResponse()
+	case OperationDeprovisioning:
+		return generateDeprovisionAcceptedResponse()
+	default:
+		return generateProvisionAcceptedResponse()
+	}
 }
 
-var responseSucceeded = []byte(
-	fmt.Sprintf(`{ "state": "%s" }`, OperationStateSucceeded),
-)
-
-func generateOperationSucceededResponse() []byte {
-	return responseSucceeded
+type operationStateResponse struct {
+	State       string `json:"state"`
+	Description string `json:"description,omitempty"`
 }
 
-var responseFailed = []byte(
-	fmt.Sprintf(`{ "state": "%s" }`, OperationStateFailed),
-)
-
-func generateOperationFailedResponse() []byte {
-	return responseFailed
+func generateOperationStateResponse(state, description string) []byte {
+	responseBody, err := json.Marshal(operationStateResponse{
+		State:       state,
+		Description: description,
+	})
+	if err != nil {
+		log.WithFields(
+			log.Fields{
+				"state":       state,
+				"description": description,
+			},
+		).Error("Error generating operation state response")
+		// There was a failure marshalling the body, so return the same state
+		// without a description in its place
+		return []byte(fmt.Sprintf(`{ "state": "%s" }`, state))
+	}
+	return responseBody
 }
 
 var responseEmptyJSON = []byte("{}")
@@ -148,6 +159,15 @@ func generateOperationInvalidResponse() []byte {
 	return responseOperationInvalid
 }
 
+var responseOperationNotResumable = []byte(
+	`{ "error": "OperationNotResumable", "description": "The service ` +
+		`instance has no failed operation that can be resumed" }`,
+)
+
+func generateOperationNotResumableResponse() []byte {
+	return responseOperationNotResumable
+}
+
 var validationFailedGenericResponse = []byte(
 	`{ "error" : "ValidationFailure", ` +
 		`"description" : "Failed to validate request" }`,
@@ -191,3 +211,35 @@ var responseParentInvalid = []byte(
 func generateParentInvalidResponse() []byte {
 	return responseParentInvalid
 }
+
+var responseParentSelfReference = []byte(
+	`{ "error": "InvalidParent", "description": "The parentAlias provided ` +
+		`is the alias of the service instance itself" }`,
+)
+
+func generateParentSelfReferenceResponse() []byte {
+	return responseParentSelfReference
+}
+
+var aliasInUseGenericResponse = []byte(
+	`{ "error": "AliasInUse", "description": "The alias provided is already ` +
+		`in use by another service instance" }`,
+)
+
+func generateAliasInUseResponse(alias string) []byte {
+	response := errorResponse{
+		Error: "AliasInUse",
+		Description: fmt.Sprintf(
+			`The alias "%s" is already in use by another service instance`,
+			alias,
+		),
+	}
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		log.WithField("alias", alias).Error(
+			"Error generating alias in use response",
+		)
+		return aliasInUseGenericResponse
+	}
+	return responseBody
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/barpilot/gosba/service"
+	"github.com/deis/async"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+var errOperationNotResumable = errors.New(
+	"instance is not in a state from which a failed operation can be resumed",
+)
+
+func (s *server) retry(w http.ResponseWriter, r *http.Request) {
+	instanceID := mux.Vars(r)["instance_id"]
+
+	logFields := log.Fields{
+		"instanceID": instanceID,
+	}
+
+	log.WithFields(logFields).Debug("received retry request")
+
+	instance, ok, err := s.store.GetInstance(instanceID)
+	if err != nil {
+		logFields["error"] = err
+		log.WithFields(logFields).Error(
+			"retry error: error retrieving instance by id",
+		)
+		s.writeResponse(w, http.StatusInternalServerError, generateEmptyResponse())
+		return
+	}
+	if !ok {
+		log.WithFields(logFields).Debug(
+			"bad retry request: the instance does not exist",
+		)
+		s.writeResponse(w, http.StatusNotFound, generateEmptyResponse())
+		return
+	}
+
+	recordAuditedPlan(r, instance.ServiceID, instance.PlanID)
+
+	logFields["status"] = instance.Status
+	logFields["failedStep"] = instance.FailedStep
+
+	operation, err := s.resumeFailedOperation(r.Context(), instance)
+	if err == errOperationNotResumable {
+		log.WithFields(logFields).Debug(
+			"bad retry request: instance has no failed operation to resume",
+		)
+		s.writeResponse(
+			w,
+			http.StatusConflict,
+			generateOperationNotResumableResponse(),
+		)
+		return
+	}
+	if err != nil {
+		logFields["error"] = err
+		log.WithFields(logFields).Error(
+			"retry error: error resuming failed operation",
+		)
+		s.writeResponse(w, http.StatusInternalServerError, generateEmptyResponse())
+		return
+	}
+
+	// If we get all the way to here, we've been successful!
+	s.writeResponse(
+		w,
+		http.StatusAccepted,
+		generateOperationAcceptedResponse(operation),
+	)
+
+	logFields["operation"] = operation
+	log.WithFields(logFields).Debug("failed operation resumed")
+}
+
+// resumeFailedOperation resubmits the failed provisioning, updating, or
+// deprovisioning operation of the given instance. Execution resumes at the
+// step that failed, using the instance details that were persisted at the
+// time of the failure. If the failure occurred outside of the operation's
+// chain of steps (e.g. while waiting on a parent or on children), the
+// operation is started over. The name of the resumed operation is returned.
+func (s *server) resumeFailedOperation(
+	ctx context.Context,
+	instance service.Instance,
+) (string, error) {
+	serviceManager := instance.Service.GetServiceManager()
+	var operation string
+	var task async.Task
+	switch instance.Status {
+	case service.InstanceStateProvisioningFailed:
+		operation = OperationProvisioning
+		provisioner, err := serviceManager.GetProvisioner(instance.Plan)
+		if err != nil {
+			return "", fmt.Errorf(
+				"error retrieving provisioner for service and plan: %s",
+				err,
+			)
+		}
+		if _, ok := provisioner.GetStep(instance.FailedStep); ok {
+			instance.Status = service.InstanceStateProvisioning
+			task = newStepTask(
+				"executeProvisioningStep",
+				instance.FailedStep,
+				instance.InstanceID,
+			)
+		} else if instance.ParentAlias != "" {
+			instance.Status = service.InstanceStateProvisioningDeferred
+			instance.WaitDeadline =
+				s.apiServerConfig.Operation.Wait.Parent.GetDeadline(time.Now())
+			task = async.NewTask(
+				"checkParentStatus",
+				map[string]string{
+					"instanceID": instance.InstanceID,
+				},
+			)
+		} else {
+			firstStepName, ok := provisioner.GetFirstStepName()
+			if !ok {
+				return "", errors.New(
+					"no steps found for provisioning service and plan",
+				)
+			}
+			instance.Status = service.InstanceStateProvisioning
+			task = newStepTask(
+				"executeProvisioningStep",
+				firstStepName,
+				instance.InstanceID,
+			)
+		}
+	case service.InstanceStateUpdatingFailed:
+		operation = OperationUpdating
+		updater, err := serviceManager.GetUpdater(instance.Plan)
+		if err != nil {
+			return "", fmt.Errorf(
+				"error retrieving updater for service and plan: %s",
+				err,
+			)
+		}
+		stepName := instance.FailedStep
+		if _, ok := updater.GetStep(stepName); !ok {
+			if stepName, ok = updater.GetFirstStepName(); !ok {
+				return "", errors.New("no steps found for updating service and plan")
+			}
+		}
+		instance.Status = service.InstanceStateUpdating
+		task = newStepTask("executeUpdatingStep", stepName, instance.InstanceID)
+	case service.InstanceStateDeprovisioningFailed:
+		operation = OperationDeprovisioning
+		deprovisioner, err := serviceManager.GetDeprovisioner(instance.Plan)
+		if err != nil {
+			return "", fmt.Errorf(
+				"error retrieving deprovisioner for service and plan: %s",
+				err,
+			)
+		}
+		if _, ok := deprovisioner.GetStep(instance.FailedStep); ok {
+			instance.Status = service.InstanceStateDeprovisioning
+			task = newStepTask(
+				"executeDeprovisioningStep",
+				instance.FailedStep,
+				instance.InstanceID,
+			)
+		} else {
+			// Checking on children will kick off the first deprovisioning step once
+			// there are no children left
+			instance.Status = service.InstanceStateDeprovisioningDeferred
+			instance.WaitDeadline =
+				s.apiServerConfig.Operation.Wait.Children.GetDeadline(time.Now())
+			task = async.NewTask(
+				"checkChildrenStatuses",
+				map[string]string{
+					"instanceID": instance.InstanceID,
+				},
+			)
+		}
+	default:
+		return "", errOperationNotResumable
+	}
+	instance.StatusReason = ""
+	instance.FailedStep = ""
+	instance.StatusDescription = ""
+	operationStarted := time.Now()
+	instance.OperationStarted = &operationStarted
+	instance.OperationDeadline = getOperationDeadline(
+		instance.Plan,
+		operationStarted,
+	)
+	if err := s.store.WriteInstance(instance); err != nil {
+		return "", fmt.Errorf("error persisting updated instance: %s", err)
+	}
+	if err := s.asyncEngine.SubmitTask(task); err != nil {
+		return "", fmt.Errorf("error submitting task: %s", err)
+	}
+	s.events().SendInstanceStatusEvent(ctx, instance)
+	return operation, nil
+}
+
+func newStepTask(jobName, stepName, instanceID string) async.Task {
+	return async.NewTask(
+		jobName,
+		map[string]string{
+			"stepName":   stepName,
+			"instanceID": instanceID,
+		},
+	)
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/services/fake"
+	fakeAsync "github.com/deis/async/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryWithInstanceNotFound(t *testing.T) {
+	s, _, err := getTestServer()
+	assert.Nil(t, err)
+	req, err := getRetryRequest(getDisposableInstanceID())
+	assert.Nil(t, err)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, responseEmptyJSON, rr.Body.Bytes())
+}
+
+func TestRetryWithInstanceNotFailed(t *testing.T) {
+	s, _, err := getTestServer()
+	assert.Nil(t, err)
+	instanceID := getDisposableInstanceID()
+	err = s.store.WriteInstance(service.Instance{
+		InstanceID: instanceID,
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Status:     service.InstanceStateProvisioned,
+	})
+	assert.Nil(t, err)
+	req, err := getRetryRequest(instanceID)
+	assert.Nil(t, err)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, responseOperationNotResumable, rr.Body.Bytes())
+}
+
+func TestRetryResumesProvisioningFromFailedStep(t *testing.T) {
+	s, _, err := getTestServer()
+	assert.Nil(t, err)
+	instanceID := getDisposableInstanceID()
+	err = s.store.WriteInstance(service.Instance{
+		InstanceID:   instanceID,
+		ServiceID:    fake.ServiceID,
+		PlanID:       fake.StandardPlanID,
+		Status:       service.InstanceStateProvisioningFailed,
+		StatusReason: "something went wrong",
+		FailedStep:   "run",
+	})
+	assert.Nil(t, err)
+	req, err := getRetryRequest(instanceID)
+	assert.Nil(t, err)
+	e := s.asyncEngine.(*fakeAsync.Engine)
+	assert.Empty(t, e.SubmittedTasks)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	assert.Equal(t, responseProvisioningAccepted, rr.Body.Bytes())
+	assert.Equal(t, 1, len(e.SubmittedTasks))
+	for _, task := range e.SubmittedTasks {
+		assert.Equal(t, "executeProvisioningStep", task.GetJobName())
+		assert.Equal(t, "run", task.GetArgs()["stepName"])
+	}
+	instance, ok, err := s.store.GetInstance(instanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, service.InstanceStateProvisioning, instance.Status)
+	assert.Empty(t, instance.StatusReason)
+	assert.Empty(t, instance.FailedStep)
+}
+
+func TestRetryResumesDeprovisioningFromFailedStep(t *testing.T) {
+	s, _, err := getTestServer()
+	assert.Nil(t, err)
+	instanceID := getDisposableInstanceID()
+	err = s.store.WriteInstance(service.Instance{
+		InstanceID: instanceID,
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Status:     service.InstanceStateDeprovisioningFailed,
+		FailedStep: "run",
+	})
+	assert.Nil(t, err)
+	req, err := getRetryRequest(instanceID)
+	assert.Nil(t, err)
+	e := s.asyncEngine.(*fakeAsync.Engine)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	assert.Equal(t, responseDeprovisioningAccepted, rr.Body.Bytes())
+	assert.Equal(t, 1, len(e.SubmittedTasks))
+	for _, task := range e.SubmittedTasks {
+		assert.Equal(t, "executeDeprovisioningStep", task.GetJobName())
+		assert.Equal(t, "run", task.GetArgs()["stepName"])
+	}
+}
+
+func TestProvisioningWithExistingInstanceWithSameAttributesAndFailed(
+	t *testing.T,
+) {
+	s, _, err := getTestServer()
+	assert.Nil(t, err)
+	instanceID := getDisposableInstanceID()
+	err = s.store.WriteInstance(service.Instance{
+		InstanceID: instanceID,
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Status:     service.InstanceStateProvisioningFailed,
+		FailedStep: "run",
+	})
+	assert.Nil(t, err)
+	req, err := getProvisionRequest(
+		instanceID,
+		map[string]string{
+			"accepts_incomplete": "true",
+		},
+		&ProvisioningRequest{
+			ServiceID: fake.ServiceID,
+			PlanID:    fake.StandardPlanID,
+		},
+	)
+	assert.Nil(t, err)
+	e := s.asyncEngine.(*fakeAsync.Engine)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	assert.Equal(t, responseProvisioningAccepted, rr.Body.Bytes())
+	assert.Equal(t, 1, len(e.SubmittedTasks))
+}
+
+func getRetryRequest(instanceID string) (*http.Request, error) {
+	return http.NewRequest(
+		http.MethodPost,
+		fmt.Sprintf("/admin/service_instances/%s/retry", instanceID),
+		nil,
+	)
+}
@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/barpilot/gosba/api/filters"
+	"github.com/barpilot/gosba/audit"
 	"github.com/barpilot/gosba/file"
 	"github.com/barpilot/gosba/http/filter"
 	"github.com/barpilot/gosba/service"
@@ -35,6 +37,15 @@ type Server interface {
 	Run(context.Context) error
 }
 
+// OperationConfigProvider is an optional interface for Servers that expose
+// the OperationConfig they carry out operations with. Brokers apply the same
+// configuration to their asynchronous jobs.
+type OperationConfigProvider interface {
+	// GetOperationConfig returns the OperationConfig the server was created
+	// with
+	GetOperationConfig() OperationConfig
+}
+
 type server struct {
 	apiServerConfig Config
 	store           storage.Store
@@ -43,6 +54,11 @@ type server struct {
 	router          *mux.Router
 	catalog         service.Catalog
 	catalogResponse []byte
+	// tenantServers are only used by servers that serve multiple tenants
+	tenantServers []*server
+	// tenantName is only set for servers that serve a single tenant on behalf
+	// of a multi-tenant server
+	tenantName string
 	// This allows tests to inject an alternative implementation of this function
 	listenAndServe func(context.Context) error
 }
@@ -55,14 +71,46 @@ func NewServer(
 	filterChain filter.Filter,
 	catalog service.Catalog,
 ) (Server, error) {
+	return newServer(
+		apiServerConfig,
+		store,
+		asyncEngine,
+		filterChain,
+		catalog,
+		"",
+	)
+}
+
+// newServer returns an HTTP router that serves the named tenant. The tenant
+// name is empty unless the server serves a single tenant on behalf of a
+// multi-tenant server.
+func newServer(
+	apiServerConfig Config,
+	store storage.Store,
+	asyncEngine async.Engine,
+	filterChain filter.Filter,
+	catalog service.Catalog,
+	tenantName string,
+) (*server, error) {
+	if apiServerConfig.AuditSink != nil {
+		// Auditing comes first so that requests rejected by other filters (e.g.
+		// for failing authentication) are recorded as well
+		filterChain = filter.NewChain(
+			filters.NewAuditFilter(apiServerConfig.AuditSink, tenantName),
+			filterChain,
+		)
+	}
 	s := &server{
 		apiServerConfig: apiServerConfig,
 		store:           store,
 		asyncEngine:     asyncEngine,
 		filterChain:     filterChain,
 		catalog:         catalog,
+		tenantName:      tenantName,
 	}
 
+	// Routes of requests that are audited are named after the operations they
+	// represent, which is how the audit filter recognizes them
 	router := mux.NewRouter()
 	router.StrictSlash(true)
 	router.HandleFunc(
@@ -72,11 +120,11 @@ func NewServer(
 	router.HandleFunc(
 		"/v2/service_instances/{instance_id}",
 		filterChain.GetHandler(s.provision),
-	).Methods(http.MethodPut)
+	).Methods(http.MethodPut).Name(string(audit.OperationProvision))
 	router.HandleFunc(
 		"/v2/service_instances/{instance_id}",
 		filterChain.GetHandler(s.update),
-	).Methods(http.MethodPatch)
+	).Methods(http.MethodPatch).Name(string(audit.OperationUpdate))
 	router.HandleFunc(
 		"/v2/service_instances/{instance_id}/last_operation",
 		filterChain.GetHandler(s.poll),
@@ -84,15 +132,19 @@ func NewServer(
 	router.HandleFunc(
 		"/v2/service_instances/{instance_id}/service_bindings/{binding_id}",
 		filterChain.GetHandler(s.bind),
-	).Methods(http.MethodPut)
+	).Methods(http.MethodPut).Name(string(audit.OperationBind))
 	router.HandleFunc(
 		"/v2/service_instances/{instance_id}/service_bindings/{binding_id}",
 		filterChain.GetHandler(s.unbind),
-	).Methods(http.MethodDelete)
+	).Methods(http.MethodDelete).Name(string(audit.OperationUnbind))
 	router.HandleFunc(
 		"/v2/service_instances/{instance_id}",
 		filterChain.GetHandler(s.deprovision),
-	).Methods(http.MethodDelete)
+	).Methods(http.MethodDelete).Name(string(audit.OperationDeprovision))
+	router.HandleFunc(
+		"/admin/service_instances/{instance_id}/retry",
+		filterChain.GetHandler(s.retry),
+	).Methods(http.MethodPost).Name(string(audit.OperationRetry))
 	router.HandleFunc(
 		"/healthz",
 		s.healthCheck, // Filter chain not applied to this reqeust
@@ -129,6 +181,10 @@ func (s *server) Run(ctx context.Context) error {
 	}
 }
 
+func (s *server) GetOperationConfig() OperationConfig {
+	return s.apiServerConfig.Operation
+}
+
 func (s *server) defaultListenAndServe(ctx context.Context) error {
 	errChan := make(chan error)
 	svr := http.Server{
@@ -1,9 +1,11 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 
+	"github.com/barpilot/gosba/lifecycle"
 	"github.com/barpilot/gosba/service"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
@@ -85,6 +87,7 @@ func (s *server) unbind(w http.ResponseWriter, r *http.Request) {
 		err = serviceManager.Unbind(instance, binding)
 		if err != nil {
 			s.handleUnbindingError(
+				r.Context(),
 				binding,
 				err,
 				"error executing service-specific unbinding logic",
@@ -97,6 +100,7 @@ func (s *server) unbind(w http.ResponseWriter, r *http.Request) {
 
 	if _, err = s.store.DeleteBinding(bindingID); err != nil {
 		s.handleUnbindingError(
+			r.Context(),
 			binding,
 			err,
 			"error deleting binding",
@@ -105,6 +109,12 @@ func (s *server) unbind(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.events().SendBindingEvent(
+		r.Context(),
+		lifecycle.EventTypeBindingDeleted,
+		binding,
+	)
+
 	s.writeResponse(w, http.StatusOK, generateEmptyResponse())
 }
 
@@ -114,6 +124,7 @@ func (s *server) unbind(w http.ResponseWriter, r *http.Request) {
 // so we log that failure and kill the process. Barring such a failure, a nicely
 // formatted error message is logged.
 func (s *server) handleUnbindingError(
+	ctx context.Context,
 	binding service.Binding,
 	e error,
 	msg string,
@@ -138,6 +149,11 @@ func (s *server) handleUnbindingError(
 			"unbinding error: error persisting binding with updated status",
 		)
 	}
+	s.events().SendBindingEvent(
+		ctx,
+		lifecycle.EventTypeBindingUnbindingFailed,
+		binding,
+	)
 	if e != nil {
 		logFields["error"] = e
 	}
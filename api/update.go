@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"reflect"
 	"strconv"
+	"time"
 
 	"github.com/barpilot/gosba/service"
 	"github.com/deis/async"
@@ -76,6 +77,8 @@ func (s *server) update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordAuditedPlan(r, updatingRequest.ServiceID, updatingRequest.PlanID)
+
 	if updatingRequest.ServiceID == "" {
 		logFields["field"] = "service_id"
 		log.WithFields(logFields).Debug(
@@ -176,6 +179,8 @@ func (s *server) update(w http.ResponseWriter, r *http.Request) {
 			existingParams = instance.ProvisioningParameters.Data
 		}
 	case service.InstanceStateUpdating:
+		fallthrough
+	case service.InstanceStateUpdatingFailed:
 		if instance.UpdatingParameters != nil {
 			existingParams = instance.UpdatingParameters.Data
 		}
@@ -186,7 +191,8 @@ func (s *server) update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if !reflect.DeepEqual(existingParams, rawUpdatingParameters) {
-		if instance.Status == service.InstanceStateUpdating {
+		if instance.Status == service.InstanceStateUpdating ||
+			instance.Status == service.InstanceStateUpdatingFailed {
 			// We cannot handle two updates at once. This is a conflict.
 			s.writeResponse(w, http.StatusConflict, generateEmptyResponse())
 			return
@@ -197,6 +203,25 @@ func (s *server) update(w http.ResponseWriter, r *http.Request) {
 			s.writeResponse(w, http.StatusOK, generateEmptyResponse())
 			return
 		}
+		if instance.Status == service.InstanceStateUpdatingFailed {
+			// In this case, the requested update previously failed. Re-sending an
+			// identical request resumes updating from the step that failed.
+			if _, err = s.resumeFailedOperation(r.Context(), instance); err != nil {
+				logFields["error"] = err
+				log.WithFields(logFields).Error(
+					"updating error: error resuming failed update",
+				)
+				s.writeResponse(
+					w,
+					http.StatusInternalServerError,
+					generateEmptyResponse(),
+				)
+				return
+			}
+			s.writeResponse(w, http.StatusAccepted, generateUpdateAcceptedResponse())
+			log.WithFields(logFields).Debug("failed update resumed")
+			return
+		}
 		// In this case, the requested update is already in-progress
 		s.writeResponse(w, http.StatusAccepted, generateUpdateAcceptedResponse())
 		return
@@ -206,6 +231,24 @@ func (s *server) update(w http.ResponseWriter, r *http.Request) {
 	// (or fully updated) and the parameters of the update request indicate the
 	// need for a new update.
 
+	// A request that omits the plan ID leaves the plan unchanged
+	if plan == nil {
+		plan, ok = svc.GetPlan(instance.PlanID)
+		if !ok {
+			logFields["serviceID"] = updatingRequest.ServiceID
+			logFields["planID"] = instance.PlanID
+			log.WithFields(logFields).Error(
+				"pre-updating error: no Plan found for planID in Service",
+			)
+			s.writeResponse(
+				w,
+				http.StatusInternalServerError,
+				generateInvalidPlanIDResponse(),
+			)
+			return
+		}
+	}
+
 	// Carry out schema-driven update request parameters validation.
 	if err :=
 		instance.Plan.GetSchemas().ServiceInstances.UpdatingParametersSchema.Validate( // nolint: lll
@@ -242,6 +285,15 @@ func (s *server) update(w http.ResponseWriter, r *http.Request) {
 			Data:   rawUpdatingParameters,
 		},
 	}
+	var previousParameters map[string]interface{}
+	if instance.ProvisioningParameters != nil {
+		previousParameters = instance.ProvisioningParameters.Redacted()
+	}
+	recordAuditedParameterChanges(
+		r,
+		previousParameters,
+		updatingParameters.Redacted(),
+	)
 
 	// This uses module-specific logic to weigh update parameters against current
 	// instance state to detect any invalid state changes. An example of this
@@ -269,22 +321,6 @@ func (s *server) update(w http.ResponseWriter, r *http.Request) {
 
 	// If we get to here, we need to update the instance.
 
-	if plan == nil {
-		plan, ok = svc.GetPlan(instance.PlanID)
-		if !ok {
-			logFields["serviceID"] = updatingRequest.ServiceID
-			logFields["planID"] = instance.PlanID
-			log.WithFields(logFields).Error(
-				"pre-updating error: no Plan found for planID in Service",
-			)
-			s.writeResponse(
-				w,
-				http.StatusInternalServerError,
-				generateInvalidPlanIDResponse(),
-			)
-			return
-		}
-	}
 	updater, err := serviceManager.GetUpdater(plan)
 	if err != nil {
 		logFields["serviceID"] = updatingRequest.ServiceID
@@ -308,7 +344,20 @@ func (s *server) update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	instance.Status = service.InstanceStateUpdating
-	instance.PlanID = updatingRequest.PlanID
+	// Remember the previous plan so that the change of plan can be reported
+	// once the update completes
+	instance.PreviousPlanID = ""
+	if updatingRequest.PlanID != "" && updatingRequest.PlanID != instance.PlanID {
+		instance.PreviousPlanID = instance.PlanID
+		instance.PlanID = updatingRequest.PlanID
+	}
+	instance.LastCompletedStep = ""
+	instance.StepExecutions = nil
+	instance.FailedStep = ""
+	instance.StatusDescription = ""
+	operationStarted := time.Now()
+	instance.OperationStarted = &operationStarted
+	instance.OperationDeadline = getOperationDeadline(plan, operationStarted)
 	if err := s.store.WriteInstance(instance); err != nil {
 		logFields["error"] = err
 		log.WithFields(logFields).Error(
@@ -335,6 +384,8 @@ func (s *server) update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.events().SendInstanceStatusEvent(r.Context(), instance)
+
 	// If we get all the way to here, we've been successful!
 	s.writeResponse(w, http.StatusAccepted, generateUpdateAcceptedResponse())
 
@@ -271,6 +271,40 @@ func TestKickOffNewAsyncUpdating(t *testing.T) {
 	assert.Equal(t, responseUpdatingAccepted, rr.Body.Bytes())
 }
 
+func TestUpdatingWithoutPlanIDLeavesPlanUnchanged(t *testing.T) {
+	s, _, err := getTestServer()
+	assert.Nil(t, err)
+	instanceID := getDisposableInstanceID()
+	err = s.store.WriteInstance(service.Instance{
+		InstanceID: instanceID,
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Status:     service.InstanceStateProvisioned,
+	})
+	assert.Nil(t, err)
+	req, err := getUpdateRequest(
+		instanceID,
+		map[string]string{
+			"accepts_incomplete": "true",
+		},
+		&UpdatingRequest{
+			ServiceID: fake.ServiceID,
+			Parameters: map[string]interface{}{
+				"someParameter": "fake",
+			},
+		},
+	)
+	assert.Nil(t, err)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	instance, ok, err := s.store.GetInstance(instanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, fake.StandardPlanID, instance.PlanID)
+	assert.Empty(t, instance.PreviousPlanID)
+}
+
 func getUpdateRequest(
 	instanceID string,
 	queryParams map[string]string,
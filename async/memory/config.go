@@ -0,0 +1,24 @@
+package memory
+
+import "time"
+
+// Config represents configuration options for the in-process implementation
+// of the async.Engine interface
+type Config struct {
+	// WorkerCount is the number of tasks that may execute concurrently
+	WorkerCount int
+	// DrainTimeout is how long the engine waits for tasks that are already
+	// executing to complete after the engine's context has been canceled. Once
+	// it has elapsed, the contexts of those tasks are canceled as well.
+	DrainTimeout time.Duration
+}
+
+// NewConfigWithDefaults returns a Config object with default values already
+// applied. Callers are then free to set custom values for the remaining fields
+// and/or override default values.
+func NewConfigWithDefaults() Config {
+	return Config{
+		WorkerCount:  5,
+		DrainTimeout: 30 * time.Second,
+	}
+}
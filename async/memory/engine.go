@@ -0,0 +1,221 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/deis/async"
+	log "github.com/sirupsen/logrus"
+)
+
+type engine struct {
+	config            Config
+	jobsFns           map[string]async.JobFn
+	jobsFnsMutex      sync.RWMutex
+	pendingTasks      []async.Task
+	pendingTasksMutex sync.Mutex
+	// pendingTasksCh signals idle workers that a pending task is available
+	pendingTasksCh chan struct{}
+	// delayedTasks holds the timers that make delayed tasks pending once their
+	// execute time has arrived
+	delayedTasks      map[*time.Timer]struct{}
+	delayedTasksMutex sync.Mutex
+}
+
+// NewEngine returns a new in-process implementation of async.Engine. Tasks
+// are held in memory only, so tasks that have not been executed by the time
+// the process exits are lost. This makes the engine suitable for tests and
+// single-node deployments-- especially in conjunction with the memory-based
+// implementation of storage.Store.
+func NewEngine(config Config) async.Engine {
+	if config.WorkerCount < 1 {
+		config.WorkerCount = 1
+	}
+	if config.DrainTimeout <= 0 {
+		config.DrainTimeout = NewConfigWithDefaults().DrainTimeout
+	}
+	return &engine{
+		config:         config,
+		jobsFns:        map[string]async.JobFn{},
+		pendingTasksCh: make(chan struct{}, 1),
+		delayedTasks:   map[*time.Timer]struct{}{},
+	}
+}
+
+// RegisterJob registers a new async.JobFn with the async engine
+func (e *engine) RegisterJob(name string, fn async.JobFn) error {
+	e.jobsFnsMutex.Lock()
+	defer e.jobsFnsMutex.Unlock()
+	if _, ok := e.jobsFns[name]; ok {
+		return fmt.Errorf(`duplicate job name "%s"`, name)
+	}
+	e.jobsFns[name] = fn
+	return nil
+}
+
+// SubmitTask submits a task to the async engine for asynchronous completion.
+// Tasks with an execute time in the future become pending once that time has
+// arrived.
+func (e *engine) SubmitTask(task async.Task) error {
+	if executeTime := task.GetExecuteTime(); executeTime != nil {
+		if delay := time.Until(*executeTime); delay > 0 {
+			e.addDelayedTask(task, delay)
+			return nil
+		}
+	}
+	e.addPendingTask(task)
+	return nil
+}
+
+// Run causes the async engine to carry out all of its functions. It blocks
+// until the context passed to it has been canceled and all tasks that were
+// executing at that time have completed or the drain timeout has elapsed.
+// Delayed tasks whose execute time has not arrived by then are discarded.
+// Run always returns a non-nil error.
+func (e *engine) Run(ctx context.Context) error {
+	defer e.stopDelayedTasks()
+	// Tasks are executed using a context of their own so they can complete
+	// after the engine's context has been canceled
+	execCtx, cancelExec := context.WithCancel(context.Background())
+	defer cancelExec()
+	wg := sync.WaitGroup{}
+	for i := 0; i < e.config.WorkerCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.executeTasks(ctx, execCtx)
+		}()
+	}
+	<-ctx.Done()
+	drainedCh := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drainedCh)
+	}()
+	select {
+	case <-drainedCh:
+	case <-time.After(e.config.DrainTimeout):
+		log.WithField("drainTimeout", e.config.DrainTimeout).Warn(
+			"async engine drain timeout elapsed; canceling executing tasks",
+		)
+		cancelExec()
+		<-drainedCh
+	}
+	log.Debug("context canceled; async engine shutting down")
+	return ctx.Err()
+}
+
+// executeTasks executes pending tasks, one at a time, until the given context
+// is canceled
+func (e *engine) executeTasks(ctx context.Context, execCtx context.Context) {
+	for {
+		task, ok := e.getPendingTask(ctx)
+		if !ok {
+			return
+		}
+		e.executeTask(execCtx, task)
+	}
+}
+
+func (e *engine) executeTask(ctx context.Context, task async.Task) {
+	logFields := log.Fields{
+		"job":    task.GetJobName(),
+		"taskID": task.GetID(),
+	}
+	e.jobsFnsMutex.RLock()
+	jobFn, ok := e.jobsFns[task.GetJobName()]
+	e.jobsFnsMutex.RUnlock()
+	if !ok {
+		// Unlike a distributed engine, there's no other worker that might know
+		// how to process this task, so there's nothing to do except log this.
+		log.WithFields(logFields).Error("no job registered for task; discarding")
+		return
+	}
+	followUpTasks, err := jobFn(ctx, task)
+	if err != nil {
+		logFields["error"] = err
+		log.WithFields(logFields).Error(
+			"error executing job; not submitting any follow-up tasks",
+		)
+		return
+	}
+	for _, followUpTask := range followUpTasks {
+		if err := e.SubmitTask(followUpTask); err != nil {
+			logFields["followUpJob"] = followUpTask.GetJobName()
+			logFields["followUpTaskID"] = followUpTask.GetID()
+			logFields["error"] = err
+			log.WithFields(logFields).Error("error submitting follow-up task")
+		}
+	}
+}
+
+// addDelayedTask makes the given task pending once the given delay has
+// elapsed
+func (e *engine) addDelayedTask(task async.Task, delay time.Duration) {
+	e.delayedTasksMutex.Lock()
+	defer e.delayedTasksMutex.Unlock()
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		e.delayedTasksMutex.Lock()
+		delete(e.delayedTasks, timer)
+		e.delayedTasksMutex.Unlock()
+		e.addPendingTask(task)
+	})
+	e.delayedTasks[timer] = struct{}{}
+}
+
+// stopDelayedTasks discards all delayed tasks whose delay has not elapsed yet
+func (e *engine) stopDelayedTasks() {
+	e.delayedTasksMutex.Lock()
+	defer e.delayedTasksMutex.Unlock()
+	for timer := range e.delayedTasks {
+		timer.Stop()
+	}
+	e.delayedTasks = map[*time.Timer]struct{}{}
+}
+
+func (e *engine) addPendingTask(task async.Task) {
+	e.pendingTasksMutex.Lock()
+	e.pendingTasks = append(e.pendingTasks, task)
+	e.pendingTasksMutex.Unlock()
+	e.signalPendingTasks()
+}
+
+// getPendingTask blocks until a pending task is available or the given
+// context is canceled
+func (e *engine) getPendingTask(ctx context.Context) (async.Task, bool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, false
+		default:
+		}
+		e.pendingTasksMutex.Lock()
+		if len(e.pendingTasks) > 0 {
+			task := e.pendingTasks[0]
+			e.pendingTasks = e.pendingTasks[1:]
+			remaining := len(e.pendingTasks)
+			e.pendingTasksMutex.Unlock()
+			// Make sure another idle worker picks up any remaining tasks
+			if remaining > 0 {
+				e.signalPendingTasks()
+			}
+			return task, true
+		}
+		e.pendingTasksMutex.Unlock()
+		select {
+		case <-e.pendingTasksCh:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+func (e *engine) signalPendingTasks() {
+	select {
+	case e.pendingTasksCh <- struct{}{}:
+	default:
+	}
+}
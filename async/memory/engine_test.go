@@ -0,0 +1,162 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/deis/async"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterDuplicateJob(t *testing.T) {
+	e := NewEngine(NewConfigWithDefaults())
+	err := e.RegisterJob("foo", getTestJob(nil))
+	assert.Nil(t, err)
+	err = e.RegisterJob("foo", getTestJob(nil))
+	assert.NotNil(t, err)
+}
+
+func TestNewEngineAppliesDefaults(t *testing.T) {
+	e := NewEngine(Config{}).(*engine)
+	assert.Equal(t, 1, e.config.WorkerCount)
+	assert.Equal(t, NewConfigWithDefaults().DrainTimeout, e.config.DrainTimeout)
+}
+
+func TestEngineExecutesTasksAndFollowUpTasks(t *testing.T) {
+	e := NewEngine(NewConfigWithDefaults())
+	executedCh := make(chan string, 2)
+	err := e.RegisterJob(
+		"foo",
+		func(_ context.Context, task async.Task) ([]async.Task, error) {
+			executedCh <- task.GetJobName()
+			return []async.Task{async.NewTask("bar", nil)}, nil
+		},
+	)
+	assert.Nil(t, err)
+	err = e.RegisterJob("bar", getTestJob(executedCh))
+	assert.Nil(t, err)
+	// Tasks submitted before the engine runs should not be lost
+	err = e.SubmitTask(async.NewTask("foo", nil))
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx) // nolint: errcheck
+	assert.Equal(t, "foo", receive(t, executedCh))
+	assert.Equal(t, "bar", receive(t, executedCh))
+}
+
+func TestEngineExecutesDelayedTasks(t *testing.T) {
+	e := NewEngine(NewConfigWithDefaults())
+	executedCh := make(chan string, 1)
+	err := e.RegisterJob("foo", getTestJob(executedCh))
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx) // nolint: errcheck
+	submitted := time.Now()
+	err = e.SubmitTask(
+		async.NewDelayedTask("foo", nil, 500*time.Millisecond),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, "foo", receive(t, executedCh))
+	assert.True(t, time.Since(submitted) >= 500*time.Millisecond)
+}
+
+func TestEngineDrainsExecutingTasks(t *testing.T) {
+	e := NewEngine(NewConfigWithDefaults())
+	startedCh := make(chan string, 1)
+	jobCanceled := false
+	err := e.RegisterJob(
+		"foo",
+		func(ctx context.Context, task async.Task) ([]async.Task, error) {
+			startedCh <- task.GetJobName()
+			select {
+			case <-time.After(500 * time.Millisecond):
+			case <-ctx.Done():
+				jobCanceled = true
+			}
+			return nil, nil
+		},
+	)
+	assert.Nil(t, err)
+	err = e.SubmitTask(async.NewTask("foo", nil))
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error)
+	go func() {
+		errCh <- e.Run(ctx)
+	}()
+	assert.Equal(t, "foo", receive(t, startedCh))
+	cancel()
+	select {
+	case err = <-errCh:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "engine did not stop")
+	}
+	assert.False(t, jobCanceled)
+}
+
+func TestEngineCancelsExecutingTasksAfterDrainTimeout(t *testing.T) {
+	config := NewConfigWithDefaults()
+	config.DrainTimeout = 100 * time.Millisecond
+	e := NewEngine(config)
+	startedCh := make(chan string, 1)
+	err := e.RegisterJob(
+		"foo",
+		func(ctx context.Context, task async.Task) ([]async.Task, error) {
+			startedCh <- task.GetJobName()
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	)
+	assert.Nil(t, err)
+	err = e.SubmitTask(async.NewTask("foo", nil))
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error)
+	go func() {
+		errCh <- e.Run(ctx)
+	}()
+	assert.Equal(t, "foo", receive(t, startedCh))
+	cancel()
+	select {
+	case err = <-errCh:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "engine did not stop")
+	}
+}
+
+func TestEngineDiscardsDelayedTasksWhenStopped(t *testing.T) {
+	e := NewEngine(NewConfigWithDefaults()).(*engine)
+	err := e.SubmitTask(async.NewDelayedTask("foo", nil, 100*time.Millisecond))
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, e.Run(ctx))
+	time.Sleep(200 * time.Millisecond)
+	e.pendingTasksMutex.Lock()
+	defer e.pendingTasksMutex.Unlock()
+	assert.Empty(t, e.pendingTasks)
+}
+
+func getTestJob(executedCh chan string) async.JobFn {
+	return func(_ context.Context, task async.Task) ([]async.Task, error) {
+		if executedCh != nil {
+			executedCh <- task.GetJobName()
+		}
+		return nil, nil
+	}
+}
+
+func receive(t *testing.T, ch chan string) string {
+	select {
+	case str := <-ch:
+		return str
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "timed out waiting for task to execute")
+		return ""
+	}
+}
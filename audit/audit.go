@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OriginatingIdentityHeader is the name of the header platforms use to convey
+// the identity of the user on whose behalf a request was made
+const OriginatingIdentityHeader = "X-Broker-API-Originating-Identity"
+
+// Operation represents the kind of OSB (or admin) call an Entry records
+type Operation string
+
+const (
+	// OperationProvision represents a request to provision an instance
+	OperationProvision Operation = "provision"
+	// OperationUpdate represents a request to update an instance
+	OperationUpdate Operation = "update"
+	// OperationDeprovision represents a request to deprovision an instance
+	OperationDeprovision Operation = "deprovision"
+	// OperationBind represents a request to create a binding
+	OperationBind Operation = "bind"
+	// OperationUnbind represents a request to delete a binding
+	OperationUnbind Operation = "unbind"
+	// OperationRetry represents a request to retry a failed operation
+	OperationRetry Operation = "retry"
+)
+
+// OriginatingIdentity is the identity of the platform user on whose behalf a
+// request was made, as conveyed by the OriginatingIdentityHeader
+type OriginatingIdentity struct {
+	Platform string                 `json:"platform"`
+	Value    map[string]interface{} `json:"value,omitempty"`
+}
+
+// ParameterChange describes a single top-level parameter that a request
+// added, changed, or removed. Old is omitted for added parameters and New is
+// omitted for removed parameters. Values of secure parameters are redacted.
+type ParameterChange struct {
+	Name string      `json:"name"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// Entry records a single mutating request and its outcome
+type Entry struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Tenant is the name of the tenant the request was made to. It is only set
+	// by brokers that serve multiple tenants.
+	Tenant    string    `json:"tenant,omitempty"`
+	Operation Operation `json:"operation"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	// PlatformIdentity is the username the platform authenticated with, if the
+	// request used basic auth. The password is never recorded.
+	PlatformIdentity    string               `json:"platformIdentity,omitempty"`    // nolint: lll
+	OriginatingIdentity *OriginatingIdentity `json:"originatingIdentity,omitempty"` // nolint: lll
+	InstanceID          string               `json:"instanceId,omitempty"`
+	BindingID           string               `json:"bindingId,omitempty"`
+	ServiceID           string               `json:"serviceId,omitempty"`
+	PlanID              string               `json:"planId,omitempty"`
+	StatusCode          int                  `json:"statusCode"`
+	ParameterChanges    []ParameterChange    `json:"parameterChanges,omitempty"` // nolint: lll
+}
+
+// ParseOriginatingIdentity parses the value of an OriginatingIdentityHeader,
+// which is formatted as the platform name, a space, and base64-encoded JSON
+func ParseOriginatingIdentity(header string) (*OriginatingIdentity, error) {
+	tokens := strings.SplitN(strings.TrimSpace(header), " ", 2)
+	if len(tokens) != 2 || tokens[0] == "" {
+		return nil, errors.New(
+			"originating identity must be a platform followed by a value",
+		)
+	}
+	valueJSON, err := base64.StdEncoding.DecodeString(tokens[1])
+	if err != nil {
+		return nil, fmt.Errorf(
+			"error decoding originating identity value: %s",
+			err,
+		)
+	}
+	identity := &OriginatingIdentity{
+		Platform: tokens[0],
+	}
+	if err := json.Unmarshal(valueJSON, &identity.Value); err != nil {
+		return nil, fmt.Errorf(
+			"error unmarshaling originating identity value: %s",
+			err,
+		)
+	}
+	return identity, nil
+}
+
+// DiffParameters compares two sets of (already redacted) parameters and
+// returns the changes, ordered by parameter name. Either set may be nil.
+func DiffParameters(
+	oldParams map[string]interface{},
+	newParams map[string]interface{},
+) []ParameterChange {
+	names := []string{}
+	for name := range oldParams {
+		names = append(names, name)
+	}
+	for name := range newParams {
+		if _, ok := oldParams[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var changes []ParameterChange
+	for _, name := range names {
+		oldValue, inOld := oldParams[name]
+		newValue, inNew := newParams[name]
+		if inOld && inNew && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		changes = append(changes, ParameterChange{
+			Name: name,
+			Old:  oldValue,
+			New:  newValue,
+		})
+	}
+	return changes
+}
+
+type entryContextKey struct{}
+
+// WithEntry returns a copy of the given context carrying the given entry, so
+// that request handlers can add details that are only known to them
+func WithEntry(ctx context.Context, entry *Entry) context.Context {
+	return context.WithValue(ctx, entryContextKey{}, entry)
+}
+
+// GetEntry returns the entry carried by the given context, if any
+func GetEntry(ctx context.Context) (*Entry, bool) {
+	entry, ok := ctx.Value(entryContextKey{}).(*Entry)
+	return entry, ok
+}
@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOriginatingIdentity(t *testing.T) {
+	identity, err := ParseOriginatingIdentity(
+		"kubernetes " +
+			base64.StdEncoding.EncodeToString([]byte(`{"username":"foo"}`)),
+	)
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		&OriginatingIdentity{
+			Platform: "kubernetes",
+			Value: map[string]interface{}{
+				"username": "foo",
+			},
+		},
+		identity,
+	)
+}
+
+func TestParseInvalidOriginatingIdentity(t *testing.T) {
+	for _, header := range []string{
+		"kubernetes",
+		"kubernetes !!!",
+		"kubernetes " + base64.StdEncoding.EncodeToString([]byte("foo")),
+	} {
+		_, err := ParseOriginatingIdentity(header)
+		assert.NotNil(t, err, header)
+	}
+}
+
+func TestDiffParameters(t *testing.T) {
+	changes := DiffParameters(
+		map[string]interface{}{
+			"location":  "eastus",
+			"password":  "REDACTED",
+			"sku":       "basic",
+			"retention": float64(7),
+		},
+		map[string]interface{}{
+			"location": "eastus",
+			"password": "REDACTED",
+			"sku":      "premium",
+			"tags": map[string]interface{}{
+				"foo": "bar",
+			},
+		},
+	)
+	assert.Equal(
+		t,
+		[]ParameterChange{
+			{
+				Name: "retention",
+				Old:  float64(7),
+			},
+			{
+				Name: "sku",
+				Old:  "basic",
+				New:  "premium",
+			},
+			{
+				Name: "tags",
+				New: map[string]interface{}{
+					"foo": "bar",
+				},
+			},
+		},
+		changes,
+	)
+	assert.Nil(t, DiffParameters(nil, nil))
+}
+
+func TestEntryContext(t *testing.T) {
+	_, ok := GetEntry(context.Background())
+	assert.False(t, ok)
+	entry := &Entry{}
+	retrievedEntry, ok := GetEntry(WithEntry(context.Background(), entry))
+	assert.True(t, ok)
+	assert.True(t, entry == retrievedEntry)
+}
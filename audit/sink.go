@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Sink is an interface to be implemented by types that persist audit entries
+type Sink interface {
+	// Record persists the given entry. Sinks are invoked synchronously, after
+	// the response to the audited request has been written.
+	Record(context.Context, Entry) error
+}
+
+// SinkFunc adapts an ordinary function to the Sink interface
+type SinkFunc func(context.Context, Entry) error
+
+// Record invokes the SinkFunc
+func (s SinkFunc) Record(ctx context.Context, entry Entry) error {
+	return s(ctx, entry)
+}
+
+type jsonLinesSink struct {
+	writer io.Writer
+	mutex  sync.Mutex
+}
+
+// NewJSONLinesSink returns a Sink that writes each entry to the given writer
+// as a single line of JSON. Writes are serialized, so the writer need not be
+// safe for concurrent use.
+func NewJSONLinesSink(writer io.Writer) Sink {
+	return &jsonLinesSink{
+		writer: writer,
+	}
+}
+
+func (j *jsonLinesSink) Record(_ context.Context, entry Entry) error {
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error marshaling audit entry: %s", err)
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if _, err := j.writer.Write(append(entryJSON, '\n')); err != nil {
+		return fmt.Errorf("error writing audit entry: %s", err)
+	}
+	return nil
+}
+
+// FileSink is a Sink that writes to a file, which must be closed when the
+// sink is no longer needed
+type FileSink interface {
+	Sink
+	io.Closer
+}
+
+type fileSink struct {
+	Sink
+	file *os.File
+}
+
+// NewFileSink returns a FileSink that appends each entry to the file at the
+// given path as a single line of JSON. The file is created if it does not
+// exist.
+func NewFileSink(path string) (FileSink, error) {
+	file, err := os.OpenFile(
+		path,
+		os.O_APPEND|os.O_CREATE|os.O_WRONLY,
+		0600,
+	)
+	if err != nil {
+		return nil, fmt.Errorf(`error opening audit log "%s": %s`, path, err)
+	}
+	return &fileSink{
+		Sink: NewJSONLinesSink(file),
+		file: file,
+	}, nil
+}
+
+func (f *fileSink) Close() error {
+	return f.file.Close()
+}
+
+// Store is an interface to be implemented by storage.Store implementations
+// that are also capable of persisting audit entries
+type Store interface {
+	// WriteAuditEntry appends the given entry to the underlying storage
+	WriteAuditEntry(Entry) error
+	// GetAuditEntries retrieves all entries still retained by the underlying
+	// storage, in the order they were written
+	GetAuditEntries() ([]Entry, error)
+}
+
+type storeSink struct {
+	store Store
+}
+
+// NewStoreSink returns a Sink that persists entries using the given Store.
+// How many entries are retained depends on the store. The Redis store discards
+// the oldest entries beyond a configurable limit, while the other stores
+// retain all entries, so they should be pruned or exported periodically.
+func NewStoreSink(store Store) Sink {
+	return &storeSink{
+		store: store,
+	}
+}
+
+func (s *storeSink) Record(_ context.Context, entry Entry) error {
+	return s.store.WriteAuditEntry(entry)
+}
+
+// Record is a convenience function for persisting an entry using the given
+// sink, which may be nil. Failures are logged, but are otherwise ignored.
+func Record(ctx context.Context, sink Sink, entry Entry) {
+	if sink == nil {
+		return
+	}
+	if err := sink.Record(ctx, entry); err != nil {
+		log.WithFields(log.Fields{
+			"operation":  entry.Operation,
+			"instanceID": entry.InstanceID,
+			"bindingID":  entry.BindingID,
+			"error":      err,
+		}).Error("error recording audit entry")
+	}
+}
@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStore struct {
+	entries []Entry
+}
+
+func (f *fakeStore) WriteAuditEntry(entry Entry) error {
+	f.entries = append(f.entries, entry)
+	return nil
+}
+
+func (f *fakeStore) GetAuditEntries() ([]Entry, error) {
+	return f.entries, nil
+}
+
+func getTestEntries() []Entry {
+	return []Entry{
+		{
+			Timestamp:  time.Now().UTC(),
+			Operation:  OperationProvision,
+			InstanceID: "foo",
+			StatusCode: 202,
+		},
+		{
+			Timestamp:  time.Now().UTC(),
+			Operation:  OperationBind,
+			InstanceID: "foo",
+			BindingID:  "bar",
+			StatusCode: 201,
+		},
+	}
+}
+
+func TestJSONLinesSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sink := NewJSONLinesSink(buf)
+	entries := getTestEntries()
+	for _, entry := range entries {
+		err := sink.Record(context.Background(), entry)
+		assert.Nil(t, err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, len(entries), len(lines))
+	for i, line := range lines {
+		entry := Entry{}
+		err := json.Unmarshal([]byte(line), &entry)
+		assert.Nil(t, err)
+		assert.Equal(t, entries[i], entry)
+	}
+}
+
+func TestFileSinkAppends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosba")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	entries := getTestEntries()
+	// Each entry is recorded by a separate sink to show that reopening the
+	// file does not clobber existing entries
+	for _, entry := range entries {
+		sink, err := NewFileSink(path)
+		assert.Nil(t, err)
+		err = sink.Record(context.Background(), entry)
+		assert.Nil(t, err)
+		assert.Nil(t, sink.Close())
+	}
+	contents, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	assert.Equal(t, len(entries), len(lines))
+}
+
+func TestStoreSink(t *testing.T) {
+	store := &fakeStore{}
+	sink := NewStoreSink(store)
+	entries := getTestEntries()
+	for _, entry := range entries {
+		err := sink.Record(context.Background(), entry)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, entries, store.entries)
+}
@@ -8,7 +8,9 @@ import (
 	"github.com/barpilot/gosba/api"
 	"github.com/barpilot/gosba/service"
 	"github.com/barpilot/gosba/storage"
+	"github.com/barpilot/gosba/tenant"
 	"github.com/deis/async"
+	uuid "github.com/satori/go.uuid"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -37,70 +39,271 @@ type Broker interface {
 }
 
 type broker struct {
-	store       storage.Store
-	apiServer   api.Server
-	asyncEngine async.Engine
-	catalog     service.Catalog
+	config Config
+	// operationConfig is obtained from the API server so that async jobs carry
+	// out operations exactly as the API server does
+	operationConfig api.OperationConfig
+	store           storage.Store
+	apiServer       api.Server
+	asyncEngine     async.Engine
+	catalog         service.Catalog
+	// tenants is only used by brokers that serve multiple tenants. It maps each
+	// tenant's name to a broker that executes jobs using that tenant's storage
+	// and catalog.
+	tenants map[string]*broker
+	// tenantName is only set for brokers that execute jobs on behalf of a
+	// single tenant of a multi-tenant broker
+	tenantName string
+	// replicaID identifies this replica of the broker when it competes with
+	// other replicas for leases
+	replicaID string
 }
 
-// NewBroker returns a new Broker
+// jobFn is the signature of broker methods that implement async jobs
+type jobFn func(*broker, context.Context, async.Task) ([]async.Task, error)
+
+// NewBroker returns a new Broker. An error is returned if the given catalog
+// is invalid. If the given store serves reads from a cache, the broker's
+// asynchronous jobs bypass the cache.
 func NewBroker(
+	config Config,
 	apiServer api.Server,
 	asyncEngine async.Engine,
 	store storage.Store,
 	catalog service.Catalog,
 ) (Broker, error) {
+	if err := catalog.Validate(); err != nil {
+		return nil, fmt.Errorf("error validating catalog: %s", err)
+	}
+	store = getUncachedStore(store)
+	if err := validateRetentionConfig(config, store); err != nil {
+		return nil, fmt.Errorf("error validating retention config: %s", err)
+	}
 	b := &broker{
-		apiServer:   apiServer,
-		store:       store,
-		asyncEngine: asyncEngine,
-		catalog:     catalog,
+		config:          config,
+		operationConfig: getOperationConfig(apiServer),
+		apiServer:       apiServer,
+		store:           store,
+		asyncEngine:     asyncEngine,
+		catalog:         catalog,
+		replicaID:       uuid.NewV4().String(),
+	}
+	if err := b.registerJobs(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// NewMultiTenantBroker returns a new Broker that executes asynchronous jobs
+// on behalf of each of the given tenants. The given api server is expected to
+// serve the OSB API on behalf of the same tenants (see
+// api.NewMultiTenantServer). Tasks are executed using the storage, codec, and
+// catalog of the tenant that submitted them.
+func NewMultiTenantBroker(
+	config Config,
+	apiServer api.Server,
+	asyncEngine async.Engine,
+	tenants ...tenant.Tenant,
+) (Broker, error) {
+	b := &broker{
+		config:          config,
+		operationConfig: getOperationConfig(apiServer),
+		apiServer:       apiServer,
+		asyncEngine:     asyncEngine,
+		tenants:         map[string]*broker{},
+		replicaID:       uuid.NewV4().String(),
+	}
+	for _, t := range tenants {
+		if t.Name == "" {
+			return nil, errors.New("tenant name must not be empty")
+		}
+		if _, ok := b.tenants[t.Name]; ok {
+			return nil, fmt.Errorf(`duplicate tenant name "%s" detected`, t.Name)
+		}
+		if err := t.Catalog.Validate(); err != nil {
+			return nil, fmt.Errorf(
+				`error validating catalog of tenant "%s": %s`,
+				t.Name,
+				err,
+			)
+		}
+		store, err := t.GetStore()
+		if err != nil {
+			return nil, fmt.Errorf(
+				`error getting store of tenant "%s": %s`,
+				t.Name,
+				err,
+			)
+		}
+		store = getUncachedStore(store)
+		if err := validateRetentionConfig(config, store); err != nil {
+			return nil, fmt.Errorf(
+				`error validating retention config of tenant "%s": %s`,
+				t.Name,
+				err,
+			)
+		}
+		b.tenants[t.Name] = &broker{
+			config:          config,
+			operationConfig: b.operationConfig,
+			apiServer:       apiServer,
+			store:           store,
+			asyncEngine:     asyncEngine,
+			catalog:         t.Catalog,
+			tenantName:      t.Name,
+			replicaID:       b.replicaID,
+		}
 	}
+	if err := b.registerJobs(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
 
+func (b *broker) registerJobs() error {
 	err := b.asyncEngine.RegisterJob(
 		"executeProvisioningStep",
-		b.executeProvisioningStep,
+		b.getTenantJob((*broker).executeProvisioningStep),
 	)
 	if err != nil {
-		return nil, errors.New(
+		return errors.New(
 			"error registering async job for executing provisioning steps",
 		)
 	}
-	err = b.asyncEngine.RegisterJob("executeUpdatingStep", b.executeUpdatingStep)
+	err = b.asyncEngine.RegisterJob(
+		"executeUpdatingStep",
+		b.getTenantJob((*broker).executeUpdatingStep),
+	)
 	if err != nil {
-		return nil, errors.New(
+		return errors.New(
 			"error registering async job for executing updating steps",
 		)
 	}
 	err = b.asyncEngine.RegisterJob(
 		"executeDeprovisioningStep",
-		b.executeDeprovisioningStep,
+		b.getTenantJob((*broker).executeDeprovisioningStep),
 	)
 	if err != nil {
-		return nil, errors.New(
+		return errors.New(
 			"error registering async job for executing deprovisioning steps",
 		)
 	}
 
-	err = b.asyncEngine.RegisterJob("checkParentStatus", b.doCheckParentStatus)
+	err = b.asyncEngine.RegisterJob(
+		"checkParentStatus",
+		b.getTenantJob((*broker).doCheckParentStatus),
+	)
 	if err != nil {
-		return nil, errors.New(
+		return errors.New(
 			"error registering async job for executing check of parent status",
 		)
 	}
 
 	err = b.asyncEngine.RegisterJob(
 		"checkChildrenStatuses",
-		b.doCheckChildrenStatuses,
+		b.getTenantJob((*broker).doCheckChildrenStatuses),
 	)
 	if err != nil {
-		return nil, errors.New(
+		return errors.New(
 			"error registering async job for executing check of children " +
 				"statuses",
 		)
 	}
 
-	return b, nil
+	err = b.asyncEngine.RegisterJob(
+		"reportUsage",
+		b.getTenantJob((*broker).reportUsage),
+	)
+	if err != nil {
+		return errors.New(
+			"error registering async job for reporting usage",
+		)
+	}
+
+	err = b.asyncEngine.RegisterJob(
+		"collectGarbage",
+		b.getTenantJob((*broker).collectGarbage),
+	)
+	if err != nil {
+		return errors.New(
+			"error registering async job for collecting garbage",
+		)
+	}
+
+	return nil
+}
+
+// getUncachedStore returns the store underlying the given store if the given
+// store serves reads from a cache (see package storage/cache). Async jobs
+// read instances, modify them, and write them back, step after step and
+// possibly on different replicas of the broker, so writing back a stale read
+// would undo the work of the previous step.
+func getUncachedStore(store storage.Store) storage.Store {
+	if cache, ok := store.(storage.Cache); ok {
+		return cache.Uncached()
+	}
+	return store
+}
+
+// getOperationConfig returns the configuration the given API server carries
+// out operations with. Defaults are returned if the API server doesn't expose
+// its configuration.
+func getOperationConfig(apiServer api.Server) api.OperationConfig {
+	if provider, ok := apiServer.(api.OperationConfigProvider); ok {
+		return provider.GetOperationConfig()
+	}
+	return api.NewOperationConfigWithDefaults()
+}
+
+// validateRetentionConfig returns an error if the retention janitor is enabled,
+// but misconfigured or unable to enumerate the given store
+func validateRetentionConfig(config Config, store storage.Store) error {
+	if config.Retention.Interval == 0 {
+		return nil
+	}
+	if err := config.Retention.Validate(); err != nil {
+		return err
+	}
+	if _, ok := store.(storage.Enumerator); !ok {
+		return errors.New(
+			"the retention janitor requires a store that supports enumeration",
+		)
+	}
+	return nil
+}
+
+// getTenantJob returns an async.JobFn that executes the given job on behalf of
+// the tenant that submitted each task. Any follow-up tasks the job returns are
+// submitted on behalf of the same tenant. Tasks that don't belong to any
+// tenant are executed by this broker, unless it serves multiple tenants, in
+// which case there is no storage or catalog to execute them with and an error
+// is returned instead.
+func (b *broker) getTenantJob(job jobFn) async.JobFn {
+	return func(ctx context.Context, task async.Task) ([]async.Task, error) {
+		tenantName := tenant.GetTaskTenant(task)
+		tb := b
+		if tenantName == "" && b.tenants != nil {
+			return nil, fmt.Errorf(
+				`task "%s" does not belong to any tenant`,
+				task.GetID(),
+			)
+		}
+		if tenantName != "" {
+			var ok bool
+			if tb, ok = b.tenants[tenantName]; !ok {
+				return nil, fmt.Errorf(
+					`task "%s" belongs to unknown tenant "%s"`,
+					task.GetID(),
+					tenantName,
+				)
+			}
+		}
+		tasks, err := job(tb, ctx, task)
+		for _, t := range tasks {
+			tenant.SetTaskTenant(t, tenantName)
+		}
+		return tasks, err
+	}
 }
 
 // Run starts all broker components (e.g. API server and async execution
@@ -116,6 +319,10 @@ func (b *broker) Run(ctx context.Context) error {
 		case <-ctx.Done():
 		}
 	}()
+	// Start retention janitor
+	if b.config.Retention.Interval > 0 {
+		go b.scheduleJanitor(ctx)
+	}
 	// Start api server
 	go func() {
 		select {
@@ -9,7 +9,13 @@ import (
 	"github.com/barpilot/gosba/api"
 	fakeAPI "github.com/barpilot/gosba/api/fake"
 	"github.com/barpilot/gosba/http/filter"
+	"github.com/barpilot/gosba/lifecycle"
 	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/storage"
+	"github.com/barpilot/gosba/storage/cache"
+	memoryStorage "github.com/barpilot/gosba/storage/memory"
+	"github.com/barpilot/gosba/tenant"
+	"github.com/deis/async"
 	fakeAsync "github.com/deis/async/fake"
 	"github.com/stretchr/testify/assert"
 )
@@ -140,6 +146,86 @@ func TestBrokerStartBlocksUntilContextCanceled(t *testing.T) {
 	assert.True(t, asyncEngineStopped)
 }
 
+func TestTenantJobExecutesOnBehalfOfTenant(t *testing.T) {
+	store := memoryStorage.NewStore(service.NewCatalog(nil))
+	b, err := NewMultiTenantBroker(
+		NewConfigWithDefaults(),
+		fakeAPI.NewServer(),
+		fakeAsync.NewEngine(),
+		tenant.Tenant{
+			Name:    "foo",
+			Catalog: service.NewCatalog(nil),
+			Store:   store,
+		},
+	)
+	assert.Nil(t, err)
+	var jobStore storage.Store
+	job := b.(*broker).getTenantJob(
+		func(tb *broker, _ context.Context, _ async.Task) ([]async.Task, error) {
+			jobStore = tb.store
+			return []async.Task{async.NewTask("bar", map[string]string{})}, nil
+		},
+	)
+	task := async.NewTask("bar", map[string]string{})
+	tenant.SetTaskTenant(task, "foo")
+	tasks, err := job(context.Background(), task)
+	assert.Nil(t, err)
+	assert.Equal(t, store, jobStore)
+	assert.Equal(t, 1, len(tasks))
+	assert.Equal(t, "foo", tenant.GetTaskTenant(tasks[0]))
+	// Tasks belonging to unknown tenants should not be executed at all
+	task = async.NewTask("bar", map[string]string{})
+	tenant.SetTaskTenant(task, "baz")
+	jobStore = nil
+	_, err = job(context.Background(), task)
+	assert.NotNil(t, err)
+	assert.Nil(t, jobStore)
+	// Nor should tasks that don't belong to any tenant, e.g. those submitted
+	// before the broker began serving multiple tenants
+	_, err = job(
+		context.Background(),
+		async.NewTask("bar", map[string]string{}),
+	)
+	assert.NotNil(t, err)
+	assert.Nil(t, jobStore)
+}
+
+func TestNewBrokerUsesOperationConfigOfAPIServer(t *testing.T) {
+	svr := fakeAPI.NewServer()
+	svr.OperationConfig.Wait.Parent.MaxWait = time.Minute
+	svr.OperationConfig.EventSink =
+		lifecycle.NewChannelSink(make(chan lifecycle.Event))
+	b, err := NewBroker(
+		NewConfigWithDefaults(),
+		svr,
+		fakeAsync.NewEngine(),
+		nil,
+		service.NewCatalog(nil),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, svr.OperationConfig, b.(*broker).operationConfig)
+}
+
+func TestBrokerJobsBypassCache(t *testing.T) {
+	catalog := service.NewCatalog(nil)
+	store := memoryStorage.NewStore(catalog)
+	cachingStore, err := cache.NewStore(
+		catalog,
+		store,
+		cache.NewConfigWithDefaults(),
+	)
+	assert.Nil(t, err)
+	b, err := NewBroker(
+		NewConfigWithDefaults(),
+		fakeAPI.NewServer(),
+		fakeAsync.NewEngine(),
+		cachingStore,
+		catalog,
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, store, b.(*broker).store)
+}
+
 func getTestBroker() (*broker, error) {
 	asyncEngine := fakeAsync.NewEngine()
 	catalog := service.NewCatalog(nil)
@@ -154,6 +240,7 @@ func getTestBroker() (*broker, error) {
 		return nil, err
 	}
 	b, err := NewBroker(
+		NewConfigWithDefaults(),
 		apiServer,
 		asyncEngine,
 		nil,
@@ -164,3 +251,16 @@ func getTestBroker() (*broker, error) {
 	}
 	return b.(*broker), nil
 }
+
+func TestNewBrokerRejectsInvalidCatalog(t *testing.T) {
+	_, err := NewBroker(
+		NewConfigWithDefaults(),
+		fakeAPI.NewServer(),
+		fakeAsync.NewEngine(),
+		nil,
+		service.NewCatalog([]service.Service{
+			service.NewService(service.ServiceProperties{ID: "foo"}, nil),
+		}),
+	)
+	assert.NotNil(t, err)
+}
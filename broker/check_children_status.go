@@ -3,15 +3,18 @@ package broker
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
+	"github.com/barpilot/gosba/lifecycle"
 	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/wait"
 	"github.com/deis/async"
 	log "github.com/sirupsen/logrus"
 )
 
 func (b *broker) doCheckChildrenStatuses(
-	_ context.Context,
+	ctx context.Context,
 	task async.Task,
 ) ([]async.Task, error) {
 	instanceID, ok := task.GetArgs()["instanceID"]
@@ -21,6 +24,7 @@ func (b *broker) doCheckChildrenStatuses(
 	instance, ok, err := b.store.GetInstance(instanceID)
 	if !ok {
 		return nil, b.handleDeprovisioningError(
+			ctx,
 			instanceID,
 			"checkChildrenStatuses",
 			nil,
@@ -29,6 +33,7 @@ func (b *broker) doCheckChildrenStatuses(
 	}
 	if err != nil {
 		return nil, b.handleDeprovisioningError(
+			ctx,
 			instanceID,
 			"checkChildrenStatuses",
 			err,
@@ -45,6 +50,7 @@ func (b *broker) doCheckChildrenStatuses(
 			"deprovisioning error: error determining child count",
 		)
 		return nil, b.handleDeprovisioningError(
+			ctx,
 			instance,
 			"checkChildrenStatuses",
 			err,
@@ -52,18 +58,36 @@ func (b *broker) doCheckChildrenStatuses(
 		)
 	}
 	if childCount > 0 {
+		if (instance.WaitDeadline != nil &&
+			time.Now().After(*instance.WaitDeadline)) ||
+			(instance.OperationDeadline != nil &&
+				time.Now().After(*instance.OperationDeadline)) {
+			log.WithFields(log.Fields{
+				"instanceID":          instanceID,
+				"provisionedChildren": childCount,
+			}).Info("children not deprovisioned, giving up")
+			return nil, b.handleDeprovisioningError(
+				ctx,
+				instance,
+				"checkChildrenStatuses",
+				nil,
+				fmt.Sprintf(
+					"timed out waiting for %d child instance(s) to be deprovisioned",
+					childCount,
+				),
+			)
+		}
 		//Put this task back into the queue
 		log.WithFields(log.Fields{
 			"instanceID":          instanceID,
 			"provisionedChildren": childCount,
 		}).Debug("children not deprovisioned, will wait again")
 		return []async.Task{
-			async.NewDelayedTask(
+			wait.NewCheckTask(
 				"checkChildrenStatuses",
-				map[string]string{
-					"instanceID": instanceID,
-				},
-				time.Minute*1,
+				instanceID,
+				wait.GetCheck(task)+1,
+				b.operationConfig.Wait.Children,
 			),
 		}, nil
 	}
@@ -81,6 +105,7 @@ func (b *broker) doCheckChildrenStatuses(
 				"service and plan",
 		)
 		return nil, b.handleDeprovisioningError(
+			ctx,
 			instance,
 			"checkChildrenStatuses",
 			err,
@@ -98,6 +123,7 @@ func (b *broker) doCheckChildrenStatuses(
 				"service and plan",
 		)
 		return nil, b.handleDeprovisioningError(
+			ctx,
 			instance,
 			"checkChildrenStatuses",
 			nil,
@@ -107,14 +133,21 @@ func (b *broker) doCheckChildrenStatuses(
 
 	// Update the status
 	instance.Status = service.InstanceStateDeprovisioning
+	instance.WaitDeadline = nil
 	if err = b.store.WriteInstance(instance); err != nil {
 		return nil, b.handleDeprovisioningError(
+			ctx,
 			instance,
 			"checkChildrenStatuses",
 			err,
 			"error: error updating instance status",
 		)
 	}
+	b.events().SendInstanceEvent(
+		ctx,
+		lifecycle.EventTypeInstanceDeprovisioning,
+		instance,
+	)
 
 	// Put the real deprovision task into the queue
 	log.WithFields(log.Fields{
@@ -6,13 +6,15 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/barpilot/gosba/lifecycle"
 	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/wait"
 	"github.com/deis/async"
 	log "github.com/sirupsen/logrus"
 )
 
 func (b *broker) doCheckParentStatus(
-	_ context.Context,
+	ctx context.Context,
 	task async.Task,
 ) ([]async.Task, error) {
 
@@ -24,6 +26,7 @@ func (b *broker) doCheckParentStatus(
 	instance, ok, err := b.store.GetInstance(instanceID)
 	if !ok {
 		return nil, b.handleProvisioningError(
+			ctx,
 			instanceID,
 			"checkParentStatus",
 			nil,
@@ -32,6 +35,7 @@ func (b *broker) doCheckParentStatus(
 	}
 	if err != nil {
 		return nil, b.handleProvisioningError(
+			ctx,
 			instanceID,
 			"checkParentStatus",
 			err,
@@ -41,6 +45,7 @@ func (b *broker) doCheckParentStatus(
 	waitForParent, err := b.waitForParent(instance)
 	if err != nil {
 		return nil, b.handleProvisioningError(
+			ctx,
 			instance,
 			"checkParentStatus",
 			err,
@@ -48,16 +53,35 @@ func (b *broker) doCheckParentStatus(
 		)
 	}
 	if waitForParent {
+		if (instance.WaitDeadline != nil &&
+			time.Now().After(*instance.WaitDeadline)) ||
+			(instance.OperationDeadline != nil &&
+				time.Now().After(*instance.OperationDeadline)) {
+			log.WithFields(log.Fields{
+				"instanceID":  instanceID,
+				"parentAlias": instance.ParentAlias,
+			}).Info("parent not done, giving up")
+			return nil, b.handleProvisioningError(
+				ctx,
+				instance,
+				"checkParentStatus",
+				nil,
+				fmt.Sprintf(
+					`timed out waiting for parent instance with alias "%s" to be `+
+						`provisioned`,
+					instance.ParentAlias,
+				),
+			)
+		}
 		log.WithFields(log.Fields{
 			"instanceID": instanceID,
 		}).Debug("parent not done, will wait again")
 		return []async.Task{
-			async.NewDelayedTask(
+			wait.NewCheckTask(
 				"checkParentStatus",
-				map[string]string{
-					"instanceID": instanceID,
-				},
-				time.Minute*1,
+				instanceID,
+				wait.GetCheck(task)+1,
+				b.operationConfig.Wait.Parent,
 			),
 		}, nil
 	}
@@ -75,6 +99,7 @@ func (b *broker) doCheckParentStatus(
 				"service and plan",
 		)
 		return nil, b.handleProvisioningError(
+			ctx,
 			instanceID,
 			"checkParentStatus",
 			err,
@@ -92,6 +117,7 @@ func (b *broker) doCheckParentStatus(
 				"service and plan",
 		)
 		return nil, b.handleProvisioningError(
+			ctx,
 			instanceID,
 			"checkParentStatus",
 			err,
@@ -105,14 +131,21 @@ func (b *broker) doCheckParentStatus(
 
 	// Update the status
 	instance.Status = service.InstanceStateProvisioning
+	instance.WaitDeadline = nil
 	if err = b.store.WriteInstance(instance); err != nil {
 		return nil, b.handleProvisioningError(
+			ctx,
 			instance,
 			"checkParentStatus",
 			err,
 			"error: error updating instance status",
 		)
 	}
+	b.events().SendInstanceEvent(
+		ctx,
+		lifecycle.EventTypeInstanceProvisioning,
+		instance,
+	)
 
 	// Put the real provision task into the queue
 	return []async.Task{
@@ -0,0 +1,93 @@
+package broker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/services/fake"
+	memoryStorage "github.com/barpilot/gosba/storage/memory"
+	"github.com/barpilot/gosba/wait"
+	"github.com/deis/async"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckParentStatusWaitsAgainWithBackoff(t *testing.T) {
+	b, err := getTestBrokerWithStore()
+	assert.Nil(t, err)
+	instanceID := uuid.NewV4().String()
+	err = b.store.WriteInstance(service.Instance{
+		InstanceID:  instanceID,
+		ServiceID:   fake.ServiceID,
+		PlanID:      fake.StandardPlanID,
+		Status:      service.InstanceStateProvisioningDeferred,
+		ParentAlias: uuid.NewV4().String(),
+	})
+	assert.Nil(t, err)
+	tasks, err := b.doCheckParentStatus(
+		context.Background(),
+		async.NewTask(
+			"checkParentStatus",
+			map[string]string{
+				"instanceID": instanceID,
+				"check":      "1",
+			},
+		),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(tasks))
+	assert.Equal(t, 2, wait.GetCheck(tasks[0]))
+	assert.NotNil(t, tasks[0].GetExecuteTime())
+}
+
+func TestCheckParentStatusGivesUpAfterDeadline(t *testing.T) {
+	b, err := getTestBrokerWithStore()
+	assert.Nil(t, err)
+	instanceID := uuid.NewV4().String()
+	waitDeadline := time.Now().Add(-time.Minute)
+	err = b.store.WriteInstance(service.Instance{
+		InstanceID:   instanceID,
+		ServiceID:    fake.ServiceID,
+		PlanID:       fake.StandardPlanID,
+		Status:       service.InstanceStateProvisioningDeferred,
+		ParentAlias:  uuid.NewV4().String(),
+		WaitDeadline: &waitDeadline,
+	})
+	assert.Nil(t, err)
+	tasks, err := b.doCheckParentStatus(
+		context.Background(),
+		async.NewTask(
+			"checkParentStatus",
+			map[string]string{
+				"instanceID": instanceID,
+			},
+		),
+	)
+	assert.NotNil(t, err)
+	assert.Empty(t, tasks)
+	instance, ok, err := b.store.GetInstance(instanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, service.InstanceStateProvisioningFailed, instance.Status)
+	assert.Contains(t, instance.StatusReason, "timed out waiting for parent")
+}
+
+func getTestBrokerWithStore() (*broker, error) {
+	b, err := getTestBroker()
+	if err != nil {
+		return nil, err
+	}
+	fakeModule, err := fake.New()
+	if err != nil {
+		return nil, err
+	}
+	fakeCatalog, err := fakeModule.GetCatalog()
+	if err != nil {
+		return nil, err
+	}
+	b.catalog = fakeCatalog
+	b.store = memoryStorage.NewStore(fakeCatalog)
+	return b, nil
+}
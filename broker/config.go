@@ -0,0 +1,43 @@
+package broker
+
+import (
+	"time"
+
+	"github.com/barpilot/gosba/retention"
+	"github.com/barpilot/gosba/usage"
+	"github.com/barpilot/gosba/wait"
+)
+
+// Config represents configuration options for the broker's asynchronous jobs.
+// Options that concern both the API server and the asynchronous jobs, such as
+// how long deferred operations wait and where lifecycle events are sent, are
+// set on the API server instead (see api.OperationConfig).
+type Config struct {
+	// UsageReporter, if set, is notified whenever an instance is created,
+	// changes plan, or is deleted. This is useful for metering usage of each
+	// plan; e.g. for billing purposes. The usage/webhook package provides a
+	// reporter that delivers these events to a billing system's webhook.
+	UsageReporter usage.Reporter
+	// UsageRetry governs how often, and for how long, reporting a usage event
+	// is retried after the UsageReporter fails to report it. If MaxWait is
+	// zero, reporting is retried until it succeeds.
+	UsageRetry wait.Policy
+	// Retention governs the retention janitor, which removes records of
+	// operations that failed long ago and reports instances that appear to be
+	// stuck. Its findings are sent to the API server's event sink.
+	Retention retention.Config
+}
+
+// NewConfigWithDefaults returns a Config object with default values already
+// applied. Callers are then free to set custom values for the remaining fields
+// and/or override default values.
+func NewConfigWithDefaults() Config {
+	return Config{
+		UsageRetry: wait.Policy{
+			InitialInterval: 10 * time.Second,
+			MaxInterval:     10 * time.Minute,
+			Multiplier:      2,
+		},
+		Retention: retention.NewConfigWithDefaults(),
+	}
+}
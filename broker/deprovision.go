@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/barpilot/gosba/lifecycle"
 	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/usage"
 	"github.com/deis/async"
 	log "github.com/sirupsen/logrus"
 )
@@ -28,6 +31,7 @@ func (b *broker) executeDeprovisioningStep(
 	instance, ok, err := b.store.GetInstance(instanceID)
 	if err != nil {
 		return nil, b.handleDeprovisioningError(
+			ctx,
 			instanceID,
 			stepName,
 			err,
@@ -36,6 +40,7 @@ func (b *broker) executeDeprovisioningStep(
 	}
 	if !ok {
 		return nil, b.handleDeprovisioningError(
+			ctx,
 			instanceID,
 			stepName,
 			nil,
@@ -60,6 +65,7 @@ func (b *broker) executeDeprovisioningStep(
 	instanceCopy, _, err := b.store.GetInstance(instanceID)
 	if err != nil {
 		return nil, b.handleProvisioningError(
+			ctx,
 			instanceID,
 			stepName,
 			err,
@@ -70,6 +76,7 @@ func (b *broker) executeDeprovisioningStep(
 	deprovisioner, err := serviceManager.GetDeprovisioner(instance.Plan)
 	if err != nil {
 		return nil, b.handleDeprovisioningError(
+			ctx,
 			instance,
 			stepName,
 			err,
@@ -82,15 +89,67 @@ func (b *broker) executeDeprovisioningStep(
 	step, ok := deprovisioner.GetStep(stepName)
 	if !ok {
 		return nil, b.handleDeprovisioningError(
+			ctx,
 			instance,
 			stepName,
 			nil,
 			`deprovisioner does not know how to process step "%s"`,
 		)
 	}
+	// If this task was redelivered after the step had already completed, the
+	// step must not be executed again
+	if service.IsStepCompleted(instance, stepName) {
+		log.WithFields(log.Fields{
+			"step":       stepName,
+			"instanceID": instanceID,
+		}).Debug("deprovisioning step already completed; skipping")
+		nextStepName, ok := deprovisioner.GetNextStepName(stepName)
+		if !ok || instance.LastCompletedStep != stepName {
+			return nil, nil
+		}
+		return []async.Task{
+			async.NewTask(
+				"executeDeprovisioningStep",
+				map[string]string{
+					"stepName":   nextStepName,
+					"instanceID": instanceID,
+				},
+			),
+		}, nil
+	}
+	// The operation's deadline is only enforced while the operation is still
+	// in progress. Tasks redelivered after a step, or the whole operation, has
+	// completed were dealt with above and must not fail the instance.
+	if instance.Status == service.InstanceStateDeprovisioning &&
+		instance.OperationDeadline != nil &&
+		time.Now().After(*instance.OperationDeadline) {
+		return nil, b.handleDeprovisioningError(
+			ctx,
+			instance,
+			stepName,
+			nil,
+			"operation did not complete within the plan's maximum polling duration",
+		)
+	}
+	// Record that the step has started before handing off to the module so
+	// that, should the step be attempted again, the same idempotency key is
+	// used
+	execution := service.StartStepExecution(&instanceCopy, stepName)
+	instance.StepExecutions = instanceCopy.StepExecutions
+	if err = b.store.WriteInstance(instanceCopy); err != nil {
+		return nil, b.handleDeprovisioningError(
+			ctx,
+			instance,
+			stepName,
+			err,
+			"error persisting step execution",
+		)
+	}
+	ctx = service.WithIdempotencyKey(ctx, execution.IdempotencyKey)
 	updatedDetails, err := step.Execute(ctx, instance)
 	if err != nil {
 		return nil, b.handleDeprovisioningError(
+			ctx,
 			instance,
 			stepName,
 			err,
@@ -98,9 +157,22 @@ func (b *broker) executeDeprovisioningStep(
 		)
 	}
 	instanceCopy.Details = updatedDetails
+	err = service.CompleteStepExecution(&instanceCopy, stepName, updatedDetails)
+	if err != nil {
+		return nil, b.handleDeprovisioningError(
+			ctx,
+			instance,
+			stepName,
+			err,
+			"error recording completion of step",
+		)
+	}
+	instanceCopy.LastCompletedStep = step.GetName()
+	instanceCopy.FailedStep = ""
 	if nextStepName, ok := deprovisioner.GetNextStepName(step.GetName()); ok {
 		if err = b.store.WriteInstance(instanceCopy); err != nil {
 			return nil, b.handleDeprovisioningError(
+				ctx,
 				instanceCopy,
 				stepName,
 				err,
@@ -121,13 +193,23 @@ func (b *broker) executeDeprovisioningStep(
 	_, err = b.store.DeleteInstance(instanceCopy.InstanceID)
 	if err != nil {
 		return nil, b.handleDeprovisioningError(
+			ctx,
 			instanceCopy,
 			stepName,
 			err,
 			"error deleting deprovisioned instance",
 		)
 	}
-	return nil, nil
+	b.events().SendInstanceEvent(
+		ctx,
+		lifecycle.EventTypeInstanceDeleted,
+		instanceCopy,
+	)
+	// Instances that never finished provisioning were never reported as created
+	if instanceCopy.ProvisioningFailed {
+		return nil, nil
+	}
+	return b.getUsageTasks(usage.EventTypeInstanceDeleted, instanceCopy), nil
 }
 
 // handleDeprovisioningError tries to handle async deprovisioning errors. If an
@@ -138,6 +220,7 @@ func (b *broker) executeDeprovisioningStep(
 // returned by the caller of this function. If an instanceID is passed in
 // (instead of an instance), only error formatting is handled.
 func (b *broker) handleDeprovisioningError(
+	ctx context.Context,
 	instanceOrInstanceID interface{},
 	stepName string,
 	e error,
@@ -182,6 +265,12 @@ func (b *broker) handleDeprovisioningError(
 		)
 	}
 	instance.StatusReason = ret.Error()
+	// Remember where we left off so the operation can later be resumed from
+	// this step instead of starting over
+	instance.FailedStep = stepName
+	// Only a message a module has explicitly deemed suitable for end users is
+	// ever exposed to platforms
+	instance.StatusDescription, _ = service.GetUserFacingMessage(e)
 	if err := b.store.WriteInstance(instance); err != nil {
 		log.WithFields(log.Fields{
 			"instanceID":       instance.InstanceID,
@@ -190,5 +279,10 @@ func (b *broker) handleDeprovisioningError(
 			"persistenceError": err,
 		}).Fatal("error persisting instance with updated status")
 	}
+	b.events().SendInstanceEvent(
+		ctx,
+		lifecycle.EventTypeInstanceDeprovisioningFailed,
+		instance,
+	)
 	return ret
 }
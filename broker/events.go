@@ -0,0 +1,14 @@
+package broker
+
+import (
+	"github.com/barpilot/gosba/lifecycle"
+)
+
+// events returns an emitter that relays events on behalf of this broker's
+// tenant to the configured event sink, if any
+func (b *broker) events() lifecycle.Emitter {
+	return lifecycle.Emitter{
+		Sink:   b.operationConfig.EventSink,
+		Tenant: b.tenantName,
+	}
+}
@@ -0,0 +1,114 @@
+package broker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/barpilot/gosba/lifecycle"
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/services/fake"
+	"github.com/deis/async"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycleEventsAreSentThroughoutInstanceLifecycle(t *testing.T) {
+	b, err := getTestBrokerWithStore()
+	assert.Nil(t, err)
+	events := []lifecycle.Event{}
+	b.operationConfig.EventSink = lifecycle.SinkFunc(
+		func(_ context.Context, event lifecycle.Event) error {
+			events = append(events, event)
+			return errSome // Should not cause any step to fail
+		},
+	)
+	instanceID := uuid.NewV4().String()
+	err = b.store.WriteInstance(service.Instance{
+		InstanceID: instanceID,
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Status:     service.InstanceStateProvisioning,
+	})
+	assert.Nil(t, err)
+	_, err = b.executeProvisioningStep(
+		context.Background(),
+		getTestStepTask("executeProvisioningStep", instanceID),
+	)
+	assert.Nil(t, err)
+
+	instance, _, err := b.store.GetInstance(instanceID)
+	assert.Nil(t, err)
+	instance.Status = service.InstanceStateUpdating
+	instance.StepExecutions = nil
+	err = b.store.WriteInstance(instance)
+	assert.Nil(t, err)
+	_, err = b.executeUpdatingStep(
+		context.Background(),
+		getTestStepTask("executeUpdatingStep", instanceID),
+	)
+	assert.Nil(t, err)
+
+	instance, _, err = b.store.GetInstance(instanceID)
+	assert.Nil(t, err)
+	instance.Status = service.InstanceStateDeprovisioning
+	instance.StepExecutions = nil
+	err = b.store.WriteInstance(instance)
+	assert.Nil(t, err)
+	_, err = b.executeDeprovisioningStep(
+		context.Background(),
+		getTestStepTask("executeDeprovisioningStep", instanceID),
+	)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 3, len(events))
+	for i, eventType := range []lifecycle.EventType{
+		lifecycle.EventTypeInstanceProvisioned,
+		lifecycle.EventTypeInstanceUpdated,
+		lifecycle.EventTypeInstanceDeleted,
+	} {
+		if i >= len(events) {
+			break
+		}
+		assert.Equal(t, eventType, events[i].Type)
+		assert.NotNil(t, events[i].Instance)
+		if events[i].Instance != nil {
+			assert.Equal(t, instanceID, events[i].Instance.InstanceID)
+		}
+	}
+}
+
+func TestLifecycleEventIsSentWhenProvisioningFails(t *testing.T) {
+	b, err := getTestBrokerWithStore()
+	assert.Nil(t, err)
+	ch := make(chan lifecycle.Event, 1)
+	b.operationConfig.EventSink = lifecycle.NewChannelSink(ch)
+	instanceID := uuid.NewV4().String()
+	err = b.store.WriteInstance(service.Instance{
+		InstanceID: instanceID,
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Status:     service.InstanceStateProvisioning,
+	})
+	assert.Nil(t, err)
+	_, err = b.executeProvisioningStep(
+		context.Background(),
+		async.NewTask(
+			"executeProvisioningStep",
+			map[string]string{
+				"stepName":   "bogus",
+				"instanceID": instanceID,
+			},
+		),
+	)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(ch))
+	if len(ch) == 1 {
+		event := <-ch
+		assert.Equal(t, lifecycle.EventTypeInstanceProvisioningFailed, event.Type)
+		assert.Equal(
+			t,
+			service.InstanceStateProvisioningFailed,
+			event.Instance.Status,
+		)
+	}
+}
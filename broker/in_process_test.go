@@ -0,0 +1,61 @@
+package broker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	fakeAPI "github.com/barpilot/gosba/api/fake"
+	memoryAsync "github.com/barpilot/gosba/async/memory"
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/services/fake"
+	memoryStorage "github.com/barpilot/gosba/storage/memory"
+	"github.com/deis/async"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInProcessBrokerCompletesProvisioning(t *testing.T) {
+	fakeModule, err := fake.New()
+	assert.Nil(t, err)
+	fakeCatalog, err := fakeModule.GetCatalog()
+	assert.Nil(t, err)
+	store := memoryStorage.NewStore(fakeCatalog)
+	asyncEngine := memoryAsync.NewEngine(memoryAsync.NewConfigWithDefaults())
+	_, err = NewBroker(
+		NewConfigWithDefaults(),
+		fakeAPI.NewServer(),
+		asyncEngine,
+		store,
+		fakeCatalog,
+	)
+	assert.Nil(t, err)
+	instanceID := uuid.NewV4().String()
+	err = store.WriteInstance(service.Instance{
+		InstanceID: instanceID,
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Status:     service.InstanceStateProvisioning,
+	})
+	assert.Nil(t, err)
+	err = asyncEngine.SubmitTask(
+		async.NewTask(
+			"executeProvisioningStep",
+			map[string]string{
+				"stepName":   "run",
+				"instanceID": instanceID,
+			},
+		),
+	)
+	assert.Nil(t, err)
+	// Give the engine a moment to work; once Run returns, the engine has
+	// drained and the store can safely be inspected
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = asyncEngine.Run(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	instance, ok, err := store.GetInstance(instanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, service.InstanceStateProvisioned, instance.Status)
+}
@@ -0,0 +1,314 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/barpilot/gosba/lifecycle"
+	"github.com/barpilot/gosba/retention"
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/storage"
+	"github.com/barpilot/gosba/tenant"
+	"github.com/deis/async"
+	log "github.com/sirupsen/logrus"
+)
+
+// janitorReport summarizes a single run of the retention janitor
+type janitorReport struct {
+	instancesRemoved int
+	bindingsRemoved  int
+	stuckInstances   int
+}
+
+// janitorLease is the name of the lease a replica must hold, if the store
+// supports leases, to submit tasks for the retention janitor
+const janitorLease = "retention-janitor"
+
+// scheduleJanitor submits a task for the retention janitor on behalf of each
+// tenant every retention interval until the given context is canceled. Every
+// replica of the broker does this, but, for stores that support leases, only
+// the replica holding the janitor's lease on a tenant's store submits tasks
+// for that tenant, so that records are archived and stuck instances reported
+// once per interval. Otherwise, the janitor's work is repeated by every
+// replica, so it must be idempotent.
+func (b *broker) scheduleJanitor(ctx context.Context) {
+	ticker := time.NewTicker(b.config.Retention.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.submitJanitorTasks()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *broker) submitJanitorTasks() {
+	brokers := []*broker{b}
+	if b.tenants != nil {
+		brokers = []*broker{}
+		for _, tb := range b.tenants {
+			brokers = append(brokers, tb)
+		}
+	}
+	for _, tb := range brokers {
+		if !tb.acquireJanitorLease() {
+			continue
+		}
+		task := async.NewTask("collectGarbage", map[string]string{})
+		tenant.SetTaskTenant(task, tb.tenantName)
+		if err := b.asyncEngine.SubmitTask(task); err != nil {
+			log.WithFields(log.Fields{
+				"tenant": tb.tenantName,
+				"error":  err,
+			}).Error("error submitting retention janitor task")
+		}
+	}
+}
+
+// acquireJanitorLease returns true if this replica may submit a task for the
+// retention janitor, i.e. if the store doesn't support leases or this replica
+// acquired or renewed the janitor's lease on it
+func (b *broker) acquireJanitorLease() bool {
+	leaser, ok := b.store.(storage.Leaser)
+	if !ok {
+		return true
+	}
+	// The lease outlasts the interval, so the holder renews it before it
+	// expires. Should the holder stop, another replica takes over within two
+	// intervals.
+	acquired, err := leaser.AcquireLease(
+		janitorLease,
+		b.replicaID,
+		2*b.config.Retention.Interval,
+	)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"tenant": b.tenantName,
+			"error":  err,
+		}).Error("retention janitor error: error acquiring lease")
+		return false
+	}
+	return acquired
+}
+
+// collectGarbage applies the configured retention policies to every record in
+// storage and reports instances that appear to be stuck. Problems with
+// individual records are logged and do not prevent the remaining records from
+// being examined.
+func (b *broker) collectGarbage(
+	ctx context.Context,
+	_ async.Task,
+) ([]async.Task, error) {
+	enumerator, ok := b.store.(storage.Enumerator)
+	if !ok {
+		return nil, errors.New("store does not support enumeration")
+	}
+	now := time.Now()
+	report := janitorReport{}
+	instanceIDs, err := enumerator.GetInstanceIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, instanceID := range instanceIDs {
+		b.collectInstance(ctx, instanceID, now, &report)
+	}
+	bindingIDs, err := enumerator.GetBindingIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, bindingID := range bindingIDs {
+		b.collectBinding(ctx, bindingID, now, &report)
+	}
+	log.WithFields(log.Fields{
+		"tenant":           b.tenantName,
+		"instancesRemoved": report.instancesRemoved,
+		"bindingsRemoved":  report.bindingsRemoved,
+		"stuckInstances":   report.stuckInstances,
+	}).Info("retention janitor finished")
+	return nil, nil
+}
+
+func (b *broker) collectInstance(
+	ctx context.Context,
+	instanceID string,
+	now time.Time,
+	report *janitorReport,
+) {
+	logFields := log.Fields{
+		"tenant":     b.tenantName,
+		"instanceID": instanceID,
+	}
+	instance, ok, err := b.store.GetInstance(instanceID)
+	if err != nil {
+		logFields["error"] = err
+		log.WithFields(logFields).Error(
+			"retention janitor error: error loading persisted instance",
+		)
+		return
+	}
+	if !ok {
+		// The instance was deleted since it was enumerated
+		return
+	}
+	logFields["status"] = instance.Status
+	lastActivity := retention.GetLastActivity(instance)
+	threshold := b.config.Retention.StuckInstanceThreshold
+	switch {
+	case retention.IsTransitional(instance.Status):
+		if threshold > 0 && now.Sub(lastActivity) > threshold {
+			logFields["lastActivity"] = lastActivity
+			log.WithFields(logFields).Warn("instance appears to be stuck")
+			b.events().SendInstanceEvent(ctx, lifecycle.EventTypeInstanceStuck, instance)
+			report.stuckInstances++
+		}
+	case instance.Status == service.InstanceStateProvisioningFailed:
+		policy := b.config.Retention.FailedInstances
+		if !policy.IsExpired(lastActivity, now) {
+			return
+		}
+		// Children are removed first, so that none are left without a parent
+		childCount, err := b.store.GetInstanceChildCountByAlias(instance.Alias)
+		if err != nil {
+			logFields["error"] = err
+			log.WithFields(logFields).Error(
+				"retention janitor error: error determining child count",
+			)
+			return
+		}
+		if childCount > 0 {
+			return
+		}
+		eventType := lifecycle.EventTypeInstancePurged
+		if policy.Action == retention.ActionArchive {
+			err = b.config.Retention.Archiver.ArchiveInstance(ctx, instance)
+			if err != nil {
+				logFields["error"] = err
+				log.WithFields(logFields).Error(
+					"retention janitor error: error archiving instance",
+				)
+				return
+			}
+			eventType = lifecycle.EventTypeInstanceArchived
+		}
+		// The instance may have been retried (e.g. through the admin API or an
+		// identical provisioning request) since it was read, in which case
+		// deleting it would orphan whatever the retry provisions
+		if !b.isInstanceUnchanged(instance, logFields) {
+			return
+		}
+		if _, err = b.store.DeleteInstance(instanceID); err != nil {
+			logFields["error"] = err
+			log.WithFields(logFields).Error(
+				"retention janitor error: error deleting instance",
+			)
+			return
+		}
+		log.WithFields(logFields).Debug("removed failed instance")
+		b.events().SendInstanceEvent(ctx, eventType, instance)
+		report.instancesRemoved++
+	}
+}
+
+func (b *broker) collectBinding(
+	ctx context.Context,
+	bindingID string,
+	now time.Time,
+	report *janitorReport,
+) {
+	logFields := log.Fields{
+		"tenant":    b.tenantName,
+		"bindingID": bindingID,
+	}
+	binding, ok, err := b.store.GetBinding(bindingID)
+	if err != nil {
+		logFields["error"] = err
+		log.WithFields(logFields).Error(
+			"retention janitor error: error loading persisted binding",
+		)
+		return
+	}
+	policy := b.config.Retention.FailedBindings
+	if !ok ||
+		binding.Status != service.BindingStateBindingFailed ||
+		!policy.IsExpired(binding.Created, now) {
+		return
+	}
+	eventType := lifecycle.EventTypeBindingPurged
+	if policy.Action == retention.ActionArchive {
+		err = b.config.Retention.Archiver.ArchiveBinding(ctx, binding)
+		if err != nil {
+			logFields["error"] = err
+			log.WithFields(logFields).Error(
+				"retention janitor error: error archiving binding",
+			)
+			return
+		}
+		eventType = lifecycle.EventTypeBindingArchived
+	}
+	if !b.isBindingUnchanged(binding, logFields) {
+		return
+	}
+	if _, err = b.store.DeleteBinding(bindingID); err != nil {
+		logFields["error"] = err
+		log.WithFields(logFields).Error(
+			"retention janitor error: error deleting binding",
+		)
+		return
+	}
+	log.WithFields(logFields).Debug("removed failed binding")
+	b.events().SendBindingEvent(ctx, eventType, binding)
+	report.bindingsRemoved++
+}
+
+// isInstanceUnchanged reads the given failed instance again and returns true
+// if it is still failed and hasn't been modified since it was first read
+func (b *broker) isInstanceUnchanged(
+	instance service.Instance,
+	logFields log.Fields,
+) bool {
+	current, ok, err := b.store.GetInstance(instance.InstanceID)
+	if err != nil {
+		logFields["error"] = err
+		log.WithFields(logFields).Error(
+			"retention janitor error: error reloading persisted instance",
+		)
+		return false
+	}
+	if !ok ||
+		current.Status != instance.Status ||
+		!retention.GetLastActivity(current).Equal(
+			retention.GetLastActivity(instance),
+		) {
+		log.WithFields(logFields).Debug(
+			"failed instance changed while being collected; leaving it alone",
+		)
+		return false
+	}
+	return true
+}
+
+// isBindingUnchanged reads the given failed binding again and returns true if
+// it is still failed
+func (b *broker) isBindingUnchanged(
+	binding service.Binding,
+	logFields log.Fields,
+) bool {
+	current, ok, err := b.store.GetBinding(binding.BindingID)
+	if err != nil {
+		logFields["error"] = err
+		log.WithFields(logFields).Error(
+			"retention janitor error: error reloading persisted binding",
+		)
+		return false
+	}
+	if !ok || current.Status != binding.Status {
+		log.WithFields(logFields).Debug(
+			"failed binding changed while being collected; leaving it alone",
+		)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,431 @@
+package broker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	fakeAPI "github.com/barpilot/gosba/api/fake"
+	"github.com/barpilot/gosba/lifecycle"
+	"github.com/barpilot/gosba/retention"
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/services/fake"
+	"github.com/barpilot/gosba/storage"
+	"github.com/barpilot/gosba/tenant"
+	fakeAsync "github.com/deis/async/fake"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+const testMaxAge = time.Hour * 24 * 7
+
+// recordingArchiver is a retention.Archiver that remembers the ids of the
+// records it archived, or fails with the given error
+type recordingArchiver struct {
+	instanceIDs []string
+	bindingIDs  []string
+	err         error
+}
+
+func (r *recordingArchiver) ArchiveInstance(
+	_ context.Context,
+	instance service.Instance,
+) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.instanceIDs = append(r.instanceIDs, instance.InstanceID)
+	return nil
+}
+
+func (r *recordingArchiver) ArchiveBinding(
+	_ context.Context,
+	binding service.Binding,
+) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.bindingIDs = append(r.bindingIDs, binding.BindingID)
+	return nil
+}
+
+// retryingArchiver is a retention.Archiver that emulates a retry of every
+// instance it archives, which happens before the janitor deletes the instance
+type retryingArchiver struct {
+	recordingArchiver
+	store storage.Store
+}
+
+func (r *retryingArchiver) ArchiveInstance(
+	ctx context.Context,
+	instance service.Instance,
+) error {
+	retriedInstance := instance
+	retriedInstance.Status = service.InstanceStateProvisioning
+	if err := r.store.WriteInstance(retriedInstance); err != nil {
+		return err
+	}
+	return r.recordingArchiver.ArchiveInstance(ctx, instance)
+}
+
+// opaqueStore is a storage.Store that doesn't support enumeration
+type opaqueStore struct {
+	storage.Store
+}
+
+func TestJanitorPurgesExpiredFailedRecords(t *testing.T) {
+	b, ch := getTestJanitorBroker(t)
+	expiredInstance := writeTestInstance(
+		t,
+		b,
+		service.InstanceStateProvisioningFailed,
+		time.Now().Add(-2*testMaxAge),
+	)
+	recentInstance := writeTestInstance(
+		t,
+		b,
+		service.InstanceStateProvisioningFailed,
+		time.Now(),
+	)
+	// Instances whose resources may still exist are never removed
+	failedUpdateInstance := writeTestInstance(
+		t,
+		b,
+		service.InstanceStateUpdatingFailed,
+		time.Now().Add(-2*testMaxAge),
+	)
+	expiredBinding := writeTestBinding(
+		t,
+		b,
+		recentInstance.InstanceID,
+		service.BindingStateBindingFailed,
+		time.Now().Add(-2*testMaxAge),
+	)
+	boundBinding := writeTestBinding(
+		t,
+		b,
+		recentInstance.InstanceID,
+		service.BindingStateBound,
+		time.Now().Add(-2*testMaxAge),
+	)
+	_, err := b.collectGarbage(context.Background(), nil)
+	assert.Nil(t, err)
+	for instanceID, exists := range map[string]bool{
+		expiredInstance.InstanceID:      false,
+		recentInstance.InstanceID:       true,
+		failedUpdateInstance.InstanceID: true,
+	} {
+		_, ok, err := b.store.GetInstance(instanceID)
+		assert.Nil(t, err)
+		assert.Equal(t, exists, ok)
+	}
+	for bindingID, exists := range map[string]bool{
+		expiredBinding.BindingID: false,
+		boundBinding.BindingID:   true,
+	} {
+		_, ok, err := b.store.GetBinding(bindingID)
+		assert.Nil(t, err)
+		assert.Equal(t, exists, ok)
+	}
+	assert.Equal(t, 2, len(ch))
+	if len(ch) == 2 {
+		event := <-ch
+		assert.Equal(t, lifecycle.EventTypeInstancePurged, event.Type)
+		assert.Equal(t, expiredInstance.InstanceID, event.Instance.InstanceID)
+		event = <-ch
+		assert.Equal(t, lifecycle.EventTypeBindingPurged, event.Type)
+		assert.Equal(t, expiredBinding.BindingID, event.Binding.BindingID)
+	}
+}
+
+func TestJanitorUsesLastActivityOfFailedInstances(t *testing.T) {
+	b, _ := getTestJanitorBroker(t)
+	instance := writeTestInstance(
+		t,
+		b,
+		service.InstanceStateProvisioningFailed,
+		time.Now().Add(-2*testMaxAge),
+	)
+	// The instance was created long ago, but provisioning was retried
+	// recently
+	operationStarted := time.Now()
+	instance.OperationStarted = &operationStarted
+	assert.Nil(t, b.store.WriteInstance(instance))
+	_, err := b.collectGarbage(context.Background(), nil)
+	assert.Nil(t, err)
+	_, ok, err := b.store.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestJanitorRemovesChildrenBeforeParents(t *testing.T) {
+	b, _ := getTestJanitorBroker(t)
+	parent := writeTestInstance(
+		t,
+		b,
+		service.InstanceStateProvisioningFailed,
+		time.Now().Add(-2*testMaxAge),
+	)
+	parent.Alias = uuid.NewV4().String()
+	assert.Nil(t, b.store.WriteInstance(parent))
+	child := writeTestInstance(
+		t,
+		b,
+		service.InstanceStateProvisioned,
+		time.Now().Add(-2*testMaxAge),
+	)
+	child.ParentAlias = parent.Alias
+	assert.Nil(t, b.store.WriteInstance(child))
+	_, err := b.collectGarbage(context.Background(), nil)
+	assert.Nil(t, err)
+	_, ok, err := b.store.GetInstance(parent.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	// Once the child is gone, so is the parent
+	_, err = b.store.DeleteInstance(child.InstanceID)
+	assert.Nil(t, err)
+	_, err = b.collectGarbage(context.Background(), nil)
+	assert.Nil(t, err)
+	_, ok, err = b.store.GetInstance(parent.InstanceID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestJanitorArchivesExpiredFailedRecords(t *testing.T) {
+	b, ch := getTestJanitorBroker(t)
+	archiver := &recordingArchiver{}
+	b.config.Retention.Archiver = archiver
+	b.config.Retention.FailedInstances.Action = retention.ActionArchive
+	b.config.Retention.FailedBindings.Action = retention.ActionArchive
+	instance := writeTestInstance(
+		t,
+		b,
+		service.InstanceStateProvisioningFailed,
+		time.Now().Add(-2*testMaxAge),
+	)
+	binding := writeTestBinding(
+		t,
+		b,
+		instance.InstanceID,
+		service.BindingStateBindingFailed,
+		time.Now().Add(-2*testMaxAge),
+	)
+	_, err := b.collectGarbage(context.Background(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{instance.InstanceID}, archiver.instanceIDs)
+	assert.Equal(t, []string{binding.BindingID}, archiver.bindingIDs)
+	_, ok, err := b.store.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, ok, err = b.store.GetBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 2, len(ch))
+	if len(ch) == 2 {
+		assert.Equal(t, lifecycle.EventTypeInstanceArchived, (<-ch).Type)
+		assert.Equal(t, lifecycle.EventTypeBindingArchived, (<-ch).Type)
+	}
+}
+
+func TestJanitorRetainsRecordsThatFailToArchive(t *testing.T) {
+	b, ch := getTestJanitorBroker(t)
+	b.config.Retention.Archiver = &recordingArchiver{err: errSome}
+	b.config.Retention.FailedInstances.Action = retention.ActionArchive
+	instance := writeTestInstance(
+		t,
+		b,
+		service.InstanceStateProvisioningFailed,
+		time.Now().Add(-2*testMaxAge),
+	)
+	_, err := b.collectGarbage(context.Background(), nil)
+	assert.Nil(t, err)
+	_, ok, err := b.store.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Empty(t, ch)
+}
+
+func TestJanitorLeavesInstancesRetriedWhileArchiving(t *testing.T) {
+	b, ch := getTestJanitorBroker(t)
+	b.config.Retention.Archiver = &retryingArchiver{store: b.store}
+	b.config.Retention.FailedInstances.Action = retention.ActionArchive
+	instance := writeTestInstance(
+		t,
+		b,
+		service.InstanceStateProvisioningFailed,
+		time.Now().Add(-2*testMaxAge),
+	)
+	_, err := b.collectGarbage(context.Background(), nil)
+	assert.Nil(t, err)
+	retrievedInstance, ok, err := b.store.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(
+		t,
+		service.InstanceStateProvisioning,
+		retrievedInstance.Status,
+	)
+	assert.Empty(t, ch)
+}
+
+func TestJanitorReportsStuckInstances(t *testing.T) {
+	b, ch := getTestJanitorBroker(t)
+	stuckInstance := writeTestInstance(
+		t,
+		b,
+		service.InstanceStateDeprovisioningDeferred,
+		time.Now().Add(-2*b.config.Retention.StuckInstanceThreshold),
+	)
+	writeTestInstance(
+		t,
+		b,
+		service.InstanceStateProvisioning,
+		time.Now(),
+	)
+	writeTestInstance(
+		t,
+		b,
+		service.InstanceStateProvisioned,
+		time.Now().Add(-2*b.config.Retention.StuckInstanceThreshold),
+	)
+	_, err := b.collectGarbage(context.Background(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ch))
+	if len(ch) == 1 {
+		event := <-ch
+		assert.Equal(t, lifecycle.EventTypeInstanceStuck, event.Type)
+		assert.Equal(t, stuckInstance.InstanceID, event.Instance.InstanceID)
+	}
+	// Stuck instances are left alone
+	_, ok, err := b.store.GetInstance(stuckInstance.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestJanitorRequiresEnumerableStore(t *testing.T) {
+	b, _ := getTestJanitorBroker(t)
+	b.store = opaqueStore{Store: b.store}
+	_, err := b.collectGarbage(context.Background(), nil)
+	assert.NotNil(t, err)
+	config := NewConfigWithDefaults()
+	config.Retention.Interval = time.Hour
+	_, err = NewBroker(
+		config,
+		fakeAPI.NewServer(),
+		fakeAsync.NewEngine(),
+		b.store,
+		service.NewCatalog(nil),
+	)
+	assert.NotNil(t, err)
+}
+
+func TestNewBrokerRejectsInvalidRetentionConfig(t *testing.T) {
+	b, _ := getTestJanitorBroker(t)
+	config := NewConfigWithDefaults()
+	config.Retention.Interval = time.Hour
+	config.Retention.FailedInstances.Action = retention.ActionArchive
+	_, err := NewBroker(
+		config,
+		fakeAPI.NewServer(),
+		fakeAsync.NewEngine(),
+		b.store,
+		service.NewCatalog(nil),
+	)
+	assert.NotNil(t, err)
+}
+
+func TestJanitorTasksAreSubmittedForEachTenant(t *testing.T) {
+	b, _ := getTestJanitorBroker(t)
+	e := fakeAsync.NewEngine()
+	mtb, err := NewMultiTenantBroker(
+		NewConfigWithDefaults(),
+		fakeAPI.NewServer(),
+		e,
+		tenant.Tenant{Name: "foo", Store: b.store, Catalog: b.catalog},
+		tenant.Tenant{Name: "bar", Store: b.store, Catalog: b.catalog},
+	)
+	assert.Nil(t, err)
+	mtb.(*broker).submitJanitorTasks()
+	tenantNames := []string{}
+	for _, task := range e.SubmittedTasks {
+		assert.Equal(t, "collectGarbage", task.GetJobName())
+		tenantNames = append(tenantNames, tenant.GetTaskTenant(task))
+	}
+	assert.ElementsMatch(t, []string{"foo", "bar"}, tenantNames)
+}
+
+func TestJanitorTasksAreSubmittedByOneReplica(t *testing.T) {
+	b, _ := getTestJanitorBroker(t)
+	config := NewConfigWithDefaults()
+	config.Retention.Interval = time.Hour
+	engines := []*fakeAsync.Engine{}
+	replicas := []*broker{}
+	for i := 0; i < 2; i++ {
+		e := fakeAsync.NewEngine()
+		replica, err := NewBroker(
+			config,
+			fakeAPI.NewServer(),
+			e,
+			b.store,
+			b.catalog,
+		)
+		assert.Nil(t, err)
+		engines = append(engines, e)
+		replicas = append(replicas, replica.(*broker))
+	}
+	// The first replica to submit a task acquires the lease and keeps it
+	for i := 0; i < 2; i++ {
+		for _, replica := range replicas {
+			replica.submitJanitorTasks()
+		}
+	}
+	assert.Equal(t, 2, len(engines[0].SubmittedTasks))
+	assert.Empty(t, engines[1].SubmittedTasks)
+}
+
+// getTestJanitorBroker returns a broker whose janitor removes failed records
+// after testMaxAge and a channel that receives the events it sends
+func getTestJanitorBroker(t *testing.T) (*broker, chan lifecycle.Event) {
+	b, err := getTestBrokerWithStore()
+	assert.Nil(t, err)
+	b.config.Retention.FailedInstances.MaxAge = testMaxAge
+	b.config.Retention.FailedBindings.MaxAge = testMaxAge
+	ch := make(chan lifecycle.Event, 10)
+	b.operationConfig.EventSink = lifecycle.NewChannelSink(ch)
+	return b, ch
+}
+
+func writeTestInstance(
+	t *testing.T,
+	b *broker,
+	status string,
+	created time.Time,
+) service.Instance {
+	instance := service.Instance{
+		InstanceID: uuid.NewV4().String(),
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Status:     status,
+		Created:    created,
+	}
+	assert.Nil(t, b.store.WriteInstance(instance))
+	return instance
+}
+
+func writeTestBinding(
+	t *testing.T,
+	b *broker,
+	instanceID string,
+	status string,
+	created time.Time,
+) service.Binding {
+	binding := service.Binding{
+		BindingID:  uuid.NewV4().String(),
+		InstanceID: instanceID,
+		ServiceID:  fake.ServiceID,
+		Status:     status,
+		Created:    created,
+	}
+	assert.Nil(t, b.store.WriteBinding(binding))
+	return binding
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/barpilot/gosba/lifecycle"
 	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/usage"
 	"github.com/deis/async"
 	log "github.com/sirupsen/logrus"
 )
@@ -28,6 +31,7 @@ func (b *broker) executeProvisioningStep(
 	instance, ok, err := b.store.GetInstance(instanceID)
 	if err != nil {
 		return nil, b.handleProvisioningError(
+			ctx,
 			instanceID,
 			stepName,
 			err,
@@ -36,6 +40,7 @@ func (b *broker) executeProvisioningStep(
 	}
 	if !ok {
 		return nil, b.handleProvisioningError(
+			ctx,
 			instanceID,
 			stepName,
 			nil,
@@ -60,6 +65,7 @@ func (b *broker) executeProvisioningStep(
 	instanceCopy, _, err := b.store.GetInstance(instanceID)
 	if err != nil {
 		return nil, b.handleProvisioningError(
+			ctx,
 			instanceID,
 			stepName,
 			err,
@@ -70,6 +76,7 @@ func (b *broker) executeProvisioningStep(
 	provisioner, err := serviceManager.GetProvisioner(instance.Plan)
 	if err != nil {
 		return nil, b.handleProvisioningError(
+			ctx,
 			instance,
 			stepName,
 			err,
@@ -82,15 +89,67 @@ func (b *broker) executeProvisioningStep(
 	step, ok := provisioner.GetStep(stepName)
 	if !ok {
 		return nil, b.handleProvisioningError(
+			ctx,
 			instance,
 			stepName,
 			nil,
 			`provisioner does not know how to process step "%s"`,
 		)
 	}
+	// If this task was redelivered after the step had already completed, the
+	// step must not be executed again
+	if service.IsStepCompleted(instance, stepName) {
+		log.WithFields(log.Fields{
+			"step":       stepName,
+			"instanceID": instanceID,
+		}).Debug("provisioning step already completed; skipping")
+		nextStepName, ok := provisioner.GetNextStepName(stepName)
+		if !ok || instance.LastCompletedStep != stepName {
+			return nil, nil
+		}
+		return []async.Task{
+			async.NewTask(
+				"executeProvisioningStep",
+				map[string]string{
+					"stepName":   nextStepName,
+					"instanceID": instanceID,
+				},
+			),
+		}, nil
+	}
+	// The operation's deadline is only enforced while the operation is still
+	// in progress. Tasks redelivered after a step, or the whole operation, has
+	// completed were dealt with above and must not fail the instance.
+	if instance.Status == service.InstanceStateProvisioning &&
+		instance.OperationDeadline != nil &&
+		time.Now().After(*instance.OperationDeadline) {
+		return nil, b.handleProvisioningError(
+			ctx,
+			instance,
+			stepName,
+			nil,
+			"operation did not complete within the plan's maximum polling duration",
+		)
+	}
+	// Record that the step has started before handing off to the module so
+	// that, should the step be attempted again, the same idempotency key is
+	// used
+	execution := service.StartStepExecution(&instanceCopy, stepName)
+	instance.StepExecutions = instanceCopy.StepExecutions
+	if err = b.store.WriteInstance(instanceCopy); err != nil {
+		return nil, b.handleProvisioningError(
+			ctx,
+			instance,
+			stepName,
+			err,
+			"error persisting step execution",
+		)
+	}
+	ctx = service.WithIdempotencyKey(ctx, execution.IdempotencyKey)
 	updatedDetails, err := step.Execute(ctx, instance)
 	if err != nil {
 		return nil, b.handleProvisioningError(
+			ctx,
 			instance,
 			stepName,
 			err,
@@ -98,9 +157,22 @@ func (b *broker) executeProvisioningStep(
 		)
 	}
 	instanceCopy.Details = updatedDetails
+	err = service.CompleteStepExecution(&instanceCopy, stepName, updatedDetails)
+	if err != nil {
+		return nil, b.handleProvisioningError(
+			ctx,
+			instance,
+			stepName,
+			err,
+			"error recording completion of step",
+		)
+	}
+	instanceCopy.LastCompletedStep = step.GetName()
+	instanceCopy.FailedStep = ""
 	if nextStepName, ok := provisioner.GetNextStepName(step.GetName()); ok {
 		if err = b.store.WriteInstance(instanceCopy); err != nil {
 			return nil, b.handleProvisioningError(
+				ctx,
 				instanceCopy,
 				stepName,
 				err,
@@ -119,15 +191,23 @@ func (b *broker) executeProvisioningStep(
 	}
 	// No next step-- we're done provisioning!
 	instanceCopy.Status = service.InstanceStateProvisioned
+	instanceCopy.OperationDeadline = nil
+	instanceCopy.ProvisioningFailed = false
 	if err = b.store.WriteInstance(instanceCopy); err != nil {
 		return nil, b.handleProvisioningError(
+			ctx,
 			instanceCopy,
 			stepName,
 			err,
 			"error persisting instance",
 		)
 	}
-	return nil, nil
+	b.events().SendInstanceEvent(
+		ctx,
+		lifecycle.EventTypeInstanceProvisioned,
+		instanceCopy,
+	)
+	return b.getUsageTasks(usage.EventTypeInstanceCreated, instanceCopy), nil
 }
 
 // handleProvisioningError tries to handle async provisioning errors. If an
@@ -138,6 +218,7 @@ func (b *broker) executeProvisioningStep(
 // returned by the caller of this function. If an instanceID is passed in
 // (instead of an instance), only error formatting is handled.
 func (b *broker) handleProvisioningError(
+	ctx context.Context,
 	instanceOrInstanceID interface{},
 	stepName string,
 	e error,
@@ -164,6 +245,7 @@ func (b *broker) handleProvisioningError(
 	}
 	// If we get to here, we have an instance (not just an instanceID)
 	instance.Status = service.InstanceStateProvisioningFailed
+	instance.ProvisioningFailed = true
 	var ret error
 	if e == nil {
 		ret = fmt.Errorf(
@@ -182,6 +264,12 @@ func (b *broker) handleProvisioningError(
 		)
 	}
 	instance.StatusReason = ret.Error()
+	// Remember where we left off so the operation can later be resumed from
+	// this step instead of starting over
+	instance.FailedStep = stepName
+	// Only a message a module has explicitly deemed suitable for end users is
+	// ever exposed to platforms
+	instance.StatusDescription, _ = service.GetUserFacingMessage(e)
 	if err := b.store.WriteInstance(instance); err != nil {
 		log.WithFields(log.Fields{
 			"instanceID":       instance.InstanceID,
@@ -190,5 +278,10 @@ func (b *broker) handleProvisioningError(
 			"persistenceError": err,
 		}).Fatal("error persisting instance with updated status")
 	}
+	b.events().SendInstanceEvent(
+		ctx,
+		lifecycle.EventTypeInstanceProvisioningFailed,
+		instance,
+	)
 	return ret
 }
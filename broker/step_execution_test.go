@@ -0,0 +1,87 @@
+package broker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/services/fake"
+	"github.com/deis/async"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteProvisioningStepSkipsCompletedStep(t *testing.T) {
+	b, err := getTestBrokerWithStore()
+	assert.Nil(t, err)
+	instanceID := uuid.NewV4().String()
+	err = b.store.WriteInstance(service.Instance{
+		InstanceID: instanceID,
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Status:     service.InstanceStateProvisioning,
+	})
+	assert.Nil(t, err)
+	task := async.NewTask(
+		"executeProvisioningStep",
+		map[string]string{
+			"stepName":   "run",
+			"instanceID": instanceID,
+		},
+	)
+	_, err = b.executeProvisioningStep(context.Background(), task)
+	assert.Nil(t, err)
+	instance, ok, err := b.store.GetInstance(instanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, service.InstanceStateProvisioned, instance.Status)
+	assert.True(t, service.IsStepCompleted(instance, "run"))
+	execution := instance.StepExecutions["run"]
+	// Redeliver the same task
+	tasks, err := b.executeProvisioningStep(context.Background(), task)
+	assert.Nil(t, err)
+	assert.Empty(t, tasks)
+	instance, _, err = b.store.GetInstance(instanceID)
+	assert.Nil(t, err)
+	assert.Equal(t, execution, instance.StepExecutions["run"])
+}
+
+func TestExecuteProvisioningStepRedeliveredAfterDeadline(t *testing.T) {
+	b, err := getTestBrokerWithStore()
+	assert.Nil(t, err)
+	instanceID := uuid.NewV4().String()
+	deadline := time.Now().Add(time.Hour)
+	err = b.store.WriteInstance(service.Instance{
+		InstanceID:        instanceID,
+		ServiceID:         fake.ServiceID,
+		PlanID:            fake.StandardPlanID,
+		Status:            service.InstanceStateProvisioning,
+		OperationDeadline: &deadline,
+	})
+	assert.Nil(t, err)
+	task := async.NewTask(
+		"executeProvisioningStep",
+		map[string]string{
+			"stepName":   "run",
+			"instanceID": instanceID,
+		},
+	)
+	_, err = b.executeProvisioningStep(context.Background(), task)
+	assert.Nil(t, err)
+	instance, _, err := b.store.GetInstance(instanceID)
+	assert.Nil(t, err)
+	assert.Equal(t, service.InstanceStateProvisioned, instance.Status)
+	// The deadline no longer applies once the operation has completed
+	assert.Nil(t, instance.OperationDeadline)
+	// Even if it were still recorded, redelivering the task after the deadline
+	// must not fail an instance that was provisioned successfully
+	deadline = time.Now().Add(-time.Hour)
+	instance.OperationDeadline = &deadline
+	assert.Nil(t, b.store.WriteInstance(instance))
+	_, err = b.executeProvisioningStep(context.Background(), task)
+	assert.Nil(t, err)
+	instance, _, err = b.store.GetInstance(instanceID)
+	assert.Nil(t, err)
+	assert.Equal(t, service.InstanceStateProvisioned, instance.Status)
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/barpilot/gosba/lifecycle"
 	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/usage"
 	"github.com/deis/async"
 	log "github.com/sirupsen/logrus"
 )
@@ -28,6 +31,7 @@ func (b *broker) executeUpdatingStep(
 	instance, ok, err := b.store.GetInstance(instanceID)
 	if err != nil {
 		return nil, b.handleUpdatingError(
+			ctx,
 			instanceID,
 			stepName,
 			err,
@@ -36,6 +40,7 @@ func (b *broker) executeUpdatingStep(
 	}
 	if !ok {
 		return nil, b.handleUpdatingError(
+			ctx,
 			instanceID,
 			stepName,
 			nil,
@@ -60,6 +65,7 @@ func (b *broker) executeUpdatingStep(
 	instanceCopy, _, err := b.store.GetInstance(instanceID)
 	if err != nil {
 		return nil, b.handleProvisioningError(
+			ctx,
 			instanceID,
 			stepName,
 			err,
@@ -70,6 +76,7 @@ func (b *broker) executeUpdatingStep(
 	updater, err := serviceManager.GetUpdater(instance.Plan)
 	if err != nil {
 		return nil, b.handleUpdatingError(
+			ctx,
 			instance,
 			stepName,
 			err,
@@ -82,15 +89,67 @@ func (b *broker) executeUpdatingStep(
 	step, ok := updater.GetStep(stepName)
 	if !ok {
 		return nil, b.handleUpdatingError(
+			ctx,
 			instance,
 			stepName,
 			nil,
 			`updater does not know how to process step "%s"`,
 		)
 	}
+	// If this task was redelivered after the step had already completed, the
+	// step must not be executed again
+	if service.IsStepCompleted(instance, stepName) {
+		log.WithFields(log.Fields{
+			"step":       stepName,
+			"instanceID": instanceID,
+		}).Debug("updating step already completed; skipping")
+		nextStepName, ok := updater.GetNextStepName(stepName)
+		if !ok || instance.LastCompletedStep != stepName {
+			return nil, nil
+		}
+		return []async.Task{
+			async.NewTask(
+				"executeUpdatingStep",
+				map[string]string{
+					"stepName":   nextStepName,
+					"instanceID": instanceID,
+				},
+			),
+		}, nil
+	}
+	// The operation's deadline is only enforced while the operation is still
+	// in progress. Tasks redelivered after a step, or the whole operation, has
+	// completed were dealt with above and must not fail the instance.
+	if instance.Status == service.InstanceStateUpdating &&
+		instance.OperationDeadline != nil &&
+		time.Now().After(*instance.OperationDeadline) {
+		return nil, b.handleUpdatingError(
+			ctx,
+			instance,
+			stepName,
+			nil,
+			"operation did not complete within the plan's maximum polling duration",
+		)
+	}
+	// Record that the step has started before handing off to the module so
+	// that, should the step be attempted again, the same idempotency key is
+	// used
+	execution := service.StartStepExecution(&instanceCopy, stepName)
+	instance.StepExecutions = instanceCopy.StepExecutions
+	if err = b.store.WriteInstance(instanceCopy); err != nil {
+		return nil, b.handleUpdatingError(
+			ctx,
+			instance,
+			stepName,
+			err,
+			"error persisting step execution",
+		)
+	}
+	ctx = service.WithIdempotencyKey(ctx, execution.IdempotencyKey)
 	updatedDetails, err := step.Execute(ctx, instance)
 	if err != nil {
 		return nil, b.handleUpdatingError(
+			ctx,
 			instance,
 			stepName,
 			err,
@@ -98,9 +157,22 @@ func (b *broker) executeUpdatingStep(
 		)
 	}
 	instanceCopy.Details = updatedDetails
+	err = service.CompleteStepExecution(&instanceCopy, stepName, updatedDetails)
+	if err != nil {
+		return nil, b.handleUpdatingError(
+			ctx,
+			instance,
+			stepName,
+			err,
+			"error recording completion of step",
+		)
+	}
+	instanceCopy.LastCompletedStep = step.GetName()
+	instanceCopy.FailedStep = ""
 	if nextStepName, ok := updater.GetNextStepName(step.GetName()); ok {
 		if err = b.store.WriteInstance(instanceCopy); err != nil {
 			return nil, b.handleUpdatingError(
+				ctx,
 				instanceCopy,
 				stepName,
 				err,
@@ -119,20 +191,33 @@ func (b *broker) executeUpdatingStep(
 	}
 	// No next step-- we're done updating!
 	instanceCopy.Status = service.InstanceStateProvisioned
+	instanceCopy.OperationDeadline = nil
 	// Set Provision Parameters to the values of Updating Parameters.
 	// No need to merge here, as it was done in the API surface before
 	// the update kicked off
 	instanceCopy.ProvisioningParameters = instanceCopy.UpdatingParameters
 	// Clear the Updating Parameters
 	instanceCopy.UpdatingParameters = nil
+	previousPlanID := instanceCopy.PreviousPlanID
+	instanceCopy.PreviousPlanID = ""
 	if err = b.store.WriteInstance(instanceCopy); err != nil {
 		return nil, b.handleUpdatingError(
+			ctx,
 			instanceCopy,
 			stepName,
 			err,
 			"error persisting instance",
 		)
 	}
+	b.events().SendInstanceEvent(
+		ctx,
+		lifecycle.EventTypeInstanceUpdated,
+		instanceCopy,
+	)
+	if previousPlanID != "" {
+		instanceCopy.PreviousPlanID = previousPlanID
+		return b.getUsageTasks(usage.EventTypePlanChanged, instanceCopy), nil
+	}
 	return nil, nil
 }
 
@@ -144,6 +229,7 @@ func (b *broker) executeUpdatingStep(
 // returned by the caller of this function. If an instanceID is passed in
 // (instead of an instance), only error formatting is handled.
 func (b *broker) handleUpdatingError(
+	ctx context.Context,
 	instanceOrInstanceID interface{},
 	stepName string,
 	e error,
@@ -188,6 +274,12 @@ func (b *broker) handleUpdatingError(
 		)
 	}
 	instance.StatusReason = ret.Error()
+	// Remember where we left off so the operation can later be resumed from
+	// this step instead of starting over
+	instance.FailedStep = stepName
+	// Only a message a module has explicitly deemed suitable for end users is
+	// ever exposed to platforms
+	instance.StatusDescription, _ = service.GetUserFacingMessage(e)
 	if err := b.store.WriteInstance(instance); err != nil {
 		log.WithFields(log.Fields{
 			"instanceID":       instance.InstanceID,
@@ -196,5 +288,10 @@ func (b *broker) handleUpdatingError(
 			"persistenceError": err,
 		}).Fatal("error persisting instance with updated status")
 	}
+	b.events().SendInstanceEvent(
+		ctx,
+		lifecycle.EventTypeInstanceUpdatingFailed,
+		instance,
+	)
 	return ret
 }
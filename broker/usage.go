@@ -0,0 +1,116 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/usage"
+	"github.com/barpilot/gosba/wait"
+	"github.com/deis/async"
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// getUsageTasks returns a task that reports a usage event describing the
+// given instance to the configured usage reporter, if any. Events are reported
+// by an async job so that an event the reporter fails to accept is retried
+// rather than lost. Events awaiting a retry are only as durable as the tasks
+// of the async engine.
+func (b *broker) getUsageTasks(
+	eventType usage.EventType,
+	instance service.Instance,
+) []async.Task {
+	if b.config.UsageReporter == nil {
+		return nil
+	}
+	now := time.Now()
+	event := usage.Event{
+		ID:             uuid.NewV4().String(),
+		Type:           eventType,
+		Timestamp:      now,
+		Tenant:         b.tenantName,
+		InstanceID:     instance.InstanceID,
+		ServiceID:      instance.ServiceID,
+		PlanID:         instance.PlanID,
+		PreviousPlanID: instance.PreviousPlanID,
+	}
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"eventType":  eventType,
+			"instanceID": instance.InstanceID,
+			"error":      err,
+		}).Error("error marshaling usage event")
+		return nil
+	}
+	args := map[string]string{
+		"event": string(eventJSON),
+	}
+	if deadline := b.config.UsageRetry.GetDeadline(now); deadline != nil {
+		args["deadline"] = deadline.Format(time.RFC3339Nano)
+	}
+	return []async.Task{async.NewTask("reportUsage", args)}
+}
+
+// reportUsage relays the usage event carried by the given task to the
+// configured usage reporter. If that fails, the task is retried after an
+// interval determined by the UsageRetry policy, until the reporter accepts
+// the event or the policy's MaxWait has elapsed.
+func (b *broker) reportUsage(
+	ctx context.Context,
+	task async.Task,
+) ([]async.Task, error) {
+	if b.config.UsageReporter == nil {
+		return nil, nil
+	}
+	args := task.GetArgs()
+	event := usage.Event{}
+	if err := json.Unmarshal([]byte(args["event"]), &event); err != nil {
+		return nil, fmt.Errorf(
+			`error unmarshaling usage event of task "%s": %s`,
+			task.GetID(),
+			err,
+		)
+	}
+	err := b.config.UsageReporter.Report(ctx, event)
+	if err == nil {
+		return nil, nil
+	}
+	check := wait.GetCheck(task)
+	logFields := log.Fields{
+		"eventID":    event.ID,
+		"eventType":  event.Type,
+		"instanceID": event.InstanceID,
+		"attempt":    check + 1,
+		"error":      err,
+	}
+	deadline, hasDeadline := args["deadline"]
+	if hasDeadline {
+		t, err := time.Parse(time.RFC3339Nano, deadline)
+		if err == nil && time.Now().After(t) {
+			log.WithFields(logFields).Error(
+				"error reporting usage event; giving up",
+			)
+			return nil, nil
+		}
+	}
+	log.WithFields(logFields).Warn("error reporting usage event; will retry")
+	retryArgs := map[string]string{
+		"event": args["event"],
+		"check": strconv.Itoa(check + 1),
+	}
+	if hasDeadline {
+		retryArgs["deadline"] = deadline
+	}
+	return []async.Task{
+		async.NewDelayedTask(
+			"reportUsage",
+			retryArgs,
+			b.config.UsageRetry.GetInterval(check),
+		),
+	}, nil
+}
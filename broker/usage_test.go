@@ -0,0 +1,214 @@
+package broker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/services/fake"
+	"github.com/barpilot/gosba/usage"
+	"github.com/barpilot/gosba/wait"
+	"github.com/deis/async"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsageIsReportedThroughoutInstanceLifecycle(t *testing.T) {
+	b, err := getTestBrokerWithStore()
+	assert.Nil(t, err)
+	events := []usage.Event{}
+	b.config.UsageReporter = usage.ReporterFunc(
+		func(_ context.Context, event usage.Event) error {
+			events = append(events, event)
+			return nil
+		},
+	)
+	instanceID := uuid.NewV4().String()
+	err = b.store.WriteInstance(service.Instance{
+		InstanceID: instanceID,
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Status:     service.InstanceStateProvisioning,
+	})
+	assert.Nil(t, err)
+	tasks, err := b.executeProvisioningStep(
+		context.Background(),
+		getTestStepTask("executeProvisioningStep", instanceID),
+	)
+	assert.Nil(t, err)
+	executeTestUsageTasks(t, b, tasks)
+
+	// An update that doesn't change plans shouldn't be reported
+	instance, _, err := b.store.GetInstance(instanceID)
+	assert.Nil(t, err)
+	instance.Status = service.InstanceStateUpdating
+	instance.StepExecutions = nil
+	err = b.store.WriteInstance(instance)
+	assert.Nil(t, err)
+	tasks, err = b.executeUpdatingStep(
+		context.Background(),
+		getTestStepTask("executeUpdatingStep", instanceID),
+	)
+	assert.Nil(t, err)
+	executeTestUsageTasks(t, b, tasks)
+
+	// An update that does change plans should be reported
+	previousPlanID := uuid.NewV4().String()
+	instance, _, err = b.store.GetInstance(instanceID)
+	assert.Nil(t, err)
+	instance.Status = service.InstanceStateUpdating
+	instance.PreviousPlanID = previousPlanID
+	instance.StepExecutions = nil
+	err = b.store.WriteInstance(instance)
+	assert.Nil(t, err)
+	tasks, err = b.executeUpdatingStep(
+		context.Background(),
+		getTestStepTask("executeUpdatingStep", instanceID),
+	)
+	assert.Nil(t, err)
+	executeTestUsageTasks(t, b, tasks)
+	instance, _, err = b.store.GetInstance(instanceID)
+	assert.Nil(t, err)
+	assert.Empty(t, instance.PreviousPlanID)
+
+	instance.Status = service.InstanceStateDeprovisioning
+	instance.StepExecutions = nil
+	err = b.store.WriteInstance(instance)
+	assert.Nil(t, err)
+	tasks, err = b.executeDeprovisioningStep(
+		context.Background(),
+		getTestStepTask("executeDeprovisioningStep", instanceID),
+	)
+	assert.Nil(t, err)
+	executeTestUsageTasks(t, b, tasks)
+
+	assert.Equal(t, 3, len(events))
+	for i, eventType := range []usage.EventType{
+		usage.EventTypeInstanceCreated,
+		usage.EventTypePlanChanged,
+		usage.EventTypeInstanceDeleted,
+	} {
+		if i >= len(events) {
+			break
+		}
+		assert.Equal(t, eventType, events[i].Type)
+		assert.Equal(t, instanceID, events[i].InstanceID)
+		assert.Equal(t, fake.ServiceID, events[i].ServiceID)
+		assert.Equal(t, fake.StandardPlanID, events[i].PlanID)
+		assert.False(t, events[i].Timestamp.IsZero())
+	}
+	if len(events) == 3 {
+		assert.Empty(t, events[0].PreviousPlanID)
+		assert.Equal(t, previousPlanID, events[1].PreviousPlanID)
+		assert.Empty(t, events[2].PreviousPlanID)
+	}
+}
+
+func TestUsageIsNotReportedForInstancesThatFailedToProvision(t *testing.T) {
+	b, err := getTestBrokerWithStore()
+	assert.Nil(t, err)
+	events := []usage.Event{}
+	b.config.UsageReporter = usage.ReporterFunc(
+		func(_ context.Context, event usage.Event) error {
+			events = append(events, event)
+			return nil
+		},
+	)
+	instanceID := uuid.NewV4().String()
+	instance := service.Instance{
+		InstanceID: instanceID,
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Status:     service.InstanceStateProvisioning,
+	}
+	err = b.store.WriteInstance(instance)
+	assert.Nil(t, err)
+	err = b.handleProvisioningError(
+		context.Background(),
+		instance,
+		"run",
+		errSome,
+		"error executing provisioning step",
+	)
+	assert.NotNil(t, err)
+	instance, _, err = b.store.GetInstance(instanceID)
+	assert.Nil(t, err)
+	assert.True(t, instance.ProvisioningFailed)
+
+	instance.Status = service.InstanceStateDeprovisioning
+	err = b.store.WriteInstance(instance)
+	assert.Nil(t, err)
+	tasks, err := b.executeDeprovisioningStep(
+		context.Background(),
+		getTestStepTask("executeDeprovisioningStep", instanceID),
+	)
+	assert.Nil(t, err)
+	executeTestUsageTasks(t, b, tasks)
+	_, ok, err := b.store.GetInstance(instanceID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Empty(t, events)
+}
+
+func TestUsageReportingIsRetriedUntilDeadline(t *testing.T) {
+	b, err := getTestBrokerWithStore()
+	assert.Nil(t, err)
+	attempts := 0
+	b.config.UsageReporter = usage.ReporterFunc(
+		func(context.Context, usage.Event) error {
+			attempts++
+			return errSome
+		},
+	)
+	b.config.UsageRetry.MaxWait = time.Hour
+	tasks := b.getUsageTasks(
+		usage.EventTypeInstanceCreated,
+		service.Instance{InstanceID: uuid.NewV4().String()},
+	)
+	assert.Equal(t, 1, len(tasks))
+	task := tasks[0]
+	for check := 1; check <= 3; check++ {
+		tasks, err = b.reportUsage(context.Background(), task)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(tasks))
+		retryTask := tasks[0]
+		assert.Equal(t, "reportUsage", retryTask.GetJobName())
+		assert.Equal(t, check, wait.GetCheck(retryTask))
+		assert.Equal(t, task.GetArgs()["event"], retryTask.GetArgs()["event"])
+		assert.NotNil(t, retryTask.GetExecuteTime())
+		task = retryTask
+	}
+	assert.Equal(t, 3, attempts)
+
+	// Once the deadline has passed, reporting should be abandoned
+	task.GetArgs()["deadline"] =
+		time.Now().Add(-time.Minute).Format(time.RFC3339Nano)
+	tasks, err = b.reportUsage(context.Background(), task)
+	assert.Nil(t, err)
+	assert.Empty(t, tasks)
+	assert.Equal(t, 4, attempts)
+}
+
+// executeTestUsageTasks executes, in order, the usage reporting tasks among
+// the given tasks
+func executeTestUsageTasks(t *testing.T, b *broker, tasks []async.Task) {
+	for _, task := range tasks {
+		if task.GetJobName() != "reportUsage" {
+			continue
+		}
+		retryTasks, err := b.reportUsage(context.Background(), task)
+		assert.Nil(t, err)
+		assert.Empty(t, retryTasks)
+	}
+}
+
+func getTestStepTask(jobName string, instanceID string) async.Task {
+	return async.NewTask(
+		jobName,
+		map[string]string{
+			"stepName":   "run",
+			"instanceID": instanceID,
+		},
+	)
+}
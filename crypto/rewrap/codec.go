@@ -0,0 +1,29 @@
+package rewrap
+
+import "github.com/barpilot/gosba/crypto"
+
+type codec struct {
+	decrypter crypto.Codec
+	encrypter crypto.Codec
+}
+
+// NewCodec returns a new implementation of crypto.Codec that decrypts using
+// one codec and encrypts using another. Installed as the global codec, it
+// re-wraps secure values while records are copied from a store written using
+// the decrypting codec into a store that is to be read using the encrypting
+// codec. Since the global codec can only be initialized once, it should only
+// be installed by a process dedicated to such a migration.
+func NewCodec(decrypter crypto.Codec, encrypter crypto.Codec) crypto.Codec {
+	return &codec{
+		decrypter: decrypter,
+		encrypter: encrypter,
+	}
+}
+
+func (c *codec) Encrypt(plaintext []byte) ([]byte, error) {
+	return c.encrypter.Encrypt(plaintext)
+}
+
+func (c *codec) Decrypt(ciphertext []byte) ([]byte, error) {
+	return c.decrypter.Decrypt(ciphertext)
+}
@@ -0,0 +1,28 @@
+package rewrap
+
+import (
+	"testing"
+
+	"github.com/barpilot/gosba/crypto/aes256"
+	"github.com/barpilot/gosba/crypto/noop"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodecRewrapsValues(t *testing.T) {
+	aesCodec, err := aes256.NewCodec(
+		aes256.Config{
+			Key: "AES256Key-32Characters1234567890",
+		},
+	)
+	assert.Nil(t, err)
+	testCodec := NewCodec(noop.NewCodec(), aesCodec)
+	plaintext, err := testCodec.Decrypt([]byte("foo"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("foo"), plaintext)
+	ciphertext, err := testCodec.Encrypt(plaintext)
+	assert.Nil(t, err)
+	assert.NotEqual(t, plaintext, ciphertext)
+	plaintext, err = aesCodec.Decrypt(ciphertext)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("foo"), plaintext)
+}
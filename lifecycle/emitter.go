@@ -0,0 +1,58 @@
+package lifecycle
+
+import (
+	"context"
+
+	"github.com/barpilot/gosba/service"
+)
+
+// Emitter relays events describing the instances and bindings of a single
+// tenant to a sink. Events are discarded if the sink is nil. Both the API
+// server and the broker's async jobs use an Emitter so that the events they
+// send are indistinguishable from one another.
+type Emitter struct {
+	Sink Sink
+	// Tenant is the name of the tenant the events belong to. It is empty
+	// unless the broker serves multiple tenants.
+	Tenant string
+}
+
+// SendInstanceEvent relays an event describing the given instance
+func (e Emitter) SendInstanceEvent(
+	ctx context.Context,
+	eventType EventType,
+	instance service.Instance,
+) {
+	if e.Sink == nil {
+		return
+	}
+	event := NewInstanceEvent(eventType, instance)
+	event.Tenant = e.Tenant
+	Send(ctx, e.Sink, event)
+}
+
+// SendInstanceStatusEvent relays an event describing the given instance's
+// transition to its current status. Nothing is sent if no event type
+// corresponds to that status.
+func (e Emitter) SendInstanceStatusEvent(
+	ctx context.Context,
+	instance service.Instance,
+) {
+	if eventType, ok := GetInstanceEventType(instance.Status); ok {
+		e.SendInstanceEvent(ctx, eventType, instance)
+	}
+}
+
+// SendBindingEvent relays an event describing the given binding
+func (e Emitter) SendBindingEvent(
+	ctx context.Context,
+	eventType EventType,
+	binding service.Binding,
+) {
+	if e.Sink == nil {
+		return
+	}
+	event := NewBindingEvent(eventType, binding)
+	event.Tenant = e.Tenant
+	Send(ctx, e.Sink, event)
+}
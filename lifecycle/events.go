@@ -0,0 +1,180 @@
+package lifecycle
+
+import (
+	"time"
+
+	"github.com/barpilot/gosba/service"
+	uuid "github.com/satori/go.uuid"
+)
+
+// EventType represents the kind of state transition an Event describes
+type EventType string
+
+const (
+	// EventTypeInstanceProvisioningDeferred indicates provisioning of an
+	// instance was requested, but deferred until its parent is provisioned
+	EventTypeInstanceProvisioningDeferred EventType = "instance.provisioning_deferred" // nolint: lll
+	// EventTypeInstanceProvisioning indicates provisioning of an instance began
+	// (or resumed)
+	EventTypeInstanceProvisioning EventType = "instance.provisioning"
+	// EventTypeInstanceProvisioned indicates an instance finished provisioning
+	EventTypeInstanceProvisioned EventType = "instance.provisioned"
+	// EventTypeInstanceProvisioningFailed indicates provisioning of an instance
+	// failed
+	EventTypeInstanceProvisioningFailed EventType = "instance.provisioning_failed" // nolint: lll
+	// EventTypeInstanceUpdating indicates updating of an instance began (or
+	// resumed)
+	EventTypeInstanceUpdating EventType = "instance.updating"
+	// EventTypeInstanceUpdated indicates an instance finished updating
+	EventTypeInstanceUpdated EventType = "instance.updated"
+	// EventTypeInstanceUpdatingFailed indicates updating of an instance failed
+	EventTypeInstanceUpdatingFailed EventType = "instance.updating_failed"
+	// EventTypeInstanceDeprovisioningDeferred indicates deprovisioning of an
+	// instance was requested, but deferred until its children are
+	// deprovisioned
+	EventTypeInstanceDeprovisioningDeferred EventType = "instance.deprovisioning_deferred" // nolint: lll
+	// EventTypeInstanceDeprovisioning indicates deprovisioning of an instance
+	// began (or resumed)
+	EventTypeInstanceDeprovisioning EventType = "instance.deprovisioning"
+	// EventTypeInstanceDeprovisioningFailed indicates deprovisioning of an
+	// instance failed
+	EventTypeInstanceDeprovisioningFailed EventType = "instance.deprovisioning_failed" // nolint: lll
+	// EventTypeInstanceDeleted indicates an instance finished deprovisioning
+	// and no longer exists
+	EventTypeInstanceDeleted EventType = "instance.deleted"
+	// EventTypeBindingBound indicates a binding was created
+	EventTypeBindingBound EventType = "binding.bound"
+	// EventTypeBindingFailed indicates creation of a binding failed
+	EventTypeBindingFailed EventType = "binding.binding_failed"
+	// EventTypeBindingUnbindingFailed indicates deletion of a binding failed
+	EventTypeBindingUnbindingFailed EventType = "binding.unbinding_failed"
+	// EventTypeBindingDeleted indicates a binding was deleted
+	EventTypeBindingDeleted EventType = "binding.deleted"
+	// EventTypeInstanceStuck indicates the retention janitor found an instance
+	// that has been deferred or in the midst of an operation for longer than
+	// expected. Unlike other events, it describes the absence of a state
+	// transition, and it is sent each time the janitor finds the instance.
+	EventTypeInstanceStuck EventType = "instance.stuck"
+	// EventTypeInstancePurged indicates the retention janitor deleted an
+	// instance that failed to provision
+	EventTypeInstancePurged EventType = "instance.purged"
+	// EventTypeInstanceArchived indicates the retention janitor archived, then
+	// deleted an instance that failed to provision
+	EventTypeInstanceArchived EventType = "instance.archived"
+	// EventTypeBindingPurged indicates the retention janitor deleted a binding
+	// that failed to bind
+	EventTypeBindingPurged EventType = "binding.purged"
+	// EventTypeBindingArchived indicates the retention janitor archived, then
+	// deleted a binding that failed to bind
+	EventTypeBindingArchived EventType = "binding.archived"
+)
+
+var instanceEventTypesByStatus = map[string]EventType{
+	service.InstanceStateProvisioningDeferred:   EventTypeInstanceProvisioningDeferred, // nolint: lll
+	service.InstanceStateProvisioning:           EventTypeInstanceProvisioning,
+	service.InstanceStateProvisioned:            EventTypeInstanceProvisioned,
+	service.InstanceStateProvisioningFailed:     EventTypeInstanceProvisioningFailed, // nolint: lll
+	service.InstanceStateUpdating:               EventTypeInstanceUpdating,
+	service.InstanceStateUpdatingFailed:         EventTypeInstanceUpdatingFailed,
+	service.InstanceStateDeprovisioningDeferred: EventTypeInstanceDeprovisioningDeferred, // nolint: lll
+	service.InstanceStateDeprovisioning:         EventTypeInstanceDeprovisioning,
+	service.InstanceStateDeprovisioningFailed:   EventTypeInstanceDeprovisioningFailed, // nolint: lll
+}
+
+// GetInstanceEventType returns the type of event that describes an
+// instance's transition to the given status. Note that an instance that
+// finishes updating returns to the provisioned status, so
+// EventTypeInstanceUpdated must be used explicitly where applicable.
+func GetInstanceEventType(status string) (EventType, bool) {
+	eventType, ok := instanceEventTypesByStatus[status]
+	return eventType, ok
+}
+
+// Event describes a state transition of an instance or binding. Exactly one
+// of Instance and Binding is set.
+type Event struct {
+	// ID uniquely identifies the event so that consumers can recognize events
+	// that are delivered more than once
+	ID        string    `json:"id"`
+	Type      EventType `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	// Tenant is the name of the tenant the instance or binding belongs to. It
+	// is only set by brokers that serve multiple tenants.
+	Tenant   string    `json:"tenant,omitempty"`
+	Instance *Instance `json:"instance,omitempty"`
+	Binding  *Binding  `json:"binding,omitempty"`
+}
+
+// Instance is a snapshot of an instance, as of the time of an event. The
+// values of secure parameters are redacted.
+type Instance struct {
+	InstanceID             string                 `json:"instanceId"`
+	Alias                  string                 `json:"alias,omitempty"`
+	ParentAlias            string                 `json:"parentAlias,omitempty"`
+	ServiceID              string                 `json:"serviceId"`
+	PlanID                 string                 `json:"planId"`
+	Status                 string                 `json:"status"`
+	StatusReason           string                 `json:"statusReason,omitempty"`
+	ProvisioningParameters map[string]interface{} `json:"provisioningParameters,omitempty"` // nolint: lll
+	UpdatingParameters     map[string]interface{} `json:"updatingParameters,omitempty"`     // nolint: lll
+}
+
+// Binding is a snapshot of a binding, as of the time of an event. The values
+// of secure parameters are redacted.
+type Binding struct {
+	BindingID    string                 `json:"bindingId"`
+	InstanceID   string                 `json:"instanceId"`
+	ServiceID    string                 `json:"serviceId"`
+	Status       string                 `json:"status"`
+	StatusReason string                 `json:"statusReason,omitempty"`
+	Parameters   map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// NewInstanceEvent returns a new Event of the given type describing the given
+// instance
+func NewInstanceEvent(eventType EventType, instance service.Instance) Event {
+	i := &Instance{
+		InstanceID:   instance.InstanceID,
+		Alias:        instance.Alias,
+		ParentAlias:  instance.ParentAlias,
+		ServiceID:    instance.ServiceID,
+		PlanID:       instance.PlanID,
+		Status:       instance.Status,
+		StatusReason: instance.StatusReason,
+	}
+	if instance.ProvisioningParameters != nil {
+		i.ProvisioningParameters = instance.ProvisioningParameters.Redacted()
+	}
+	if instance.UpdatingParameters != nil {
+		i.UpdatingParameters = instance.UpdatingParameters.Redacted()
+	}
+	event := newEvent(eventType)
+	event.Instance = i
+	return event
+}
+
+// NewBindingEvent returns a new Event of the given type describing the given
+// binding
+func NewBindingEvent(eventType EventType, binding service.Binding) Event {
+	b := &Binding{
+		BindingID:    binding.BindingID,
+		InstanceID:   binding.InstanceID,
+		ServiceID:    binding.ServiceID,
+		Status:       binding.Status,
+		StatusReason: binding.StatusReason,
+	}
+	if binding.BindingParameters != nil {
+		b.Parameters = binding.BindingParameters.Redacted()
+	}
+	event := newEvent(eventType)
+	event.Binding = b
+	return event
+}
+
+func newEvent(eventType EventType) Event {
+	return Event{
+		ID:        uuid.NewV4().String(),
+		Type:      eventType,
+		Timestamp: time.Now(),
+	}
+}
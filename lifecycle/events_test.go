@@ -0,0 +1,101 @@
+package lifecycle
+
+import (
+	"testing"
+
+	"github.com/barpilot/gosba/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewInstanceEventRedactsSecureParameters(t *testing.T) {
+	schema := &service.InputParametersSchema{
+		SecureProperties: []string{"password"},
+		PropertySchemas: map[string]service.PropertySchema{
+			"location": &service.StringPropertySchema{},
+			"password": &service.StringPropertySchema{},
+		},
+	}
+	event := NewInstanceEvent(
+		EventTypeInstanceProvisioning,
+		service.Instance{
+			InstanceID: "foo",
+			ServiceID:  "bar",
+			PlanID:     "bat",
+			Status:     service.InstanceStateProvisioning,
+			ProvisioningParameters: &service.ProvisioningParameters{
+				Parameters: service.Parameters{
+					Schema: schema,
+					Data: map[string]interface{}{
+						"location": "eastus",
+						"password": "secret",
+					},
+				},
+			},
+		},
+	)
+	assert.NotEmpty(t, event.ID)
+	assert.Equal(t, EventTypeInstanceProvisioning, event.Type)
+	assert.False(t, event.Timestamp.IsZero())
+	assert.Nil(t, event.Binding)
+	assert.Equal(
+		t,
+		&Instance{
+			InstanceID: "foo",
+			ServiceID:  "bar",
+			PlanID:     "bat",
+			Status:     service.InstanceStateProvisioning,
+			ProvisioningParameters: map[string]interface{}{
+				"location": "eastus",
+				"password": service.RedactedValue,
+			},
+		},
+		event.Instance,
+	)
+}
+
+func TestNewBindingEventRedactsSecureParameters(t *testing.T) {
+	event := NewBindingEvent(
+		EventTypeBindingBound,
+		service.Binding{
+			BindingID:  "foo",
+			InstanceID: "bar",
+			ServiceID:  "bat",
+			Status:     service.BindingStateBound,
+			BindingParameters: &service.BindingParameters{
+				Parameters: service.Parameters{
+					Schema: &service.InputParametersSchema{
+						SecureProperties: []string{"token"},
+						PropertySchemas: map[string]service.PropertySchema{
+							"token": &service.StringPropertySchema{},
+						},
+					},
+					Data: map[string]interface{}{
+						"token": "secret",
+					},
+				},
+			},
+		},
+	)
+	assert.Nil(t, event.Instance)
+	assert.Equal(
+		t,
+		&Binding{
+			BindingID:  "foo",
+			InstanceID: "bar",
+			ServiceID:  "bat",
+			Status:     service.BindingStateBound,
+			Parameters: map[string]interface{}{
+				"token": service.RedactedValue,
+			},
+		},
+		event.Binding,
+	)
+}
+
+func TestGetInstanceEventType(t *testing.T) {
+	eventType, ok := GetInstanceEventType(service.InstanceStateUpdatingFailed)
+	assert.True(t, ok)
+	assert.Equal(t, EventTypeInstanceUpdatingFailed, eventType)
+	_, ok = GetInstanceEventType("bogus")
+	assert.False(t, ok)
+}
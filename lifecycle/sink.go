@@ -0,0 +1,93 @@
+package lifecycle
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Sink is an interface to be implemented by types that receive events
+// describing state transitions of instances and bindings
+type Sink interface {
+	// Send relays the given event. Sinks are invoked synchronously, after the
+	// state transition has been persisted, from within API handlers and async
+	// jobs, so they should not block for long. A failure to relay an event is
+	// logged, but does not cause the operation the event describes to fail.
+	Send(context.Context, Event) error
+}
+
+// SinkFunc adapts an ordinary function to the Sink interface
+type SinkFunc func(context.Context, Event) error
+
+// Send invokes the SinkFunc
+func (s SinkFunc) Send(ctx context.Context, event Event) error {
+	return s(ctx, event)
+}
+
+type channelSink struct {
+	ch chan<- Event
+}
+
+// NewChannelSink returns a Sink that relays events to in-process consumers by
+// way of the given channel. Sending blocks until the event is received or the
+// context is canceled, so consumers should read from the channel promptly or
+// use a buffered channel.
+func NewChannelSink(ch chan<- Event) Sink {
+	return &channelSink{
+		ch: ch,
+	}
+}
+
+func (c *channelSink) Send(ctx context.Context, event Event) error {
+	select {
+	case c.ch <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type multiSink struct {
+	sinks []Sink
+}
+
+// NewMultiSink returns a Sink that relays every event to each of the given
+// sinks. If any of the sinks fails, the first error encountered is returned
+// after the event has been offered to all of them.
+func NewMultiSink(sinks ...Sink) Sink {
+	return &multiSink{
+		sinks: sinks,
+	}
+}
+
+func (m *multiSink) Send(ctx context.Context, event Event) error {
+	var firstErr error
+	for _, sink := range m.sinks {
+		if err := sink.Send(ctx, event); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Send is a convenience function for relaying an event to the given sink,
+// which may be nil. Failures are logged, but are otherwise ignored.
+func Send(ctx context.Context, sink Sink, event Event) {
+	if sink == nil {
+		return
+	}
+	if err := sink.Send(ctx, event); err != nil {
+		fields := log.Fields{
+			"eventID":   event.ID,
+			"eventType": event.Type,
+			"error":     err,
+		}
+		if event.Instance != nil {
+			fields["instanceID"] = event.Instance.InstanceID
+		}
+		if event.Binding != nil {
+			fields["bindingID"] = event.Binding.BindingID
+		}
+		log.WithFields(fields).Error("error sending lifecycle event")
+	}
+}
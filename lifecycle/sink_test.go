@@ -0,0 +1,43 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelSink(t *testing.T) {
+	ch := make(chan Event, 1)
+	sink := NewChannelSink(ch)
+	event := newEvent(EventTypeBindingDeleted)
+	err := sink.Send(context.Background(), event)
+	assert.Nil(t, err)
+	assert.Equal(t, event, <-ch)
+	// Nothing is receiving, so sending blocks until the context is canceled
+	ch = make(chan Event)
+	sink = NewChannelSink(ch)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = sink.Send(ctx, event)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestMultiSinkSendsToAllSinks(t *testing.T) {
+	errSome := errors.New("an error")
+	var received []Event
+	sink := NewMultiSink(
+		SinkFunc(func(context.Context, Event) error {
+			return errSome
+		}),
+		SinkFunc(func(_ context.Context, event Event) error {
+			received = append(received, event)
+			return nil
+		}),
+	)
+	event := newEvent(EventTypeBindingDeleted)
+	err := sink.Send(context.Background(), event)
+	assert.Equal(t, errSome, err)
+	assert.Equal(t, []Event{event}, received)
+}
@@ -0,0 +1,40 @@
+package webhook
+
+import "time"
+
+// Config represents configuration options for the webhook-based implementation
+// of the lifecycle.Sink interface and for Deliverers in general
+type Config struct {
+	// URL is the endpoint to which events are POSTed
+	URL string
+	// Secret is the key used to sign each payload using HMAC-SHA256. If it is
+	// empty, payloads are not signed.
+	Secret string
+	// Timeout bounds each individual delivery attempt
+	Timeout time.Duration
+	// MaxAttempts is the maximum number of attempts made to deliver each event.
+	// If it is zero, delivery is retried until it succeeds, the consumer rejects
+	// the event, or the deliverer stops running.
+	MaxAttempts int
+	// RetryDelay is how long to wait before the first retry. The delay doubles
+	// with each subsequent retry.
+	RetryDelay time.Duration
+	// MaxRetryDelay, if non-zero, caps the delay between retries
+	MaxRetryDelay time.Duration
+	// QueueSize is the number of events that may await delivery before further
+	// events are dropped
+	QueueSize int
+}
+
+// NewConfigWithDefaults returns a Config object with default values already
+// applied. Callers are then free to set custom values for the remaining fields
+// and/or override default values.
+func NewConfigWithDefaults() Config {
+	return Config{
+		Timeout:       10 * time.Second,
+		MaxAttempts:   5,
+		RetryDelay:    time.Second,
+		MaxRetryDelay: 5 * time.Minute,
+		QueueSize:     1000,
+	}
+}
@@ -0,0 +1,167 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Delivery is a JSON-encoded event awaiting delivery to a webhook
+type Delivery struct {
+	// ID uniquely identifies the event. It is conveyed by the EventIDHeader.
+	ID string
+	// Type is conveyed by the EventTypeHeader
+	Type string
+	Body []byte
+}
+
+// Deliverer delivers events to a webhook, retrying transient failures, either
+// directly or asynchronously from a queue. It is used by the webhook-based
+// lifecycle.Sink and is exported so that other kinds of events can be
+// delivered the same way.
+type Deliverer interface {
+	// Deliver delivers the given event directly. It blocks until the event has
+	// been delivered, the consumer has rejected it, the configured maximum
+	// number of attempts has been made, or the context is canceled.
+	Deliver(context.Context, Delivery) error
+	// Enqueue queues the given delivery. It never blocks. If the queue is full,
+	// the delivery is dropped and an error is returned.
+	Enqueue(Delivery) error
+	// Run delivers queued events until the context is canceled. Events still
+	// queued at that time are not delivered.
+	Run(context.Context) error
+}
+
+type deliverer struct {
+	config     Config
+	queue      chan Delivery
+	httpClient *http.Client
+}
+
+// NewDeliverer returns a new Deliverer
+func NewDeliverer(config Config) (Deliverer, error) {
+	if config.URL == "" {
+		return nil, errors.New("webhook URL must not be empty")
+	}
+	if config.MaxAttempts < 0 {
+		return nil, errors.New("webhook max attempts must not be negative")
+	}
+	if config.RetryDelay <= 0 {
+		return nil, errors.New("webhook retry delay must be positive")
+	}
+	if config.QueueSize < 1 {
+		return nil, errors.New("webhook queue size must be at least 1")
+	}
+	return &deliverer{
+		config: config,
+		queue:  make(chan Delivery, config.QueueSize),
+		httpClient: &http.Client{
+			Timeout: config.Timeout,
+		},
+	}, nil
+}
+
+func (d *deliverer) Deliver(ctx context.Context, delivery Delivery) error {
+	return d.deliver(ctx, delivery)
+}
+
+func (d *deliverer) Enqueue(delivery Delivery) error {
+	select {
+	case d.queue <- delivery:
+		return nil
+	default:
+		return fmt.Errorf(
+			`webhook queue is full; dropped event "%s"`,
+			delivery.ID,
+		)
+	}
+}
+
+func (d *deliverer) Run(ctx context.Context) error {
+	for {
+		select {
+		case delivery := <-d.queue:
+			if err := d.deliver(ctx, delivery); err != nil {
+				log.WithFields(log.Fields{
+					"eventID":   delivery.ID,
+					"eventType": delivery.Type,
+					"error":     err,
+				}).Error("error delivering event to webhook")
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// deliver makes up to the configured maximum number of attempts to deliver
+// the given event, waiting an exponentially increasing amount of time
+// between attempts
+func (d *deliverer) deliver(ctx context.Context, delivery Delivery) error {
+	delay := d.config.RetryDelay
+	for attempt := 1; ; attempt++ {
+		retryable, err := d.post(ctx, delivery)
+		if err == nil {
+			return nil
+		}
+		if !retryable ||
+			(d.config.MaxAttempts > 0 && attempt >= d.config.MaxAttempts) {
+			return fmt.Errorf("giving up after %d attempt(s): %s", attempt, err)
+		}
+		log.WithFields(log.Fields{
+			"eventID": delivery.ID,
+			"attempt": attempt,
+			"error":   err,
+		}).Debug("error delivering event to webhook; will retry")
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+		if d.config.MaxRetryDelay > 0 && delay > d.config.MaxRetryDelay {
+			delay = d.config.MaxRetryDelay
+		}
+	}
+}
+
+// post makes a single attempt to deliver the given event. If it fails, it
+// also indicates whether the failure is transient and therefore worth
+// retrying.
+func (d *deliverer) post(ctx context.Context, delivery Delivery) (bool, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		d.config.URL,
+		bytes.NewReader(delivery.Body),
+	)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIDHeader, delivery.ID)
+	req.Header.Set(EventTypeHeader, delivery.Type)
+	if d.config.Secret != "" {
+		req.Header.Set(
+			SignatureHeader,
+			Sign([]byte(d.config.Secret), delivery.Body),
+		)
+	}
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	return resp.StatusCode >= 500 ||
+		resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode == http.StatusRequestTimeout, err
+}
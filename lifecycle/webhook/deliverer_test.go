@@ -0,0 +1,30 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDelivererRejectsInvalidConfig(t *testing.T) {
+	testCases := map[string]func(*Config){
+		"empty URL":             func(c *Config) { c.URL = "" },
+		"negative max attempts": func(c *Config) { c.MaxAttempts = -1 },
+		"zero retry delay":      func(c *Config) { c.RetryDelay = 0 },
+		"negative retry delay":  func(c *Config) { c.RetryDelay = -1 },
+		"zero queue size":       func(c *Config) { c.QueueSize = 0 },
+	}
+	for name, mutate := range testCases {
+		t.Run(name, func(t *testing.T) {
+			config := NewConfigWithDefaults()
+			config.URL = "http://example.com"
+			mutate(&config)
+			_, err := NewDeliverer(config)
+			assert.NotNil(t, err)
+		})
+	}
+	config := NewConfigWithDefaults()
+	config.URL = "http://example.com"
+	_, err := NewDeliverer(config)
+	assert.Nil(t, err)
+}
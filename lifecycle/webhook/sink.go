@@ -0,0 +1,85 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/barpilot/gosba/lifecycle"
+)
+
+const (
+	// EventIDHeader is the name of the header that carries the ID of the event
+	// being delivered. Since a delivery may be retried, consumers can use it to
+	// recognize events they have already received.
+	EventIDHeader = "X-Broker-Event-Id"
+	// EventTypeHeader is the name of the header that carries the type of the
+	// event being delivered
+	EventTypeHeader = "X-Broker-Event-Type"
+	// SignatureHeader is the name of the header that carries the payload's
+	// signature, formatted as "sha256=" followed by the hex-encoded HMAC-SHA256
+	// of the request body, keyed using the shared secret
+	SignatureHeader = "X-Broker-Signature"
+)
+
+// Sink is a lifecycle.Sink that delivers events to a webhook. Events are
+// queued when sent and delivered asynchronously by Run.
+type Sink interface {
+	lifecycle.Sink
+	// Run delivers queued events until the context is canceled. Events still
+	// queued at that time are not delivered.
+	Run(context.Context) error
+}
+
+type sink struct {
+	deliverer Deliverer
+}
+
+// NewSink returns a new webhook-based implementation of the lifecycle.Sink
+// interface
+func NewSink(config Config) (Sink, error) {
+	deliverer, err := NewDeliverer(config)
+	if err != nil {
+		return nil, err
+	}
+	return &sink{
+		deliverer: deliverer,
+	}, nil
+}
+
+// Send queues the given event for delivery. It never blocks. If the queue is
+// full, the event is dropped and an error is returned.
+func (s *sink) Send(_ context.Context, event lifecycle.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error marshaling event: %s", err)
+	}
+	return s.deliverer.Enqueue(Delivery{
+		ID:   event.ID,
+		Type: string(event.Type),
+		Body: body,
+	})
+}
+
+func (s *sink) Run(ctx context.Context) error {
+	return s.deliverer.Run(ctx)
+}
+
+// Sign returns the signature of the given payload, keyed using the given
+// secret, in the form conveyed by the SignatureHeader
+func Sign(secret []byte, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload) // nolint: errcheck
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature returns true if the given signature, in the form conveyed
+// by the SignatureHeader, is the valid signature of the given payload, keyed
+// using the given secret. Webhook consumers can use this to authenticate
+// deliveries.
+func VerifySignature(secret []byte, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, payload)), []byte(signature))
+}
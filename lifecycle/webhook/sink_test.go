@@ -0,0 +1,109 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/barpilot/gosba/lifecycle"
+	"github.com/barpilot/gosba/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSinkDeliversSignedEventsWithRetries(t *testing.T) {
+	secret := "foo"
+	var mutex sync.Mutex
+	attempts := 0
+	delivered := make(chan lifecycle.Event, 1)
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			attempts++
+			if attempts < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			body, err := ioutil.ReadAll(r.Body)
+			assert.Nil(t, err)
+			assert.True(t, VerifySignature(
+				[]byte(secret),
+				body,
+				r.Header.Get(SignatureHeader),
+			))
+			event := lifecycle.Event{}
+			assert.Nil(t, json.Unmarshal(body, &event))
+			assert.Equal(t, event.ID, r.Header.Get(EventIDHeader))
+			assert.Equal(t, string(event.Type), r.Header.Get(EventTypeHeader))
+			w.WriteHeader(http.StatusNoContent)
+			delivered <- event
+		},
+	))
+	defer svr.Close()
+	config := NewConfigWithDefaults()
+	config.URL = svr.URL
+	config.Secret = secret
+	config.RetryDelay = 10 * time.Millisecond
+	sink, err := NewSink(config)
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go sink.Run(ctx) // nolint: errcheck
+	event := lifecycle.NewInstanceEvent(
+		lifecycle.EventTypeInstanceProvisioned,
+		service.Instance{InstanceID: "bar"},
+	)
+	err = sink.Send(ctx, event)
+	assert.Nil(t, err)
+	select {
+	case deliveredEvent := <-delivered:
+		assert.Equal(t, event.ID, deliveredEvent.ID)
+		assert.Equal(t, "bar", deliveredEvent.Instance.InstanceID)
+	case <-ctx.Done():
+		assert.Fail(t, "event was never delivered")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, 3, attempts)
+}
+
+func TestSinkDoesNotRetryClientErrors(t *testing.T) {
+	attempts := 0
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.WriteHeader(http.StatusBadRequest)
+		},
+	))
+	defer svr.Close()
+	config := NewConfigWithDefaults()
+	config.URL = svr.URL
+	config.RetryDelay = time.Millisecond
+	d, err := NewDeliverer(config)
+	assert.Nil(t, err)
+	err = d.(*deliverer).deliver(
+		context.Background(),
+		Delivery{ID: "foo", Type: "bar", Body: []byte("{}")},
+	)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestSinkDropsEventsWhenQueueIsFull(t *testing.T) {
+	config := NewConfigWithDefaults()
+	config.URL = "http://example.com"
+	config.QueueSize = 1
+	sink, err := NewSink(config)
+	assert.Nil(t, err)
+	event := lifecycle.NewInstanceEvent(
+		lifecycle.EventTypeInstanceProvisioned,
+		service.Instance{},
+	)
+	assert.Nil(t, sink.Send(context.Background(), event))
+	assert.NotNil(t, sink.Send(context.Background(), event))
+}
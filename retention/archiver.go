@@ -0,0 +1,77 @@
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/barpilot/gosba/service"
+)
+
+// Archiver is an interface to be implemented by types that preserve records
+// the retention janitor removes from storage, e.g. for post-mortems
+type Archiver interface {
+	// ArchiveInstance preserves the given instance. The instance is only
+	// deleted from storage if this returns nil.
+	ArchiveInstance(context.Context, service.Instance) error
+	// ArchiveBinding preserves the given binding. The binding is only deleted
+	// from storage if this returns nil.
+	ArchiveBinding(context.Context, service.Binding) error
+}
+
+// archivedRecord is a single line written by the writer archiver. Exactly one
+// of Instance and Binding is set.
+type archivedRecord struct {
+	Instance json.RawMessage `json:"instance,omitempty"`
+	Binding  json.RawMessage `json:"binding,omitempty"`
+}
+
+type writerArchiver struct {
+	// mutex serializes writes so that lines are never interleaved
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+// NewWriterArchiver returns an Archiver that writes each record to the given
+// writer as a line of JSON of the form {"instance": ...} or
+// {"binding": ...}. Records are serialized the same way stores serialize them,
+// so secure values remain encrypted using the global codec.
+func NewWriterArchiver(w io.Writer) Archiver {
+	return &writerArchiver{
+		w: w,
+	}
+}
+
+func (w *writerArchiver) ArchiveInstance(
+	_ context.Context,
+	instance service.Instance,
+) error {
+	instanceJSON, err := instance.ToJSON()
+	if err != nil {
+		return err
+	}
+	return w.write(archivedRecord{Instance: instanceJSON})
+}
+
+func (w *writerArchiver) ArchiveBinding(
+	_ context.Context,
+	binding service.Binding,
+) error {
+	bindingJSON, err := binding.ToJSON()
+	if err != nil {
+		return err
+	}
+	return w.write(archivedRecord{Binding: bindingJSON})
+}
+
+func (w *writerArchiver) write(record archivedRecord) error {
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	_, err = w.w.Write(append(recordJSON, '\n'))
+	return err
+}
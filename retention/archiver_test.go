@@ -0,0 +1,51 @@
+package retention
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/barpilot/gosba/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriterArchiverWritesOneLinePerRecord(t *testing.T) {
+	buf := &bytes.Buffer{}
+	archiver := NewWriterArchiver(buf)
+	err := archiver.ArchiveInstance(
+		context.Background(),
+		service.Instance{
+			InstanceID: "foo",
+			Status:     service.InstanceStateProvisioningFailed,
+		},
+	)
+	assert.Nil(t, err)
+	err = archiver.ArchiveBinding(
+		context.Background(),
+		service.Binding{
+			BindingID:  "bar",
+			InstanceID: "foo",
+			Status:     service.BindingStateBindingFailed,
+		},
+	)
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Equal(t, 2, len(lines))
+	if len(lines) != 2 {
+		return
+	}
+	record := archivedRecord{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Nil(t, record.Binding)
+	instance, err := service.NewInstanceFromJSON(record.Instance, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "foo", instance.InstanceID)
+	record = archivedRecord{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &record))
+	assert.Nil(t, record.Instance)
+	binding, err := service.NewBindingFromJSON(record.Binding, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "bar", binding.BindingID)
+}
@@ -0,0 +1,112 @@
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Action represents what becomes of a record once its retention period has
+// elapsed
+type Action string
+
+const (
+	// ActionPurge deletes the record
+	ActionPurge Action = "purge"
+	// ActionArchive hands the record to the configured Archiver, then deletes
+	// it. If archiving fails, the record is retained until the next run.
+	ActionArchive Action = "archive"
+)
+
+// Policy describes how long failed records are retained and what becomes of
+// them afterwards
+type Policy struct {
+	// MaxAge is how long a failed record is retained, measured from the last
+	// activity recorded for it. Zero means failed records are retained
+	// indefinitely.
+	MaxAge time.Duration
+	Action Action
+}
+
+// Config represents configuration options for the retention janitor: a
+// periodic async job that removes records that failed long ago and reports
+// instances that appear to be stuck
+type Config struct {
+	// Interval is how often the janitor runs. Zero disables the janitor. The
+	// janitor enumerates every record in storage, so the store must implement
+	// storage.Enumerator if it is enabled. If the store also implements
+	// storage.Leaser, only one replica of the broker runs the janitor at a
+	// time.
+	Interval time.Duration
+	// FailedInstances governs instances that failed to provision. Instances
+	// whose updating or deprovisioning failed are never removed, since the
+	// resources they represent may still exist.
+	FailedInstances Policy
+	// FailedBindings governs bindings that failed to bind
+	FailedBindings Policy
+	// Archiver receives records removed under policies whose action is
+	// ActionArchive. It is required if any policy archives.
+	Archiver Archiver
+	// StuckInstanceThreshold is how long an instance may remain deferred or in
+	// the midst of an operation before the janitor reports it as stuck. Zero
+	// disables detection of stuck instances.
+	StuckInstanceThreshold time.Duration
+}
+
+// NewConfigWithDefaults returns a Config object with default values already
+// applied. Callers are then free to set custom values for the remaining fields
+// and/or override default values.
+func NewConfigWithDefaults() Config {
+	return Config{
+		FailedInstances: Policy{
+			Action: ActionPurge,
+		},
+		FailedBindings: Policy{
+			Action: ActionPurge,
+		},
+		StuckInstanceThreshold: time.Hour * 24,
+	}
+}
+
+// Validate returns an error describing the first problem found with the
+// configuration, or nil if there is none
+func (c Config) Validate() error {
+	if c.Interval < 0 {
+		return errors.New("janitor interval must not be negative")
+	}
+	if c.StuckInstanceThreshold < 0 {
+		return errors.New("stuck instance threshold must not be negative")
+	}
+	for _, p := range []struct {
+		name   string
+		policy Policy
+	}{
+		{name: "failed instances", policy: c.FailedInstances},
+		{name: "failed bindings", policy: c.FailedBindings},
+	} {
+		name, policy := p.name, p.policy
+		if policy.MaxAge < 0 {
+			return fmt.Errorf(
+				"maximum age of %s must not be negative",
+				name,
+			)
+		}
+		switch policy.Action {
+		case ActionPurge:
+		case ActionArchive:
+			if c.Archiver == nil {
+				return fmt.Errorf(
+					"an archiver is required to archive %s",
+					name,
+				)
+			}
+		default:
+			return fmt.Errorf(
+				`unknown retention action "%s" for %s`,
+				policy.Action,
+				name,
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package retention
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/barpilot/gosba/service"
+	"github.com/stretchr/testify/assert"
+)
+
+type noopArchiver struct{}
+
+func (noopArchiver) ArchiveInstance(context.Context, service.Instance) error {
+	return nil
+}
+
+func (noopArchiver) ArchiveBinding(context.Context, service.Binding) error {
+	return nil
+}
+
+func TestValidateDefaultConfig(t *testing.T) {
+	assert.Nil(t, NewConfigWithDefaults().Validate())
+}
+
+func TestValidateConfig(t *testing.T) {
+	testCases := []struct {
+		name   string
+		modify func(*Config)
+		valid  bool
+	}{
+		{
+			name: "negative interval",
+			modify: func(c *Config) {
+				c.Interval = -time.Hour
+			},
+		},
+		{
+			name: "negative stuck instance threshold",
+			modify: func(c *Config) {
+				c.StuckInstanceThreshold = -time.Hour
+			},
+		},
+		{
+			name: "negative maximum age",
+			modify: func(c *Config) {
+				c.FailedBindings.MaxAge = -time.Hour
+			},
+		},
+		{
+			name: "unknown action",
+			modify: func(c *Config) {
+				c.FailedInstances.Action = "bogus"
+			},
+		},
+		{
+			name: "archiving without an archiver",
+			modify: func(c *Config) {
+				c.FailedInstances.Action = ActionArchive
+			},
+		},
+		{
+			name: "archiving with an archiver",
+			modify: func(c *Config) {
+				c.FailedInstances.Action = ActionArchive
+				c.Archiver = noopArchiver{}
+			},
+			valid: true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			config := NewConfigWithDefaults()
+			testCase.modify(&config)
+			err := config.Validate()
+			if testCase.valid {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// Package retention describes how long the broker retains records of failed
+// operations and how it recognizes instances that appear to be stuck. The
+// broker applies these rules using a periodic async job; see
+// broker.Config.Retention.
+package retention
+
+import (
+	"strings"
+	"time"
+
+	"github.com/barpilot/gosba/service"
+)
+
+// GetLastActivity returns the time of the most recent activity recorded for
+// the given instance: its creation, the request for its current (or most
+// recent) operation, or the start or completion of any of that operation's
+// steps
+func GetLastActivity(instance service.Instance) time.Time {
+	lastActivity := instance.Created
+	latest := func(t time.Time) {
+		if t.After(lastActivity) {
+			lastActivity = t
+		}
+	}
+	if instance.OperationStarted != nil {
+		latest(*instance.OperationStarted)
+	}
+	for _, execution := range instance.StepExecutions {
+		latest(execution.Started)
+		if execution.Completed != nil {
+			latest(*execution.Completed)
+		}
+	}
+	return lastActivity
+}
+
+// IsTransitional returns a bool indicating whether the given instance status
+// is one that an instance is only expected to hold temporarily; i.e. the
+// instance is either deferred or in the midst of an operation
+func IsTransitional(status string) bool {
+	return strings.HasSuffix(status, "_DEFERRED") ||
+		strings.HasSuffix(status, "ING")
+}
+
+// IsExpired returns a bool indicating whether a failed record whose last
+// activity was at the given time has exceeded the policy's maximum age
+func (p Policy) IsExpired(lastActivity time.Time, now time.Time) bool {
+	return p.MaxAge > 0 && now.Sub(lastActivity) > p.MaxAge
+}
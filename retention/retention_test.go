@@ -0,0 +1,59 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/barpilot/gosba/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetLastActivity(t *testing.T) {
+	created := time.Now().Add(-time.Hour * 3)
+	instance := service.Instance{
+		Created: created,
+	}
+	assert.Equal(t, created, GetLastActivity(instance))
+	operationStarted := created.Add(time.Hour)
+	instance.OperationStarted = &operationStarted
+	assert.Equal(t, operationStarted, GetLastActivity(instance))
+	stepCompleted := operationStarted.Add(time.Hour)
+	instance.StepExecutions = map[string]service.StepExecution{
+		"foo": {
+			Started:   operationStarted,
+			Completed: &stepCompleted,
+		},
+		"bar": {
+			Started: operationStarted.Add(time.Minute),
+		},
+	}
+	assert.Equal(t, stepCompleted, GetLastActivity(instance))
+}
+
+func TestIsTransitional(t *testing.T) {
+	for status, transitional := range map[string]bool{
+		service.InstanceStateProvisioningDeferred:   true,
+		service.InstanceStateProvisioning:           true,
+		service.InstanceStateProvisioned:            false,
+		service.InstanceStateProvisioningFailed:     false,
+		service.InstanceStateUpdating:               true,
+		service.InstanceStateUpdatingFailed:         false,
+		service.InstanceStateDeprovisioningDeferred: true,
+		service.InstanceStateDeprovisioning:         true,
+		service.InstanceStateDeprovisioningFailed:   false,
+	} {
+		assert.Equal(t, transitional, IsTransitional(status), status)
+	}
+}
+
+func TestPolicyIsExpired(t *testing.T) {
+	now := time.Now()
+	policy := Policy{
+		MaxAge: time.Hour,
+	}
+	assert.False(t, policy.IsExpired(now.Add(-time.Minute), now))
+	assert.True(t, policy.IsExpired(now.Add(-time.Hour*2), now))
+	// Records are retained indefinitely if there is no maximum age
+	policy.MaxAge = 0
+	assert.False(t, policy.IsExpired(now.Add(-time.Hour*24*365), now))
+}
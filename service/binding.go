@@ -3,10 +3,15 @@ package service
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/barpilot/gosba/crypto"
 )
 
 // Binding represents a binding to a service
 type Binding struct {
+	// FormatVersion is the format version the binding was persisted in. It is
+	// always the latest format version once the binding has been unmarshaled.
+	FormatVersion     int                `json:"formatVersion"`
 	BindingID         string             `json:"bindingId"`
 	InstanceID        string             `json:"instanceId"`
 	ServiceID         string             `json:"serviceId"`
@@ -23,6 +28,24 @@ func NewBindingFromJSON(
 	jsonBytes []byte,
 	emptyBindingDetails BindingDetails,
 	schema *InputParametersSchema, // nolint: interfacer
+) (Binding, error) {
+	return NewBindingFromJSONWithCodec(
+		jsonBytes,
+		emptyBindingDetails,
+		schema,
+		nil,
+	)
+}
+
+// NewBindingFromJSONWithCodec returns a new Binding unmarshalled from the
+// provided JSON []byte, decrypting secure values using the given codec
+// instead of the globally configured one. If the codec is nil, the globally
+// configured codec is used.
+func NewBindingFromJSONWithCodec(
+	jsonBytes []byte,
+	emptyBindingDetails BindingDetails,
+	schema *InputParametersSchema, // nolint: interfacer
+	codec crypto.Codec,
 ) (Binding, error) {
 	binding := Binding{
 		Details: emptyBindingDetails,
@@ -32,11 +55,33 @@ func NewBindingFromJSON(
 			},
 		},
 	}
-	err := json.Unmarshal(jsonBytes, &binding)
+	jsonBytes, err := bindingFormats.upgrade(jsonBytes)
+	if err != nil {
+		return binding, err
+	}
+	err = withCodec(codec, func() error {
+		return json.Unmarshal(jsonBytes, &binding)
+	})
+	binding.FormatVersion = bindingFormats.getLatestVersion()
 	return binding, err
 }
 
 // ToJSON returns a []byte containing a JSON representation of the instance
 func (b Binding) ToJSON() ([]byte, error) {
-	return json.Marshal(b)
+	return b.ToJSONWithCodec(nil)
+}
+
+// ToJSONWithCodec returns a []byte containing a JSON representation of the
+// binding, encrypting secure values using the given codec instead of the
+// globally configured one. If the codec is nil, the globally configured codec
+// is used.
+func (b Binding) ToJSONWithCodec(codec crypto.Codec) ([]byte, error) {
+	b.FormatVersion = bindingFormats.getLatestVersion()
+	var jsonBytes []byte
+	err := withCodec(codec, func() error {
+		var err error
+		jsonBytes, err = json.Marshal(b)
+		return err
+	})
+	return jsonBytes, err
 }
@@ -44,6 +44,7 @@ func init() {
 	}
 
 	testBinding = Binding{
+		FormatVersion:     initialFormatVersion,
 		BindingID:         bindingID,
 		InstanceID:        instanceID,
 		ServiceID:         serviceID,
@@ -56,6 +57,7 @@ func init() {
 
 	testBindingJSONStr := fmt.Sprintf(
 		`{
+			"formatVersion":%d,
 			"bindingId":"%s",
 			"instanceId":"%s",
 			"serviceId":"%s",
@@ -65,6 +67,7 @@ func init() {
 			"details":%s,
 			"created":"%s"
 		}`,
+		initialFormatVersion,
 		bindingID,
 		instanceID,
 		serviceID,
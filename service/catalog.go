@@ -2,6 +2,7 @@ package service
 
 import (
 	"encoding/json"
+	"time"
 )
 
 // Catalog is an interface to be implemented by types that represents the
@@ -9,6 +10,9 @@ import (
 type Catalog interface {
 	GetServices() []Service
 	GetService(serviceID string) (Service, bool)
+	// Validate returns an error describing every problem found with the
+	// catalog's services and plans, or nil if there are none
+	Validate() error
 }
 
 type catalog struct {
@@ -32,6 +36,14 @@ type ServiceProperties struct { // nolint: golint
 	ChildServiceID  string                 `json:"-"`
 	Extended        map[string]interface{} `json:"-"`
 	EndOfLife       bool                   `json:"-"`
+	// Migration indicates the service exists to migrate existing resources
+	// under the broker's management. Such services are only included in the
+	// catalog if CatalogConfig.EnableMigrationServices is set.
+	Migration bool `json:"-"`
+	// DisasterRecovery indicates the service exists to set up disaster
+	// recovery for other services. Such services are only included in the
+	// catalog if CatalogConfig.EnableDRServices is set.
+	DisasterRecovery bool `json:"-"`
 }
 
 // ServiceMetadata contains metadata about the service classes
@@ -78,12 +90,34 @@ type PlanProperties struct {
 	Extended    map[string]interface{} `json:"-"`
 	EndOfLife   bool                   `json:"-"`
 	Schemas     PlanSchemas            `json:"schemas,omitempty"`
+	// MaximumPollingDuration is the number of seconds after which platforms
+	// stop polling for the status of an asynchronous operation. The broker also
+	// fails any operation that is still incomplete once this has elapsed. Zero
+	// means no limit.
+	MaximumPollingDuration int `json:"maximum_polling_duration,omitempty"`
+	// ExpectedStepDuration is roughly how long each step of an operation is
+	// expected to take when the step itself does not say. Platforms polling for
+	// the status of an operation are advised to wait that long between polls.
+	ExpectedStepDuration time.Duration `json:"-"`
 }
 
 // ServicePlanMetadata contains metadata about the service plans
 type ServicePlanMetadata struct { // nolint: golint
-	DisplayName string   `json:"displayName,omitempty"`
-	Bullets     []string `json:"bullets,omitempty"`
+	DisplayName string     `json:"displayName,omitempty"`
+	Bullets     []string   `json:"bullets,omitempty"`
+	Costs       []PlanCost `json:"costs,omitempty"`
+}
+
+// PlanCost describes one of the costs of a plan, as recommended by the OSB
+// profile. A plan may have several costs; e.g. a monthly fee plus a charge per
+// GB of storage.
+type PlanCost struct {
+	// Amount maps lowercase ISO 4217 currency codes (e.g. "usd") to the amount
+	// charged in that currency
+	Amount map[string]float64 `json:"amount"`
+	// Unit is the unit of consumption the amount applies to; e.g. "MONTHLY" or
+	// "PER GB"
+	Unit string `json:"unit"`
 }
 
 // Plan is an interface to be implemented by types that represent a single
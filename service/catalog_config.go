@@ -3,8 +3,21 @@ package service
 // CatalogConfig represents details re: which modules' services should be
 // included or excluded from the catalog
 type CatalogConfig struct {
+	// MinStability is the minimum stability a module must have for its
+	// services to be included in the catalog
+	MinStability Stability
+	// EnableMigrationServices indicates whether services marked as migration
+	// services are included in the catalog
 	EnableMigrationServices bool
-	EnableDRServices        bool
+	// EnableDRServices indicates whether services marked as disaster recovery
+	// services are included in the catalog
+	EnableDRServices bool
+	// EnabledModules, if non-empty, lists the names of the only modules whose
+	// services are included in the catalog
+	EnabledModules []string
+	// DisabledModules lists the names of modules whose services are excluded
+	// from the catalog
+	DisabledModules []string
 }
 
 type tempCatalogConfig struct {
@@ -18,6 +31,7 @@ type tempCatalogConfig struct {
 // remaining fields and/or override default values.
 func NewCatalogConfigWithDefaults() CatalogConfig {
 	return CatalogConfig{
+		MinStability:            StabilityPreview,
 		EnableMigrationServices: false,
 	}
 }
@@ -0,0 +1,583 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// catalogDefinition is the root of a declarative catalog file. Its shape
+// deliberately mirrors the catalog the broker advertises, with a handful of
+// broker-specific extensions.
+type catalogDefinition struct {
+	Services []serviceDefinition `json:"services"`
+}
+
+type serviceDefinition struct {
+	// ServiceManager is the name under which the ServiceManager for this
+	// service was registered
+	ServiceManager   string                 `json:"serviceManager"`
+	ID               string                 `json:"id"`
+	Name             string                 `json:"name"`
+	Description      string                 `json:"description"`
+	Metadata         *ServiceMetadata       `json:"metadata"`
+	Tags             []string               `json:"tags"`
+	Bindable         bool                   `json:"bindable"`
+	PlanUpdatable    bool                   `json:"plan_updateable"`
+	ParentServiceID  string                 `json:"parentServiceId"`
+	ChildServiceID   string                 `json:"childServiceId"`
+	Extended         map[string]interface{} `json:"extended"`
+	EndOfLife        bool                   `json:"endOfLife"`
+	Migration        bool                   `json:"migration"`
+	DisasterRecovery bool                   `json:"disasterRecovery"`
+	Plans            []planDefinition       `json:"plans"`
+}
+
+type planDefinition struct {
+	ID                     string                 `json:"id"`
+	Name                   string                 `json:"name"`
+	Description            string                 `json:"description"`
+	Free                   bool                   `json:"free"`
+	Metadata               *ServicePlanMetadata   `json:"metadata"`
+	Extended               map[string]interface{} `json:"extended"`
+	EndOfLife              bool                   `json:"endOfLife"`
+	Schemas                planSchemasDefinition  `json:"schemas"`
+	MaximumPollingDuration int                    `json:"maximum_polling_duration"` // nolint: lll
+	// ExpectedStepDuration is expressed in the format understood by
+	// time.ParseDuration; e.g. "30s"
+	ExpectedStepDuration string `json:"expectedStepDuration"`
+}
+
+type planSchemasDefinition struct {
+	ServiceInstances struct {
+		ProvisioningParametersSchema inputParametersSchemaDefinition `json:"create"` // nolint: lll
+		UpdatingParametersSchema     inputParametersSchemaDefinition `json:"update"` // nolint: lll
+	} `json:"service_instance"`
+	ServiceBindings struct {
+		BindingParametersSchema inputParametersSchemaDefinition `json:"create"`
+	} `json:"service_binding"`
+}
+
+type inputParametersSchemaDefinition struct {
+	RequiredProperties []string                             `json:"required"`
+	SecureProperties   []string                             `json:"secure"`
+	PropertySchemas    map[string]*propertySchemaDefinition `json:"properties"`
+}
+
+// propertySchemaDefinition is a JSON schema-like definition of any kind of
+// PropertySchema. The kind is determined by the type field, which must be one
+// of string, integer, number, object, or array. Fields whose type depends on
+// the kind of property are left raw until the kind is known.
+type propertySchemaDefinition struct {
+	Type                 string                               `json:"type"`
+	Title                string                               `json:"title"`
+	Description          string                               `json:"description"`
+	AllowedValues        json.RawMessage                      `json:"enum"`
+	DefaultValue         json.RawMessage                      `json:"default"`
+	MinLength            *int                                 `json:"minLength"`
+	MaxLength            *int                                 `json:"maxLength"`
+	AllowedPattern       string                               `json:"pattern"`
+	OneOf                []enumValueDefinition                `json:"oneOf"`
+	MinValue             json.RawMessage                      `json:"minimum"`
+	MaxValue             json.RawMessage                      `json:"maximum"`
+	AllowedIncrement     json.RawMessage                      `json:"multipleOf"`
+	RequiredProperties   []string                             `json:"required"`
+	PropertySchemas      map[string]*propertySchemaDefinition `json:"properties"`
+	AdditionalProperties json.RawMessage                      `json:"additionalProperties"` // nolint: lll
+	MinItems             *int                                 `json:"minItems"`
+	MaxItems             *int                                 `json:"maxItems"`
+	ItemsSchema          *propertySchemaDefinition            `json:"items"`
+}
+
+// propertySchemaFields maps each supported property type to the fields of a
+// propertySchemaDefinition, other than type, title, and description, that
+// apply to properties of that type
+var propertySchemaFields = map[string]map[string]struct{}{
+	"string": {
+		"enum":      {},
+		"default":   {},
+		"minLength": {},
+		"maxLength": {},
+		"pattern":   {},
+		"oneOf":     {},
+	},
+	"integer": {
+		"enum":       {},
+		"default":    {},
+		"minimum":    {},
+		"maximum":    {},
+		"multipleOf": {},
+	},
+	"number": {
+		"enum":       {},
+		"default":    {},
+		"minimum":    {},
+		"maximum":    {},
+		"multipleOf": {},
+	},
+	"object": {
+		"default":              {},
+		"required":             {},
+		"properties":           {},
+		"additionalProperties": {},
+	},
+	"array": {
+		"default":  {},
+		"minItems": {},
+		"maxItems": {},
+		"items":    {},
+	},
+}
+
+type enumValueDefinition struct {
+	Value string `json:"value"`
+	Title string `json:"title"`
+}
+
+// LoadCatalogFile reads a declarative catalog definition from the file at the
+// given path and returns the corresponding Catalog. See LoadCatalog.
+func LoadCatalogFile(
+	path string,
+	serviceManagers map[string]ServiceManager,
+) (Catalog, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf(`error reading catalog file "%s": %s`, path, err)
+	}
+	catalog, err := LoadCatalog(data, serviceManagers)
+	if err != nil {
+		return nil, fmt.Errorf(`error loading catalog file "%s": %s`, path, err)
+	}
+	return catalog, nil
+}
+
+// LoadCatalog returns a Catalog built from the given declarative catalog
+// definition, which may be either YAML or JSON. This permits plan names,
+// descriptions, metadata, and parameter schemas to be modified without any
+// change to code. The definition mirrors the catalog advertised by the broker:
+//
+//	services:
+//	- serviceManager: fake
+//	  id: cdd1fb7a-d1e9-49e0-b195-e0bab747798a
+//	  name: fake
+//	  description: Fake Service
+//	  bindable: true
+//	  plans:
+//	  - id: bd15e6f3-4ff5-477c-bb57-26313a368e74
+//	    name: standard
+//	    description: The standard plan
+//	    expectedStepDuration: 30s
+//	    metadata:
+//	      displayName: Standard
+//	      bullets: [Fast, Cheap]
+//	    schemas:
+//	      service_instance:
+//	        create:
+//	          required: [location]
+//	          secure: [password]
+//	          properties:
+//	            location:
+//	              type: string
+//	              enum: [eastus, westus]
+//	            password:
+//	              type: string
+//	            cores:
+//	              type: integer
+//	              minimum: 1
+//
+// Each service names the ServiceManager it is bound to. That name must be a
+// key of the given serviceManagers map. Broker-specific service properties
+// that are never advertised are expressed as parentServiceId,
+// childServiceId, extended, endOfLife, migration, and disasterRecovery. Input
+// parameter schemas list their secure properties explicitly and each property
+// schema's kind is determined by its type: string, integer, number, object,
+// or array. Custom property validators can only be set in code. Unrecognized
+// fields, and fields that don't apply to a property schema's type (e.g.
+// minimum for a string), are treated as errors so that typos do not go
+// unnoticed.
+func LoadCatalog(
+	data []byte,
+	serviceManagers map[string]ServiceManager,
+) (Catalog, error) {
+	// YAML is a superset of JSON, so both are parsed as YAML and then
+	// re-encoded as JSON so that the json tags above are the only ones that
+	// need to be maintained.
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing catalog definition: %s", err)
+	}
+	jsonData, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing catalog definition: %s", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	def := catalogDefinition{}
+	if err := decoder.Decode(&def); err != nil {
+		return nil, fmt.Errorf("error parsing catalog definition: %s", err)
+	}
+	services := make([]Service, len(def.Services))
+	for i, serviceDef := range def.Services {
+		if services[i], err = serviceDef.toService(serviceManagers); err != nil {
+			return nil, err
+		}
+	}
+	return NewCatalog(services), nil
+}
+
+func (s serviceDefinition) toService(
+	serviceManagers map[string]ServiceManager,
+) (Service, error) {
+	serviceManager, ok := serviceManagers[s.ServiceManager]
+	if !ok {
+		return nil, fmt.Errorf(
+			`service "%s" refers to unknown service manager "%s"`,
+			s.Name,
+			s.ServiceManager,
+		)
+	}
+	serviceProperties := ServiceProperties{
+		ID:               s.ID,
+		Name:             s.Name,
+		Description:      s.Description,
+		Tags:             s.Tags,
+		Bindable:         s.Bindable,
+		PlanUpdatable:    s.PlanUpdatable,
+		ParentServiceID:  s.ParentServiceID,
+		ChildServiceID:   s.ChildServiceID,
+		Extended:         s.Extended,
+		EndOfLife:        s.EndOfLife,
+		Migration:        s.Migration,
+		DisasterRecovery: s.DisasterRecovery,
+	}
+	if s.Metadata != nil {
+		serviceProperties.Metadata = *s.Metadata
+	}
+	plans := make([]Plan, len(s.Plans))
+	for i, planDef := range s.Plans {
+		planProperties, err := planDef.toPlanProperties()
+		if err != nil {
+			return nil, fmt.Errorf(
+				`service "%s" plan "%s": %s`,
+				s.Name,
+				planDef.Name,
+				err,
+			)
+		}
+		plans[i] = NewPlan(planProperties)
+	}
+	return NewService(serviceProperties, serviceManager, plans...), nil
+}
+
+func (p planDefinition) toPlanProperties() (PlanProperties, error) {
+	planProperties := PlanProperties{
+		ID:                     p.ID,
+		Name:                   p.Name,
+		Description:            p.Description,
+		Free:                   p.Free,
+		Extended:               p.Extended,
+		EndOfLife:              p.EndOfLife,
+		MaximumPollingDuration: p.MaximumPollingDuration,
+	}
+	if p.Metadata != nil {
+		planProperties.Metadata = *p.Metadata
+	}
+	if p.ExpectedStepDuration != "" {
+		var err error
+		planProperties.ExpectedStepDuration, err =
+			time.ParseDuration(p.ExpectedStepDuration)
+		if err != nil {
+			return PlanProperties{}, fmt.Errorf(
+				`invalid expected step duration "%s": %s`,
+				p.ExpectedStepDuration,
+				err,
+			)
+		}
+	}
+	schemas := &planProperties.Schemas
+	for _, schema := range []struct {
+		context string
+		def     inputParametersSchemaDefinition
+		target  *InputParametersSchema
+	}{
+		{
+			"provisioning parameters",
+			p.Schemas.ServiceInstances.ProvisioningParametersSchema,
+			&schemas.ServiceInstances.ProvisioningParametersSchema,
+		},
+		{
+			"updating parameters",
+			p.Schemas.ServiceInstances.UpdatingParametersSchema,
+			&schemas.ServiceInstances.UpdatingParametersSchema,
+		},
+		{
+			"binding parameters",
+			p.Schemas.ServiceBindings.BindingParametersSchema,
+			&schemas.ServiceBindings.BindingParametersSchema,
+		},
+	} {
+		var err error
+		if *schema.target, err =
+			schema.def.toInputParametersSchema(schema.context); err != nil {
+			return PlanProperties{}, err
+		}
+	}
+	return planProperties, nil
+}
+
+func (i inputParametersSchemaDefinition) toInputParametersSchema(
+	context string,
+) (InputParametersSchema, error) {
+	propertySchemas, err := toPropertySchemas(context, i.PropertySchemas)
+	if err != nil {
+		return InputParametersSchema{}, err
+	}
+	return InputParametersSchema{
+		RequiredProperties: i.RequiredProperties,
+		SecureProperties:   i.SecureProperties,
+		PropertySchemas:    propertySchemas,
+	}, nil
+}
+
+func toPropertySchemas(
+	context string,
+	defs map[string]*propertySchemaDefinition,
+) (map[string]PropertySchema, error) {
+	if defs == nil {
+		return nil, nil
+	}
+	propertySchemas := make(map[string]PropertySchema, len(defs))
+	for name, def := range defs {
+		propertyContext := fmt.Sprintf(`%s property "%s"`, context, name)
+		if def == nil {
+			return nil, fmt.Errorf("%s: schema is missing", propertyContext)
+		}
+		propertySchema, err := def.toPropertySchema(propertyContext)
+		if err != nil {
+			return nil, err
+		}
+		propertySchemas[name] = propertySchema
+	}
+	return propertySchemas, nil
+}
+
+func (p *propertySchemaDefinition) toPropertySchema(
+	context string,
+) (PropertySchema, error) {
+	fields, ok := propertySchemaFields[p.Type]
+	if !ok {
+		return nil, fmt.Errorf(`%s: unsupported type "%s"`, context, p.Type)
+	}
+	for _, field := range p.getSetFields() {
+		if _, ok := fields[field]; !ok {
+			return nil, fmt.Errorf(
+				`%s: "%s" does not apply to properties of type "%s"`,
+				context,
+				field,
+				p.Type,
+			)
+		}
+	}
+	var propertySchema PropertySchema
+	var err error
+	switch p.Type {
+	case "string":
+		propertySchema, err = p.toStringPropertySchema()
+	case "integer":
+		propertySchema, err = p.toIntPropertySchema()
+	case "number":
+		propertySchema, err = p.toFloatPropertySchema()
+	case "object":
+		return p.toObjectPropertySchema(context)
+	case "array":
+		return p.toArrayPropertySchema(context)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", context, err)
+	}
+	return propertySchema, nil
+}
+
+// getSetFields returns the names of all fields that are set, other than type,
+// title, and description
+func (p *propertySchemaDefinition) getSetFields() []string {
+	fields := []string{}
+	for _, field := range []struct {
+		name string
+		set  bool
+	}{
+		{"enum", len(p.AllowedValues) > 0},
+		{"default", len(p.DefaultValue) > 0},
+		{"minLength", p.MinLength != nil},
+		{"maxLength", p.MaxLength != nil},
+		{"pattern", p.AllowedPattern != ""},
+		{"oneOf", p.OneOf != nil},
+		{"minimum", len(p.MinValue) > 0},
+		{"maximum", len(p.MaxValue) > 0},
+		{"multipleOf", len(p.AllowedIncrement) > 0},
+		{"required", p.RequiredProperties != nil},
+		{"properties", p.PropertySchemas != nil},
+		{"additionalProperties", len(p.AdditionalProperties) > 0},
+		{"minItems", p.MinItems != nil},
+		{"maxItems", p.MaxItems != nil},
+		{"items", p.ItemsSchema != nil},
+	} {
+		if field.set {
+			fields = append(fields, field.name)
+		}
+	}
+	return fields
+}
+
+func (p *propertySchemaDefinition) toStringPropertySchema() (
+	*StringPropertySchema,
+	error,
+) {
+	sps := &StringPropertySchema{
+		Title:          p.Title,
+		Description:    p.Description,
+		MinLength:      p.MinLength,
+		MaxLength:      p.MaxLength,
+		AllowedPattern: p.AllowedPattern,
+	}
+	for _, oneOf := range p.OneOf {
+		sps.OneOf = append(sps.OneOf, EnumValue(oneOf))
+	}
+	if err := unmarshalOptional("enum", p.AllowedValues, &sps.AllowedValues); err != nil { // nolint: lll
+		return nil, err
+	}
+	if err := unmarshalOptional("default", p.DefaultValue, &sps.DefaultValue); err != nil { // nolint: lll
+		return nil, err
+	}
+	return sps, nil
+}
+
+func (p *propertySchemaDefinition) toIntPropertySchema() (
+	*IntPropertySchema,
+	error,
+) {
+	ips := &IntPropertySchema{
+		Title:       p.Title,
+		Description: p.Description,
+	}
+	for name, field := range map[string]struct {
+		raw    json.RawMessage
+		target interface{}
+	}{
+		"enum":       {p.AllowedValues, &ips.AllowedValues},
+		"default":    {p.DefaultValue, &ips.DefaultValue},
+		"minimum":    {p.MinValue, &ips.MinValue},
+		"maximum":    {p.MaxValue, &ips.MaxValue},
+		"multipleOf": {p.AllowedIncrement, &ips.AllowedIncrement},
+	} {
+		if err := unmarshalOptional(name, field.raw, field.target); err != nil {
+			return nil, err
+		}
+	}
+	return ips, nil
+}
+
+func (p *propertySchemaDefinition) toFloatPropertySchema() (
+	*FloatPropertySchema,
+	error,
+) {
+	fps := &FloatPropertySchema{
+		Title:       p.Title,
+		Description: p.Description,
+	}
+	for name, field := range map[string]struct {
+		raw    json.RawMessage
+		target interface{}
+	}{
+		"enum":       {p.AllowedValues, &fps.AllowedValues},
+		"default":    {p.DefaultValue, &fps.DefaultValue},
+		"minimum":    {p.MinValue, &fps.MinValue},
+		"maximum":    {p.MaxValue, &fps.MaxValue},
+		"multipleOf": {p.AllowedIncrement, &fps.AllowedIncrement},
+	} {
+		if err := unmarshalOptional(name, field.raw, field.target); err != nil {
+			return nil, err
+		}
+	}
+	return fps, nil
+}
+
+func (p *propertySchemaDefinition) toObjectPropertySchema(
+	context string,
+) (*ObjectPropertySchema, error) {
+	ops := &ObjectPropertySchema{
+		Title:              p.Title,
+		Description:        p.Description,
+		RequiredProperties: p.RequiredProperties,
+	}
+	var err error
+	if ops.PropertySchemas, err =
+		toPropertySchemas(context, p.PropertySchemas); err != nil {
+		return nil, err
+	}
+	if err = unmarshalOptional("default", p.DefaultValue, &ops.DefaultValue); err != nil { // nolint: lll
+		return nil, fmt.Errorf("%s: %s", context, err)
+	}
+	// additionalProperties may be false (the default) or a schema
+	if len(p.AdditionalProperties) > 0 &&
+		!bytes.Equal(p.AdditionalProperties, []byte("false")) {
+		additionalDef := &propertySchemaDefinition{}
+		decoder := json.NewDecoder(bytes.NewReader(p.AdditionalProperties))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(additionalDef); err != nil {
+			return nil, fmt.Errorf(
+				"%s: invalid value for additionalProperties: %s",
+				context,
+				err,
+			)
+		}
+		if ops.Additional, err = additionalDef.toPropertySchema(
+			context + " additional properties",
+		); err != nil {
+			return nil, err
+		}
+	}
+	return ops, nil
+}
+
+func (p *propertySchemaDefinition) toArrayPropertySchema(
+	context string,
+) (*ArrayPropertySchema, error) {
+	aps := &ArrayPropertySchema{
+		Title:       p.Title,
+		Description: p.Description,
+		MinItems:    p.MinItems,
+		MaxItems:    p.MaxItems,
+	}
+	if err := unmarshalOptional("default", p.DefaultValue, &aps.DefaultValue); err != nil { // nolint: lll
+		return nil, fmt.Errorf("%s: %s", context, err)
+	}
+	if p.ItemsSchema != nil {
+		var err error
+		if aps.ItemsSchema, err =
+			p.ItemsSchema.toPropertySchema(context + " items"); err != nil {
+			return nil, err
+		}
+	}
+	return aps, nil
+}
+
+// unmarshalOptional unmarshals the given raw JSON into the target, but only if
+// any raw JSON is present
+func unmarshalOptional(
+	name string,
+	raw json.RawMessage,
+	target interface{},
+) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, target); err != nil {
+		return fmt.Errorf(`invalid value for "%s": %s`, name, err)
+	}
+	return nil
+}
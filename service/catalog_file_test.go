@@ -0,0 +1,399 @@
+package service
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testCatalogYAML = `
+services:
+- serviceManager: foo
+  id: 4b4c7a9e-2f52-4f8c-9d35-e3a2f0a6c1d1
+  name: foo
+  description: Foo Service
+  metadata:
+    displayName: Foo
+  tags: [Foo]
+  bindable: true
+  plan_updateable: true
+  childServiceId: 8e2d4c6b-1a3f-4e5d-b7c9-d0e1f2a3b4c5
+  plans:
+  - id: 6d1f3a2b-9c8e-4f7d-a6b5-c4d3e2f1a0b9
+    name: standard
+    description: Standard plan
+    maximum_polling_duration: 3600
+    expectedStepDuration: 30s
+    metadata:
+      displayName: Standard
+      bullets: [Fast, Cheap]
+    schemas:
+      service_instance:
+        create:
+          required: [location]
+          secure: [password]
+          properties:
+            location:
+              type: string
+              title: Location
+              enum: [eastus, westus]
+              default: eastus
+            password:
+              type: string
+              minLength: 8
+              pattern: "^[a-z]+$"
+            tier:
+              type: string
+              oneOf:
+              - value: basic
+                title: Basic
+            cores:
+              type: integer
+              minimum: 1
+              maximum: 64
+              multipleOf: 2
+              default: 2
+            ratio:
+              type: number
+              enum: [0.5, 1.5]
+            tags:
+              type: object
+              additionalProperties:
+                type: string
+            firewall:
+              type: object
+              required: [start]
+              properties:
+                start:
+                  type: string
+            addresses:
+              type: array
+              minItems: 1
+              items:
+                type: string
+        update:
+          properties:
+            cores:
+              type: integer
+      service_binding:
+        create:
+          properties:
+            role:
+              type: string
+  - id: a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d
+    name: retired
+    description: Retired plan
+    endOfLife: true
+- serviceManager: bar
+  id: 8e2d4c6b-1a3f-4e5d-b7c9-d0e1f2a3b4c5
+  name: bar
+  description: Bar Service
+  parentServiceId: 4b4c7a9e-2f52-4f8c-9d35-e3a2f0a6c1d1
+  plans:
+  - id: 0f9e8d7c-6b5a-4c3d-9e2f-1a0b9c8d7e6f
+    name: standard
+    description: Standard plan
+`
+
+type testServiceManager struct {
+	ServiceManager
+	name string
+}
+
+func getTestServiceManagers() map[string]ServiceManager {
+	return map[string]ServiceManager{
+		"foo": &testServiceManager{name: "foo"},
+		"bar": &testServiceManager{name: "bar"},
+	}
+}
+
+func TestLoadCatalog(t *testing.T) {
+	serviceManagers := getTestServiceManagers()
+	catalog, err := LoadCatalog([]byte(testCatalogYAML), serviceManagers)
+	assert.Nil(t, err)
+	assert.Nil(t, catalog.Validate())
+	assert.Equal(t, 2, len(catalog.GetServices()))
+
+	svc, ok := catalog.GetService("4b4c7a9e-2f52-4f8c-9d35-e3a2f0a6c1d1")
+	assert.True(t, ok)
+	assert.Equal(t, serviceManagers["foo"], svc.GetServiceManager())
+	props := svc.GetProperties()
+	assert.Equal(t, "foo", props.Name)
+	assert.Equal(t, ServiceMetadata{DisplayName: "Foo"}, props.Metadata)
+	assert.Equal(t, []string{"Foo"}, props.Tags)
+	assert.True(t, props.Bindable)
+	assert.True(t, props.PlanUpdatable)
+	assert.Equal(
+		t,
+		"8e2d4c6b-1a3f-4e5d-b7c9-d0e1f2a3b4c5",
+		props.ChildServiceID,
+	)
+	assert.Equal(t, 2, len(svc.GetPlans()))
+
+	plan, ok := svc.GetPlan("6d1f3a2b-9c8e-4f7d-a6b5-c4d3e2f1a0b9")
+	assert.True(t, ok)
+	planProps := plan.GetProperties()
+	assert.Equal(t, 3600, planProps.MaximumPollingDuration)
+	assert.Equal(t, 30*time.Second, planProps.ExpectedStepDuration)
+	assert.Equal(
+		t,
+		ServicePlanMetadata{
+			DisplayName: "Standard",
+			Bullets:     []string{"Fast", "Cheap"},
+		},
+		planProps.Metadata,
+	)
+
+	minLength := 8
+	minCores := int64(1)
+	maxCores := int64(64)
+	coresIncrement := int64(2)
+	defaultCores := int64(2)
+	minItems := 1
+	assert.Equal(
+		t,
+		InputParametersSchema{
+			RequiredProperties: []string{"location"},
+			SecureProperties:   []string{"password"},
+			PropertySchemas: map[string]PropertySchema{
+				"location": &StringPropertySchema{
+					Title:         "Location",
+					AllowedValues: []string{"eastus", "westus"},
+					DefaultValue:  "eastus",
+				},
+				"password": &StringPropertySchema{
+					MinLength:      &minLength,
+					AllowedPattern: "^[a-z]+$",
+				},
+				"tier": &StringPropertySchema{
+					OneOf: []EnumValue{{Value: "basic", Title: "Basic"}},
+				},
+				"cores": &IntPropertySchema{
+					MinValue:         &minCores,
+					MaxValue:         &maxCores,
+					AllowedIncrement: &coresIncrement,
+					DefaultValue:     &defaultCores,
+				},
+				"ratio": &FloatPropertySchema{
+					AllowedValues: []float64{0.5, 1.5},
+				},
+				"tags": &ObjectPropertySchema{
+					Additional: &StringPropertySchema{},
+				},
+				"firewall": &ObjectPropertySchema{
+					RequiredProperties: []string{"start"},
+					PropertySchemas: map[string]PropertySchema{
+						"start": &StringPropertySchema{},
+					},
+				},
+				"addresses": &ArrayPropertySchema{
+					MinItems:    &minItems,
+					ItemsSchema: &StringPropertySchema{},
+				},
+			},
+		},
+		planProps.Schemas.ServiceInstances.ProvisioningParametersSchema,
+	)
+	assert.Equal(
+		t,
+		map[string]PropertySchema{"cores": &IntPropertySchema{}},
+		planProps.Schemas.ServiceInstances.UpdatingParametersSchema.PropertySchemas, // nolint: lll
+	)
+	assert.Equal(
+		t,
+		map[string]PropertySchema{"role": &StringPropertySchema{}},
+		planProps.Schemas.ServiceBindings.BindingParametersSchema.PropertySchemas,
+	)
+
+	plan, ok = svc.GetPlan("a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d")
+	assert.True(t, ok)
+	assert.True(t, plan.IsEndOfLife())
+
+	svc, ok = catalog.GetService("8e2d4c6b-1a3f-4e5d-b7c9-d0e1f2a3b4c5")
+	assert.True(t, ok)
+	assert.Equal(t, serviceManagers["bar"], svc.GetServiceManager())
+	assert.Equal(
+		t,
+		"4b4c7a9e-2f52-4f8c-9d35-e3a2f0a6c1d1",
+		svc.GetParentServiceID(),
+	)
+}
+
+func TestLoadCatalogFromJSON(t *testing.T) {
+	catalog, err := LoadCatalog(
+		[]byte(`{
+			"services": [{
+				"serviceManager": "foo",
+				"id": "4b4c7a9e-2f52-4f8c-9d35-e3a2f0a6c1d1",
+				"name": "foo",
+				"description": "Foo Service",
+				"plans": [{
+					"id": "6d1f3a2b-9c8e-4f7d-a6b5-c4d3e2f1a0b9",
+					"name": "standard",
+					"description": "Standard plan"
+				}]
+			}]
+		}`),
+		getTestServiceManagers(),
+	)
+	assert.Nil(t, err)
+	assert.Nil(t, catalog.Validate())
+	assert.Equal(t, 1, len(catalog.GetServices()))
+}
+
+func TestLoadCatalogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.yaml")
+	err := ioutil.WriteFile(path, []byte(testCatalogYAML), 0600)
+	assert.Nil(t, err)
+	catalog, err := LoadCatalogFile(path, getTestServiceManagers())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(catalog.GetServices()))
+	_, err = LoadCatalogFile(
+		filepath.Join(t.TempDir(), "nonexistent.yaml"),
+		getTestServiceManagers(),
+	)
+	assert.NotNil(t, err)
+}
+
+func TestLoadCatalogErrors(t *testing.T) {
+	testCases := []struct {
+		name       string
+		definition string
+		errMsg     string
+	}{
+		{
+			name:       "unknown service manager",
+			definition: "services: [{serviceManager: bat, name: bat}]",
+			errMsg: `service "bat" refers to unknown service manager ` +
+				`"bat"`,
+		},
+		{
+			name:       "unknown field",
+			definition: "services: [{serviceManager: foo, nmae: foo}]",
+			errMsg: "error parsing catalog definition: json: unknown " +
+				`field "nmae"`,
+		},
+		{
+			name: "unsupported property type",
+			definition: `
+services:
+- serviceManager: foo
+  name: foo
+  plans:
+  - name: standard
+    schemas:
+      service_binding:
+        create:
+          properties:
+            enabled:
+              type: boolean`,
+			errMsg: `service "foo" plan "standard": binding parameters ` +
+				`property "enabled": unsupported type "boolean"`,
+		},
+		{
+			name: "property value of wrong type",
+			definition: `
+services:
+- serviceManager: foo
+  name: foo
+  plans:
+  - name: standard
+    schemas:
+      service_instance:
+        update:
+          properties:
+            cores:
+              type: integer
+              default: two`,
+			errMsg: `service "foo" plan "standard": updating parameters ` +
+				`property "cores": invalid value for "default": json: ` +
+				"cannot unmarshal string into Go value of type int64",
+		},
+		{
+			name: "numeric field on string property",
+			definition: `
+services:
+- serviceManager: foo
+  name: foo
+  plans:
+  - name: standard
+    schemas:
+      service_instance:
+        create:
+          properties:
+            location:
+              type: string
+              minimum: 1`,
+			errMsg: `service "foo" plan "standard": provisioning parameters ` +
+				`property "location": "minimum" does not apply to properties ` +
+				`of type "string"`,
+		},
+		{
+			name: "string field on integer property",
+			definition: `
+services:
+- serviceManager: foo
+  name: foo
+  plans:
+  - name: standard
+    schemas:
+      service_instance:
+        create:
+          properties:
+            cores:
+              type: integer
+              pattern: "^[0-9]+$"`,
+			errMsg: `service "foo" plan "standard": provisioning parameters ` +
+				`property "cores": "pattern" does not apply to properties of ` +
+				`type "integer"`,
+		},
+		{
+			name: "object field on array items",
+			definition: `
+services:
+- serviceManager: foo
+  name: foo
+  plans:
+  - name: standard
+    schemas:
+      service_binding:
+        create:
+          properties:
+            tags:
+              type: array
+              items:
+                type: string
+                additionalProperties: false`,
+			errMsg: `service "foo" plan "standard": binding parameters ` +
+				`property "tags" items: "additionalProperties" does not apply ` +
+				`to properties of type "string"`,
+		},
+		{
+			name: "invalid expected step duration",
+			definition: `
+services:
+- serviceManager: foo
+  name: foo
+  plans:
+  - name: standard
+    expectedStepDuration: soon`,
+			errMsg: `service "foo" plan "standard": invalid expected step ` +
+				`duration "soon": time: invalid duration "soon"`,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := LoadCatalog(
+				[]byte(testCase.definition),
+				getTestServiceManagers(),
+			)
+			assert.NotNil(t, err)
+			if err != nil {
+				assert.Equal(t, testCase.errMsg, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/barpilot/gosba/slice"
+	uuid "github.com/satori/go.uuid"
+)
+
+// nameRegex matches CLI-friendly service and plan names, as recommended by
+// the OSB spec
+var nameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9.-]*$`)
+
+// currencyRegex matches the lowercase ISO 4217 currency codes used as keys of
+// plan cost amounts
+var currencyRegex = regexp.MustCompile(`^[a-z]{3}$`)
+
+// CatalogValidationError represents one or more problems found while
+// validating a catalog
+type CatalogValidationError struct {
+	Problems []string
+}
+
+func (e *CatalogValidationError) Error() string {
+	return fmt.Sprintf(
+		"catalog has %d problem(s): %s",
+		len(e.Problems),
+		strings.Join(e.Problems, "; "),
+	)
+}
+
+// Validate checks the catalog for problems that would otherwise only surface
+// when requests are made for the offending services or plans. These include
+// malformed or duplicate service and plan IDs, malformed names, missing
+// descriptions, services without plans, malformed plan costs, inconsistent
+// parent/child relationships, and inconsistent parameter schemas. If any
+// problems are found, a *CatalogValidationError describing all of them is
+// returned.
+func (c *catalog) Validate() error {
+	v := &catalogValidator{}
+	serviceIDs := map[string]struct{}{}
+	serviceNames := map[string]struct{}{}
+	planIDs := map[string]struct{}{}
+	for _, svc := range c.services {
+		properties := svc.GetProperties()
+		context := fmt.Sprintf(`service "%s"`, svc.GetName())
+		v.validateID(context, svc.GetID(), serviceIDs)
+		v.validateName(context, svc.GetName())
+		if _, ok := serviceNames[svc.GetName()]; ok {
+			v.addProblem(context, "name is not unique")
+		}
+		serviceNames[svc.GetName()] = struct{}{}
+		if properties.Description == "" {
+			v.addProblem(context, "description is required")
+		}
+		if len(svc.GetPlans()) == 0 {
+			v.addProblem(context, "at least one plan is required")
+		}
+		v.validateRelatives(context, svc, c.indexedServices)
+		planNames := map[string]struct{}{}
+		for _, plan := range svc.GetPlans() {
+			planContext := fmt.Sprintf(`%s plan "%s"`, context, plan.GetName())
+			v.validateID(planContext, plan.GetID(), planIDs)
+			v.validateName(planContext, plan.GetName())
+			if _, ok := planNames[plan.GetName()]; ok {
+				v.addProblem(planContext, "name is not unique within service")
+			}
+			planNames[plan.GetName()] = struct{}{}
+			if plan.GetProperties().Description == "" {
+				v.addProblem(planContext, "description is required")
+			}
+			v.validateCosts(planContext, plan.GetProperties())
+			schemas := plan.GetSchemas()
+			v.validateInputParametersSchema(
+				planContext+" provisioning parameters",
+				schemas.ServiceInstances.ProvisioningParametersSchema,
+			)
+			v.validateInputParametersSchema(
+				planContext+" updating parameters",
+				schemas.ServiceInstances.UpdatingParametersSchema,
+			)
+			v.validateInputParametersSchema(
+				planContext+" binding parameters",
+				schemas.ServiceBindings.BindingParametersSchema,
+			)
+		}
+	}
+	if len(v.problems) > 0 {
+		return &CatalogValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+type catalogValidator struct {
+	problems []string
+}
+
+func (v *catalogValidator) addProblem(context, problem string) {
+	v.problems = append(v.problems, fmt.Sprintf("%s: %s", context, problem))
+}
+
+func (v *catalogValidator) validateID(
+	context string,
+	id string,
+	ids map[string]struct{},
+) {
+	if _, err := uuid.FromString(id); err != nil {
+		v.addProblem(context, fmt.Sprintf(`id "%s" is not a valid UUID`, id))
+	}
+	if _, ok := ids[id]; ok {
+		v.addProblem(context, fmt.Sprintf(`id "%s" is not unique`, id))
+	}
+	ids[id] = struct{}{}
+}
+
+func (v *catalogValidator) validateName(context string, name string) {
+	if !nameRegex.MatchString(name) {
+		v.addProblem(
+			context,
+			"name must be non-empty and contain only alphanumeric characters, "+
+				"periods, and hyphens",
+		)
+	}
+}
+
+func (v *catalogValidator) validateCosts(
+	context string,
+	planProperties PlanProperties,
+) {
+	var metadata *ServicePlanMetadata
+	switch m := planProperties.Metadata.(type) {
+	case ServicePlanMetadata:
+		metadata = &m
+	case *ServicePlanMetadata:
+		metadata = m
+	}
+	if metadata == nil {
+		return
+	}
+	if planProperties.Free && len(metadata.Costs) > 0 {
+		v.addProblem(context, "free plan must not have costs")
+	}
+	for i, cost := range metadata.Costs {
+		costContext := fmt.Sprintf("%s cost %d", context, i)
+		if cost.Unit == "" {
+			v.addProblem(costContext, "unit is required")
+		}
+		if len(cost.Amount) == 0 {
+			v.addProblem(costContext, "at least one amount is required")
+		}
+		currencies := make([]string, 0, len(cost.Amount))
+		for currency := range cost.Amount {
+			currencies = append(currencies, currency)
+		}
+		sort.Strings(currencies)
+		for _, currency := range currencies {
+			if !currencyRegex.MatchString(currency) {
+				v.addProblem(
+					costContext,
+					fmt.Sprintf(
+						`currency "%s" is not a lowercase ISO 4217 code`,
+						currency,
+					),
+				)
+			}
+		}
+	}
+}
+
+func (v *catalogValidator) validateRelatives(
+	context string,
+	svc Service,
+	services map[string]Service,
+) {
+	properties := svc.GetProperties()
+	if properties.ParentServiceID != "" {
+		parent, ok := services[properties.ParentServiceID]
+		if !ok {
+			v.addProblem(
+				context,
+				fmt.Sprintf(
+					`parent service "%s" does not exist`,
+					properties.ParentServiceID,
+				),
+			)
+		} else if parent.GetProperties().ChildServiceID != svc.GetID() {
+			v.addProblem(
+				context,
+				fmt.Sprintf(
+					`parent service "%s" does not name this service as its child`,
+					parent.GetName(),
+				),
+			)
+		}
+	}
+	if properties.ChildServiceID != "" {
+		child, ok := services[properties.ChildServiceID]
+		if !ok {
+			v.addProblem(
+				context,
+				fmt.Sprintf(
+					`child service "%s" does not exist`,
+					properties.ChildServiceID,
+				),
+			)
+		} else if child.GetParentServiceID() != svc.GetID() {
+			v.addProblem(
+				context,
+				fmt.Sprintf(
+					`child service "%s" does not name this service as its parent`,
+					child.GetName(),
+				),
+			)
+		}
+	}
+}
+
+func (v *catalogValidator) validateInputParametersSchema(
+	context string,
+	schema InputParametersSchema,
+) {
+	v.validateRequiredProperties(
+		context,
+		schema.RequiredProperties,
+		schema.PropertySchemas,
+	)
+	for _, secureProperty := range schema.SecureProperties {
+		propertySchema, ok := schema.PropertySchemas[secureProperty]
+		if !ok {
+			v.addProblem(
+				context,
+				fmt.Sprintf(`secure property "%s" is not defined`, secureProperty),
+			)
+			continue
+		}
+		if _, ok := propertySchema.(*StringPropertySchema); !ok {
+			v.addProblem(
+				context,
+				fmt.Sprintf(`secure property "%s" is not a string`, secureProperty),
+			)
+		}
+	}
+	v.validatePropertySchemas(context, schema.PropertySchemas)
+}
+
+func (v *catalogValidator) validateRequiredProperties(
+	context string,
+	requiredProperties []string,
+	propertySchemas map[string]PropertySchema,
+) {
+	for _, requiredProperty := range requiredProperties {
+		if _, ok := propertySchemas[requiredProperty]; !ok {
+			v.addProblem(
+				context,
+				fmt.Sprintf(
+					`required property "%s" is not defined`,
+					requiredProperty,
+				),
+			)
+		}
+	}
+}
+
+func (v *catalogValidator) validatePropertySchemas(
+	context string,
+	propertySchemas map[string]PropertySchema,
+) {
+	// Sort keys so problems are reported in a predictable order
+	keys := make([]string, 0, len(propertySchemas))
+	for key := range propertySchemas {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v.validatePropertySchema(
+			fmt.Sprintf(`%s property "%s"`, context, key),
+			propertySchemas[key],
+		)
+	}
+}
+
+func (v *catalogValidator) validatePropertySchema(
+	context string,
+	propertySchema PropertySchema,
+) {
+	switch ps := propertySchema.(type) {
+	case nil:
+		v.addProblem(context, "schema is missing")
+	case *StringPropertySchema:
+		if ps.AllowedPattern != "" {
+			if _, err := regexp.Compile(ps.AllowedPattern); err != nil {
+				v.addProblem(
+					context,
+					fmt.Sprintf(`pattern "%s" is invalid: %s`, ps.AllowedPattern, err),
+				)
+			}
+		}
+		if ps.DefaultValue != "" && len(ps.AllowedValues) > 0 &&
+			!slice.ContainsString(ps.AllowedValues, ps.DefaultValue) {
+			v.addProblem(context, "default value is not an allowed value")
+		}
+	case *IntPropertySchema:
+		if ps.AllowedIncrement != nil && *ps.AllowedIncrement == 0 {
+			v.addProblem(context, "allowed increment must not be zero")
+		}
+	case *ObjectPropertySchema:
+		v.validateRequiredProperties(
+			context,
+			ps.RequiredProperties,
+			ps.PropertySchemas,
+		)
+		v.validatePropertySchemas(context, ps.PropertySchemas)
+		if ps.Additional != nil {
+			v.validatePropertySchema(
+				context+" additional properties",
+				ps.Additional,
+			)
+		}
+	case *ArrayPropertySchema:
+		if ps.ItemsSchema != nil {
+			v.validatePropertySchema(context+" items", ps.ItemsSchema)
+		}
+	}
+}
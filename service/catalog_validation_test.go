@@ -0,0 +1,202 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testParentServiceID = "4b4c7a9e-2f52-4f8c-9d35-e3a2f0a6c1d1"
+	testParentPlanID    = "6d1f3a2b-9c8e-4f7d-a6b5-c4d3e2f1a0b9"
+	testChildServiceID  = "8e2d4c6b-1a3f-4e5d-b7c9-d0e1f2a3b4c5"
+	testChildPlanID     = "a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d"
+)
+
+func getValidTestCatalogServices() []Service {
+	return []Service{
+		NewService(
+			ServiceProperties{
+				ID:             testParentServiceID,
+				Name:           "parent",
+				Description:    "parent service",
+				ChildServiceID: testChildServiceID,
+			},
+			nil,
+			NewPlan(PlanProperties{
+				ID:          testParentPlanID,
+				Name:        "standard",
+				Description: "standard plan",
+				Schemas: PlanSchemas{
+					ServiceInstances: InstanceSchemas{
+						ProvisioningParametersSchema: InputParametersSchema{
+							RequiredProperties: []string{"location"},
+							SecureProperties:   []string{"password"},
+							PropertySchemas: map[string]PropertySchema{
+								"location": &StringPropertySchema{},
+								"password": &StringPropertySchema{
+									AllowedPattern: "^[a-z]+$",
+								},
+								"tags": &ObjectPropertySchema{
+									Additional: &StringPropertySchema{},
+								},
+							},
+						},
+					},
+				},
+			}),
+		),
+		NewService(
+			ServiceProperties{
+				ID:              testChildServiceID,
+				Name:            "child",
+				Description:     "child service",
+				ParentServiceID: testParentServiceID,
+			},
+			nil,
+			NewPlan(PlanProperties{
+				ID:          testChildPlanID,
+				Name:        "standard",
+				Description: "standard plan",
+			}),
+		),
+	}
+}
+
+func TestValidateValidCatalog(t *testing.T) {
+	assert.Nil(t, NewCatalog(getValidTestCatalogServices()).Validate())
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	services := append(
+		getValidTestCatalogServices(),
+		NewService(
+			ServiceProperties{
+				ID:              testParentServiceID,
+				Name:            "bad name",
+				ParentServiceID: "nonexistent",
+			},
+			nil,
+			NewPlan(PlanProperties{
+				ID:          testChildPlanID,
+				Name:        "standard",
+				Description: "standard plan",
+				Schemas: PlanSchemas{
+					ServiceBindings: BindingSchemas{
+						BindingParametersSchema: InputParametersSchema{
+							RequiredProperties: []string{"missing"},
+							SecureProperties:   []string{"count", "undefined"},
+							PropertySchemas: map[string]PropertySchema{
+								"count": &IntPropertySchema{},
+								"nested": &ObjectPropertySchema{
+									PropertySchemas: map[string]PropertySchema{
+										"name": &StringPropertySchema{
+											AllowedPattern: "[",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			}),
+		),
+	)
+	err := NewCatalog(services).Validate()
+	assert.NotNil(t, err)
+	validationErr, ok := err.(*CatalogValidationError)
+	assert.True(t, ok)
+	assert.Equal(
+		t,
+		[]string{
+			// The duplicate service ID shadows the real parent of "child"
+			`service "child": parent service "bad name" does not name this ` +
+				`service as its child`,
+			`service "bad name": id "` + testParentServiceID + `" is not unique`,
+			`service "bad name": name must be non-empty and contain only ` +
+				`alphanumeric characters, periods, and hyphens`,
+			`service "bad name": description is required`,
+			`service "bad name": parent service "nonexistent" does not exist`,
+			`service "bad name" plan "standard": id "` + testChildPlanID +
+				`" is not unique`,
+			`service "bad name" plan "standard" binding parameters: required ` +
+				`property "missing" is not defined`,
+			`service "bad name" plan "standard" binding parameters: secure ` +
+				`property "count" is not a string`,
+			`service "bad name" plan "standard" binding parameters: secure ` +
+				`property "undefined" is not defined`,
+			`service "bad name" plan "standard" binding parameters property ` +
+				`"nested" property "name": pattern "[" is invalid: error ` +
+				"parsing regexp: missing closing ]: `[`",
+		},
+		validationErr.Problems,
+	)
+}
+
+func TestValidateInconsistentRelatives(t *testing.T) {
+	services := getValidTestCatalogServices()
+	services[1] = NewService(
+		ServiceProperties{
+			ID:          testChildServiceID,
+			Name:        "child",
+			Description: "child service",
+		},
+		nil,
+		NewPlan(PlanProperties{
+			ID:          testChildPlanID,
+			Name:        "standard",
+			Description: "standard plan",
+		}),
+	)
+	err := NewCatalog(services).Validate()
+	assert.NotNil(t, err)
+	validationErr, ok := err.(*CatalogValidationError)
+	assert.True(t, ok)
+	assert.Equal(
+		t,
+		[]string{
+			`service "parent": child service "child" does not name this ` +
+				`service as its parent`,
+		},
+		validationErr.Problems,
+	)
+}
+
+func TestValidatePlanCosts(t *testing.T) {
+	services := getValidTestCatalogServices()
+	services[1] = NewService(
+		services[1].GetProperties(),
+		nil,
+		NewPlan(PlanProperties{
+			ID:          testChildPlanID,
+			Name:        "standard",
+			Description: "standard plan",
+			Free:        true,
+			Metadata: ServicePlanMetadata{
+				Costs: []PlanCost{
+					{
+						Amount: map[string]float64{"usd": 10, "EUR": 9},
+						Unit:   "MONTHLY",
+					},
+					{},
+				},
+			},
+		}),
+	)
+	err := NewCatalog(services).Validate()
+	assert.NotNil(t, err)
+	validationErr, ok := err.(*CatalogValidationError)
+	assert.True(t, ok)
+	assert.Equal(
+		t,
+		[]string{
+			`service "child" plan "standard": free plan must not have costs`,
+			`service "child" plan "standard" cost 0: currency "EUR" is not a ` +
+				"lowercase ISO 4217 code",
+			`service "child" plan "standard" cost 1: unit is required`,
+			`service "child" plan "standard" cost 1: at least one amount is ` +
+				"required",
+		},
+		validationErr.Problems,
+	)
+}
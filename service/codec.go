@@ -0,0 +1,66 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/barpilot/gosba/crypto"
+)
+
+// Secure strings and secure parameters encrypt and decrypt themselves while
+// being marshaled and unmarshaled, which leaves no way of handing them a
+// codec. Instead, the codec that instances and bindings are marshaled or
+// unmarshaled with is put in effect for the duration. Marshaling with the
+// global codec may proceed concurrently, but marshaling with any other codec
+// happens one instance or binding at a time.
+var (
+	// codecScopeMutex is held for reading while marshaling with the global
+	// codec and for writing while marshaling with any other codec
+	codecScopeMutex sync.RWMutex
+	// codecMutex guards scopedCodec
+	codecMutex sync.RWMutex
+	// scopedCodec is the codec in effect, or nil if the global codec is
+	scopedCodec crypto.Codec
+)
+
+// withCodec invokes the given function with the given codec in effect. A nil
+// codec puts the global codec in effect.
+func withCodec(codec crypto.Codec, fn func() error) error {
+	if codec == nil {
+		codecScopeMutex.RLock()
+		defer codecScopeMutex.RUnlock()
+		return fn()
+	}
+	codecScopeMutex.Lock()
+	defer codecScopeMutex.Unlock()
+	setScopedCodec(codec)
+	defer setScopedCodec(nil)
+	return fn()
+}
+
+func setScopedCodec(codec crypto.Codec) {
+	codecMutex.Lock()
+	defer codecMutex.Unlock()
+	scopedCodec = codec
+}
+
+func getScopedCodec() crypto.Codec {
+	codecMutex.RLock()
+	defer codecMutex.RUnlock()
+	return scopedCodec
+}
+
+// encrypt encrypts the provided bytes using the codec in effect
+func encrypt(plaintext []byte) ([]byte, error) {
+	if codec := getScopedCodec(); codec != nil {
+		return codec.Encrypt(plaintext)
+	}
+	return crypto.Encrypt(plaintext)
+}
+
+// decrypt decrypts the provided bytes using the codec in effect
+func decrypt(ciphertext []byte) ([]byte, error) {
+	if codec := getScopedCodec(); codec != nil {
+		return codec.Decrypt(ciphertext)
+	}
+	return crypto.Decrypt(ciphertext)
+}
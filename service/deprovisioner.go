@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"fmt"
+	"time"
 )
 
 // DeprovisioningStepFunction is the signature for functions that implement a
@@ -23,8 +24,9 @@ type DeprovisioningStep interface {
 }
 
 type deprovisioningStep struct {
-	name string
-	fn   DeprovisioningStepFunction
+	name             string
+	fn               DeprovisioningStepFunction
+	expectedDuration time.Duration
 }
 
 // Deprovisioner is an interface to be implemented by types that model a
@@ -52,11 +54,33 @@ func NewDeprovisioningStep(
 	}
 }
 
+// NewDeprovisioningStepWithExpectedDuration returns a new DeprovisioningStep that is
+// expected to take roughly the given duration to execute. Platforms polling
+// for the status of an operation are advised to wait that long between polls
+// while the step executes.
+func NewDeprovisioningStepWithExpectedDuration(
+	name string,
+	fn DeprovisioningStepFunction,
+	expectedDuration time.Duration,
+) DeprovisioningStep {
+	return &deprovisioningStep{
+		name:             name,
+		fn:               fn,
+		expectedDuration: expectedDuration,
+	}
+}
+
 // GetName returns a deprovisioning step's name
 func (d *deprovisioningStep) GetName() string {
 	return d.name
 }
 
+// GetExpectedDuration returns roughly how long a deprovisioning step is expected
+// to take to execute or zero if that is unknown
+func (d *deprovisioningStep) GetExpectedDuration() time.Duration {
+	return d.expectedDuration
+}
+
 // Execute executes a step
 func (d *deprovisioningStep) Execute(
 	ctx context.Context,
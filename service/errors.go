@@ -1,6 +1,9 @@
 package service
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 // ValidationError represents an error validating requestParameters. This
 // specific error type should be used to allow the broker's framework to
@@ -22,3 +25,44 @@ func NewValidationError(field, issue string) *ValidationError {
 func (e *ValidationError) Error() string {
 	return fmt.Sprintf("Error validating field '%s': %s", e.Field, e.Issue)
 }
+
+// UserFacingError is an error that modules may return from provisioning,
+// updating, or deprovisioning steps to supply a message that is suitable for
+// display to end users. The broker exposes only this message to platforms,
+// never the details of the wrapped error.
+type UserFacingError struct {
+	Message string
+	Err     error
+}
+
+// NewUserFacingError returns a new UserFacingError that wraps the given error
+// with a message suitable for display to end users
+func NewUserFacingError(message string, err error) *UserFacingError {
+	return &UserFacingError{
+		Message: message,
+		Err:     err,
+	}
+}
+
+func (e *UserFacingError) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Message, e.Err)
+}
+
+// Unwrap returns the error wrapped by the UserFacingError
+func (e *UserFacingError) Unwrap() error {
+	return e.Err
+}
+
+// GetUserFacingMessage returns the message carried by the first
+// UserFacingError found in the given error's chain along with a bool
+// indicating whether one was found
+func GetUserFacingMessage(err error) (string, bool) {
+	var userFacingErr *UserFacingError
+	if errors.As(err, &userFacingErr) {
+		return userFacingErr.Message, true
+	}
+	return "", false
+}
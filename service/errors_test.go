@@ -0,0 +1,23 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetUserFacingMessage(t *testing.T) {
+	err := NewUserFacingError("quota exceeded", errors.New("HTTP 403"))
+	msg, ok := GetUserFacingMessage(fmt.Errorf("error creating server: %w", err))
+	assert.True(t, ok)
+	assert.Equal(t, "quota exceeded", msg)
+	assert.Equal(t, "quota exceeded: HTTP 403", err.Error())
+}
+
+func TestGetUserFacingMessageWithOrdinaryError(t *testing.T) {
+	msg, ok := GetUserFacingMessage(errors.New("HTTP 403"))
+	assert.False(t, ok)
+	assert.Empty(t, msg)
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// initialFormatVersion is the format version of records persisted before
+// format versions were introduced. Such records lack a format version field
+// altogether.
+const initialFormatVersion = 1
+
+// FormatUpgrade is a function that upgrades a persisted record, unmarshaled
+// into a generic map, from one format version to the next. Numbers in the map
+// are represented as json.Number so they survive the upgrade unaltered.
+// Secure values remain encrypted and must be carried over as is.
+type FormatUpgrade func(record map[string]interface{}) error
+
+// formatRegistry tracks the upgrades that, applied in order, bring a persisted
+// record of any supported format version to the latest format version
+type formatRegistry struct {
+	recordType string
+	mutex      sync.RWMutex
+	// upgrades[i] upgrades records from format version initialFormatVersion + i
+	upgrades []FormatUpgrade
+}
+
+var (
+	instanceFormats = &formatRegistry{recordType: "instance"}
+	bindingFormats  = &formatRegistry{recordType: "binding"}
+)
+
+// RegisterInstanceFormatUpgrade registers a function that upgrades persisted
+// instances from the given format version to the next one. Upgrades must be
+// registered in order, so fromVersion must be the latest instance format
+// version at the time of registration; otherwise an error is returned.
+// Persisted instances are upgraded transparently as they are unmarshaled.
+func RegisterInstanceFormatUpgrade(
+	fromVersion int,
+	upgrade FormatUpgrade,
+) error {
+	return instanceFormats.register(fromVersion, upgrade)
+}
+
+// RegisterBindingFormatUpgrade registers a function that upgrades persisted
+// bindings from the given format version to the next one. Upgrades must be
+// registered in order, so fromVersion must be the latest binding format
+// version at the time of registration; otherwise an error is returned.
+// Persisted bindings are upgraded transparently as they are unmarshaled.
+func RegisterBindingFormatUpgrade(
+	fromVersion int,
+	upgrade FormatUpgrade,
+) error {
+	return bindingFormats.register(fromVersion, upgrade)
+}
+
+// GetInstanceFormatVersion returns the format version that instances are
+// persisted in
+func GetInstanceFormatVersion() int {
+	return instanceFormats.getLatestVersion()
+}
+
+// GetBindingFormatVersion returns the format version that bindings are
+// persisted in
+func GetBindingFormatVersion() int {
+	return bindingFormats.getLatestVersion()
+}
+
+func (f *formatRegistry) register(
+	fromVersion int,
+	upgrade FormatUpgrade,
+) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	latestVersion := initialFormatVersion + len(f.upgrades)
+	if fromVersion != latestVersion {
+		return fmt.Errorf(
+			"cannot register upgrade of %s format version %d; upgrades must "+
+				"start from the latest version, %d",
+			f.recordType,
+			fromVersion,
+			latestVersion,
+		)
+	}
+	f.upgrades = append(f.upgrades, upgrade)
+	return nil
+}
+
+func (f *formatRegistry) getLatestVersion() int {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return initialFormatVersion + len(f.upgrades)
+}
+
+// upgrade returns the given JSON record upgraded to the latest format version.
+// Records that are already in the latest format version are returned
+// unaltered.
+func (f *formatRegistry) upgrade(jsonBytes []byte) ([]byte, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	latestVersion := initialFormatVersion + len(f.upgrades)
+	header := struct {
+		FormatVersion int `json:"formatVersion"`
+	}{}
+	if err := json.Unmarshal(jsonBytes, &header); err != nil {
+		return nil, err
+	}
+	version := header.FormatVersion
+	if version == 0 {
+		version = initialFormatVersion
+	}
+	if version == latestVersion {
+		return jsonBytes, nil
+	}
+	if version < initialFormatVersion || version > latestVersion {
+		return nil, fmt.Errorf(
+			"%s format version %d is not supported; the latest supported "+
+				"version is %d",
+			f.recordType,
+			version,
+			latestVersion,
+		)
+	}
+	record := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(jsonBytes))
+	decoder.UseNumber()
+	if err := decoder.Decode(&record); err != nil {
+		return nil, err
+	}
+	for ; version < latestVersion; version++ {
+		if err := f.upgrades[version-initialFormatVersion](record); err != nil {
+			return nil, fmt.Errorf(
+				"error upgrading %s from format version %d: %s",
+				f.recordType,
+				version,
+				err,
+			)
+		}
+		record["formatVersion"] = version + 1
+	}
+	return json.Marshal(record)
+}
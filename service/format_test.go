@@ -0,0 +1,94 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatUpgradesMustBeRegisteredInOrder(t *testing.T) {
+	f := &formatRegistry{recordType: "test"}
+	noop := func(map[string]interface{}) error { return nil }
+	assert.NotNil(t, f.register(initialFormatVersion+1, noop))
+	assert.Nil(t, f.register(initialFormatVersion, noop))
+	assert.NotNil(t, f.register(initialFormatVersion, noop))
+	assert.Nil(t, f.register(initialFormatVersion+1, noop))
+	assert.Equal(t, initialFormatVersion+2, f.getLatestVersion())
+}
+
+func TestFormatUpgradeLeavesLatestRecordsUnaltered(t *testing.T) {
+	f := &formatRegistry{recordType: "test"}
+	// Records lacking a format version predate format versions
+	record := []byte(`{"foo":"bar"}`)
+	upgradedRecord, err := f.upgrade(record)
+	assert.Nil(t, err)
+	assert.Equal(t, record, upgradedRecord)
+}
+
+func TestFormatUpgradeAppliesUpgradesInOrder(t *testing.T) {
+	f := &formatRegistry{recordType: "test"}
+	assert.Nil(t, f.register(
+		initialFormatVersion,
+		func(record map[string]interface{}) error {
+			record["bar"] = record["foo"]
+			delete(record, "foo")
+			return nil
+		},
+	))
+	assert.Nil(t, f.register(
+		initialFormatVersion+1,
+		func(record map[string]interface{}) error {
+			record["bat"] = []interface{}{record["bar"]}
+			delete(record, "bar")
+			return nil
+		},
+	))
+	testCases := map[string][]byte{
+		"legacy record":    []byte(`{"foo":"baz","big":9007199254740993}`),
+		"versioned record": []byte(`{"formatVersion":2,"bar":"baz","big":9007199254740993}`), // nolint: lll
+	}
+	for name, record := range testCases {
+		t.Run(name, func(t *testing.T) {
+			upgradedRecord, err := f.upgrade(record)
+			assert.Nil(t, err)
+			assert.JSONEq(
+				t,
+				// Large numbers survive upgrades without losing precision
+				`{"formatVersion":3,"bat":["baz"],"big":9007199254740993}`,
+				string(upgradedRecord),
+			)
+		})
+	}
+}
+
+func TestFormatUpgradeRejectsUnsupportedVersions(t *testing.T) {
+	f := &formatRegistry{recordType: "test"}
+	_, err := f.upgrade([]byte(`{"formatVersion":2}`))
+	assert.NotNil(t, err)
+	_, err = f.upgrade([]byte(`{"formatVersion":-1}`))
+	assert.NotNil(t, err)
+}
+
+func TestFormatUpgradeReturnsUpgradeErrors(t *testing.T) {
+	f := &formatRegistry{recordType: "test"}
+	assert.Nil(t, f.register(
+		initialFormatVersion,
+		func(map[string]interface{}) error {
+			return errors.New("boom")
+		},
+	))
+	_, err := f.upgrade([]byte(`{}`))
+	assert.NotNil(t, err)
+}
+
+func TestInstanceIsPersistedInLatestFormatVersion(t *testing.T) {
+	jsonBytes, err := Instance{}.ToJSON()
+	assert.Nil(t, err)
+	header := struct {
+		FormatVersion int `json:"formatVersion"`
+	}{}
+	assert.Nil(t, json.Unmarshal(jsonBytes, &header))
+	assert.Equal(t, GetInstanceFormatVersion(), header.FormatVersion)
+}
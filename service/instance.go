@@ -3,24 +3,44 @@ package service
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/barpilot/gosba/crypto"
 )
 
 // Instance represents an instance of a service
 type Instance struct {
-	InstanceID             string                  `json:"instanceId"`
-	Alias                  string                  `json:"alias"`
-	ServiceID              string                  `json:"serviceId"`
-	Service                Service                 `json:"-"`
-	PlanID                 string                  `json:"planId"`
-	Plan                   Plan                    `json:"-"`
-	ProvisioningParameters *ProvisioningParameters `json:"provisioningParameters"`
-	UpdatingParameters     *ProvisioningParameters `json:"updatingParameters"`
-	Status                 string                  `json:"status"`
-	StatusReason           string                  `json:"statusReason"`
-	Parent                 *Instance               `json:"-"`
-	ParentAlias            string                  `json:"parentAlias"`
-	Details                InstanceDetails         `json:"details"`
-	Created                time.Time               `json:"created"`
+	// FormatVersion is the format version the instance was persisted in. It is
+	// always the latest format version once the instance has been unmarshaled.
+	FormatVersion          int                      `json:"formatVersion"`
+	InstanceID             string                   `json:"instanceId"`
+	Alias                  string                   `json:"alias"`
+	ServiceID              string                   `json:"serviceId"`
+	Service                Service                  `json:"-"`
+	PlanID                 string                   `json:"planId"`
+	Plan                   Plan                     `json:"-"`
+	PreviousPlanID         string                   `json:"previousPlanId,omitempty"`
+	ProvisioningParameters *ProvisioningParameters  `json:"provisioningParameters"`
+	UpdatingParameters     *ProvisioningParameters  `json:"updatingParameters"`
+	Status                 string                   `json:"status"`
+	StatusReason           string                   `json:"statusReason"`
+	StatusDescription      string                   `json:"statusDescription,omitempty"`
+	LastCompletedStep      string                   `json:"lastCompletedStep,omitempty"`
+	FailedStep             string                   `json:"failedStep,omitempty"`
+	WaitDeadline           *time.Time               `json:"waitDeadline,omitempty"`
+	OperationDeadline      *time.Time               `json:"operationDeadline,omitempty"`
+	StepExecutions         map[string]StepExecution `json:"stepExecutions,omitempty"`
+	Parent                 *Instance                `json:"-"`
+	ParentAlias            string                   `json:"parentAlias"`
+	Details                InstanceDetails          `json:"details"`
+	Created                time.Time                `json:"created"`
+	// OperationStarted is when the instance's current (or most recent)
+	// operation was requested. It is nil for instances persisted before it was
+	// recorded.
+	OperationStarted *time.Time `json:"operationStarted,omitempty"`
+	// ProvisioningFailed is true if provisioning the instance failed and has not
+	// since been retried successfully. It remains set while such an instance is
+	// deprovisioned, because the instance never accrued any usage.
+	ProvisioningFailed bool `json:"provisioningFailed,omitempty"`
 }
 
 // NewInstanceFromJSON returns a new Instance unmarshalled from the provided
@@ -29,6 +49,24 @@ func NewInstanceFromJSON(
 	jsonBytes []byte,
 	emptyInstanceDetails InstanceDetails,
 	provisioningParametersSchema *InputParametersSchema, // nolint: interfacer
+) (Instance, error) {
+	return NewInstanceFromJSONWithCodec(
+		jsonBytes,
+		emptyInstanceDetails,
+		provisioningParametersSchema,
+		nil,
+	)
+}
+
+// NewInstanceFromJSONWithCodec returns a new Instance unmarshalled from the
+// provided JSON []byte, decrypting secure values using the given codec
+// instead of the globally configured one. If the codec is nil, the globally
+// configured codec is used.
+func NewInstanceFromJSONWithCodec(
+	jsonBytes []byte,
+	emptyInstanceDetails InstanceDetails,
+	provisioningParametersSchema *InputParametersSchema, // nolint: interfacer
+	codec crypto.Codec,
 ) (Instance, error) {
 	instance := Instance{
 		Details: emptyInstanceDetails,
@@ -47,12 +85,34 @@ func NewInstanceFromJSON(
 			},
 		},
 	}
-	err := json.Unmarshal(jsonBytes, &instance)
+	jsonBytes, err := instanceFormats.upgrade(jsonBytes)
+	if err != nil {
+		return instance, err
+	}
+	err = withCodec(codec, func() error {
+		return json.Unmarshal(jsonBytes, &instance)
+	})
+	instance.FormatVersion = instanceFormats.getLatestVersion()
 	return instance, err
 }
 
 // ToJSON returns a []byte containing a JSON representation of the
 // instance
 func (i Instance) ToJSON() ([]byte, error) {
-	return json.Marshal(i)
+	return i.ToJSONWithCodec(nil)
+}
+
+// ToJSONWithCodec returns a []byte containing a JSON representation of the
+// instance, encrypting secure values using the given codec instead of the
+// globally configured one. If the codec is nil, the globally configured codec
+// is used.
+func (i Instance) ToJSONWithCodec(codec crypto.Codec) ([]byte, error) {
+	i.FormatVersion = instanceFormats.getLatestVersion()
+	var jsonBytes []byte
+	err := withCodec(codec, func() error {
+		var err error
+		jsonBytes, err = json.Marshal(i)
+		return err
+	})
+	return jsonBytes, err
 }
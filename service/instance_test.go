@@ -55,6 +55,7 @@ func init() {
 	}
 
 	testInstance = Instance{
+		FormatVersion:          initialFormatVersion,
 		InstanceID:             instanceID,
 		Alias:                  alias,
 		ServiceID:              serviceID,
@@ -70,6 +71,7 @@ func init() {
 
 	testInstanceJSONStr := fmt.Sprintf(
 		`{
+			"formatVersion":%d,
 			"instanceId":"%s",
 			"alias":"%s",
 			"serviceId":"%s",
@@ -82,6 +84,7 @@ func init() {
 			"details":%s,
 			"created":"%s"
 		}`,
+		initialFormatVersion,
 		instanceID,
 		alias,
 		serviceID,
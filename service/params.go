@@ -6,13 +6,14 @@ import (
 	"errors"
 	"fmt"
 
-	"github.com/barpilot/gosba/crypto"
 	"github.com/barpilot/gosba/slice"
 )
 
 // Parameters is a wrapper for a map that uses a schema to inform data access,
 // marshaling, and unmarshaling with seamless encryption and decryption of
-// sensitive string fields using the globally configured codec.
+// sensitive string fields. The globally configured codec is used unless the
+// Parameters are part of an instance or binding that is marshaled or
+// unmarshaled using a codec of its own.
 type Parameters struct {
 	Schema KeyedPropertySchemaContainer
 	Data   map[string]interface{}
@@ -52,7 +53,7 @@ func (p Parameters) MarshalJSON() ([]byte, error) {
 						k,
 					)
 				}
-				encryptedBytes, err := crypto.Encrypt([]byte(vStr))
+				encryptedBytes, err := encrypt([]byte(vStr))
 				if err != nil {
 					return nil, err
 				}
@@ -110,7 +111,7 @@ func (p *Parameters) UnmarshalJSON(bytes []byte) error {
 					if err != nil {
 						return err
 					}
-					decryptedBytes, err := crypto.Decrypt(encryptedBytes)
+					decryptedBytes, err := decrypt(encryptedBytes)
 					if err != nil {
 						return err
 					}
@@ -606,3 +607,78 @@ func ifaceToParams(
 	params.Data = defaultVal
 	return params
 }
+
+// Decode decodes the Parameters' underlying map into the given struct, which
+// is typically the same struct from which the Parameters' schema was generated
+// using NewInputParametersSchemaFromStruct. Any default values specified in
+// the schema are applied to properties that are absent from the map.
+func (p *Parameters) Decode(s interface{}) error {
+	data := p.Data
+	if p.Schema != nil {
+		data = getDataWithDefaults(p.Schema, p.Data)
+	}
+	return GetStructFromMap(data, s)
+}
+
+func getDataWithDefaults(
+	schema KeyedPropertySchemaContainer,
+	data map[string]interface{},
+) map[string]interface{} {
+	retData := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		retData[k] = v
+	}
+	for k, propertySchema := range schema.GetPropertySchemas() {
+		v, ok := data[k]
+		switch ps := propertySchema.(type) {
+		case *StringPropertySchema:
+			if !ok && ps.DefaultValue != "" {
+				retData[k] = ps.DefaultValue
+			}
+		case *IntPropertySchema:
+			if !ok && ps.DefaultValue != nil {
+				retData[k] = *ps.DefaultValue
+			}
+		case *FloatPropertySchema:
+			if !ok && ps.DefaultValue != nil {
+				retData[k] = *ps.DefaultValue
+			}
+		case *ArrayPropertySchema:
+			if !ok && ps.DefaultValue != nil {
+				retData[k] = ps.DefaultValue
+			}
+		case *ObjectPropertySchema:
+			if !ok {
+				v = ps.DefaultValue
+			}
+			if val, ok := v.(map[string]interface{}); ok && val != nil {
+				retData[k] = getDataWithDefaults(ps, val)
+			}
+		}
+	}
+	return retData
+}
+
+// RedactedValue replaces the values of secure parameters in the output of
+// Parameters.Redacted
+const RedactedValue = "REDACTED"
+
+// Redacted returns a copy of the Parameters' underlying map that is safe to
+// log or to share with third parties. The values of any secure properties are
+// replaced with RedactedValue. Since there is no way of knowing which
+// properties are secure without an *InputParametersSchema, nil is returned if
+// the Parameters do not have one.
+func (p Parameters) Redacted() map[string]interface{} {
+	ips, ok := p.Schema.(*InputParametersSchema)
+	if !ok || ips == nil || p.Data == nil {
+		return nil
+	}
+	data := make(map[string]interface{}, len(p.Data))
+	for k, v := range p.Data {
+		if slice.ContainsString(ips.SecureProperties, k) {
+			v = RedactedValue
+		}
+		data[k] = v
+	}
+	return data
+}
@@ -1405,3 +1405,31 @@ func TestGetObjectArray(t *testing.T) {
 		val,
 	)
 }
+
+func TestRedactParameters(t *testing.T) {
+	p := Parameters{
+		Schema: &InputParametersSchema{
+			SecureProperties: []string{"password"},
+			PropertySchemas: map[string]PropertySchema{
+				"location": &StringPropertySchema{},
+				"password": &StringPropertySchema{},
+			},
+		},
+		Data: map[string]interface{}{
+			"location": "eastus",
+			"password": "secret",
+		},
+	}
+	assert.Equal(
+		t,
+		map[string]interface{}{
+			"location": "eastus",
+			"password": RedactedValue,
+		},
+		p.Redacted(),
+	)
+	assert.Equal(t, "secret", p.Data["password"])
+	// Without a schema, there is no way to tell what is secure
+	p.Schema = nil
+	assert.Nil(t, p.Redacted())
+}
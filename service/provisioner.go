@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"fmt"
+	"time"
 )
 
 // ProvisioningStepFunction is the signature for functions that implement a
@@ -23,8 +24,9 @@ type ProvisioningStep interface {
 }
 
 type provisioningStep struct {
-	name string
-	fn   ProvisioningStepFunction
+	name             string
+	fn               ProvisioningStepFunction
+	expectedDuration time.Duration
 }
 
 // Provisioner is an interface to be implemented by types that model a declared
@@ -52,11 +54,33 @@ func NewProvisioningStep(
 	}
 }
 
+// NewProvisioningStepWithExpectedDuration returns a new ProvisioningStep that is
+// expected to take roughly the given duration to execute. Platforms polling
+// for the status of an operation are advised to wait that long between polls
+// while the step executes.
+func NewProvisioningStepWithExpectedDuration(
+	name string,
+	fn ProvisioningStepFunction,
+	expectedDuration time.Duration,
+) ProvisioningStep {
+	return &provisioningStep{
+		name:             name,
+		fn:               fn,
+		expectedDuration: expectedDuration,
+	}
+}
+
 // GetName returns a provisioning step's name
 func (p *provisioningStep) GetName() string {
 	return p.name
 }
 
+// GetExpectedDuration returns roughly how long a provisioning step is expected
+// to take to execute or zero if that is unknown
+func (p *provisioningStep) GetExpectedDuration() time.Duration {
+	return p.expectedDuration
+}
+
 // Execute executes a step
 func (p *provisioningStep) Execute(
 	ctx context.Context,
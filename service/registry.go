@@ -0,0 +1,159 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/barpilot/gosba/slice"
+)
+
+// ModuleRegistry is an interface to be implemented by types that aggregate
+// the services and plans of many modules into a single Catalog
+type ModuleRegistry interface {
+	// GetModules returns all modules that are enabled by the registry's
+	// CatalogConfig
+	GetModules() []Module
+	// GetModule returns the named module, if it is enabled by the registry's
+	// CatalogConfig
+	GetModule(name string) (Module, bool)
+	// GetCatalog returns a Catalog combining the services and plans of all
+	// enabled modules that are permitted by the registry's CatalogConfig
+	GetCatalog() (Catalog, error)
+}
+
+type moduleRegistry struct {
+	config         CatalogConfig
+	modules        []Module
+	indexedModules map[string]Module
+}
+
+// NewModuleRegistry returns a new ModuleRegistry for the given modules.
+// Modules that are disabled by name or that are less stable than the
+// configured minimum stability are omitted.
+func NewModuleRegistry(
+	config CatalogConfig,
+	modules ...Module,
+) (ModuleRegistry, error) {
+	m := &moduleRegistry{
+		config:         config,
+		indexedModules: map[string]Module{},
+	}
+	allModuleNames := map[string]struct{}{}
+	for _, module := range modules {
+		name := module.GetName()
+		if _, ok := allModuleNames[name]; ok {
+			return nil, fmt.Errorf(`duplicate module name "%s" detected`, name)
+		}
+		allModuleNames[name] = struct{}{}
+		if !m.isModuleEnabled(module) {
+			continue
+		}
+		m.modules = append(m.modules, module)
+		m.indexedModules[name] = module
+	}
+	// Catch typos in module names early
+	for _, names := range [][]string{
+		config.EnabledModules,
+		config.DisabledModules,
+	} {
+		for _, name := range names {
+			if _, ok := allModuleNames[name]; !ok {
+				return nil, fmt.Errorf(
+					`catalog config refers to unknown module "%s"`,
+					name,
+				)
+			}
+		}
+	}
+	return m, nil
+}
+
+func (m *moduleRegistry) isModuleEnabled(module Module) bool {
+	name := module.GetName()
+	if len(m.config.EnabledModules) > 0 &&
+		!slice.ContainsString(m.config.EnabledModules, name) {
+		return false
+	}
+	if slice.ContainsString(m.config.DisabledModules, name) {
+		return false
+	}
+	return GetModuleStability(module) >= m.config.MinStability
+}
+
+func (m *moduleRegistry) GetModules() []Module {
+	return m.modules
+}
+
+func (m *moduleRegistry) GetModule(name string) (Module, bool) {
+	module, ok := m.indexedModules[name]
+	return module, ok
+}
+
+// GetCatalog returns a Catalog combining the services and plans of all
+// enabled modules. Migration and disaster recovery services are omitted
+// unless enabled by the registry's CatalogConfig. End-of-life services and
+// plans are retained so that existing instances can still be managed, but, as
+// with any Catalog, they are never advertised to platforms. An error is
+// returned if any service or plan ID is not unique across all modules or if
+// the combined catalog fails validation.
+func (m *moduleRegistry) GetCatalog() (Catalog, error) {
+	services := []Service{}
+	serviceModules := map[string]string{}
+	planModules := map[string]string{}
+	for _, module := range m.modules {
+		catalog, err := module.GetCatalog()
+		if err != nil {
+			return nil, fmt.Errorf(
+				`error retrieving catalog from module "%s": %s`,
+				module.GetName(),
+				err,
+			)
+		}
+		for _, svc := range catalog.GetServices() {
+			if !m.isServiceEnabled(svc) {
+				continue
+			}
+			if otherModule, ok := serviceModules[svc.GetID()]; ok {
+				return nil, fmt.Errorf(
+					`module "%s" service "%s" has id "%s", which is already used by `+
+						`a service of module "%s"`,
+					module.GetName(),
+					svc.GetName(),
+					svc.GetID(),
+					otherModule,
+				)
+			}
+			serviceModules[svc.GetID()] = module.GetName()
+			for _, plan := range svc.GetPlans() {
+				if otherModule, ok := planModules[plan.GetID()]; ok {
+					return nil, fmt.Errorf(
+						`module "%s" service "%s" plan "%s" has id "%s", which is `+
+							`already used by a plan of module "%s"`,
+						module.GetName(),
+						svc.GetName(),
+						plan.GetName(),
+						plan.GetID(),
+						otherModule,
+					)
+				}
+				planModules[plan.GetID()] = module.GetName()
+			}
+			services = append(services, svc)
+		}
+	}
+	catalog := NewCatalog(services)
+	if err := catalog.Validate(); err != nil {
+		return nil, err
+	}
+	return catalog, nil
+}
+
+func (m *moduleRegistry) isServiceEnabled(svc Service) bool {
+	properties := svc.GetProperties()
+	if properties.Migration && !m.config.EnableMigrationServices {
+		return false
+	}
+	if properties.DisasterRecovery && !m.config.EnableDRServices {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testFooSvcID           = "d7f4e0a2-5b1c-4e3a-9f6d-2c8b7a1e0f31"
+	testFooPlanID          = "0c6a9e1d-3b7f-4a2e-8d5c-9f1e2b3a4c52"
+	testFooMigrationSvcID  = "5e2b8c1a-7d4f-4b6e-a3c9-1f0d2e3b4a63"
+	testFooMigrationPlanID = "9a3d6f2e-1c8b-4e7a-b5d4-2e1f0c9b8a74"
+	testBarSvcID           = "3f8c1b7d-6e2a-4d9f-8b1e-5a4c3d2e1f85"
+	testBarPlanID          = "7b1e4d9a-2f6c-4a8e-9c3b-6d5e4f3a2b96"
+	testBatSvcID           = "1d9a5c3e-8b2f-4e6d-a7c1-3b2a1f0e9da7"
+	testBatPlanID          = "e4c7a2f9-6d1b-4c5a-8e9f-7a6b5c4d3eb8"
+	testPlanID             = "2a5f8d1c-9e3b-4f7a-b6d2-8c7b6a5f4ec9"
+	testSvcID              = "f0e1d2c3-b4a5-4968-8776-655443322110"
+)
+
+type testModule struct {
+	name      string
+	stability Stability
+	services  []Service
+}
+
+func (t *testModule) GetName() string {
+	return t.name
+}
+
+func (t *testModule) GetCatalog() (Catalog, error) {
+	return NewCatalog(t.services), nil
+}
+
+func (t *testModule) GetStability() Stability {
+	return t.stability
+}
+
+func newTestRegistryService(
+	serviceProperties ServiceProperties,
+	planIDs ...string,
+) Service {
+	// Names and descriptions are filled in so that catalogs pass validation
+	serviceProperties.Name = fmt.Sprintf("svc-%s", serviceProperties.ID)
+	serviceProperties.Description = "test service"
+	plans := make([]Plan, len(planIDs))
+	for i, planID := range planIDs {
+		plans[i] = NewPlan(PlanProperties{
+			ID:          planID,
+			Name:        fmt.Sprintf("plan-%d", i),
+			Description: "test plan",
+		})
+	}
+	return NewService(serviceProperties, nil, plans...)
+}
+
+func TestModuleRegistryCombinesCatalogs(t *testing.T) {
+	registry, err := NewModuleRegistry(
+		NewCatalogConfigWithDefaults(),
+		&testModule{
+			name:      "foo",
+			stability: StabilityStable,
+			services: []Service{
+				newTestRegistryService(ServiceProperties{ID: testFooSvcID}, testFooPlanID),
+				newTestRegistryService(
+					ServiceProperties{ID: testFooMigrationSvcID, Migration: true},
+					testFooMigrationPlanID,
+				),
+			},
+		},
+		&testModule{
+			name:      "bar",
+			stability: StabilityPreview,
+			services: []Service{
+				newTestRegistryService(ServiceProperties{ID: testBarSvcID}, testBarPlanID),
+			},
+		},
+		&testModule{
+			name:      "bat",
+			stability: StabilityExperimental,
+			services: []Service{
+				newTestRegistryService(ServiceProperties{ID: testBatSvcID}, testBatPlanID),
+			},
+		},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(registry.GetModules()))
+	_, ok := registry.GetModule("bat")
+	assert.False(t, ok)
+	catalog, err := registry.GetCatalog()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(catalog.GetServices()))
+	_, ok = catalog.GetService(testFooSvcID)
+	assert.True(t, ok)
+	_, ok = catalog.GetService(testBarSvcID)
+	assert.True(t, ok)
+	_, ok = catalog.GetService(testFooMigrationSvcID)
+	assert.False(t, ok)
+}
+
+func TestModuleRegistryEnablesAndDisablesModulesByName(t *testing.T) {
+	modules := []Module{
+		&testModule{name: "foo", stability: StabilityStable},
+		&testModule{name: "bar", stability: StabilityStable},
+	}
+	config := NewCatalogConfigWithDefaults()
+	config.EnabledModules = []string{"foo"}
+	registry, err := NewModuleRegistry(config, modules...)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(registry.GetModules()))
+	_, ok := registry.GetModule("foo")
+	assert.True(t, ok)
+	config = NewCatalogConfigWithDefaults()
+	config.DisabledModules = []string{"foo"}
+	registry, err = NewModuleRegistry(config, modules...)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(registry.GetModules()))
+	_, ok = registry.GetModule("bar")
+	assert.True(t, ok)
+	config.DisabledModules = []string{"baz"}
+	_, err = NewModuleRegistry(config, modules...)
+	assert.NotNil(t, err)
+}
+
+func TestModuleRegistryWithDuplicateModuleNames(t *testing.T) {
+	_, err := NewModuleRegistry(
+		NewCatalogConfigWithDefaults(),
+		&testModule{name: "foo", stability: StabilityStable},
+		&testModule{name: "foo", stability: StabilityStable},
+	)
+	assert.NotNil(t, err)
+}
+
+func TestModuleRegistryWithDuplicateIDs(t *testing.T) {
+	registry, err := NewModuleRegistry(
+		NewCatalogConfigWithDefaults(),
+		&testModule{
+			name:      "foo",
+			stability: StabilityStable,
+			services: []Service{
+				newTestRegistryService(ServiceProperties{ID: testSvcID}, testFooPlanID),
+			},
+		},
+		&testModule{
+			name:      "bar",
+			stability: StabilityStable,
+			services: []Service{
+				newTestRegistryService(ServiceProperties{ID: testSvcID}, testBarPlanID),
+			},
+		},
+	)
+	assert.Nil(t, err)
+	_, err = registry.GetCatalog()
+	assert.NotNil(t, err)
+	registry, err = NewModuleRegistry(
+		NewCatalogConfigWithDefaults(),
+		&testModule{
+			name:      "foo",
+			stability: StabilityStable,
+			services: []Service{
+				newTestRegistryService(ServiceProperties{ID: testFooSvcID}, testPlanID),
+				newTestRegistryService(ServiceProperties{ID: testBarSvcID}, testPlanID),
+			},
+		},
+	)
+	assert.Nil(t, err)
+	_, err = registry.GetCatalog()
+	assert.NotNil(t, err)
+}
+
+func TestModuleRegistryWithMalformedIDs(t *testing.T) {
+	registry, err := NewModuleRegistry(
+		NewCatalogConfigWithDefaults(),
+		&testModule{
+			name:      "foo",
+			stability: StabilityStable,
+			services: []Service{
+				newTestRegistryService(ServiceProperties{ID: "foo-svc"}, testPlanID),
+			},
+		},
+	)
+	assert.Nil(t, err)
+	_, err = registry.GetCatalog()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,409 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const schemaTagName = "schema"
+
+// NewInputParametersSchemaFromStruct returns an InputParametersSchema derived
+// from the exported fields of the given struct (or pointer to struct). Each
+// field's property name is taken from its json tag, exactly as
+// GetStructFromMap and Parameters.Decode expect. Fields tagged json:"-" are
+// ignored. Further details of each property's schema are taken from an
+// optional schema tag containing semicolon-delimited options. e.g.:
+//
+//	Location string `json:"location" schema:"title=Location;required"`
+//	Tier     string `json:"tier" schema:"enum=basic,standard;default=basic"`
+//	Cores    int64  `json:"cores" schema:"min=1;max=64;default=2"`
+//	Password string `json:"password" schema:"secure;min=8"`
+//	Name     string `json:"name" schema:"pattern=^[a-z]+$"`
+//
+// Supported options are title, description, enum (comma-delimited), min, max,
+// pattern, default, required, and secure. min and max constrain the length of
+// strings, the value of numbers, and the number of items in arrays. enum and
+// default apply only to strings and numbers, and pattern only to strings.
+// Options that don't apply to a field's kind are treated as errors, as are
+// defaults that the field's other options would reject. Only top-level string
+// properties may be secure.
+//
+// Fields of type string, any integer or floating point type, struct, slice,
+// and map with string keys (or pointers to any of these) are supported.
+// Boolean fields are not, since there is no boolean kind of PropertySchema.
+func NewInputParametersSchemaFromStruct(
+	s interface{},
+) (InputParametersSchema, error) {
+	t := reflect.TypeOf(s)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return InputParametersSchema{}, fmt.Errorf(
+			"error generating schema: %T is not a struct",
+			s,
+		)
+	}
+	ips := InputParametersSchema{}
+	var err error
+	ips.PropertySchemas, ips.RequiredProperties, ips.SecureProperties, err =
+		getStructPropertySchemas(t, "")
+	if err != nil {
+		return InputParametersSchema{}, fmt.Errorf(
+			"error generating schema: %s",
+			err,
+		)
+	}
+	return ips, nil
+}
+
+func getStructPropertySchemas(
+	t reflect.Type,
+	context string,
+) (map[string]PropertySchema, []string, []string, error) {
+	propertySchemas := map[string]PropertySchema{}
+	required := []string{}
+	secure := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" { // Unexported
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		propertyContext := name
+		if context != "" {
+			propertyContext = fmt.Sprintf("%s.%s", context, name)
+		}
+		opts, err := parseSchemaTag(field.Tag.Get(schemaTagName))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf(`field "%s": %s`, propertyContext, err)
+		}
+		propertySchema, err := getPropertySchema(field.Type, opts, propertyContext)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		propertySchemas[name] = propertySchema
+		if _, ok := opts["required"]; ok {
+			required = append(required, name)
+		}
+		if _, ok := opts["secure"]; ok {
+			if _, ok := propertySchema.(*StringPropertySchema); !ok || context != "" {
+				return nil, nil, nil, fmt.Errorf(
+					`field "%s": only top-level string fields can be secure`,
+					propertyContext,
+				)
+			}
+			secure = append(secure, name)
+		}
+	}
+	return propertySchemas, required, secure, nil
+}
+
+func getPropertySchema(
+	t reflect.Type,
+	opts map[string]string,
+	context string,
+) (PropertySchema, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if err := checkSchemaOpts(t.Kind(), opts); err != nil {
+		return nil, fmt.Errorf(`field "%s": %s`, context, err)
+	}
+	var propertySchema PropertySchema
+	var err error
+	switch t.Kind() {
+	case reflect.String:
+		if propertySchema, err = getStringPropertySchema(opts); err != nil {
+			return nil, fmt.Errorf(`field "%s": %s`, context, err)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		if propertySchema, err = getIntPropertySchema(opts); err != nil {
+			return nil, fmt.Errorf(`field "%s": %s`, context, err)
+		}
+	case reflect.Float32, reflect.Float64:
+		if propertySchema, err = getFloatPropertySchema(opts); err != nil {
+			return nil, fmt.Errorf(`field "%s": %s`, context, err)
+		}
+	case reflect.Slice, reflect.Array:
+		propertySchema, err = getArrayPropertySchema(t, opts, context)
+	case reflect.Struct:
+		ops := &ObjectPropertySchema{
+			Title:       opts["title"],
+			Description: opts["description"],
+		}
+		ops.PropertySchemas, ops.RequiredProperties, _, err =
+			getStructPropertySchemas(t, context)
+		propertySchema = ops
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf(
+				`field "%s": only maps with string keys are supported`,
+				context,
+			)
+		}
+		ops := &ObjectPropertySchema{
+			Title:       opts["title"],
+			Description: opts["description"],
+		}
+		ops.Additional, err = getPropertySchema(
+			t.Elem(),
+			map[string]string{},
+			context,
+		)
+		propertySchema = ops
+	default:
+		return nil, fmt.Errorf(
+			`field "%s": fields of kind %s are not supported`,
+			context,
+			t.Kind(),
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return propertySchema, nil
+}
+
+func getStringPropertySchema(
+	opts map[string]string,
+) (*StringPropertySchema, error) {
+	sps := &StringPropertySchema{
+		Title:          opts["title"],
+		Description:    opts["description"],
+		AllowedPattern: opts["pattern"],
+		DefaultValue:   opts["default"],
+	}
+	if enum, ok := opts["enum"]; ok {
+		sps.AllowedValues = strings.Split(enum, ",")
+	}
+	var err error
+	if sps.MinLength, err = parseIntOpt(opts, "min"); err != nil {
+		return nil, err
+	}
+	if sps.MaxLength, err = parseIntOpt(opts, "max"); err != nil {
+		return nil, err
+	}
+	if sps.AllowedPattern != "" {
+		if _, err = regexp.Compile(sps.AllowedPattern); err != nil {
+			return nil, fmt.Errorf(
+				`invalid value "%s" for "pattern": %s`,
+				sps.AllowedPattern,
+				err,
+			)
+		}
+	}
+	if _, ok := opts["default"]; ok {
+		if err = sps.validate("default", sps.DefaultValue); err != nil {
+			return nil, err
+		}
+	}
+	return sps, nil
+}
+
+func getIntPropertySchema(opts map[string]string) (*IntPropertySchema, error) {
+	ips := &IntPropertySchema{
+		Title:       opts["title"],
+		Description: opts["description"],
+	}
+	var err error
+	if ips.MinValue, err = parseInt64Opt(opts, "min"); err != nil {
+		return nil, err
+	}
+	if ips.MaxValue, err = parseInt64Opt(opts, "max"); err != nil {
+		return nil, err
+	}
+	if ips.DefaultValue, err = parseInt64Opt(opts, "default"); err != nil {
+		return nil, err
+	}
+	if enum, ok := opts["enum"]; ok {
+		for _, valStr := range strings.Split(enum, ",") {
+			val, err := strconv.ParseInt(valStr, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf(`invalid enum value "%s"`, valStr)
+			}
+			ips.AllowedValues = append(ips.AllowedValues, val)
+		}
+	}
+	if ips.DefaultValue != nil {
+		if err = ips.validate("default", ips.DefaultValue); err != nil {
+			return nil, err
+		}
+	}
+	return ips, nil
+}
+
+func getFloatPropertySchema(
+	opts map[string]string,
+) (*FloatPropertySchema, error) {
+	fps := &FloatPropertySchema{
+		Title:       opts["title"],
+		Description: opts["description"],
+	}
+	var err error
+	if fps.MinValue, err = parseFloat64Opt(opts, "min"); err != nil {
+		return nil, err
+	}
+	if fps.MaxValue, err = parseFloat64Opt(opts, "max"); err != nil {
+		return nil, err
+	}
+	if fps.DefaultValue, err = parseFloat64Opt(opts, "default"); err != nil {
+		return nil, err
+	}
+	if enum, ok := opts["enum"]; ok {
+		for _, valStr := range strings.Split(enum, ",") {
+			val, err := strconv.ParseFloat(valStr, 64)
+			if err != nil {
+				return nil, fmt.Errorf(`invalid enum value "%s"`, valStr)
+			}
+			fps.AllowedValues = append(fps.AllowedValues, val)
+		}
+	}
+	if fps.DefaultValue != nil {
+		if err = fps.validate("default", fps.DefaultValue); err != nil {
+			return nil, err
+		}
+	}
+	return fps, nil
+}
+
+func getArrayPropertySchema(
+	t reflect.Type,
+	opts map[string]string,
+	context string,
+) (*ArrayPropertySchema, error) {
+	aps := &ArrayPropertySchema{
+		Title:       opts["title"],
+		Description: opts["description"],
+	}
+	var err error
+	if aps.MinItems, err = parseIntOpt(opts, "min"); err != nil {
+		return nil, fmt.Errorf(`field "%s": %s`, context, err)
+	}
+	if aps.MaxItems, err = parseIntOpt(opts, "max"); err != nil {
+		return nil, fmt.Errorf(`field "%s": %s`, context, err)
+	}
+	aps.ItemsSchema, err = getPropertySchema(
+		t.Elem(),
+		map[string]string{},
+		fmt.Sprintf("%s[]", context),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return aps, nil
+}
+
+// checkSchemaOpts returns an error if any of the given options doesn't apply
+// to fields of the given kind. Whether a field may be secure is determined
+// separately, since that also depends on where the field is.
+func checkSchemaOpts(kind reflect.Kind, opts map[string]string) error {
+	applicable := map[string]bool{}
+	switch kind {
+	case reflect.String:
+		applicable = map[string]bool{
+			"enum":    true,
+			"min":     true,
+			"max":     true,
+			"pattern": true,
+			"default": true,
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Float32, reflect.Float64:
+		applicable = map[string]bool{
+			"enum":    true,
+			"min":     true,
+			"max":     true,
+			"default": true,
+		}
+	case reflect.Slice, reflect.Array:
+		applicable = map[string]bool{
+			"min": true,
+			"max": true,
+		}
+	}
+	for _, opt := range []string{"enum", "min", "max", "pattern", "default"} {
+		if _, ok := opts[opt]; ok && !applicable[opt] {
+			return fmt.Errorf(
+				`schema option "%s" does not apply to fields of kind %s`,
+				opt,
+				kind,
+			)
+		}
+	}
+	return nil
+}
+
+// parseSchemaTag parses a schema tag into a map of options. Options are
+// delimited by semicolons. Each option is either a key=value pair or a lone
+// key (e.g. required).
+func parseSchemaTag(tag string) (map[string]string, error) {
+	opts := map[string]string{}
+	for _, opt := range strings.Split(tag, ";") {
+		if opt = strings.TrimSpace(opt); opt == "" {
+			continue
+		}
+		tokens := strings.SplitN(opt, "=", 2)
+		key := strings.TrimSpace(tokens[0])
+		switch key {
+		case "title", "description", "enum", "min", "max", "pattern", "default":
+			if len(tokens) != 2 {
+				return nil, fmt.Errorf(`schema option "%s" requires a value`, key)
+			}
+			opts[key] = tokens[1]
+		case "required", "secure":
+			opts[key] = ""
+		default:
+			return nil, fmt.Errorf(`unrecognized schema option "%s"`, key)
+		}
+	}
+	return opts, nil
+}
+
+func parseIntOpt(opts map[string]string, key string) (*int, error) {
+	valStr, ok := opts[key]
+	if !ok {
+		return nil, nil
+	}
+	val, err := strconv.Atoi(valStr)
+	if err != nil {
+		return nil, fmt.Errorf(`invalid value "%s" for "%s"`, valStr, key)
+	}
+	return &val, nil
+}
+
+func parseInt64Opt(opts map[string]string, key string) (*int64, error) {
+	valStr, ok := opts[key]
+	if !ok {
+		return nil, nil
+	}
+	val, err := strconv.ParseInt(valStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf(`invalid value "%s" for "%s"`, valStr, key)
+	}
+	return &val, nil
+}
+
+func parseFloat64Opt(opts map[string]string, key string) (*float64, error) {
+	valStr, ok := opts[key]
+	if !ok {
+		return nil, nil
+	}
+	val, err := strconv.ParseFloat(valStr, 64)
+	if err != nil {
+		return nil, fmt.Errorf(`invalid value "%s" for "%s"`, valStr, key)
+	}
+	return &val, nil
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSchemaNetwork struct {
+	Subnet string `json:"subnet" schema:"required;pattern=^[0-9./]+$"`
+}
+
+type testSchemaParams struct {
+	Location string            `json:"location" schema:"title=Location;required"`
+	Tier     string            `json:"tier" schema:"enum=basic,standard;default=basic"` // nolint: lll
+	Cores    int64             `json:"cores" schema:"min=1;max=64;default=2"`
+	Ratio    float64           `json:"ratio,omitempty" schema:"min=0;max=1"`
+	Password string            `json:"password" schema:"secure;min=8"`
+	Tags     map[string]string `json:"tags"`
+	Zones    []string          `json:"zones" schema:"max=3"`
+	Network  testSchemaNetwork `json:"network"`
+	Ignored  string            `json:"-"`
+}
+
+func TestNewInputParametersSchemaFromStruct(t *testing.T) {
+	ips, err := NewInputParametersSchemaFromStruct(&testSchemaParams{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"location"}, ips.RequiredProperties)
+	assert.Equal(t, []string{"password"}, ips.SecureProperties)
+	assert.Equal(t, 8, len(ips.PropertySchemas))
+	assert.Equal(
+		t,
+		&StringPropertySchema{
+			Title: "Location",
+		},
+		ips.PropertySchemas["location"],
+	)
+	assert.Equal(
+		t,
+		&StringPropertySchema{
+			AllowedValues: []string{"basic", "standard"},
+			DefaultValue:  "basic",
+		},
+		ips.PropertySchemas["tier"],
+	)
+	cores, ok := ips.PropertySchemas["cores"].(*IntPropertySchema)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), *cores.MinValue)
+	assert.Equal(t, int64(64), *cores.MaxValue)
+	assert.Equal(t, int64(2), *cores.DefaultValue)
+	password, ok := ips.PropertySchemas["password"].(*StringPropertySchema)
+	assert.True(t, ok)
+	assert.Equal(t, 8, *password.MinLength)
+	tags, ok := ips.PropertySchemas["tags"].(*ObjectPropertySchema)
+	assert.True(t, ok)
+	assert.Equal(t, &StringPropertySchema{}, tags.Additional)
+	zones, ok := ips.PropertySchemas["zones"].(*ArrayPropertySchema)
+	assert.True(t, ok)
+	assert.Equal(t, 3, *zones.MaxItems)
+	network, ok := ips.PropertySchemas["network"].(*ObjectPropertySchema)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"subnet"}, network.RequiredProperties)
+	// The generated schema should be usable for validation
+	assert.Nil(t, ips.Validate(map[string]interface{}{"location": "eastus"}))
+	assert.NotNil(t, ips.Validate(map[string]interface{}{"location": 1}))
+	assert.NotNil(
+		t,
+		ips.Validate(map[string]interface{}{"location": "eastus", "cores": 65.0}),
+	)
+	assert.NotNil(
+		t,
+		ips.Validate(map[string]interface{}{
+			"location": "eastus",
+			"network": map[string]interface{}{
+				"subnet": "foo",
+			},
+		}),
+	)
+	_, err = json.Marshal(ips)
+	assert.Nil(t, err)
+}
+
+func TestNewInputParametersSchemaFromStructWithInvalidTags(t *testing.T) {
+	_, err := NewInputParametersSchemaFromStruct(struct {
+		Foo string `json:"foo" schema:"bar=bat"`
+	}{})
+	assert.NotNil(t, err)
+	_, err = NewInputParametersSchemaFromStruct(struct {
+		Foo int64 `json:"foo" schema:"secure"`
+	}{})
+	assert.NotNil(t, err)
+	_, err = NewInputParametersSchemaFromStruct(struct {
+		Foo bool `json:"foo"`
+	}{})
+	assert.NotNil(t, err)
+	_, err = NewInputParametersSchemaFromStruct("foo")
+	assert.NotNil(t, err)
+}
+
+func TestNewInputParametersSchemaFromStructWithInapplicableTags(
+	t *testing.T,
+) {
+	testCases := map[string]interface{}{
+		"pattern on integer": struct {
+			Foo int64 `json:"foo" schema:"pattern=^[0-9]+$"`
+		}{},
+		"pattern on float": struct {
+			Foo float64 `json:"foo" schema:"pattern=^[0-9]+$"`
+		}{},
+		"enum on array": struct {
+			Foo []string `json:"foo" schema:"enum=bar,bat"`
+		}{},
+		"default on object": struct {
+			Foo map[string]string `json:"foo" schema:"default=bar"`
+		}{},
+		"min on struct": struct {
+			Foo testSchemaNetwork `json:"foo" schema:"min=1"`
+		}{},
+	}
+	for name, s := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewInputParametersSchemaFromStruct(s)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestNewInputParametersSchemaFromStructWithInvalidDefaults(
+	t *testing.T,
+) {
+	testCases := map[string]interface{}{
+		"string default not in enum": struct {
+			Foo string `json:"foo" schema:"enum=bar,bat;default=baz"`
+		}{},
+		"string default too short": struct {
+			Foo string `json:"foo" schema:"min=4;default=bar"`
+		}{},
+		"string default too long": struct {
+			Foo string `json:"foo" schema:"max=2;default=bar"`
+		}{},
+		"string default not matching pattern": struct {
+			Foo string `json:"foo" schema:"pattern=^[0-9]+$;default=bar"`
+		}{},
+		"invalid pattern": struct {
+			Foo string `json:"foo" schema:"pattern=[;default=bar"`
+		}{},
+		"integer default not in enum": struct {
+			Foo int64 `json:"foo" schema:"enum=1,2;default=3"`
+		}{},
+		"integer default below min": struct {
+			Foo int64 `json:"foo" schema:"min=1;default=0"`
+		}{},
+		"integer default above max": struct {
+			Foo int64 `json:"foo" schema:"max=1;default=2"`
+		}{},
+		"float default below min": struct {
+			Foo float64 `json:"foo" schema:"min=0.5;default=0.1"`
+		}{},
+		"float default not in enum": struct {
+			Foo float64 `json:"foo" schema:"enum=0.5,1.5;default=1"`
+		}{},
+	}
+	for name, s := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewInputParametersSchemaFromStruct(s)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestParametersDecode(t *testing.T) {
+	ips, err := NewInputParametersSchemaFromStruct(testSchemaParams{})
+	assert.Nil(t, err)
+	params := Parameters{
+		Schema: &ips,
+		Data: map[string]interface{}{
+			"location": "eastus",
+			"zones":    []interface{}{"1", "2"},
+			"network": map[string]interface{}{
+				"subnet": "10.0.0.0/24",
+			},
+		},
+	}
+	decoded := testSchemaParams{}
+	err = params.Decode(&decoded)
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		testSchemaParams{
+			Location: "eastus",
+			Tier:     "basic",
+			Cores:    2,
+			Zones:    []string{"1", "2"},
+			Network: testSchemaNetwork{
+				Subnet: "10.0.0.0/24",
+			},
+		},
+		decoded,
+	)
+}
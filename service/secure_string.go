@@ -1,18 +1,16 @@
 package service
 
-import (
-	"encoding/json"
-
-	"github.com/barpilot/gosba/crypto"
-)
+import "encoding/json"
 
 // SecureString is a string that is seamlessly encrypted and decrypted when it
-// is, respectively, marshaled or unmarshaled
+// is, respectively, marshaled or unmarshaled. The globally configured codec is
+// used unless the SecureString is part of an instance or binding that is
+// marshaled or unmarshaled using a codec of its own.
 type SecureString string
 
 // MarshalJSON converts a SecureString to JSON, encrypting it in the process
 func (s SecureString) MarshalJSON() ([]byte, error) {
-	encryptedBytes, err := crypto.Encrypt([]byte(string(s)))
+	encryptedBytes, err := encrypt([]byte(string(s)))
 	if err != nil {
 		return nil, err
 	}
@@ -26,7 +24,7 @@ func (s *SecureString) UnmarshalJSON(bytes []byte) error {
 	if err != nil {
 		return err
 	}
-	decryptedBytes, err := crypto.Decrypt(encryptedBytes)
+	decryptedBytes, err := decrypt(encryptedBytes)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,63 @@
+package service
+
+import "fmt"
+
+// Stability represents the relative stability of a module
+type Stability int
+
+const (
+	// StabilityExperimental represents relative stability of the most immature
+	// modules. At this level of stability, we're not even certain we've built
+	// the right thing!
+	StabilityExperimental Stability = iota
+	// StabilityPreview represents relative stability of modules we believe are
+	// approaching a stable state
+	StabilityPreview
+	// StabilityStable represents relative stability of the mature, production-
+	// ready modules
+	StabilityStable
+)
+
+// StabilityModule is an interface that may optionally be implemented by
+// modules that are less than stable. Modules that don't implement this
+// interface are assumed to be stable.
+type StabilityModule interface {
+	GetStability() Stability
+}
+
+// GetModuleStability returns the stability of the given module
+func GetModuleStability(module Module) Stability {
+	if stabilityModule, ok := module.(StabilityModule); ok {
+		return stabilityModule.GetStability()
+	}
+	return StabilityStable
+}
+
+// ParseStability returns the Stability represented by the given string
+func ParseStability(str string) (Stability, error) {
+	switch str {
+	case "EXPERIMENTAL":
+		return StabilityExperimental, nil
+	case "PREVIEW":
+		return StabilityPreview, nil
+	case "STABLE":
+		return StabilityStable, nil
+	default:
+		return StabilityStable, fmt.Errorf(
+			`unrecognized stability "%s"; valid values are "EXPERIMENTAL", `+
+				`"PREVIEW", and "STABLE"`,
+			str,
+		)
+	}
+}
+
+func (s Stability) String() string {
+	switch s {
+	case StabilityExperimental:
+		return "EXPERIMENTAL"
+	case StabilityPreview:
+		return "PREVIEW"
+	default:
+		return "STABLE"
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+type idempotencyKeyContextKey struct{}
+
+// StepExecution records the execution of a single provisioning, updating, or
+// deprovisioning step. Together, the step executions of an instance form a
+// ledger that allows the broker to recognize steps that were already
+// completed when a task is redelivered by the async engine.
+type StepExecution struct {
+	// IdempotencyKey uniquely identifies this execution of the step. It
+	// remains the same if the step is attempted again (e.g. after a worker
+	// crashed or after a failed operation is resumed), so modules can pass it
+	// along to external APIs that support idempotent requests.
+	IdempotencyKey string     `json:"idempotencyKey"`
+	Started        time.Time  `json:"started"`
+	Completed      *time.Time `json:"completed,omitempty"`
+	// DetailsHash is a hash of the serialized instance details that resulted
+	// from completion of the step
+	DetailsHash string `json:"detailsHash,omitempty"`
+}
+
+// StartStepExecution records that the named step of the given instance's
+// current operation has started and returns the record. If the step was
+// previously started, but never completed, the idempotency key of that
+// earlier attempt is retained.
+func StartStepExecution(instance *Instance, stepName string) StepExecution {
+	execution, ok := instance.StepExecutions[stepName]
+	if !ok {
+		execution.IdempotencyKey = uuid.NewV4().String()
+	}
+	execution.Started = time.Now()
+	execution.Completed = nil
+	execution.DetailsHash = ""
+	if instance.StepExecutions == nil {
+		instance.StepExecutions = map[string]StepExecution{}
+	}
+	instance.StepExecutions[stepName] = execution
+	return execution
+}
+
+// CompleteStepExecution records that the named step of the given instance's
+// current operation has completed, resulting in the given details
+func CompleteStepExecution(
+	instance *Instance,
+	stepName string,
+	details InstanceDetails,
+) error {
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	detailsHash := sha256.Sum256(detailsJSON)
+	execution, ok := instance.StepExecutions[stepName]
+	if !ok {
+		execution = StartStepExecution(instance, stepName)
+	}
+	completed := time.Now()
+	execution.Completed = &completed
+	execution.DetailsHash = hex.EncodeToString(detailsHash[:])
+	instance.StepExecutions[stepName] = execution
+	return nil
+}
+
+// IsStepCompleted returns a bool indicating whether the named step of the
+// given instance's current operation has already completed
+func IsStepCompleted(instance Instance, stepName string) bool {
+	execution, ok := instance.StepExecutions[stepName]
+	return ok && execution.Completed != nil
+}
+
+// WithIdempotencyKey returns a copy of the given context that carries the
+// given idempotency key
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+// GetIdempotencyKey returns the idempotency key for the step execution
+// associated with the given context. Modules may use this key to make calls
+// to external APIs safe to repeat if a step is executed more than once.
+func GetIdempotencyKey(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idempotencyKeyContextKey{}).(string)
+	return key, ok
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartStepExecutionRetainsIdempotencyKey(t *testing.T) {
+	instance := Instance{}
+	execution := StartStepExecution(&instance, "foo")
+	assert.NotEmpty(t, execution.IdempotencyKey)
+	assert.Nil(t, execution.Completed)
+	assert.False(t, IsStepCompleted(instance, "foo"))
+	// An incomplete step that is attempted again must use the same key
+	retriedExecution := StartStepExecution(&instance, "foo")
+	assert.Equal(t, execution.IdempotencyKey, retriedExecution.IdempotencyKey)
+	// Other steps use other keys
+	otherExecution := StartStepExecution(&instance, "bar")
+	assert.NotEqual(t, execution.IdempotencyKey, otherExecution.IdempotencyKey)
+}
+
+func TestCompleteStepExecution(t *testing.T) {
+	instance := Instance{}
+	execution := StartStepExecution(&instance, "foo")
+	err := CompleteStepExecution(
+		&instance,
+		"foo",
+		map[string]string{"foo": "bar"},
+	)
+	assert.Nil(t, err)
+	assert.True(t, IsStepCompleted(instance, "foo"))
+	completedExecution := instance.StepExecutions["foo"]
+	assert.Equal(t, execution.IdempotencyKey, completedExecution.IdempotencyKey)
+	assert.NotNil(t, completedExecution.Completed)
+	assert.NotEmpty(t, completedExecution.DetailsHash)
+}
+
+func TestIdempotencyKeyContext(t *testing.T) {
+	_, ok := GetIdempotencyKey(context.Background())
+	assert.False(t, ok)
+	key, ok := GetIdempotencyKey(
+		WithIdempotencyKey(context.Background(), "foo"),
+	)
+	assert.True(t, ok)
+	assert.Equal(t, "foo", key)
+}
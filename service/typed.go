@@ -0,0 +1,291 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TypedProvisioningStepFunction is the signature for functions that implement
+// a provisioning step using instance details of type D
+type TypedProvisioningStepFunction[D any] func(
+	ctx context.Context,
+	instance Instance,
+	details *D,
+) (*D, error)
+
+// TypedUpdatingStepFunction is the signature for functions that implement an
+// updating step using instance details of type D
+type TypedUpdatingStepFunction[D any] func(
+	ctx context.Context,
+	instance Instance,
+	details *D,
+) (*D, error)
+
+// TypedDeprovisioningStepFunction is the signature for functions that
+// implement a deprovisioning step using instance details of type D
+type TypedDeprovisioningStepFunction[D any] func(
+	ctx context.Context,
+	instance Instance,
+	details *D,
+) (*D, error)
+
+// NewTypedProvisioningStep returns a new ProvisioningStep that hands instance
+// details to the given function as a *D
+func NewTypedProvisioningStep[D any](
+	name string,
+	fn TypedProvisioningStepFunction[D],
+) ProvisioningStep {
+	return NewProvisioningStep(name, adaptStepFunction(fn))
+}
+
+// NewTypedProvisioningStepWithExpectedDuration returns a new ProvisioningStep
+// that hands instance details to the given function as a *D and that is
+// expected to take roughly the given duration to execute
+func NewTypedProvisioningStepWithExpectedDuration[D any](
+	name string,
+	fn TypedProvisioningStepFunction[D],
+	expectedDuration time.Duration,
+) ProvisioningStep {
+	return NewProvisioningStepWithExpectedDuration(
+		name,
+		adaptStepFunction(fn),
+		expectedDuration,
+	)
+}
+
+// NewTypedUpdatingStep returns a new UpdatingStep that hands instance details
+// to the given function as a *D
+func NewTypedUpdatingStep[D any](
+	name string,
+	fn TypedUpdatingStepFunction[D],
+) UpdatingStep {
+	return NewUpdatingStep(name, adaptStepFunction(fn))
+}
+
+// NewTypedUpdatingStepWithExpectedDuration returns a new UpdatingStep that
+// hands instance details to the given function as a *D and that is expected
+// to take roughly the given duration to execute
+func NewTypedUpdatingStepWithExpectedDuration[D any](
+	name string,
+	fn TypedUpdatingStepFunction[D],
+	expectedDuration time.Duration,
+) UpdatingStep {
+	return NewUpdatingStepWithExpectedDuration(
+		name,
+		adaptStepFunction(fn),
+		expectedDuration,
+	)
+}
+
+// NewTypedDeprovisioningStep returns a new DeprovisioningStep that hands
+// instance details to the given function as a *D
+func NewTypedDeprovisioningStep[D any](
+	name string,
+	fn TypedDeprovisioningStepFunction[D],
+) DeprovisioningStep {
+	return NewDeprovisioningStep(name, adaptStepFunction(fn))
+}
+
+// NewTypedDeprovisioningStepWithExpectedDuration returns a new
+// DeprovisioningStep that hands instance details to the given function as a
+// *D and that is expected to take roughly the given duration to execute
+func NewTypedDeprovisioningStepWithExpectedDuration[D any](
+	name string,
+	fn TypedDeprovisioningStepFunction[D],
+	expectedDuration time.Duration,
+) DeprovisioningStep {
+	return NewDeprovisioningStepWithExpectedDuration(
+		name,
+		adaptStepFunction(fn),
+		expectedDuration,
+	)
+}
+
+// adaptStepFunction adapts a typed step function to the untyped signature
+// shared by provisioning, updating, and deprovisioning step functions
+func adaptStepFunction[D any](
+	fn func(context.Context, Instance, *D) (*D, error),
+) func(context.Context, Instance) (InstanceDetails, error) {
+	return func(ctx context.Context, instance Instance) (InstanceDetails, error) {
+		details, err := GetInstanceDetails[D](instance)
+		if err != nil {
+			return nil, err
+		}
+		updatedDetails, err := fn(ctx, instance, details)
+		if err != nil || updatedDetails == nil {
+			// Avoid returning a nil *D wrapped in a non-nil InstanceDetails
+			return nil, err
+		}
+		return updatedDetails, nil
+	}
+}
+
+// GetInstanceDetails returns the details of the given instance as a *D. If
+// the instance has no details yet, a pointer to a new, zero-valued D is
+// returned.
+func GetInstanceDetails[D any](instance Instance) (*D, error) {
+	return getTypedDetails[D](instance.Details)
+}
+
+// GetBindingDetails returns the details of the given binding as a *B. If the
+// binding has no details yet, a pointer to a new, zero-valued B is returned.
+func GetBindingDetails[B any](binding Binding) (*B, error) {
+	return getTypedDetails[B](binding.Details)
+}
+
+func getTypedDetails[T any](details interface{}) (*T, error) {
+	switch d := details.(type) {
+	case nil:
+		return new(T), nil
+	case *T:
+		if d == nil {
+			return new(T), nil
+		}
+		return d, nil
+	case T:
+		return &d, nil
+	default:
+		return nil, fmt.Errorf(
+			"details of type %T cannot be used as details of type %T",
+			details,
+			new(T),
+		)
+	}
+}
+
+// TypedServiceManager is a type-safe counterpart of the ServiceManager
+// interface. D, B, and C are the module's instance details, binding details,
+// and credentials types, respectively. Use NewServiceManager to adapt a
+// TypedServiceManager to the ServiceManager interface.
+type TypedServiceManager[D any, B any, C any] interface {
+	// GetProvisioner returns a provisioner that defines the steps a module must
+	// execute asynchronously to provision a service. Steps are typically
+	// constructed using NewTypedProvisioningStep.
+	GetProvisioner(Plan) (Provisioner, error)
+	// ValidateUpdatingParameters validates the provided updating parameters
+	// against current instance state and returns an error if there is any
+	// problem
+	ValidateUpdatingParameters(Instance, *D) error
+	// GetUpdater returns a updater that defines the steps a module must execute
+	// asynchronously to update a service. Steps are typically constructed using
+	// NewTypedUpdatingStep.
+	GetUpdater(Plan) (Updater, error)
+	// Bind synchronously binds to a service
+	Bind(Instance, *D, BindingParameters) (*B, error)
+	// GetCredentials returns service-specific credentials populated from instance
+	// and binding details
+	GetCredentials(Instance, *D, Binding, *B) (C, error)
+	// Unbind synchronously unbinds from a service
+	Unbind(Instance, *D, Binding, *B) error
+	// GetDeprovisioner returns a deprovisioner that defines the steps a module
+	// must execute asynchronously to deprovision a service. Steps are typically
+	// constructed using NewTypedDeprovisioningStep.
+	GetDeprovisioner(Plan) (Deprovisioner, error)
+}
+
+type typedServiceManagerAdapter[D any, B any, C any] struct {
+	serviceManager TypedServiceManager[D, B, C]
+}
+
+// NewServiceManager returns an implementation of the ServiceManager interface
+// that delegates to the given TypedServiceManager. Empty instance and binding
+// details are derived from D and B, so modules need not implement
+// GetEmptyInstanceDetails or GetEmptyBindingDetails themselves.
+func NewServiceManager[D any, B any, C any](
+	serviceManager TypedServiceManager[D, B, C],
+) ServiceManager {
+	return &typedServiceManagerAdapter[D, B, C]{
+		serviceManager: serviceManager,
+	}
+}
+
+func (t *typedServiceManagerAdapter[D, B, C]) GetEmptyInstanceDetails() InstanceDetails { // nolint: lll
+	return new(D)
+}
+
+func (t *typedServiceManagerAdapter[D, B, C]) GetProvisioner(
+	plan Plan,
+) (Provisioner, error) {
+	return t.serviceManager.GetProvisioner(plan)
+}
+
+func (t *typedServiceManagerAdapter[D, B, C]) ValidateUpdatingParameters(
+	instance Instance,
+) error {
+	details, err := GetInstanceDetails[D](instance)
+	if err != nil {
+		return err
+	}
+	return t.serviceManager.ValidateUpdatingParameters(instance, details)
+}
+
+func (t *typedServiceManagerAdapter[D, B, C]) GetUpdater(
+	plan Plan,
+) (Updater, error) {
+	return t.serviceManager.GetUpdater(plan)
+}
+
+func (t *typedServiceManagerAdapter[D, B, C]) GetEmptyBindingDetails() BindingDetails { // nolint: lll
+	return new(B)
+}
+
+func (t *typedServiceManagerAdapter[D, B, C]) Bind(
+	instance Instance,
+	bindingParameters BindingParameters,
+) (BindingDetails, error) {
+	details, err := GetInstanceDetails[D](instance)
+	if err != nil {
+		return nil, err
+	}
+	bindingDetails, err := t.serviceManager.Bind(
+		instance,
+		details,
+		bindingParameters,
+	)
+	if err != nil || bindingDetails == nil {
+		return nil, err
+	}
+	return bindingDetails, nil
+}
+
+func (t *typedServiceManagerAdapter[D, B, C]) GetCredentials(
+	instance Instance,
+	binding Binding,
+) (Credentials, error) {
+	details, err := GetInstanceDetails[D](instance)
+	if err != nil {
+		return nil, err
+	}
+	bindingDetails, err := GetBindingDetails[B](binding)
+	if err != nil {
+		return nil, err
+	}
+	return t.serviceManager.GetCredentials(
+		instance,
+		details,
+		binding,
+		bindingDetails,
+	)
+}
+
+func (t *typedServiceManagerAdapter[D, B, C]) Unbind(
+	instance Instance,
+	binding Binding,
+) error {
+	details, err := GetInstanceDetails[D](instance)
+	if err != nil {
+		return err
+	}
+	bindingDetails, err := GetBindingDetails[B](binding)
+	if err != nil {
+		return err
+	}
+	return t.serviceManager.Unbind(instance, details, binding, bindingDetails)
+}
+
+func (t *typedServiceManagerAdapter[D, B, C]) GetDeprovisioner(
+	plan Plan,
+) (Deprovisioner, error) {
+	return t.serviceManager.GetDeprovisioner(plan)
+}
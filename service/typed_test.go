@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type typedInstanceDetails struct {
+	Foo string `json:"foo"`
+}
+
+type typedBindingDetails struct {
+	Bar string `json:"bar"`
+}
+
+type typedCredentials struct {
+	FooBar string
+}
+
+type typedServiceManager struct{}
+
+func (t *typedServiceManager) GetProvisioner(Plan) (Provisioner, error) {
+	return NewProvisioner(
+		NewTypedProvisioningStep(
+			"run",
+			func(
+				_ context.Context,
+				_ Instance,
+				details *typedInstanceDetails,
+			) (*typedInstanceDetails, error) {
+				details.Foo = "foo"
+				return details, nil
+			},
+		),
+	)
+}
+
+func (t *typedServiceManager) ValidateUpdatingParameters(
+	Instance,
+	*typedInstanceDetails,
+) error {
+	return nil
+}
+
+func (t *typedServiceManager) GetUpdater(Plan) (Updater, error) {
+	return NewUpdater()
+}
+
+func (t *typedServiceManager) Bind(
+	_ Instance,
+	details *typedInstanceDetails,
+	_ BindingParameters,
+) (*typedBindingDetails, error) {
+	return &typedBindingDetails{Bar: details.Foo + "bar"}, nil
+}
+
+func (t *typedServiceManager) GetCredentials(
+	_ Instance,
+	details *typedInstanceDetails,
+	_ Binding,
+	bindingDetails *typedBindingDetails,
+) (typedCredentials, error) {
+	return typedCredentials{FooBar: details.Foo + bindingDetails.Bar}, nil
+}
+
+func (t *typedServiceManager) Unbind(
+	Instance,
+	*typedInstanceDetails,
+	Binding,
+	*typedBindingDetails,
+) error {
+	return nil
+}
+
+func (t *typedServiceManager) GetDeprovisioner(Plan) (Deprovisioner, error) {
+	return NewDeprovisioner()
+}
+
+func TestTypedServiceManager(t *testing.T) {
+	serviceManager := NewServiceManager[
+		typedInstanceDetails,
+		typedBindingDetails,
+		typedCredentials,
+	](&typedServiceManager{})
+	provisioner, err := serviceManager.GetProvisioner(nil)
+	assert.Nil(t, err)
+	step, ok := provisioner.GetStep("run")
+	assert.True(t, ok)
+	// The first step of provisioning is executed without any details
+	instance := Instance{}
+	instance.Details, err = step.Execute(context.Background(), instance)
+	assert.Nil(t, err)
+	assert.Equal(t, &typedInstanceDetails{Foo: "foo"}, instance.Details)
+	// Details unmarshaled into the empty details should have the right type
+	detailsJSON, err := json.Marshal(instance.Details)
+	assert.Nil(t, err)
+	instance.Details = serviceManager.GetEmptyInstanceDetails()
+	err = json.Unmarshal(detailsJSON, instance.Details)
+	assert.Nil(t, err)
+	bindingDetails, err := serviceManager.Bind(instance, BindingParameters{})
+	assert.Nil(t, err)
+	assert.Equal(t, &typedBindingDetails{Bar: "foobar"}, bindingDetails)
+	credentials, err := serviceManager.GetCredentials(
+		instance,
+		Binding{Details: bindingDetails},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, typedCredentials{FooBar: "foofoobar"}, credentials)
+}
+
+func TestGetInstanceDetailsWithWrongType(t *testing.T) {
+	_, err := GetInstanceDetails[typedInstanceDetails](
+		Instance{Details: &typedBindingDetails{}},
+	)
+	assert.NotNil(t, err)
+}
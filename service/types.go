@@ -1,5 +1,7 @@
 package service
 
+import "time"
+
 // ProvisioningParameters wraps a map containing provisioning parameters.
 type ProvisioningParameters struct {
 	Parameters
@@ -23,3 +25,13 @@ type BindingDetails interface{}
 // functions to be implemented. It exists to improve the clarity of function
 // signatures and documentation.
 type Credentials interface{}
+
+// ExpectedDurationStep is an interface that may optionally be implemented by
+// provisioning, updating, and deprovisioning steps that know roughly how long
+// they take to execute. Steps constructed using
+// NewProvisioningStepWithExpectedDuration,
+// NewUpdatingStepWithExpectedDuration, or
+// NewDeprovisioningStepWithExpectedDuration implement this interface.
+type ExpectedDurationStep interface {
+	GetExpectedDuration() time.Duration
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"fmt"
+	"time"
 )
 
 // UpdatingStepFunction is the signature for functions that implement a
@@ -23,8 +24,9 @@ type UpdatingStep interface {
 }
 
 type updatingStep struct {
-	name string
-	fn   UpdatingStepFunction
+	name             string
+	fn               UpdatingStepFunction
+	expectedDuration time.Duration
 }
 
 // Updater is an interface to be implemented by types that model a declared
@@ -52,11 +54,33 @@ func NewUpdatingStep(
 	}
 }
 
+// NewUpdatingStepWithExpectedDuration returns a new UpdatingStep that is
+// expected to take roughly the given duration to execute. Platforms polling
+// for the status of an operation are advised to wait that long between polls
+// while the step executes.
+func NewUpdatingStepWithExpectedDuration(
+	name string,
+	fn UpdatingStepFunction,
+	expectedDuration time.Duration,
+) UpdatingStep {
+	return &updatingStep{
+		name:             name,
+		fn:               fn,
+		expectedDuration: expectedDuration,
+	}
+}
+
 // GetName returns a updating step's name
 func (u *updatingStep) GetName() string {
 	return u.name
 }
 
+// GetExpectedDuration returns roughly how long a updating step is expected
+// to take to execute or zero if that is unknown
+func (u *updatingStep) GetExpectedDuration() time.Duration {
+	return u.expectedDuration
+}
+
 // Execute executes a step
 func (u *updatingStep) Execute(
 	ctx context.Context,
@@ -1,6 +1,10 @@
 package fake
 
-import "github.com/barpilot/gosba/service"
+import (
+	"time"
+
+	"github.com/barpilot/gosba/service"
+)
 
 const (
 	// ServiceID is the service ID of the fake service
@@ -34,6 +38,9 @@ func (m *Module) GetCatalog() (service.Catalog, error) {
 				Name:        "standard",
 				Description: "The ONLY sort of fake service-- one that's fake!",
 				Free:        false,
+				// Advises platforms to poll every 30 seconds while operations against
+				// this plan are in progress
+				ExpectedStepDuration: time.Second * 30,
 				Metadata: service.ServicePlanMetadata{
 					DisplayName: "Fake",
 					Bullets: []string{"Fake 1",
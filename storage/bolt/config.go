@@ -0,0 +1,25 @@
+package bolt
+
+import "time"
+
+// Config represents configuration options for the bbolt-based implementation
+// of the Store interface
+type Config struct {
+	// Path is the path of the database file. It is created if it does not
+	// exist.
+	Path string
+	// Timeout is how long to wait to obtain the exclusive lock on the database
+	// file, which is held for as long as the store is open. Zero means wait
+	// indefinitely.
+	Timeout time.Duration
+}
+
+// NewConfigWithDefaults returns a Config object with default values already
+// applied. Callers are then free to set custom values for the remaining fields
+// and/or override default values.
+func NewConfigWithDefaults() Config {
+	return Config{
+		Path:    "gosba.db",
+		Timeout: 5 * time.Second,
+	}
+}
@@ -0,0 +1,585 @@
+package bolt
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/barpilot/gosba/audit"
+	"github.com/barpilot/gosba/crypto"
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/storage"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	instancesBucket = []byte("instances")
+	// aliasesBucket maps instance aliases to instance IDs
+	aliasesBucket = []byte("aliases")
+	// childrenBucket contains a nested bucket for every parent alias, whose
+	// keys are the IDs of the parent's children
+	childrenBucket = []byte("children")
+	bindingsBucket = []byte("bindings")
+	auditBucket    = []byte("audit")
+	// leasesBucket maps lease names to leases
+	leasesBucket = []byte("leases")
+	buckets      = [][]byte{
+		instancesBucket,
+		aliasesBucket,
+		childrenBucket,
+		bindingsBucket,
+		auditBucket,
+		leasesBucket,
+	}
+)
+
+// Store is an embedded, file-based implementation of the storage.Store
+// interface. Every write is a crash-safe transaction that is durably
+// committed to disk before returning. Only one process at a time may open a
+// given database file.
+type Store interface {
+	storage.Store
+	storage.Enumerator
+	storage.ParentlessReader
+	storage.Leaser
+	storage.CodecStore
+	audit.Store
+	// Backup writes a consistent snapshot of the entire database to the given
+	// writer, without blocking other reads or writes. The snapshot is itself a
+	// valid database file.
+	Backup(io.Writer) (int64, error)
+	// Close closes the database file and releases its lock
+	Close() error
+}
+
+type store struct {
+	db      *bolt.DB
+	catalog service.Catalog
+	// codec encrypts and decrypts secure values, or is nil if the globally
+	// configured codec does
+	codec crypto.Codec
+}
+
+// lease records the holder of a lease and when the lease expires
+type lease struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+// NewStore returns a new bbolt-based implementation of the Store interface
+func NewStore(catalog service.Catalog, config Config) (Store, error) {
+	db, err := bolt.Open(
+		config.Path,
+		0600,
+		&bolt.Options{
+			Timeout: config.Timeout,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf(
+			`error opening database file "%s": %s`,
+			config.Path,
+			err,
+		)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range buckets {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		db.Close() // nolint: errcheck
+		return nil, fmt.Errorf("error initializing database: %s", err)
+	}
+	return &store{
+		db:      db,
+		catalog: catalog,
+	}, nil
+}
+
+func (s *store) WriteInstance(instance service.Instance) error {
+	if err := storage.ValidateParentAlias(instance); err != nil {
+		return err
+	}
+	instanceJSON, err := instance.ToJSONWithCodec(s.codec)
+	if err != nil {
+		return err
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		aliases := tx.Bucket(aliasesBucket)
+		instances := tx.Bucket(instancesBucket)
+		var previous *service.Instance
+		if previousJSON := instances.Get(
+			[]byte(instance.InstanceID),
+		); previousJSON != nil {
+			// Only the alias and parent alias are needed, so there's no need to
+			// involve the catalog
+			p, err := service.NewInstanceFromJSON(previousJSON, nil, nil)
+			if err != nil {
+				return err
+			}
+			previous = &p
+		}
+		ownerID := aliases.Get([]byte(instance.Alias))
+		ownsAlias := ownerID == nil || string(ownerID) == instance.InstanceID
+		// Only a new claim on an alias is rejected. An instance whose alias was
+		// claimed by another instance before aliases were enforced to be unique
+		// remains writable, but does not get the alias back.
+		if instance.Alias != "" && !ownsAlias &&
+			(previous == nil || previous.Alias != instance.Alias) {
+			return storage.NewAliasInUseError(instance.Alias, string(ownerID))
+		}
+		if previous != nil {
+			if previous.Alias != instance.Alias {
+				err = releaseAlias(tx, previous.Alias, instance.InstanceID)
+				if err != nil {
+					return err
+				}
+			}
+			if previous.ParentAlias != instance.ParentAlias {
+				err = removeChild(tx, previous.ParentAlias, instance.InstanceID)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if err := instances.Put(
+			[]byte(instance.InstanceID),
+			instanceJSON,
+		); err != nil {
+			return err
+		}
+		if instance.Alias != "" && ownsAlias {
+			if err := aliases.Put(
+				[]byte(instance.Alias),
+				[]byte(instance.InstanceID),
+			); err != nil {
+				return err
+			}
+		}
+		if instance.ParentAlias != "" {
+			children, err := tx.Bucket(childrenBucket).CreateBucketIfNotExists(
+				[]byte(instance.ParentAlias),
+			)
+			if err != nil {
+				return err
+			}
+			return children.Put([]byte(instance.InstanceID), []byte{})
+		}
+		return nil
+	})
+	if _, ok := err.(*storage.AliasInUseError); ok {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf(
+			`error writing instance "%s": %s`,
+			instance.InstanceID,
+			err,
+		)
+	}
+	return nil
+}
+
+func (s *store) GetInstance(instanceID string) (
+	service.Instance,
+	bool,
+	error,
+) {
+	instance, ok, err := s.GetInstanceWithoutParent(instanceID)
+	if err != nil || !ok || instance.ParentAlias == "" {
+		return instance, ok, err
+	}
+	parent, ok, err := s.GetInstanceByAlias(instance.ParentAlias)
+	if err != nil {
+		return instance, false, fmt.Errorf(
+			`error retrieving parent with alias "%s" for instance "%s": %s`,
+			instance.ParentAlias,
+			instance.InstanceID,
+			err,
+		)
+	}
+	if ok {
+		instance.Parent = &parent
+	}
+	return instance, true, nil
+}
+
+func (s *store) GetInstanceWithoutParent(instanceID string) (
+	service.Instance,
+	bool,
+	error,
+) {
+	bytes, err := s.get(instancesBucket, instanceID)
+	if err != nil || bytes == nil {
+		return service.Instance{}, false, err
+	}
+	instance, err := service.NewInstanceFromJSON(bytes, nil, nil)
+	if err != nil {
+		return instance, false, err
+	}
+	svc, ok := s.catalog.GetService(instance.ServiceID)
+	if !ok {
+		return instance,
+			false,
+			fmt.Errorf(
+				`service not found in catalog for service ID "%s"`,
+				instance.ServiceID,
+			)
+	}
+	plan, ok := svc.GetPlan(instance.PlanID)
+	if !ok {
+		return instance,
+			false,
+			fmt.Errorf(
+				`plan not found for planID "%s" for service "%s" in the catalog`,
+				instance.PlanID,
+				instance.ServiceID,
+			)
+	}
+	pps := plan.GetSchemas().ServiceInstances.ProvisioningParametersSchema
+	instance, err = service.NewInstanceFromJSONWithCodec(
+		bytes,
+		svc.GetServiceManager().GetEmptyInstanceDetails(),
+		&pps,
+		s.codec,
+	)
+	instance.Service = svc
+	instance.Plan = plan
+	return instance, err == nil, err
+}
+
+func (s *store) GetInstanceByAlias(
+	alias string,
+) (service.Instance, bool, error) {
+	instanceID, err := s.get(aliasesBucket, alias)
+	if err != nil || instanceID == nil {
+		return service.Instance{}, false, err
+	}
+	return s.GetInstance(string(instanceID))
+}
+
+func (s *store) GetInstanceByAliasWithoutParent(
+	alias string,
+) (service.Instance, bool, error) {
+	instanceID, err := s.get(aliasesBucket, alias)
+	if err != nil || instanceID == nil {
+		return service.Instance{}, false, err
+	}
+	return s.GetInstanceWithoutParent(string(instanceID))
+}
+
+func (s *store) GetInstanceChildCountByAlias(alias string) (int64, error) {
+	var count int64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		children := tx.Bucket(childrenBucket).Bucket([]byte(alias))
+		if children == nil {
+			return nil
+		}
+		return children.ForEach(func([]byte, []byte) error {
+			count++
+			return nil
+		})
+	})
+	return count, err
+}
+
+func (s *store) DeleteInstance(instanceID string) (bool, error) {
+	var found bool
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		instances := tx.Bucket(instancesBucket)
+		instanceJSON := instances.Get([]byte(instanceID))
+		if found = instanceJSON != nil; !found {
+			return nil
+		}
+		// Only the alias and parent alias are needed, so there's no need to
+		// involve the catalog
+		instance, err := service.NewInstanceFromJSON(instanceJSON, nil, nil)
+		if err != nil {
+			return err
+		}
+		if err := instances.Delete([]byte(instanceID)); err != nil {
+			return err
+		}
+		if err := releaseAlias(tx, instance.Alias, instanceID); err != nil {
+			return err
+		}
+		return removeChild(tx, instance.ParentAlias, instanceID)
+	})
+	if err != nil {
+		return false, fmt.Errorf(
+			`error deleting instance "%s": %s`,
+			instanceID,
+			err,
+		)
+	}
+	return found, nil
+}
+
+// releaseAlias removes the given alias from the index of aliases, provided it
+// belongs to the given instance
+func releaseAlias(tx *bolt.Tx, alias string, instanceID string) error {
+	if alias == "" {
+		return nil
+	}
+	aliases := tx.Bucket(aliasesBucket)
+	if string(aliases.Get([]byte(alias))) != instanceID {
+		return nil
+	}
+	return aliases.Delete([]byte(alias))
+}
+
+// removeChild removes the given instance from the children of the parent with
+// the given alias
+func removeChild(tx *bolt.Tx, parentAlias string, instanceID string) error {
+	if parentAlias == "" {
+		return nil
+	}
+	children := tx.Bucket(childrenBucket).Bucket([]byte(parentAlias))
+	if children == nil {
+		return nil
+	}
+	if err := children.Delete([]byte(instanceID)); err != nil {
+		return err
+	}
+	// Don't leave empty buckets behind for parents that no longer have any
+	// children
+	if k, _ := children.Cursor().First(); k == nil {
+		return tx.Bucket(childrenBucket).DeleteBucket([]byte(parentAlias))
+	}
+	return nil
+}
+
+func (s *store) WriteBinding(binding service.Binding) error {
+	bindingJSON, err := binding.ToJSONWithCodec(s.codec)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bindingsBucket).Put(
+			[]byte(binding.BindingID),
+			bindingJSON,
+		)
+	}); err != nil {
+		return fmt.Errorf(
+			`error writing binding "%s": %s`,
+			binding.BindingID,
+			err,
+		)
+	}
+	return nil
+}
+
+func (s *store) GetBinding(bindingID string) (service.Binding, bool, error) {
+	bytes, err := s.get(bindingsBucket, bindingID)
+	if err != nil || bytes == nil {
+		return service.Binding{}, false, err
+	}
+	binding, err := service.NewBindingFromJSON(bytes, nil, nil)
+	if err != nil {
+		return binding, false, err
+	}
+	instance, ok, err := s.GetInstance(binding.InstanceID)
+	if err != nil {
+		return binding, false, err
+	}
+	// Now that we have schema for binding params, take a second pass at getting a
+	// binding from the JSON
+	if ok {
+		bps := instance.Plan.GetSchemas().ServiceBindings.BindingParametersSchema
+		binding, err = service.NewBindingFromJSONWithCodec(
+			bytes,
+			instance.Service.GetServiceManager().GetEmptyBindingDetails(),
+			&bps,
+			s.codec,
+		)
+	}
+	return binding, err == nil, err
+}
+
+func (s *store) DeleteBinding(bindingID string) (bool, error) {
+	var found bool
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		bindings := tx.Bucket(bindingsBucket)
+		if found = bindings.Get([]byte(bindingID)) != nil; !found {
+			return nil
+		}
+		return bindings.Delete([]byte(bindingID))
+	}); err != nil {
+		return false, fmt.Errorf(
+			`error deleting binding "%s": %s`,
+			bindingID,
+			err,
+		)
+	}
+	return found, nil
+}
+
+func (s *store) GetInstanceIDs() ([]string, error) {
+	return s.getKeys(instancesBucket)
+}
+
+func (s *store) GetBindingIDs() ([]string, error) {
+	return s.getKeys(bindingsBucket)
+}
+
+func (s *store) WriteAuditEntry(entry audit.Entry) error {
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error marshaling audit entry: %s", err)
+	}
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		entries := tx.Bucket(auditBucket)
+		seq, err := entries.NextSequence()
+		if err != nil {
+			return err
+		}
+		// Big-endian keys sort in the order entries were written
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return entries.Put(key, entryJSON)
+	}); err != nil {
+		return fmt.Errorf("error writing audit entry: %s", err)
+	}
+	return nil
+}
+
+func (s *store) GetAuditEntries() ([]audit.Entry, error) {
+	entries := []audit.Entry{}
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(auditBucket).ForEach(func(_, entryJSON []byte) error {
+			entry := audit.Entry{}
+			if err := json.Unmarshal(entryJSON, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	}); err != nil {
+		return nil, fmt.Errorf("error retrieving audit entries: %s", err)
+	}
+	return entries, nil
+}
+
+func (s *store) AcquireLease(
+	name string,
+	holder string,
+	ttl time.Duration,
+) (bool, error) {
+	acquired := false
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		leases := tx.Bucket(leasesBucket)
+		now := time.Now()
+		if leaseJSON := leases.Get([]byte(name)); leaseJSON != nil {
+			l := lease{}
+			if err := json.Unmarshal(leaseJSON, &l); err != nil {
+				return err
+			}
+			if l.Holder != holder && now.Before(l.Expires) {
+				return nil
+			}
+		}
+		leaseJSON, err := json.Marshal(lease{
+			Holder:  holder,
+			Expires: now.Add(ttl),
+		})
+		if err != nil {
+			return err
+		}
+		acquired = true
+		return leases.Put([]byte(name), leaseJSON)
+	}); err != nil {
+		return false, fmt.Errorf(`error acquiring lease "%s": %s`, name, err)
+	}
+	return acquired, nil
+}
+
+// WithCodec returns a Store for the same database file that encrypts and
+// decrypts secure values using the given codec. Closing either store closes
+// the database file for both.
+func (s *store) WithCodec(codec crypto.Codec) (storage.Store, error) {
+	return &store{
+		db:      s.db,
+		catalog: s.catalog,
+		codec:   codec,
+	}, nil
+}
+
+func (s *store) TestConnection() error {
+	return s.db.View(func(*bolt.Tx) error {
+		return nil
+	})
+}
+
+func (s *store) Backup(w io.Writer) (int64, error) {
+	var n int64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+func (s *store) Close() error {
+	return s.db.Close()
+}
+
+// get retrieves a copy of the value of the given key from the given bucket.
+// It returns nil if the key does not exist.
+func (s *store) get(bucket []byte, key string) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		// Values are only valid for the life of the transaction
+		if v := tx.Bucket(bucket).Get([]byte(key)); v != nil {
+			value = append([]byte{}, v...)
+		}
+		return nil
+	})
+	return value, err
+}
+
+// Compact copies the database at srcPath to a new, compacted database at
+// dstPath, reclaiming space freed by deletions. The database at srcPath must
+// not be open, including by a running broker. The new database can replace
+// the old one once compaction succeeds.
+func Compact(srcPath string, dstPath string) error {
+	if _, err := os.Stat(dstPath); err == nil {
+		return fmt.Errorf(`compaction destination "%s" already exists`, dstPath)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	src, err := bolt.Open(srcPath, 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf(`error opening database file "%s": %s`, srcPath, err)
+	}
+	defer src.Close() // nolint: errcheck
+	dst, err := bolt.Open(dstPath, 0600, nil)
+	if err != nil {
+		return fmt.Errorf(`error creating database file "%s": %s`, dstPath, err)
+	}
+	if err := bolt.Compact(dst, src, 64*1024*1024); err != nil {
+		dst.Close() // nolint: errcheck
+		return fmt.Errorf("error compacting database: %s", err)
+	}
+	return dst.Close()
+}
+
+// getKeys returns all keys in the given top-level bucket
+func (s *store) getKeys(bucket []byte) ([]string, error) {
+	keys := []string{}
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(k, _ []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	}); err != nil {
+		return nil, fmt.Errorf(`error listing keys of bucket "%s": %s`, bucket, err)
+	}
+	return keys, nil
+}
@@ -0,0 +1,320 @@
+package bolt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/barpilot/gosba/audit"
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/services/fake"
+	"github.com/barpilot/gosba/storage"
+	"github.com/barpilot/gosba/storage/storetest"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func getTestCatalog(t *testing.T) service.Catalog {
+	fakeModule, err := fake.New()
+	assert.Nil(t, err)
+	fakeCatalog, err := fakeModule.GetCatalog()
+	assert.Nil(t, err)
+	return fakeCatalog
+}
+
+func getTestConfig(t *testing.T) Config {
+	dir, err := ioutil.TempDir("", "gosba")
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(dir) // nolint: errcheck
+	})
+	config := NewConfigWithDefaults()
+	config.Path = filepath.Join(dir, "gosba.db")
+	config.Timeout = 100 * time.Millisecond
+	return config
+}
+
+func getTestStore(t *testing.T, config Config) Store {
+	store, err := NewStore(getTestCatalog(t), config)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		store.Close() // nolint: errcheck
+	})
+	return store
+}
+
+func getTestInstance() service.Instance {
+	return service.Instance{
+		InstanceID: uuid.NewV4().String(),
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Status:     service.InstanceStateProvisioned,
+	}
+}
+
+func TestWriteAndGetInstance(t *testing.T) {
+	store := getTestStore(t, getTestConfig(t))
+	instance := getTestInstance()
+	_, ok, err := store.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	err = store.WriteInstance(instance)
+	assert.Nil(t, err)
+	retrievedInstance, ok, err := store.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, instance.InstanceID, retrievedInstance.InstanceID)
+	assert.Equal(t, instance.Status, retrievedInstance.Status)
+	assert.NotNil(t, retrievedInstance.Service)
+	assert.NotNil(t, retrievedInstance.Plan)
+}
+
+func TestInstancesSurviveReopening(t *testing.T) {
+	config := getTestConfig(t)
+	store, err := NewStore(getTestCatalog(t), config)
+	assert.Nil(t, err)
+	instance := getTestInstance()
+	err = store.WriteInstance(instance)
+	assert.Nil(t, err)
+	assert.Nil(t, store.Close())
+	store = getTestStore(t, config)
+	_, ok, err := store.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestDatabaseFileIsLocked(t *testing.T) {
+	config := getTestConfig(t)
+	getTestStore(t, config)
+	_, err := NewStore(getTestCatalog(t), config)
+	assert.NotNil(t, err)
+}
+
+func TestAliasAndChildrenIndexes(t *testing.T) {
+	store := getTestStore(t, getTestConfig(t))
+	parent := getTestInstance()
+	parent.Alias = uuid.NewV4().String()
+	err := store.WriteInstance(parent)
+	assert.Nil(t, err)
+	retrievedParent, ok, err := store.GetInstanceByAlias(parent.Alias)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, parent.InstanceID, retrievedParent.InstanceID)
+
+	children := []service.Instance{getTestInstance(), getTestInstance()}
+	for _, child := range children {
+		child.ParentAlias = parent.Alias
+		err = store.WriteInstance(child)
+		assert.Nil(t, err)
+	}
+	// Rewriting a child must not count it twice
+	children[0].ParentAlias = parent.Alias
+	err = store.WriteInstance(children[0])
+	assert.Nil(t, err)
+	childCount, err := store.GetInstanceChildCountByAlias(parent.Alias)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), childCount)
+	retrievedChild, ok, err := store.GetInstance(children[0].InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.NotNil(t, retrievedChild.Parent)
+	if retrievedChild.Parent != nil {
+		assert.Equal(t, parent.InstanceID, retrievedChild.Parent.InstanceID)
+	}
+
+	for i, child := range children {
+		ok, err = store.DeleteInstance(child.InstanceID)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		childCount, err = store.GetInstanceChildCountByAlias(parent.Alias)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(len(children)-i-1), childCount)
+	}
+	ok, err = store.DeleteInstance(parent.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	_, ok, err = store.GetInstanceByAlias(parent.Alias)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = store.DeleteInstance(parent.InstanceID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestInstanceWhoseAliasWasClaimedByAnotherRemainsWritable(t *testing.T) {
+	str := getTestStore(t, getTestConfig(t))
+	instance := getTestInstance()
+	instance.Alias = uuid.NewV4().String()
+	err := str.WriteInstance(instance)
+	assert.Nil(t, err)
+	// Simulate an alias claimed by another instance before aliases were
+	// enforced to be unique
+	ownerID := uuid.NewV4().String()
+	err = str.(*store).db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(aliasesBucket).Put(
+			[]byte(instance.Alias),
+			[]byte(ownerID),
+		)
+	})
+	assert.Nil(t, err)
+	instance.Status = service.InstanceStateDeprovisioning
+	err = str.WriteInstance(instance)
+	assert.Nil(t, err)
+	ok, err := str.DeleteInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	// The alias still belongs to the instance that claimed it
+	err = str.(*store).db.View(func(tx *bolt.Tx) error {
+		assert.Equal(
+			t,
+			ownerID,
+			string(tx.Bucket(aliasesBucket).Get([]byte(instance.Alias))),
+		)
+		return nil
+	})
+	assert.Nil(t, err)
+}
+
+func TestGetInstanceReportsWhyParentCouldNotBeRetrieved(t *testing.T) {
+	str := getTestStore(t, getTestConfig(t))
+	parent := getTestInstance()
+	parent.Alias = uuid.NewV4().String()
+	err := str.WriteInstance(parent)
+	assert.Nil(t, err)
+	child := getTestInstance()
+	child.ParentAlias = parent.Alias
+	err = str.WriteInstance(child)
+	assert.Nil(t, err)
+	err = str.(*store).db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(instancesBucket).Put(
+			[]byte(parent.InstanceID),
+			[]byte("{"),
+		)
+	})
+	assert.Nil(t, err)
+	_, _, parentErr := str.GetInstance(parent.InstanceID)
+	assert.NotNil(t, parentErr)
+	_, _, err = str.GetInstance(child.InstanceID)
+	assert.NotNil(t, err)
+	if err != nil && parentErr != nil {
+		assert.Contains(t, err.Error(), parentErr.Error())
+	}
+}
+
+func TestWriteGetAndDeleteBinding(t *testing.T) {
+	store := getTestStore(t, getTestConfig(t))
+	instance := getTestInstance()
+	err := store.WriteInstance(instance)
+	assert.Nil(t, err)
+	binding := service.Binding{
+		BindingID:  uuid.NewV4().String(),
+		InstanceID: instance.InstanceID,
+		ServiceID:  fake.ServiceID,
+		Status:     service.BindingStateBound,
+	}
+	err = store.WriteBinding(binding)
+	assert.Nil(t, err)
+	retrievedBinding, ok, err := store.GetBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, binding.BindingID, retrievedBinding.BindingID)
+	ok, err = store.DeleteBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	_, ok, err = store.GetBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = store.DeleteBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestWriteAndGetAuditEntries(t *testing.T) {
+	store := getTestStore(t, getTestConfig(t))
+	entries := []audit.Entry{}
+	// Enough entries that lexical ordering of keys would be wrong if the
+	// sequence numbers weren't encoded as fixed-width big-endian integers
+	for i := 0; i < 300; i++ {
+		entry := audit.Entry{
+			Timestamp:  time.Now().UTC().Round(time.Second),
+			Operation:  audit.OperationProvision,
+			InstanceID: uuid.NewV4().String(),
+			StatusCode: 202,
+		}
+		entries = append(entries, entry)
+		err := store.WriteAuditEntry(entry)
+		assert.Nil(t, err)
+	}
+	retrievedEntries, err := store.GetAuditEntries()
+	assert.Nil(t, err)
+	assert.Equal(t, entries, retrievedEntries)
+}
+
+func TestBackup(t *testing.T) {
+	store := getTestStore(t, getTestConfig(t))
+	instance := getTestInstance()
+	err := store.WriteInstance(instance)
+	assert.Nil(t, err)
+	buf := &bytes.Buffer{}
+	n, err := store.Backup(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+	// The backup is a database in its own right
+	backupConfig := getTestConfig(t)
+	err = ioutil.WriteFile(backupConfig.Path, buf.Bytes(), 0600)
+	assert.Nil(t, err)
+	backupStore := getTestStore(t, backupConfig)
+	_, ok, err := backupStore.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestCompact(t *testing.T) {
+	config := getTestConfig(t)
+	store, err := NewStore(getTestCatalog(t), config)
+	assert.Nil(t, err)
+	instances := []service.Instance{}
+	for i := 0; i < 100; i++ {
+		instance := getTestInstance()
+		instances = append(instances, instance)
+		err = store.WriteInstance(instance)
+		assert.Nil(t, err)
+	}
+	// Delete all but one instance to leave space behind to be reclaimed
+	for _, instance := range instances[1:] {
+		_, err = store.DeleteInstance(instance.InstanceID)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, store.Close())
+	compactedConfig := getTestConfig(t)
+	err = Compact(config.Path, compactedConfig.Path)
+	assert.Nil(t, err)
+	// Compacting to an existing file must not clobber it
+	err = Compact(config.Path, compactedConfig.Path)
+	assert.NotNil(t, err)
+	compactedStore := getTestStore(t, compactedConfig)
+	_, ok, err := compactedStore.GetInstance(instances[0].InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	_, ok, err = compactedStore.GetInstance(instances[1].InstanceID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestStoreConformance(t *testing.T) {
+	storetest.Run(
+		t,
+		func(t *testing.T, catalog service.Catalog) storage.Store {
+			store, err := NewStore(catalog, getTestConfig(t))
+			assert.Nil(t, err)
+			t.Cleanup(func() {
+				store.Close() // nolint: errcheck
+			})
+			return store
+		},
+	)
+}
@@ -0,0 +1,31 @@
+package cache
+
+import "time"
+
+// Config represents configuration options for the caching decorator around
+// implementations of the Store interface
+type Config struct {
+	// InstanceTTL is how long an instance read from the underlying store is
+	// served from the cache. Writes and deletes made through the cache take
+	// effect immediately, but changes made by other processes sharing the
+	// underlying store can go unnoticed for this long. Zero disables caching
+	// of instances.
+	InstanceTTL time.Duration
+	// BindingTTL is the equivalent of InstanceTTL for bindings
+	BindingTTL time.Duration
+	// MaxParentDepth is the number of ancestors hydrated for an instance; e.g.
+	// 1 hydrates an instance's parent, but not its grandparent. It must be
+	// positive.
+	MaxParentDepth int
+}
+
+// NewConfigWithDefaults returns a Config object with default values already
+// applied. Callers are then free to set custom values for the remaining fields
+// and/or override default values.
+func NewConfigWithDefaults() Config {
+	return Config{
+		InstanceTTL:    5 * time.Second,
+		BindingTTL:     5 * time.Second,
+		MaxParentDepth: 5,
+	}
+}
@@ -0,0 +1,489 @@
+// Package cache provides a read-through caching decorator around
+// implementations of storage.Store. It spares the underlying store (and
+// whatever database is behind it) from repeated reads of the same records by,
+// for instance, platforms polling for the status of asynchronous operations.
+//
+// Records are cached in their serialized form, so every read still returns a
+// fresh copy that callers are free to modify. Parents are not cached as part
+// of their children. Rather, each time an instance is read, its ancestors, up
+// to the configured MaxParentDepth, are eagerly resolved from the cache, one
+// at a time, so a parent written through the cache is immediately reflected
+// in all of its children. Ancestors beyond that depth are never resolved.
+// Ancestors missing from the cache are read from the underlying store one at
+// a time as well, provided it implements storage.ParentlessReader, as all of
+// this module's stores do. Otherwise, whenever an instance isn't cached, the
+// underlying store resolves the instance's entire parent chain, of which only
+// the ancestors within MaxParentDepth are cached and returned.
+//
+// Reads served from the cache may be stale by up to the configured TTL when
+// other processes write to the underlying store. A stale record that is
+// modified and written back silently undoes whatever those processes wrote in
+// the meantime. The caching store implements storage.Cache, and the broker
+// uses the underlying store for its asynchronous jobs, which read, modify,
+// and write instances step after step, possibly on different replicas.
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/barpilot/gosba/crypto"
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+// purgeInterval is how often expired entries are purged from the cache.
+// Between purges, expired entries are only ignored.
+const purgeInterval = time.Minute
+
+type instanceEntry struct {
+	json    []byte
+	alias   string
+	svc     service.Service
+	plan    service.Plan
+	expires time.Time
+}
+
+type bindingEntry struct {
+	json       []byte
+	instanceID string
+	// schema and emptyDetails are nil for bindings whose instance doesn't exist
+	schema       *service.InputParametersSchema
+	emptyDetails func() service.BindingDetails
+	expires      time.Time
+}
+
+type store struct {
+	store storage.Store
+	// parentless is the underlying store, if it implements
+	// storage.ParentlessReader, or nil otherwise
+	parentless storage.ParentlessReader
+	catalog    service.Catalog
+	config     Config
+	// codec encrypts and decrypts secure values, or is nil if the globally
+	// configured codec does
+	codec crypto.Codec
+	now   func() time.Time
+	// mutex guards all of the fields below it
+	mutex sync.Mutex
+	// generation is incremented by every invalidation so that reads from the
+	// underlying store that began before an invalidation never repopulate the
+	// cache with the records it invalidated
+	generation      uint64
+	instances       map[string]instanceEntry
+	instanceAliases map[string]string
+	bindings        map[string]bindingEntry
+	nextPurge       time.Time
+}
+
+// enumeratingStore is returned in place of store when the underlying store
+// implements storage.Enumerator, so the caching store does as well.
+// Enumeration is never cached.
+type enumeratingStore struct {
+	*store
+	storage.Enumerator
+}
+
+// NewStore returns a new implementation of the Store interface that caches
+// records read from the given store
+func NewStore(
+	catalog service.Catalog,
+	str storage.Store,
+	config Config,
+) (storage.Store, error) {
+	if config.InstanceTTL < 0 {
+		return nil, errors.New("instance TTL must not be negative")
+	}
+	if config.BindingTTL < 0 {
+		return nil, errors.New("binding TTL must not be negative")
+	}
+	if config.MaxParentDepth < 1 {
+		return nil, errors.New("maximum parent depth must be positive")
+	}
+	return newStore(catalog, str, config, nil), nil
+}
+
+func newStore(
+	catalog service.Catalog,
+	str storage.Store,
+	config Config,
+	codec crypto.Codec,
+) storage.Store {
+	s := &store{
+		store:           str,
+		catalog:         catalog,
+		config:          config,
+		codec:           codec,
+		now:             time.Now,
+		instances:       map[string]instanceEntry{},
+		instanceAliases: map[string]string{},
+		bindings:        map[string]bindingEntry{},
+	}
+	s.parentless, _ = str.(storage.ParentlessReader)
+	if enumerator, ok := str.(storage.Enumerator); ok {
+		return &enumeratingStore{
+			store:      s,
+			Enumerator: enumerator,
+		}
+	}
+	return s
+}
+
+func (s *store) WriteInstance(instance service.Instance) error {
+	// The instance is invalidated even if the write failed, since it may have
+	// partially succeeded
+	defer s.invalidateInstance(instance.InstanceID)
+	return s.store.WriteInstance(instance)
+}
+
+func (s *store) GetInstance(instanceID string) (
+	service.Instance,
+	bool,
+	error,
+) {
+	if s.config.InstanceTTL == 0 {
+		return s.store.GetInstance(instanceID)
+	}
+	instance, ok, err := s.getInstance(instanceID)
+	if err != nil || !ok {
+		return instance, ok, err
+	}
+	if err := s.hydrate(&instance); err != nil {
+		return instance, false, err
+	}
+	return instance, true, nil
+}
+
+func (s *store) GetInstanceByAlias(alias string) (
+	service.Instance,
+	bool,
+	error,
+) {
+	if s.config.InstanceTTL == 0 {
+		return s.store.GetInstanceByAlias(alias)
+	}
+	instance, ok, err := s.getInstanceByAlias(alias)
+	if err != nil || !ok {
+		return instance, ok, err
+	}
+	if err := s.hydrate(&instance); err != nil {
+		return instance, false, err
+	}
+	return instance, true, nil
+}
+
+// getInstance retrieves an instance by instance id, without its parent
+func (s *store) getInstance(instanceID string) (
+	service.Instance,
+	bool,
+	error,
+) {
+	s.mutex.Lock()
+	entry, ok := s.getInstanceEntry(instanceID)
+	generation := s.generation
+	s.mutex.Unlock()
+	if ok {
+		return s.decodeInstance(entry)
+	}
+	var instance service.Instance
+	var err error
+	if s.parentless != nil {
+		instance, ok, err = s.parentless.GetInstanceWithoutParent(instanceID)
+	} else {
+		instance, ok, err = s.store.GetInstance(instanceID)
+	}
+	if err != nil || !ok {
+		return instance, ok, err
+	}
+	s.cacheInstances(generation, instance)
+	instance.Parent = nil
+	return instance, true, nil
+}
+
+// getInstanceByAlias retrieves an instance by alias, without its parent
+func (s *store) getInstanceByAlias(alias string) (
+	service.Instance,
+	bool,
+	error,
+) {
+	s.mutex.Lock()
+	entry, ok := s.getInstanceEntry(s.instanceAliases[alias])
+	// The alias index isn't cleaned up when entries expire or are invalidated,
+	// so it is only trusted if the entry it leads to agrees
+	ok = ok && entry.alias == alias
+	generation := s.generation
+	s.mutex.Unlock()
+	if ok {
+		return s.decodeInstance(entry)
+	}
+	var instance service.Instance
+	var err error
+	if s.parentless != nil {
+		instance, ok, err = s.parentless.GetInstanceByAliasWithoutParent(alias)
+	} else {
+		instance, ok, err = s.store.GetInstanceByAlias(alias)
+	}
+	if err != nil || !ok {
+		return instance, ok, err
+	}
+	s.cacheInstances(generation, instance)
+	instance.Parent = nil
+	return instance, true, nil
+}
+
+// getInstanceEntry returns the unexpired entry for the given instance id. The
+// caller must hold the mutex.
+func (s *store) getInstanceEntry(instanceID string) (instanceEntry, bool) {
+	entry, ok := s.instances[instanceID]
+	if !ok || !s.now().Before(entry.expires) {
+		return instanceEntry{}, false
+	}
+	return entry, true
+}
+
+// hydrate resolves the given instance's ancestors, up to the maximum parent
+// depth
+func (s *store) hydrate(instance *service.Instance) error {
+	child := instance
+	for depth := 0; depth < s.config.MaxParentDepth; depth++ {
+		if child.ParentAlias == "" {
+			return nil
+		}
+		parent, ok, err := s.getInstanceByAlias(child.ParentAlias)
+		if err != nil {
+			return fmt.Errorf(
+				`error retrieving parent with alias "%s" for instance "%s": %s`,
+				child.ParentAlias,
+				child.InstanceID,
+				err,
+			)
+		}
+		if !ok {
+			return nil
+		}
+		child.Parent = &parent
+		child = &parent
+	}
+	return nil
+}
+
+// cacheInstances caches the given instance and any ancestors, up to the
+// maximum parent depth, the underlying store hydrated it with, unless the
+// cache was invalidated since the given generation
+func (s *store) cacheInstances(generation uint64, instance service.Instance) {
+	entries := map[string]instanceEntry{}
+	i := &instance
+	for depth := 0; i != nil && depth <= s.config.MaxParentDepth; depth++ {
+		if i.Service == nil || i.Plan == nil {
+			break
+		}
+		json, err := i.ToJSONWithCodec(s.codec)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"instanceID": i.InstanceID,
+				"error":      err,
+			}).Error("error caching instance")
+			break
+		}
+		entries[i.InstanceID] = instanceEntry{
+			json:  json,
+			alias: i.Alias,
+			svc:   i.Service,
+			plan:  i.Plan,
+		}
+		i = i.Parent
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.generation != generation {
+		return
+	}
+	now := s.now()
+	s.purgeExpired(now)
+	for instanceID, entry := range entries {
+		entry.expires = now.Add(s.config.InstanceTTL)
+		s.instances[instanceID] = entry
+		if entry.alias != "" {
+			s.instanceAliases[entry.alias] = instanceID
+		}
+	}
+}
+
+func (s *store) decodeInstance(
+	entry instanceEntry,
+) (service.Instance, bool, error) {
+	pps := entry.plan.GetSchemas().ServiceInstances.ProvisioningParametersSchema
+	instance, err := service.NewInstanceFromJSONWithCodec(
+		entry.json,
+		entry.svc.GetServiceManager().GetEmptyInstanceDetails(),
+		&pps,
+		s.codec,
+	)
+	if err != nil {
+		return instance, false, err
+	}
+	instance.Service = entry.svc
+	instance.Plan = entry.plan
+	return instance, true, nil
+}
+
+func (s *store) GetInstanceChildCountByAlias(alias string) (int64, error) {
+	return s.store.GetInstanceChildCountByAlias(alias)
+}
+
+func (s *store) DeleteInstance(instanceID string) (bool, error) {
+	defer s.invalidateInstance(instanceID)
+	return s.store.DeleteInstance(instanceID)
+}
+
+func (s *store) invalidateInstance(instanceID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.generation++
+	delete(s.instances, instanceID)
+	// Bindings are decoded using their instance's binding parameters schema,
+	// which changes along with the instance's plan
+	for bindingID, entry := range s.bindings {
+		if entry.instanceID == instanceID {
+			delete(s.bindings, bindingID)
+		}
+	}
+}
+
+func (s *store) WriteBinding(binding service.Binding) error {
+	defer s.invalidateBinding(binding.BindingID)
+	return s.store.WriteBinding(binding)
+}
+
+func (s *store) GetBinding(bindingID string) (service.Binding, bool, error) {
+	if s.config.BindingTTL == 0 {
+		return s.store.GetBinding(bindingID)
+	}
+	s.mutex.Lock()
+	entry, ok := s.bindings[bindingID]
+	ok = ok && s.now().Before(entry.expires)
+	generation := s.generation
+	s.mutex.Unlock()
+	if ok {
+		var emptyDetails service.BindingDetails
+		if entry.emptyDetails != nil {
+			emptyDetails = entry.emptyDetails()
+		}
+		binding, err := service.NewBindingFromJSONWithCodec(
+			entry.json,
+			emptyDetails,
+			entry.schema,
+			s.codec,
+		)
+		return binding, err == nil, err
+	}
+	binding, ok, err := s.store.GetBinding(bindingID)
+	if err != nil || !ok {
+		return binding, ok, err
+	}
+	s.cacheBinding(generation, binding)
+	return binding, true, nil
+}
+
+// cacheBinding caches the given binding, unless the cache was invalidated
+// since the given generation
+func (s *store) cacheBinding(generation uint64, binding service.Binding) {
+	entry := bindingEntry{
+		instanceID: binding.InstanceID,
+	}
+	if binding.BindingParameters != nil {
+		entry.schema, _ =
+			binding.BindingParameters.Schema.(*service.InputParametersSchema)
+	}
+	if entry.schema != nil {
+		svc, ok := s.catalog.GetService(binding.ServiceID)
+		if !ok {
+			return
+		}
+		entry.emptyDetails = svc.GetServiceManager().GetEmptyBindingDetails
+	}
+	json, err := binding.ToJSONWithCodec(s.codec)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"bindingID": binding.BindingID,
+			"error":     err,
+		}).Error("error caching binding")
+		return
+	}
+	entry.json = json
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.generation != generation {
+		return
+	}
+	now := s.now()
+	s.purgeExpired(now)
+	entry.expires = now.Add(s.config.BindingTTL)
+	s.bindings[binding.BindingID] = entry
+}
+
+func (s *store) DeleteBinding(bindingID string) (bool, error) {
+	defer s.invalidateBinding(bindingID)
+	return s.store.DeleteBinding(bindingID)
+}
+
+func (s *store) invalidateBinding(bindingID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.generation++
+	delete(s.bindings, bindingID)
+}
+
+// purgeExpired removes expired entries from the cache, provided it has been
+// long enough since they were last purged. The caller must hold the mutex.
+func (s *store) purgeExpired(now time.Time) {
+	if now.Before(s.nextPurge) {
+		return
+	}
+	s.nextPurge = now.Add(purgeInterval)
+	for instanceID, entry := range s.instances {
+		if !now.Before(entry.expires) {
+			delete(s.instances, instanceID)
+		}
+	}
+	for alias, instanceID := range s.instanceAliases {
+		if _, ok := s.instances[instanceID]; !ok {
+			delete(s.instanceAliases, alias)
+		}
+	}
+	for bindingID, entry := range s.bindings {
+		if !now.Before(entry.expires) {
+			delete(s.bindings, bindingID)
+		}
+	}
+}
+
+func (s *store) Uncached() storage.Store {
+	return s.store
+}
+
+// WithCodec returns a new caching store, with a cache of its own, around a
+// store for the same records as the underlying store that encrypts and
+// decrypts secure values using the given codec. The underlying store must
+// implement storage.CodecStore.
+func (s *store) WithCodec(codec crypto.Codec) (storage.Store, error) {
+	codecStore, ok := s.store.(storage.CodecStore)
+	if !ok {
+		return nil, errors.New(
+			"the underlying store does not support codecs other than the global " +
+				"codec",
+		)
+	}
+	str, err := codecStore.WithCodec(codec)
+	if err != nil {
+		return nil, err
+	}
+	return newStore(s.catalog, str, s.config, codec), nil
+}
+
+func (s *store) TestConnection() error {
+	return s.store.TestConnection()
+}
@@ -0,0 +1,458 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/barpilot/gosba/crypto/noop"
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/services/fake"
+	"github.com/barpilot/gosba/storage"
+	memoryStorage "github.com/barpilot/gosba/storage/memory"
+	"github.com/barpilot/gosba/storage/storetest"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStore is a storage.Store that counts the reads that reach it
+type countingStore struct {
+	storage.Store
+	mutex sync.Mutex
+	reads int
+}
+
+func (c *countingStore) GetInstance(instanceID string) (
+	service.Instance,
+	bool,
+	error,
+) {
+	c.count()
+	return c.Store.GetInstance(instanceID)
+}
+
+func (c *countingStore) GetInstanceByAlias(alias string) (
+	service.Instance,
+	bool,
+	error,
+) {
+	c.count()
+	return c.Store.GetInstanceByAlias(alias)
+}
+
+func (c *countingStore) GetBinding(bindingID string) (
+	service.Binding,
+	bool,
+	error,
+) {
+	c.count()
+	return c.Store.GetBinding(bindingID)
+}
+
+func (c *countingStore) count() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.reads++
+}
+
+func (c *countingStore) getReads() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.reads
+}
+
+// parentlessCountingStore is a countingStore that can also be read without
+// parents, and counts those reads separately
+type parentlessCountingStore struct {
+	*countingStore
+	reader          storage.ParentlessReader
+	parentlessReads int
+}
+
+func (p *parentlessCountingStore) GetInstanceWithoutParent(
+	instanceID string,
+) (service.Instance, bool, error) {
+	p.parentlessReads++
+	return p.reader.GetInstanceWithoutParent(instanceID)
+}
+
+func (p *parentlessCountingStore) GetInstanceByAliasWithoutParent(
+	alias string,
+) (service.Instance, bool, error) {
+	p.parentlessReads++
+	return p.reader.GetInstanceByAliasWithoutParent(alias)
+}
+
+func TestStoreConformance(t *testing.T) {
+	storetest.Run(
+		t,
+		func(t *testing.T, catalog service.Catalog) storage.Store {
+			str, err := NewStore(
+				catalog,
+				memoryStorage.NewStore(catalog),
+				NewConfigWithDefaults(),
+			)
+			assert.Nil(t, err)
+			return str
+		},
+	)
+}
+
+func TestNewStoreWithInvalidConfig(t *testing.T) {
+	catalog, err := storetest.NewCatalog()
+	assert.Nil(t, err)
+	for name, config := range map[string]Config{
+		"negative instance TTL": {InstanceTTL: -time.Second, MaxParentDepth: 1},
+		"negative binding TTL":  {BindingTTL: -time.Second, MaxParentDepth: 1},
+		"no parent depth":       {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewStore(catalog, memoryStorage.NewStore(catalog), config)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestEnumerationIsPassedThrough(t *testing.T) {
+	catalog, err := storetest.NewCatalog()
+	assert.Nil(t, err)
+	str, err := NewStore(
+		catalog,
+		memoryStorage.NewStore(catalog),
+		NewConfigWithDefaults(),
+	)
+	assert.Nil(t, err)
+	_, ok := str.(storage.Enumerator)
+	assert.True(t, ok)
+	// Stores that can't enumerate don't appear to
+	str, err = NewStore(
+		catalog,
+		&countingStore{Store: memoryStorage.NewStore(catalog)},
+		NewConfigWithDefaults(),
+	)
+	assert.Nil(t, err)
+	_, ok = str.(storage.Enumerator)
+	assert.False(t, ok)
+}
+
+func TestWithCodecRequiresCodecSupport(t *testing.T) {
+	catalog, err := storetest.NewCatalog()
+	assert.Nil(t, err)
+	str, err := NewStore(
+		catalog,
+		&countingStore{Store: memoryStorage.NewStore(catalog)},
+		NewConfigWithDefaults(),
+	)
+	assert.Nil(t, err)
+	_, err = str.(storage.CodecStore).WithCodec(noop.NewCodec())
+	assert.NotNil(t, err)
+}
+
+func TestReadsAreServedFromCache(t *testing.T) {
+	s, backend := getTestStore(t, NewConfigWithDefaults())
+	parent := getTestInstance()
+	parent.Alias = uuid.NewV4().String()
+	child := getTestInstance()
+	child.ParentAlias = parent.Alias
+	assert.Nil(t, s.WriteInstance(parent))
+	assert.Nil(t, s.WriteInstance(child))
+	binding := getTestBinding(child.InstanceID)
+	assert.Nil(t, s.WriteBinding(binding))
+	for i := 0; i < 3; i++ {
+		retrievedChild, ok, err := s.GetInstance(child.InstanceID)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		if assert.NotNil(t, retrievedChild.Parent) {
+			assert.Equal(t, parent.InstanceID, retrievedChild.Parent.InstanceID)
+		}
+		_, ok, err = s.GetInstanceByAlias(parent.Alias)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		_, ok, err = s.GetBinding(binding.BindingID)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}
+	// The child was read along with its parent, and the parent was cached
+	// along the way, so only the first reads of the child and binding reached
+	// the underlying store
+	assert.Equal(t, 2, backend.getReads())
+}
+
+func TestEntriesExpire(t *testing.T) {
+	config := NewConfigWithDefaults()
+	s, backend := getTestStore(t, config)
+	now := time.Now()
+	s.now = func() time.Time {
+		return now
+	}
+	instance := getTestInstance()
+	assert.Nil(t, s.WriteInstance(instance))
+	binding := getTestBinding(instance.InstanceID)
+	assert.Nil(t, s.WriteBinding(binding))
+	read := func() {
+		_, ok, err := s.GetInstance(instance.InstanceID)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		_, ok, err = s.GetBinding(binding.BindingID)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}
+	read()
+	read()
+	assert.Equal(t, 2, backend.getReads())
+	now = now.Add(config.InstanceTTL)
+	read()
+	assert.Equal(t, 4, backend.getReads())
+}
+
+func TestWritesAndDeletesInvalidate(t *testing.T) {
+	s, _ := getTestStore(t, NewConfigWithDefaults())
+	instance := getTestInstance()
+	assert.Nil(t, s.WriteInstance(instance))
+	binding := getTestBinding(instance.InstanceID)
+	assert.Nil(t, s.WriteBinding(binding))
+	_, _, err := s.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	_, _, err = s.GetBinding(binding.BindingID)
+	assert.Nil(t, err)
+	instance.Status = service.InstanceStateProvisioned
+	assert.Nil(t, s.WriteInstance(instance))
+	binding.Status = service.BindingStateBound
+	assert.Nil(t, s.WriteBinding(binding))
+	retrievedInstance, ok, err := s.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, service.InstanceStateProvisioned, retrievedInstance.Status)
+	retrievedBinding, ok, err := s.GetBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, service.BindingStateBound, retrievedBinding.Status)
+	_, err = s.DeleteInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	_, err = s.DeleteBinding(binding.BindingID)
+	assert.Nil(t, err)
+	_, ok, err = s.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, ok, err = s.GetBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestParentWritesAreReflectedInChildren(t *testing.T) {
+	s, backend := getTestStore(t, NewConfigWithDefaults())
+	parent := getTestInstance()
+	parent.Alias = uuid.NewV4().String()
+	child := getTestInstance()
+	child.ParentAlias = parent.Alias
+	assert.Nil(t, s.WriteInstance(parent))
+	assert.Nil(t, s.WriteInstance(child))
+	_, _, err := s.GetInstance(child.InstanceID)
+	assert.Nil(t, err)
+	parent.Status = service.InstanceStateProvisioned
+	assert.Nil(t, s.WriteInstance(parent))
+	retrievedChild, ok, err := s.GetInstance(child.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	if assert.NotNil(t, retrievedChild.Parent) {
+		assert.Equal(
+			t,
+			service.InstanceStateProvisioned,
+			retrievedChild.Parent.Status,
+		)
+	}
+	// Only the parent had to be read again
+	assert.Equal(t, 2, backend.getReads())
+}
+
+func TestParentDepthIsLimited(t *testing.T) {
+	config := NewConfigWithDefaults()
+	config.MaxParentDepth = 1
+	s, _ := getTestStore(t, config)
+	grandparent := getTestInstance()
+	grandparent.Alias = uuid.NewV4().String()
+	parent := getTestInstance()
+	parent.Alias = uuid.NewV4().String()
+	parent.ParentAlias = grandparent.Alias
+	child := getTestInstance()
+	child.ParentAlias = parent.Alias
+	for _, instance := range []service.Instance{grandparent, parent, child} {
+		assert.Nil(t, s.WriteInstance(instance))
+	}
+	// The limit applies whether or not the chain was already cached
+	for i := 0; i < 2; i++ {
+		retrievedChild, ok, err := s.GetInstance(child.InstanceID)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		if assert.NotNil(t, retrievedChild.Parent) {
+			assert.Equal(t, parent.InstanceID, retrievedChild.Parent.InstanceID)
+			assert.Nil(t, retrievedChild.Parent.Parent)
+		}
+	}
+}
+
+func TestMissesDoNotLoadEntireParentChain(t *testing.T) {
+	catalog, err := storetest.NewCatalog()
+	assert.Nil(t, err)
+	memoryStore := memoryStorage.NewStore(catalog)
+	backend := &parentlessCountingStore{
+		countingStore: &countingStore{Store: memoryStore},
+		reader:        memoryStore.(storage.ParentlessReader),
+	}
+	config := NewConfigWithDefaults()
+	config.MaxParentDepth = 1
+	str, err := NewStore(catalog, backend, config)
+	assert.Nil(t, err)
+	instances := make([]service.Instance, 10)
+	for i := range instances {
+		instances[i] = getTestInstance()
+		instances[i].Alias = uuid.NewV4().String()
+		if i > 0 {
+			instances[i].ParentAlias = instances[i-1].Alias
+		}
+		assert.Nil(t, str.WriteInstance(instances[i]))
+	}
+	child := instances[len(instances)-1]
+	retrievedChild, ok, err := str.GetInstance(child.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	if assert.NotNil(t, retrievedChild.Parent) {
+		assert.Nil(t, retrievedChild.Parent.Parent)
+	}
+	// Only the child and its parent were read from the underlying store, not
+	// the remainder of the chain
+	assert.Equal(t, 2, backend.parentlessReads)
+	assert.Equal(t, 0, backend.getReads())
+}
+
+func TestMissesLimitParentDepthWithoutParentlessReader(t *testing.T) {
+	config := NewConfigWithDefaults()
+	config.MaxParentDepth = 1
+	s, _ := getTestStore(t, config)
+	instances := make([]service.Instance, 10)
+	for i := range instances {
+		instances[i] = getTestInstance()
+		instances[i].Alias = uuid.NewV4().String()
+		if i > 0 {
+			instances[i].ParentAlias = instances[i-1].Alias
+		}
+		assert.Nil(t, s.WriteInstance(instances[i]))
+	}
+	child := instances[len(instances)-1]
+	retrievedChild, ok, err := s.GetInstance(child.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	if assert.NotNil(t, retrievedChild.Parent) {
+		assert.Nil(t, retrievedChild.Parent.Parent)
+	}
+	// The underlying store resolved the entire chain, but only the child and
+	// its parent were cached
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	assert.Equal(t, 2, len(s.instances))
+}
+
+func TestUncachedStoreIsUnderlyingStore(t *testing.T) {
+	s, backend := getTestStore(t, NewConfigWithDefaults())
+	var str storage.Store = s
+	cache, ok := str.(storage.Cache)
+	assert.True(t, ok)
+	if ok {
+		assert.Equal(t, backend, cache.Uncached())
+	}
+}
+
+func TestReadsReturnCopies(t *testing.T) {
+	s, _ := getTestStore(t, NewConfigWithDefaults())
+	svc, _ := s.catalog.GetService(fake.ServiceID)
+	plan, _ := svc.GetPlan(fake.StandardPlanID)
+	pps := plan.GetSchemas().ServiceInstances.ProvisioningParametersSchema
+	instance := getTestInstance()
+	instance.ProvisioningParameters = &service.ProvisioningParameters{
+		Parameters: service.Parameters{
+			Schema: &pps,
+			Data: map[string]interface{}{
+				storetest.SecureParameter: "foo",
+			},
+		},
+	}
+	assert.Nil(t, s.WriteInstance(instance))
+	retrievedInstance, ok, err := s.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	retrievedInstance.Status = service.InstanceStateProvisioned
+	retrievedInstance.ProvisioningParameters.Data["someParameter"] = "bar"
+	retrievedInstance, ok, err = s.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, instance.Status, retrievedInstance.Status)
+	assert.NotContains(
+		t,
+		retrievedInstance.ProvisioningParameters.Data,
+		"someParameter",
+	)
+}
+
+func TestStaleReadsAreNotCached(t *testing.T) {
+	s, backend := getTestStore(t, NewConfigWithDefaults())
+	instance := getTestInstance()
+	assert.Nil(t, s.WriteInstance(instance))
+	staleInstance, ok, err := backend.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	// Simulate the read above having been interleaved with a rewrite
+	generation := s.generation
+	instance.Status = service.InstanceStateProvisioned
+	assert.Nil(t, s.WriteInstance(instance))
+	s.cacheInstances(generation, staleInstance)
+	retrievedInstance, ok, err := s.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, service.InstanceStateProvisioned, retrievedInstance.Status)
+}
+
+func TestCachingCanBeDisabled(t *testing.T) {
+	config := NewConfigWithDefaults()
+	config.InstanceTTL = 0
+	config.BindingTTL = 0
+	s, backend := getTestStore(t, config)
+	instance := getTestInstance()
+	assert.Nil(t, s.WriteInstance(instance))
+	binding := getTestBinding(instance.InstanceID)
+	assert.Nil(t, s.WriteBinding(binding))
+	for i := 0; i < 2; i++ {
+		_, _, err := s.GetInstance(instance.InstanceID)
+		assert.Nil(t, err)
+		_, _, err = s.GetBinding(binding.BindingID)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 4, backend.getReads())
+}
+
+func getTestStore(t *testing.T, config Config) (*store, *countingStore) {
+	catalog, err := storetest.NewCatalog()
+	assert.Nil(t, err)
+	backend := &countingStore{Store: memoryStorage.NewStore(catalog)}
+	str, err := NewStore(catalog, backend, config)
+	assert.Nil(t, err)
+	return str.(*store), backend
+}
+
+func getTestInstance() service.Instance {
+	return service.Instance{
+		InstanceID: uuid.NewV4().String(),
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Status:     service.InstanceStateProvisioning,
+		Created:    time.Now(),
+	}
+}
+
+func getTestBinding(instanceID string) service.Binding {
+	return service.Binding{
+		BindingID:  uuid.NewV4().String(),
+		InstanceID: instanceID,
+		ServiceID:  fake.ServiceID,
+		Created:    time.Now(),
+	}
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/barpilot/gosba/service"
+)
+
+// AliasInUseError is returned by stores when an instance cannot be written
+// because its alias already belongs to a different instance
+type AliasInUseError struct {
+	Alias string
+	// InstanceID is the id of the instance the alias belongs to
+	InstanceID string
+}
+
+// NewAliasInUseError returns a new AliasInUseError for the given alias and the
+// id of the instance it belongs to
+func NewAliasInUseError(alias, instanceID string) *AliasInUseError {
+	return &AliasInUseError{
+		Alias:      alias,
+		InstanceID: instanceID,
+	}
+}
+
+func (e *AliasInUseError) Error() string {
+	return fmt.Sprintf(
+		`alias "%s" is already in use by instance "%s"`,
+		e.Alias,
+		e.InstanceID,
+	)
+}
+
+// InvalidParentAliasError is returned by stores when an instance cannot be
+// written because its parent alias is its own alias
+type InvalidParentAliasError struct {
+	InstanceID  string
+	ParentAlias string
+}
+
+// NewInvalidParentAliasError returns a new InvalidParentAliasError for the
+// given instance id and parent alias
+func NewInvalidParentAliasError(
+	instanceID string,
+	parentAlias string,
+) *InvalidParentAliasError {
+	return &InvalidParentAliasError{
+		InstanceID:  instanceID,
+		ParentAlias: parentAlias,
+	}
+}
+
+func (e *InvalidParentAliasError) Error() string {
+	return fmt.Sprintf(
+		`instance "%s" cannot be its own parent; its alias and parent alias `+
+			`are both "%s"`,
+		e.InstanceID,
+		e.ParentAlias,
+	)
+}
+
+// ValidateParentAlias returns an InvalidParentAliasError if the given
+// instance names itself as its parent. Stores call it before writing an
+// instance.
+func ValidateParentAlias(instance service.Instance) error {
+	if instance.Alias != "" && instance.Alias == instance.ParentAlias {
+		return NewInvalidParentAliasError(
+			instance.InstanceID,
+			instance.ParentAlias,
+		)
+	}
+	return nil
+}
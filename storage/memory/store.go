@@ -3,53 +3,184 @@ package memory
 import (
 	"fmt"
 	"sync"
+	"time"
 
+	"github.com/barpilot/gosba/audit"
+	"github.com/barpilot/gosba/crypto"
 	"github.com/barpilot/gosba/service"
 	"github.com/barpilot/gosba/storage"
 )
 
 type store struct {
-	catalog                       service.Catalog
-	instances                     map[string][]byte
-	instanceAliases               map[string]string
-	bindings                      map[string][]byte
-	instanceAliasChildCounts      map[string]int64
-	instanceAliasChildCountsMutex sync.Mutex
+	catalog service.Catalog
+	// codec encrypts and decrypts secure values, or is nil if the globally
+	// configured codec does
+	codec crypto.Codec
+	*records
 }
 
-// NewStore returns a new memory-based implementation of the storage.Store used
-// for testing
+// records holds everything a store stores. It is shared with the stores
+// returned by WithCodec.
+type records struct {
+	// mutex guards all of the fields below it
+	mutex           sync.RWMutex
+	instances       map[string][]byte
+	instanceAliases map[string]string
+	// instanceAliasChildren maps parent aliases to the sets of IDs of their
+	// children
+	instanceAliasChildren map[string]map[string]struct{}
+	bindings              map[string][]byte
+	auditEntries          []audit.Entry
+	leases                map[string]lease
+}
+
+// lease records the holder of a lease and when the lease expires
+type lease struct {
+	holder  string
+	expires time.Time
+}
+
+// NewStore returns a new memory-based implementation of the storage.Store.
+// It is safe for concurrent use, but everything it stores is lost when the
+// process exits, so it is best suited to testing.
 func NewStore(catalog service.Catalog) storage.Store {
 	return &store{
-		catalog:                  catalog,
-		instances:                make(map[string][]byte),
-		instanceAliases:          make(map[string]string),
-		bindings:                 make(map[string][]byte),
-		instanceAliasChildCounts: make(map[string]int64),
+		catalog: catalog,
+		records: &records{
+			instances:             make(map[string][]byte),
+			instanceAliases:       make(map[string]string),
+			instanceAliasChildren: make(map[string]map[string]struct{}),
+			bindings:              make(map[string][]byte),
+			leases:                make(map[string]lease),
+		},
 	}
 }
 
 func (s *store) WriteInstance(instance service.Instance) error {
-	json, err := instance.ToJSON()
+	if err := storage.ValidateParentAlias(instance); err != nil {
+		return err
+	}
+	json, err := instance.ToJSONWithCodec(s.codec)
 	if err != nil {
 		return err
 	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var previous *service.Instance
+	if previousJSON, ok := s.instances[instance.InstanceID]; ok {
+		// Only the alias and parent alias are needed, so there's no need to
+		// involve the catalog
+		p, err := service.NewInstanceFromJSON(previousJSON, nil, nil)
+		if err != nil {
+			return err
+		}
+		previous = &p
+	}
+	ownerID, claimed := s.instanceAliases[instance.Alias]
+	ownsAlias := !claimed || ownerID == instance.InstanceID
+	// Only a new claim on an alias is rejected. An instance whose alias was
+	// claimed by another instance before aliases were enforced to be unique
+	// remains writable, but does not get the alias back.
+	if instance.Alias != "" && !ownsAlias &&
+		(previous == nil || previous.Alias != instance.Alias) {
+		return storage.NewAliasInUseError(instance.Alias, ownerID)
+	}
+	if previous != nil {
+		if previous.Alias != instance.Alias {
+			s.releaseAlias(previous.Alias, instance.InstanceID)
+		}
+		if previous.ParentAlias != instance.ParentAlias {
+			s.removeChild(previous.ParentAlias, instance.InstanceID)
+		}
+	}
 	s.instances[instance.InstanceID] = json
-	if instance.Alias != "" {
+	if instance.Alias != "" && ownsAlias {
 		s.instanceAliases[instance.Alias] = instance.InstanceID
 	}
 	if instance.ParentAlias != "" {
-		s.instanceAliasChildCountsMutex.Lock()
-		defer s.instanceAliasChildCountsMutex.Unlock()
-		s.instanceAliasChildCounts[instance.ParentAlias]++
+		children, ok := s.instanceAliasChildren[instance.ParentAlias]
+		if !ok {
+			children = map[string]struct{}{}
+			s.instanceAliasChildren[instance.ParentAlias] = children
+		}
+		children[instance.InstanceID] = struct{}{}
 	}
 	return nil
 }
 
+// releaseAlias removes the given alias from the index of aliases, provided it
+// belongs to the given instance. The caller must hold the mutex.
+func (s *store) releaseAlias(alias string, instanceID string) {
+	if alias != "" && s.instanceAliases[alias] == instanceID {
+		delete(s.instanceAliases, alias)
+	}
+}
+
+// removeChild removes the given instance from the children of the parent with
+// the given alias. The caller must hold the mutex.
+func (s *store) removeChild(parentAlias string, instanceID string) {
+	if parentAlias == "" {
+		return
+	}
+	children := s.instanceAliasChildren[parentAlias]
+	delete(children, instanceID)
+	if len(children) == 0 {
+		delete(s.instanceAliasChildren, parentAlias)
+	}
+}
+
 func (s *store) GetInstance(instanceID string) (
 	service.Instance,
 	bool,
 	error,
+) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.getInstance(instanceID)
+}
+
+func (s *store) GetInstanceWithoutParent(instanceID string) (
+	service.Instance,
+	bool,
+	error,
+) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.getInstanceWithoutParent(instanceID)
+}
+
+// getInstance retrieves an instance, along with its ancestors, by instance id.
+// The caller must hold the mutex.
+func (s *store) getInstance(instanceID string) (
+	service.Instance,
+	bool,
+	error,
+) {
+	instance, ok, err := s.getInstanceWithoutParent(instanceID)
+	if err != nil || !ok || instance.ParentAlias == "" {
+		return instance, ok, err
+	}
+	parent, ok, err := s.getInstanceByAlias(instance.ParentAlias)
+	if err != nil {
+		return instance, false, fmt.Errorf(
+			`error retrieving parent with alias "%s" for instance "%s": %s`,
+			instance.ParentAlias,
+			instance.InstanceID,
+			err,
+		)
+	}
+	if ok {
+		instance.Parent = &parent
+	}
+	return instance, true, nil
+}
+
+// getInstanceWithoutParent retrieves an instance by instance id. The caller
+// must hold the mutex.
+func (s *store) getInstanceWithoutParent(instanceID string) (
+	service.Instance,
+	bool,
+	error,
 ) {
 	json, ok := s.instances[instanceID]
 	if !ok {
@@ -79,10 +210,11 @@ func (s *store) GetInstance(instanceID string) (
 			)
 	}
 	pps := plan.GetSchemas().ServiceInstances.ProvisioningParametersSchema
-	instance, err = service.NewInstanceFromJSON(
+	instance, err = service.NewInstanceFromJSONWithCodec(
 		json,
 		svc.GetServiceManager().GetEmptyInstanceDetails(),
 		&pps,
+		s.codec,
 	)
 	instance.Service = svc
 	instance.Plan = plan
@@ -94,49 +226,78 @@ func (s *store) GetInstanceByAlias(alias string) (
 	bool,
 	error,
 ) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.getInstanceByAlias(alias)
+}
+
+func (s *store) GetInstanceByAliasWithoutParent(alias string) (
+	service.Instance,
+	bool,
+	error,
+) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	instanceID, ok := s.instanceAliases[alias]
 	if !ok {
 		return service.Instance{}, false, nil
 	}
-	return s.GetInstance(instanceID)
+	return s.getInstanceWithoutParent(instanceID)
 }
 
-func (s *store) DeleteInstance(instanceID string) (bool, error) {
-	instance, ok, err := s.GetInstance(instanceID)
-	if err != nil {
-		return false, err
+// getInstanceByAlias retrieves an instance by alias. The caller must hold the
+// mutex.
+func (s *store) getInstanceByAlias(alias string) (
+	service.Instance,
+	bool,
+	error,
+) {
+	instanceID, ok := s.instanceAliases[alias]
+	if !ok {
+		return service.Instance{}, false, nil
 	}
+	return s.getInstance(instanceID)
+}
+
+func (s *store) DeleteInstance(instanceID string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	json, ok := s.instances[instanceID]
 	if !ok {
 		return false, nil
 	}
-	delete(s.instances, instanceID)
-	if instance.Alias != "" {
-		delete(s.instanceAliases, instance.Alias)
-	}
-	if instance.ParentAlias != "" {
-		s.instanceAliasChildCountsMutex.Lock()
-		defer s.instanceAliasChildCountsMutex.Unlock()
-		s.instanceAliasChildCounts[instance.ParentAlias]--
+	// Only the alias and parent alias are needed, so there's no need to
+	// involve the catalog
+	instance, err := service.NewInstanceFromJSON(json, nil, nil)
+	if err != nil {
+		return false, err
 	}
+	delete(s.instances, instanceID)
+	s.releaseAlias(instance.Alias, instanceID)
+	s.removeChild(instance.ParentAlias, instanceID)
 	return true, nil
 }
 
 func (s *store) GetInstanceChildCountByAlias(alias string) (int64, error) {
-	s.instanceAliasChildCountsMutex.Lock()
-	defer s.instanceAliasChildCountsMutex.Unlock()
-	return s.instanceAliasChildCounts[alias], nil
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return int64(len(s.instanceAliasChildren[alias])), nil
 }
 
 func (s *store) WriteBinding(binding service.Binding) error {
-	json, err := binding.ToJSON()
+	json, err := binding.ToJSONWithCodec(s.codec)
 	if err != nil {
 		return err
 	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	s.bindings[binding.BindingID] = json
 	return nil
 }
 
 func (s *store) GetBinding(bindingID string) (service.Binding, bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	json, ok := s.bindings[bindingID]
 	if !ok {
 		return service.Binding{}, false, nil
@@ -145,7 +306,7 @@ func (s *store) GetBinding(bindingID string) (service.Binding, bool, error) {
 	if err != nil {
 		return binding, false, err
 	}
-	instance, ok, err := s.GetInstance(binding.InstanceID)
+	instance, ok, err := s.getInstance(binding.InstanceID)
 	if err != nil {
 		return binding, false, err
 	}
@@ -153,16 +314,19 @@ func (s *store) GetBinding(bindingID string) (service.Binding, bool, error) {
 	// binding from the JSON
 	if ok {
 		bps := instance.Plan.GetSchemas().ServiceBindings.BindingParametersSchema
-		binding, err = service.NewBindingFromJSON(
+		binding, err = service.NewBindingFromJSONWithCodec(
 			json,
 			instance.Service.GetServiceManager().GetEmptyBindingDetails(),
 			&bps,
+			s.codec,
 		)
 	}
 	return binding, err == nil, err
 }
 
 func (s *store) DeleteBinding(bindingID string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	_, ok := s.bindings[bindingID]
 	if !ok {
 		return false, nil
@@ -171,6 +335,69 @@ func (s *store) DeleteBinding(bindingID string) (bool, error) {
 	return true, nil
 }
 
+func (s *store) GetInstanceIDs() ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	instanceIDs := make([]string, 0, len(s.instances))
+	for instanceID := range s.instances {
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+	return instanceIDs, nil
+}
+
+func (s *store) GetBindingIDs() ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	bindingIDs := make([]string, 0, len(s.bindings))
+	for bindingID := range s.bindings {
+		bindingIDs = append(bindingIDs, bindingID)
+	}
+	return bindingIDs, nil
+}
+
+func (s *store) AcquireLease(
+	name string,
+	holder string,
+	ttl time.Duration,
+) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	if l, ok := s.leases[name]; ok && l.holder != holder && now.Before(l.expires) {
+		return false, nil
+	}
+	s.leases[name] = lease{
+		holder:  holder,
+		expires: now.Add(ttl),
+	}
+	return true, nil
+}
+
+// WithCodec returns a store for the same records that encrypts and decrypts
+// secure values using the given codec
+func (s *store) WithCodec(codec crypto.Codec) (storage.Store, error) {
+	return &store{
+		catalog: s.catalog,
+		codec:   codec,
+		records: s.records,
+	}, nil
+}
+
 func (s *store) TestConnection() error {
 	return nil
 }
+
+func (s *store) WriteAuditEntry(entry audit.Entry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.auditEntries = append(s.auditEntries, entry)
+	return nil
+}
+
+func (s *store) GetAuditEntries() ([]audit.Entry, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	entries := make([]audit.Entry, len(s.auditEntries))
+	copy(entries, s.auditEntries)
+	return entries, nil
+}
@@ -0,0 +1,18 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/storage"
+	"github.com/barpilot/gosba/storage/storetest"
+)
+
+func TestStoreConformance(t *testing.T) {
+	storetest.Run(
+		t,
+		func(t *testing.T, catalog service.Catalog) storage.Store {
+			return NewStore(catalog)
+		},
+	)
+}
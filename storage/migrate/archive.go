@@ -0,0 +1,566 @@
+package migrate
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+// ArchiveVersion is the version of the layout of archives written by Export
+const ArchiveVersion = 1
+
+const (
+	manifestEntry  = "manifest.json"
+	instancesEntry = "instances.jsonl"
+	bindingsEntry  = "bindings.jsonl"
+)
+
+// ConflictPolicy determines how Import treats records that already exist in
+// the destination store with contents that differ from the archive's
+type ConflictPolicy string
+
+const (
+	// ConflictPolicySkip leaves conflicting records in the destination store
+	// untouched
+	ConflictPolicySkip ConflictPolicy = "skip"
+	// ConflictPolicyOverwrite replaces conflicting records in the destination
+	// store with the archive's. Instances whose alias belongs to a different
+	// instance in the destination store are skipped regardless, since
+	// overwriting would steal the alias, and any children, from that instance.
+	// Their children and bindings are skipped along with them.
+	ConflictPolicyOverwrite ConflictPolicy = "overwrite"
+)
+
+// manifest describes the contents of an archive. It is always the first
+// entry.
+type manifest struct {
+	ArchiveVersion        int       `json:"archiveVersion"`
+	Created               time.Time `json:"created"`
+	InstanceFormatVersion int       `json:"instanceFormatVersion"`
+	BindingFormatVersion  int       `json:"bindingFormatVersion"`
+	Instances             int       `json:"instances"`
+	Bindings              int       `json:"bindings"`
+}
+
+// ImportOptions represents options for importing an archive
+type ImportOptions struct {
+	// ConflictPolicy determines how records that already exist in the
+	// destination store with different contents are treated. It defaults to
+	// ConflictPolicySkip.
+	ConflictPolicy ConflictPolicy
+	// DryRun, if set, reports what importing would do without writing
+	// anything to the destination store
+	DryRun bool
+}
+
+// ImportResults lists the ids of the records of one kind found in an archive,
+// by what importing did, or in a dry run would do, with them
+type ImportResults struct {
+	// Created lists records that did not exist in the destination store
+	Created []string `json:"created,omitempty"`
+	// Unchanged lists records that already existed in the destination store
+	// with identical contents
+	Unchanged []string `json:"unchanged,omitempty"`
+	// Overwritten lists conflicting records that were replaced
+	Overwritten []string `json:"overwritten,omitempty"`
+	// Skipped lists records that were not imported: conflicting records that
+	// were left untouched, instances whose alias belongs to a different
+	// instance in the destination store, and the children and bindings of
+	// such instances
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// ImportReport summarizes the outcome of an import
+type ImportReport struct {
+	DryRun    bool          `json:"dryRun"`
+	Instances ImportResults `json:"instances"`
+	Bindings  ImportResults `json:"bindings"`
+}
+
+// Export writes every instance and binding held by the source store to the
+// given writer as a gzipped tar archive. The source must implement
+// storage.Enumerator. Records are written, one JSON document per line, in the
+// format in which stores persist them, so secure values remain encrypted
+// using the global codec. Aliases and parent relations are part of each
+// instance record; parents precede their children. Orphaned bindings are not
+// exported, but are listed in the returned report.
+func Export(src storage.Store, w io.Writer) (Report, error) {
+	// Tar headers must state the size of each entry, so both record entries
+	// are assembled in memory
+	var instancesBuf, bindingsBuf bytes.Buffer
+	report, err := forEachRecord(
+		src,
+		func(instance service.Instance) error {
+			return writeRecordLine(&instancesBuf, instance.ToJSON)
+		},
+		func(binding service.Binding) error {
+			return writeRecordLine(&bindingsBuf, binding.ToJSON)
+		},
+	)
+	if err != nil {
+		return report, err
+	}
+	manifestJSON, err := json.Marshal(manifest{
+		ArchiveVersion:        ArchiveVersion,
+		Created:               time.Now(),
+		InstanceFormatVersion: service.GetInstanceFormatVersion(),
+		BindingFormatVersion:  service.GetBindingFormatVersion(),
+		Instances:             report.InstancesCopied,
+		Bindings:              report.BindingsCopied,
+	})
+	if err != nil {
+		return report, fmt.Errorf("error marshaling archive manifest: %s", err)
+	}
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, entry := range []struct {
+		name    string
+		content []byte
+	}{
+		{name: manifestEntry, content: manifestJSON},
+		{name: instancesEntry, content: instancesBuf.Bytes()},
+		{name: bindingsEntry, content: bindingsBuf.Bytes()},
+	} {
+		if err := tarWriter.WriteHeader(&tar.Header{
+			Name:    entry.name,
+			Mode:    0600,
+			Size:    int64(len(entry.content)),
+			ModTime: time.Now(),
+		}); err != nil {
+			return report, fmt.Errorf(
+				`error writing archive entry "%s": %s`,
+				entry.name,
+				err,
+			)
+		}
+		if _, err := tarWriter.Write(entry.content); err != nil {
+			return report, fmt.Errorf(
+				`error writing archive entry "%s": %s`,
+				entry.name,
+				err,
+			)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return report, fmt.Errorf("error writing archive: %s", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return report, fmt.Errorf("error writing archive: %s", err)
+	}
+	return report, nil
+}
+
+func writeRecordLine(w io.Writer, toJSON func() ([]byte, error)) error {
+	recordJSON, err := toJSON()
+	if err != nil {
+		return fmt.Errorf("error marshaling record: %s", err)
+	}
+	_, err = w.Write(append(recordJSON, '\n'))
+	return err
+}
+
+// Import reads an archive written by Export and writes its records to the
+// destination store, resolving services and plans using the given catalog.
+// Secure values are decrypted using the global codec and re-encrypted as
+// they are written, so importing an archive exported using a different codec
+// must be done by a dedicated migration process, as described in the package
+// documentation.
+// Records of older format versions are upgraded as they are read. Importing
+// is idempotent: records already in the destination store with identical
+// contents are left untouched, and conflicting records are treated as
+// dictated by the options.
+func Import(
+	dst storage.Store,
+	catalog service.Catalog,
+	r io.Reader,
+	options ImportOptions,
+) (ImportReport, error) {
+	report := ImportReport{
+		DryRun: options.DryRun,
+	}
+	switch options.ConflictPolicy {
+	case "":
+		options.ConflictPolicy = ConflictPolicySkip
+	case ConflictPolicySkip, ConflictPolicyOverwrite:
+	default:
+		return report, fmt.Errorf(
+			`unrecognized conflict policy "%s"`,
+			options.ConflictPolicy,
+		)
+	}
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return report, fmt.Errorf("error reading archive: %s", err)
+	}
+	defer gzipReader.Close() // nolint: errcheck
+	tarReader := tar.NewReader(gzipReader)
+	i := importer{
+		dst:                 dst,
+		catalog:             catalog,
+		options:             options,
+		report:              &report,
+		instances:           map[string]service.Instance{},
+		excludedInstanceIDs: map[string]struct{}{},
+		excludedAliases:     map[string]struct{}{},
+	}
+	for _, entryName := range []string{
+		manifestEntry,
+		instancesEntry,
+		bindingsEntry,
+	} {
+		header, err := tarReader.Next()
+		if err != nil {
+			return report, fmt.Errorf(
+				`error reading archive entry "%s": %s`,
+				entryName,
+				err,
+			)
+		}
+		if header.Name != entryName {
+			return report, fmt.Errorf(
+				`unexpected archive entry "%s"; expected "%s"`,
+				header.Name,
+				entryName,
+			)
+		}
+		var entryFn func(json.RawMessage) error
+		switch entryName {
+		case manifestEntry:
+			entryFn = i.checkManifest
+		case instancesEntry:
+			entryFn = i.importInstance
+		case bindingsEntry:
+			entryFn = i.importBinding
+		}
+		decoder := json.NewDecoder(tarReader)
+		for decoder.More() {
+			var record json.RawMessage
+			if err := decoder.Decode(&record); err != nil {
+				return report, fmt.Errorf(
+					`error reading archive entry "%s": %s`,
+					entryName,
+					err,
+				)
+			}
+			if err := entryFn(record); err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, nil
+}
+
+// importer tracks the state of a single import
+type importer struct {
+	dst     storage.Store
+	catalog service.Catalog
+	options ImportOptions
+	report  *ImportReport
+	// instances indexes the instances in the archive by id, so that the
+	// parameters of their bindings can be decrypted using the right schema
+	instances map[string]service.Instance
+	// excludedInstanceIDs and excludedAliases index the instances in the
+	// archive that are absent from the destination store because they were
+	// skipped. Their children and bindings are skipped as well, since they
+	// would otherwise be orphaned or, worse, attached to an unrelated instance
+	// that holds the same alias in the destination store.
+	excludedInstanceIDs map[string]struct{}
+	excludedAliases     map[string]struct{}
+}
+
+func (i *importer) checkManifest(manifestJSON json.RawMessage) error {
+	m := manifest{}
+	if err := json.Unmarshal(manifestJSON, &m); err != nil {
+		return fmt.Errorf("error unmarshaling archive manifest: %s", err)
+	}
+	if m.ArchiveVersion != ArchiveVersion {
+		return fmt.Errorf(
+			"archive version %d is not supported; only version %d is",
+			m.ArchiveVersion,
+			ArchiveVersion,
+		)
+	}
+	return nil
+}
+
+func (i *importer) importInstance(instanceJSON json.RawMessage) error {
+	instance, err := service.NewInstanceFromJSON(instanceJSON, nil, nil)
+	if err != nil {
+		return fmt.Errorf("error unmarshaling archived instance: %s", err)
+	}
+	svc, plan, err := i.getServiceAndPlan(instance.ServiceID, instance.PlanID)
+	if err != nil {
+		return fmt.Errorf(
+			`error importing instance "%s": %s`,
+			instance.InstanceID,
+			err,
+		)
+	}
+	pps := plan.GetSchemas().ServiceInstances.ProvisioningParametersSchema
+	if instance, err = service.NewInstanceFromJSON(
+		instanceJSON,
+		svc.GetServiceManager().GetEmptyInstanceDetails(),
+		&pps,
+	); err != nil {
+		return fmt.Errorf(
+			`error unmarshaling archived instance "%s": %s`,
+			instance.InstanceID,
+			err,
+		)
+	}
+	instance.Service = svc
+	instance.Plan = plan
+	i.instances[instance.InstanceID] = instance
+
+	logFields := log.Fields{
+		"instanceID": instance.InstanceID,
+		"dryRun":     i.options.DryRun,
+	}
+	// Parents precede their children in archives, so a child of a skipped
+	// instance is always recognized as such
+	if _, ok := i.excludedAliases[instance.ParentAlias]; ok {
+		logFields["parentAlias"] = instance.ParentAlias
+		log.WithFields(logFields).Warn(
+			"skipping instance whose parent was skipped",
+		)
+		i.excludeInstance(instance)
+		return nil
+	}
+	existing, exists, err := i.dst.GetInstance(instance.InstanceID)
+	if err != nil {
+		return fmt.Errorf(
+			`error retrieving instance "%s" from destination: %s`,
+			instance.InstanceID,
+			err,
+		)
+	}
+	if instance.Alias != "" {
+		aliased, ok, err := i.dst.GetInstanceByAlias(instance.Alias)
+		if err != nil {
+			return fmt.Errorf(
+				`error retrieving instance with alias "%s" from destination: %s`,
+				instance.Alias,
+				err,
+			)
+		}
+		if ok && aliased.InstanceID != instance.InstanceID {
+			logFields["alias"] = instance.Alias
+			logFields["aliasedInstanceID"] = aliased.InstanceID
+			log.WithFields(logFields).Warn(
+				"skipping instance whose alias belongs to another instance",
+			)
+			i.excludeInstance(instance)
+			return nil
+		}
+	}
+	results := &i.report.Instances
+	if exists {
+		if sameInstance(existing, instance) {
+			results.Unchanged = append(results.Unchanged, instance.InstanceID)
+			return nil
+		}
+		if i.options.ConflictPolicy == ConflictPolicySkip {
+			log.WithFields(logFields).Warn("skipping conflicting instance")
+			results.Skipped = append(results.Skipped, instance.InstanceID)
+			return nil
+		}
+		results.Overwritten = append(results.Overwritten, instance.InstanceID)
+	} else {
+		results.Created = append(results.Created, instance.InstanceID)
+	}
+	if i.options.DryRun {
+		return nil
+	}
+	if err := i.dst.WriteInstance(instance); err != nil {
+		return fmt.Errorf(
+			`error writing instance "%s" to destination: %s`,
+			instance.InstanceID,
+			err,
+		)
+	}
+	log.WithFields(logFields).Debug("imported instance")
+	return nil
+}
+
+// excludeInstance records that the given instance was skipped and won't be
+// present in the destination store
+func (i *importer) excludeInstance(instance service.Instance) {
+	i.excludedInstanceIDs[instance.InstanceID] = struct{}{}
+	if instance.Alias != "" {
+		i.excludedAliases[instance.Alias] = struct{}{}
+	}
+	i.report.Instances.Skipped =
+		append(i.report.Instances.Skipped, instance.InstanceID)
+}
+
+func (i *importer) importBinding(bindingJSON json.RawMessage) error {
+	binding, err := service.NewBindingFromJSON(bindingJSON, nil, nil)
+	if err != nil {
+		return fmt.Errorf("error unmarshaling archived binding: %s", err)
+	}
+	if _, ok := i.excludedInstanceIDs[binding.InstanceID]; ok {
+		log.WithFields(log.Fields{
+			"bindingID":  binding.BindingID,
+			"instanceID": binding.InstanceID,
+			"dryRun":     i.options.DryRun,
+		}).Warn("skipping binding whose instance was skipped")
+		i.report.Bindings.Skipped =
+			append(i.report.Bindings.Skipped, binding.BindingID)
+		return nil
+	}
+	instance, ok := i.instances[binding.InstanceID]
+	if !ok {
+		return fmt.Errorf(
+			`archived binding "%s" belongs to instance "%s", which is not in the `+
+				`archive`,
+			binding.BindingID,
+			binding.InstanceID,
+		)
+	}
+	bps := instance.Plan.GetSchemas().ServiceBindings.BindingParametersSchema
+	if binding, err = service.NewBindingFromJSON(
+		bindingJSON,
+		instance.Service.GetServiceManager().GetEmptyBindingDetails(),
+		&bps,
+	); err != nil {
+		return fmt.Errorf(
+			`error unmarshaling archived binding "%s": %s`,
+			binding.BindingID,
+			err,
+		)
+	}
+
+	logFields := log.Fields{
+		"bindingID": binding.BindingID,
+		"dryRun":    i.options.DryRun,
+	}
+	existing, exists, err := i.dst.GetBinding(binding.BindingID)
+	if err != nil {
+		return fmt.Errorf(
+			`error retrieving binding "%s" from destination: %s`,
+			binding.BindingID,
+			err,
+		)
+	}
+	results := &i.report.Bindings
+	if exists {
+		if sameBinding(existing, binding) {
+			results.Unchanged = append(results.Unchanged, binding.BindingID)
+			return nil
+		}
+		if i.options.ConflictPolicy == ConflictPolicySkip {
+			log.WithFields(logFields).Warn("skipping conflicting binding")
+			results.Skipped = append(results.Skipped, binding.BindingID)
+			return nil
+		}
+		results.Overwritten = append(results.Overwritten, binding.BindingID)
+	} else {
+		results.Created = append(results.Created, binding.BindingID)
+	}
+	if i.options.DryRun {
+		return nil
+	}
+	if err := i.dst.WriteBinding(binding); err != nil {
+		return fmt.Errorf(
+			`error writing binding "%s" to destination: %s`,
+			binding.BindingID,
+			err,
+		)
+	}
+	log.WithFields(logFields).Debug("imported binding")
+	return nil
+}
+
+func (i *importer) getServiceAndPlan(
+	serviceID string,
+	planID string,
+) (service.Service, service.Plan, error) {
+	svc, ok := i.catalog.GetService(serviceID)
+	if !ok {
+		return nil, nil, fmt.Errorf(
+			`service not found in catalog for service ID "%s"`,
+			serviceID,
+		)
+	}
+	plan, ok := svc.GetPlan(planID)
+	if !ok {
+		return nil, nil, fmt.Errorf(
+			`plan not found for planID "%s" for service "%s" in the catalog`,
+			planID,
+			serviceID,
+		)
+	}
+	return svc, plan, nil
+}
+
+// sameInstance reports whether two instances have identical persisted
+// contents. Fields that are not persisted and parameter schemas, which are
+// derived from the catalog, are disregarded.
+func sameInstance(a service.Instance, b service.Instance) bool {
+	if !sameData(
+		getProvisioningData(a.ProvisioningParameters),
+		getProvisioningData(b.ProvisioningParameters),
+	) || !sameData(
+		getProvisioningData(a.UpdatingParameters),
+		getProvisioningData(b.UpdatingParameters),
+	) {
+		return false
+	}
+	for _, instance := range []*service.Instance{&a, &b} {
+		instance.Service = nil
+		instance.Plan = nil
+		instance.Parent = nil
+		instance.ProvisioningParameters = nil
+		instance.UpdatingParameters = nil
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// sameBinding reports whether two bindings have identical persisted contents.
+// Binding parameter schemas, which are derived from the catalog, are
+// disregarded.
+func sameBinding(a service.Binding, b service.Binding) bool {
+	if !sameData(
+		getBindingData(a.BindingParameters),
+		getBindingData(b.BindingParameters),
+	) {
+		return false
+	}
+	a.BindingParameters = nil
+	b.BindingParameters = nil
+	return reflect.DeepEqual(a, b)
+}
+
+// sameData reports whether two parameter maps hold the same data. Absent and
+// empty maps are considered the same.
+func sameData(a map[string]interface{}, b map[string]interface{}) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func getProvisioningData(
+	pp *service.ProvisioningParameters,
+) map[string]interface{} {
+	if pp == nil {
+		return nil
+	}
+	return pp.Data
+}
+
+func getBindingData(bp *service.BindingParameters) map[string]interface{} {
+	if bp == nil {
+		return nil
+	}
+	return bp.Data
+}
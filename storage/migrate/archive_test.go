@@ -0,0 +1,382 @@
+package migrate
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/barpilot/gosba/crypto/rewrap"
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/storage"
+	"github.com/barpilot/gosba/storage/bolt"
+	"github.com/barpilot/gosba/storage/memory"
+	"github.com/barpilot/gosba/storage/storetest"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// getTestArchive returns a store holding a parent, its child, a binding to the
+// child, and an orphaned binding, along with an archive exported from it
+func getTestArchive(
+	t *testing.T,
+) (storage.Store, []service.Instance, service.Binding, []byte) {
+	src := memory.NewStore(getTestCatalog(t))
+	parent := getTestInstance()
+	parent.Alias = uuid.NewV4().String()
+	child := getTestInstance()
+	child.ParentAlias = parent.Alias
+	for _, instance := range []service.Instance{child, parent} {
+		assert.Nil(t, src.WriteInstance(instance))
+	}
+	binding := getTestBinding(t, child.InstanceID)
+	assert.Nil(t, src.WriteBinding(binding))
+	orphan := getTestBinding(t, uuid.NewV4().String())
+	assert.Nil(t, src.WriteBinding(orphan))
+	var buf bytes.Buffer
+	report, err := Export(src, &buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, report.InstancesCopied)
+	assert.Equal(t, 1, report.BindingsCopied)
+	assert.Equal(t, []string{orphan.BindingID}, report.OrphanedBindingIDs)
+	return src, []service.Instance{parent, child}, binding, buf.Bytes()
+}
+
+func getTestBoltStore(t *testing.T) storage.Store {
+	dir, err := ioutil.TempDir("", "gosba")
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(dir) // nolint: errcheck
+	})
+	config := bolt.NewConfigWithDefaults()
+	config.Path = filepath.Join(dir, "gosba.db")
+	store, err := bolt.NewStore(getTestCatalog(t), config)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		store.Close() // nolint: errcheck
+	})
+	return store
+}
+
+func writeTestArchive(t *testing.T, entries map[string]string) []byte {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, name := range []string{manifestEntry, instancesEntry, bindingsEntry} {
+		content, ok := entries[name]
+		if !ok {
+			continue
+		}
+		assert.Nil(t, tarWriter.WriteHeader(&tar.Header{
+			Name: name,
+			Mode: 0600,
+			Size: int64(len(content)),
+		}))
+		_, err := tarWriter.Write([]byte(content))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, tarWriter.Close())
+	assert.Nil(t, gzipWriter.Close())
+	return buf.Bytes()
+}
+
+func readTestArchive(t *testing.T, archive []byte) map[string][]byte {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(archive))
+	assert.Nil(t, err)
+	tarReader := tar.NewReader(gzipReader)
+	entries := map[string][]byte{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return entries
+		}
+		assert.Nil(t, err)
+		entries[header.Name], err = ioutil.ReadAll(tarReader)
+		assert.Nil(t, err)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	_, instances, binding, archive := getTestArchive(t)
+	entries := readTestArchive(t, archive)
+	assert.Contains(t, string(entries[manifestEntry]), `"archiveVersion":1`)
+	// Parents precede their children
+	assert.True(
+		t,
+		bytes.Index(entries[instancesEntry], []byte(instances[0].InstanceID)) <
+			bytes.Index(entries[instancesEntry], []byte(instances[1].InstanceID)),
+	)
+
+	dst := getTestBoltStore(t)
+	report, err := Import(
+		dst,
+		getTestCatalog(t),
+		bytes.NewReader(archive),
+		ImportOptions{},
+	)
+	assert.Nil(t, err)
+	assert.False(t, report.DryRun)
+	assert.Equal(
+		t,
+		[]string{instances[0].InstanceID, instances[1].InstanceID},
+		report.Instances.Created,
+	)
+	assert.Equal(t, []string{binding.BindingID}, report.Bindings.Created)
+
+	retrievedChild, ok, err := dst.GetInstance(instances[1].InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	if assert.NotNil(t, retrievedChild.Parent) {
+		assert.Equal(t, instances[0].InstanceID, retrievedChild.Parent.InstanceID)
+	}
+	count, err := dst.GetInstanceChildCountByAlias(instances[0].Alias)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+	retrievedBinding, ok, err := dst.GetBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(
+		t,
+		"foo",
+		retrievedBinding.BindingParameters.GetString(storetest.SecureParameter),
+	)
+}
+
+func TestImportIsIdempotent(t *testing.T) {
+	_, instances, binding, archive := getTestArchive(t)
+	dst := memory.NewStore(getTestCatalog(t))
+	for i := 0; i < 2; i++ {
+		report, err := Import(
+			dst,
+			getTestCatalog(t),
+			bytes.NewReader(archive),
+			ImportOptions{},
+		)
+		assert.Nil(t, err)
+		if i == 0 {
+			continue
+		}
+		assert.Empty(t, report.Instances.Created)
+		assert.Equal(
+			t,
+			[]string{instances[0].InstanceID, instances[1].InstanceID},
+			report.Instances.Unchanged,
+		)
+		assert.Empty(t, report.Bindings.Created)
+		assert.Equal(t, []string{binding.BindingID}, report.Bindings.Unchanged)
+	}
+	count, err := dst.GetInstanceChildCountByAlias(instances[0].Alias)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestImportConflictPolicies(t *testing.T) {
+	_, instances, binding, archive := getTestArchive(t)
+	testCases := map[ConflictPolicy]string{
+		ConflictPolicySkip:      service.InstanceStateDeprovisioning,
+		ConflictPolicyOverwrite: service.InstanceStateProvisioned,
+	}
+	for policy, expectedStatus := range testCases {
+		t.Run(string(policy), func(t *testing.T) {
+			dst := memory.NewStore(getTestCatalog(t))
+			conflictingInstance := instances[1]
+			conflictingInstance.Status = service.InstanceStateDeprovisioning
+			assert.Nil(t, dst.WriteInstance(conflictingInstance))
+			report, err := Import(
+				dst,
+				getTestCatalog(t),
+				bytes.NewReader(archive),
+				ImportOptions{
+					ConflictPolicy: policy,
+				},
+			)
+			assert.Nil(t, err)
+			assert.Equal(
+				t,
+				[]string{instances[0].InstanceID},
+				report.Instances.Created,
+			)
+			if policy == ConflictPolicySkip {
+				assert.Equal(
+					t,
+					[]string{conflictingInstance.InstanceID},
+					report.Instances.Skipped,
+				)
+			} else {
+				assert.Equal(
+					t,
+					[]string{conflictingInstance.InstanceID},
+					report.Instances.Overwritten,
+				)
+			}
+			assert.Equal(t, []string{binding.BindingID}, report.Bindings.Created)
+			retrievedInstance, ok, err :=
+				dst.GetInstance(conflictingInstance.InstanceID)
+			assert.Nil(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, expectedStatus, retrievedInstance.Status)
+		})
+	}
+}
+
+func TestImportSkipsInstancesWhoseAliasIsTaken(t *testing.T) {
+	_, instances, binding, archive := getTestArchive(t)
+	dst := memory.NewStore(getTestCatalog(t))
+	squatter := getTestInstance()
+	squatter.Alias = instances[0].Alias
+	assert.Nil(t, dst.WriteInstance(squatter))
+	// A dry run reports the same as the import itself
+	for _, dryRun := range []bool{true, false} {
+		report, err := Import(
+			dst,
+			getTestCatalog(t),
+			bytes.NewReader(archive),
+			ImportOptions{
+				ConflictPolicy: ConflictPolicyOverwrite,
+				DryRun:         dryRun,
+			},
+		)
+		assert.Nil(t, err)
+		// The child and its binding are skipped along with the parent, rather
+		// than being attached to the squatter
+		assert.Equal(
+			t,
+			[]string{instances[0].InstanceID, instances[1].InstanceID},
+			report.Instances.Skipped,
+		)
+		assert.Empty(t, report.Instances.Created)
+		assert.Equal(t, []string{binding.BindingID}, report.Bindings.Skipped)
+		assert.Empty(t, report.Bindings.Created)
+	}
+	retrievedInstance, ok, err := dst.GetInstanceByAlias(instances[0].Alias)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, squatter.InstanceID, retrievedInstance.InstanceID)
+	childCount, err := dst.GetInstanceChildCountByAlias(squatter.Alias)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), childCount)
+	_, ok, err = dst.GetBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestImportDryRun(t *testing.T) {
+	_, instances, binding, archive := getTestArchive(t)
+	dst := memory.NewStore(getTestCatalog(t))
+	report, err := Import(
+		dst,
+		getTestCatalog(t),
+		bytes.NewReader(archive),
+		ImportOptions{
+			DryRun: true,
+		},
+	)
+	assert.Nil(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(
+		t,
+		[]string{instances[0].InstanceID, instances[1].InstanceID},
+		report.Instances.Created,
+	)
+	assert.Equal(t, []string{binding.BindingID}, report.Bindings.Created)
+	for _, instance := range instances {
+		_, ok, err := dst.GetInstance(instance.InstanceID)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	}
+	_, ok, err := dst.GetBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestImportRejectsInvalidArchives(t *testing.T) {
+	testCases := map[string][]byte{
+		"not gzipped": []byte("foo"),
+		"unsupported archive version": writeTestArchive(
+			t,
+			map[string]string{
+				manifestEntry:  `{"archiveVersion":2}`,
+				instancesEntry: "",
+				bindingsEntry:  "",
+			},
+		),
+		"missing manifest": writeTestArchive(
+			t,
+			map[string]string{
+				instancesEntry: "",
+				bindingsEntry:  "",
+			},
+		),
+		"binding without instance": writeTestArchive(
+			t,
+			map[string]string{
+				manifestEntry:  `{"archiveVersion":1}`,
+				instancesEntry: "",
+				bindingsEntry:  `{"bindingId":"foo","instanceId":"bar"}`,
+			},
+		),
+	}
+	for name, archive := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Import(
+				memory.NewStore(getTestCatalog(t)),
+				getTestCatalog(t),
+				bytes.NewReader(archive),
+				ImportOptions{},
+			)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestImportRejectsUnknownConflictPolicy(t *testing.T) {
+	_, _, _, archive := getTestArchive(t)
+	_, err := Import(
+		memory.NewStore(getTestCatalog(t)),
+		getTestCatalog(t),
+		bytes.NewReader(archive),
+		ImportOptions{
+			ConflictPolicy: "bogus",
+		},
+	)
+	assert.NotNil(t, err)
+}
+
+func TestArchivesKeepSecureValuesEncrypted(t *testing.T) {
+	srcCodec := getTestAESCodec(t, "AES256Key-32Characters1234567890")
+	dstCodec := getTestAESCodec(t, "AES256Key-32Characters0987654321")
+	var archive []byte
+	var binding service.Binding
+	t.Run("export", func(t *testing.T) {
+		useCodec(t, srcCodec)
+		_, _, binding, archive = getTestArchive(t)
+		entries := readTestArchive(t, archive)
+		assert.NotContains(t, string(entries[bindingsEntry]), `"foo"`)
+	})
+	dst := memory.NewStore(getTestCatalog(t))
+	t.Run("import", func(t *testing.T) {
+		useCodec(t, rewrap.NewCodec(srcCodec, dstCodec))
+		_, err := Import(
+			dst,
+			getTestCatalog(t),
+			bytes.NewReader(archive),
+			ImportOptions{},
+		)
+		assert.Nil(t, err)
+	})
+	t.Run("read destination", func(t *testing.T) {
+		useCodec(t, dstCodec)
+		retrievedBinding, ok, err := dst.GetBinding(binding.BindingID)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		assert.Equal(
+			t,
+			"foo",
+			retrievedBinding.BindingParameters.GetString(storetest.SecureParameter),
+		)
+	})
+}
@@ -0,0 +1,224 @@
+// Package migrate moves broker state between storage backends, either
+// directly or by way of portable archives. Because the global codec encrypts
+// and decrypts secure values as records are written and read, moving a record
+// re-encrypts it and any format upgrades registered with the service package
+// are applied along the way.
+//
+// Secure values are encrypted and decrypted within the records' JSON
+// marshaling, so the codecs involved cannot be passed to the functions of
+// this package. Re-wrapping secure values for a different codec instead
+// requires a dedicated migration process whose global codec is initialized,
+// once and before anything else, with a codec returned by rewrap.NewCodec.
+// Since the global codec cannot be replaced, that process can't go on to
+// serve requests; a broker reading the destination must be started
+// separately, using the new codec.
+package migrate
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+// Report summarizes the outcome of a copy or an export
+type Report struct {
+	// InstancesCopied is the number of instances copied or exported
+	InstancesCopied int
+	// BindingsCopied is the number of bindings copied or exported
+	BindingsCopied int
+	// OrphanedBindingIDs are the ids of bindings that were not copied because
+	// the instances they belong to no longer exist. Secure binding parameters
+	// cannot be decrypted without knowing the plan of the binding's instance.
+	OrphanedBindingIDs []string
+}
+
+// instanceRef is the subset of an instance's fields needed to order instances
+// such that parents are written before their children
+type instanceRef struct {
+	instanceID  string
+	parentAlias string
+}
+
+// Copy streams every instance and binding held by the source store into the
+// destination store, one record at a time. The source must implement
+// storage.Enumerator. Instances are written before bindings and parents
+// before their children, so that the destination is consistent at every step.
+// Records that already exist in the destination are overwritten, so an
+// interrupted copy can simply be repeated. Copying a store onto itself
+// rewrites every record using the latest format version and the global codec.
+// Neither store should be in use by a running broker while the copy is in
+// progress.
+func Copy(src storage.Store, dst storage.Store) (Report, error) {
+	return forEachRecord(
+		src,
+		func(instance service.Instance) error {
+			if err := dst.WriteInstance(instance); err != nil {
+				return fmt.Errorf(
+					`error writing instance "%s" to destination: %s`,
+					instance.InstanceID,
+					err,
+				)
+			}
+			return nil
+		},
+		func(binding service.Binding) error {
+			if err := dst.WriteBinding(binding); err != nil {
+				return fmt.Errorf(
+					`error writing binding "%s" to destination: %s`,
+					binding.BindingID,
+					err,
+				)
+			}
+			return nil
+		},
+	)
+}
+
+// forEachRecord retrieves every instance and binding held by the source store,
+// one record at a time, and passes each to the corresponding function.
+// Instances are visited before bindings and parents before their children.
+// Orphaned bindings are not visited, but are listed in the returned report.
+func forEachRecord(
+	src storage.Store,
+	instanceFn func(service.Instance) error,
+	bindingFn func(service.Binding) error,
+) (Report, error) {
+	report := Report{}
+	enumerator, ok := src.(storage.Enumerator)
+	if !ok {
+		return report, fmt.Errorf(
+			"source store of type %T cannot enumerate its records",
+			src,
+		)
+	}
+	instanceIDs, err := enumerator.GetInstanceIDs()
+	if err != nil {
+		return report, fmt.Errorf("error listing source instances: %s", err)
+	}
+	refs, err := getOrderedInstanceRefs(src, instanceIDs)
+	if err != nil {
+		return report, err
+	}
+	for _, ref := range refs {
+		instance, ok, err := src.GetInstance(ref.instanceID)
+		if err != nil {
+			return report, fmt.Errorf(
+				`error retrieving source instance "%s": %s`,
+				ref.instanceID,
+				err,
+			)
+		}
+		if !ok {
+			// The instance was deleted since it was listed
+			continue
+		}
+		if err := instanceFn(instance); err != nil {
+			return report, err
+		}
+		report.InstancesCopied++
+		log.WithFields(log.Fields{
+			"instanceID": ref.instanceID,
+		}).Debug("copied instance")
+	}
+	bindingIDs, err := enumerator.GetBindingIDs()
+	if err != nil {
+		return report, fmt.Errorf("error listing source bindings: %s", err)
+	}
+	sort.Strings(bindingIDs)
+	for _, bindingID := range bindingIDs {
+		binding, ok, err := src.GetBinding(bindingID)
+		if err != nil {
+			return report, fmt.Errorf(
+				`error retrieving source binding "%s": %s`,
+				bindingID,
+				err,
+			)
+		}
+		if !ok {
+			continue
+		}
+		if _, ok, err = src.GetInstance(binding.InstanceID); err != nil {
+			return report, fmt.Errorf(
+				`error retrieving instance "%s" of source binding "%s": %s`,
+				binding.InstanceID,
+				bindingID,
+				err,
+			)
+		} else if !ok {
+			log.WithFields(log.Fields{
+				"bindingID":  bindingID,
+				"instanceID": binding.InstanceID,
+			}).Warn("skipping orphaned binding")
+			report.OrphanedBindingIDs = append(report.OrphanedBindingIDs, bindingID)
+			continue
+		}
+		if err := bindingFn(binding); err != nil {
+			return report, err
+		}
+		report.BindingsCopied++
+		log.WithFields(log.Fields{
+			"bindingID": bindingID,
+		}).Debug("copied binding")
+	}
+	return report, nil
+}
+
+// getOrderedInstanceRefs returns references to the given instances, ordered
+// such that every instance comes after its ancestors. Instances whose parents
+// are not held by the store are treated as having no parent.
+func getOrderedInstanceRefs(
+	src storage.Store,
+	instanceIDs []string,
+) ([]instanceRef, error) {
+	refs := make([]instanceRef, 0, len(instanceIDs))
+	aliasedRefs := map[string]instanceRef{}
+	for _, instanceID := range instanceIDs {
+		instance, ok, err := src.GetInstance(instanceID)
+		if err != nil {
+			return nil, fmt.Errorf(
+				`error retrieving source instance "%s": %s`,
+				instanceID,
+				err,
+			)
+		}
+		if !ok {
+			continue
+		}
+		ref := instanceRef{
+			instanceID:  instanceID,
+			parentAlias: instance.ParentAlias,
+		}
+		refs = append(refs, ref)
+		if instance.Alias != "" {
+			aliasedRefs[instance.Alias] = ref
+		}
+	}
+	depths := make(map[string]int, len(refs))
+	var getDepth func(ref instanceRef, visited map[string]struct{}) int
+	getDepth = func(ref instanceRef, visited map[string]struct{}) int {
+		if depth, ok := depths[ref.instanceID]; ok {
+			return depth
+		}
+		depth := 0
+		parent, ok := aliasedRefs[ref.parentAlias]
+		if _, cycle := visited[ref.instanceID]; ok && !cycle {
+			visited[ref.instanceID] = struct{}{}
+			depth = getDepth(parent, visited) + 1
+		}
+		depths[ref.instanceID] = depth
+		return depth
+	}
+	for _, ref := range refs {
+		getDepth(ref, map[string]struct{}{})
+	}
+	sort.SliceStable(refs, func(i, j int) bool {
+		if depths[refs[i].instanceID] != depths[refs[j].instanceID] {
+			return depths[refs[i].instanceID] < depths[refs[j].instanceID]
+		}
+		return refs[i].instanceID < refs[j].instanceID
+	})
+	return refs, nil
+}
@@ -0,0 +1,206 @@
+package migrate
+
+import (
+	"testing"
+
+	"github.com/barpilot/gosba/crypto"
+	"github.com/barpilot/gosba/crypto/aes256"
+	"github.com/barpilot/gosba/crypto/rewrap"
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/services/fake"
+	"github.com/barpilot/gosba/storage"
+	"github.com/barpilot/gosba/storage/memory"
+	"github.com/barpilot/gosba/storage/storetest"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// orderRecordingStore records the ids of instances in the order they are
+// written
+type orderRecordingStore struct {
+	storage.Store
+	instanceIDs []string
+}
+
+func (o *orderRecordingStore) WriteInstance(instance service.Instance) error {
+	o.instanceIDs = append(o.instanceIDs, instance.InstanceID)
+	return o.Store.WriteInstance(instance)
+}
+
+// opaqueStore hides the optional interfaces of the store it wraps
+type opaqueStore struct {
+	storage.Store
+}
+
+func getTestCatalog(t *testing.T) service.Catalog {
+	catalog, err := storetest.NewCatalog()
+	assert.Nil(t, err)
+	return catalog
+}
+
+func getTestInstance() service.Instance {
+	return service.Instance{
+		InstanceID: uuid.NewV4().String(),
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Status:     service.InstanceStateProvisioned,
+	}
+}
+
+func getTestBinding(t *testing.T, instanceID string) service.Binding {
+	svc, _ := getTestCatalog(t).GetService(fake.ServiceID)
+	plan, _ := svc.GetPlan(fake.StandardPlanID)
+	schema := plan.GetSchemas().ServiceBindings.BindingParametersSchema
+	return service.Binding{
+		BindingID:  uuid.NewV4().String(),
+		InstanceID: instanceID,
+		ServiceID:  fake.ServiceID,
+		BindingParameters: &service.BindingParameters{
+			Parameters: service.Parameters{
+				Schema: &schema,
+				Data: map[string]interface{}{
+					storetest.SecureParameter: "foo",
+				},
+			},
+		},
+		Status: service.BindingStateBound,
+	}
+}
+
+func getTestAESCodec(t *testing.T, key string) crypto.Codec {
+	codec, err := aes256.NewCodec(aes256.Config{Key: key})
+	assert.Nil(t, err)
+	return codec
+}
+
+// useCodec makes the global codec behave like the given codec until the test
+// ends
+func useCodec(t *testing.T, codec crypto.Codec) {
+	encryptBehavior := testCodec.EncryptBehavior
+	decryptBehavior := testCodec.DecryptBehavior
+	testCodec.EncryptBehavior = codec.Encrypt
+	testCodec.DecryptBehavior = codec.Decrypt
+	t.Cleanup(func() {
+		testCodec.EncryptBehavior = encryptBehavior
+		testCodec.DecryptBehavior = decryptBehavior
+	})
+}
+
+func TestCopyRequiresEnumerableSource(t *testing.T) {
+	catalog := getTestCatalog(t)
+	_, err := Copy(
+		opaqueStore{Store: memory.NewStore(catalog)},
+		memory.NewStore(catalog),
+	)
+	assert.NotNil(t, err)
+}
+
+func TestCopyCopiesAllRecords(t *testing.T) {
+	catalog := getTestCatalog(t)
+	src := memory.NewStore(catalog)
+	parent := getTestInstance()
+	parent.Alias = uuid.NewV4().String()
+	child := getTestInstance()
+	child.ParentAlias = parent.Alias
+	for _, instance := range []service.Instance{child, parent} {
+		assert.Nil(t, src.WriteInstance(instance))
+	}
+	binding := getTestBinding(t, child.InstanceID)
+	assert.Nil(t, src.WriteBinding(binding))
+	orphan := getTestBinding(t, uuid.NewV4().String())
+	assert.Nil(t, src.WriteBinding(orphan))
+
+	dst := memory.NewStore(catalog)
+	report, err := Copy(src, dst)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, report.InstancesCopied)
+	assert.Equal(t, 1, report.BindingsCopied)
+	assert.Equal(t, []string{orphan.BindingID}, report.OrphanedBindingIDs)
+
+	retrievedChild, ok, err := dst.GetInstance(child.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	if assert.NotNil(t, retrievedChild.Parent) {
+		assert.Equal(t, parent.InstanceID, retrievedChild.Parent.InstanceID)
+	}
+	count, err := dst.GetInstanceChildCountByAlias(parent.Alias)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+	retrievedBinding, ok, err := dst.GetBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(
+		t,
+		"foo",
+		retrievedBinding.BindingParameters.GetString(storetest.SecureParameter),
+	)
+	_, ok, err = dst.GetBinding(orphan.BindingID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// Repeating the copy is harmless
+	_, err = Copy(src, dst)
+	assert.Nil(t, err)
+	count, err = dst.GetInstanceChildCountByAlias(parent.Alias)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestCopyWritesParentsBeforeChildren(t *testing.T) {
+	catalog := getTestCatalog(t)
+	src := memory.NewStore(catalog)
+	instances := make([]service.Instance, 4)
+	for i := range instances {
+		instances[i] = getTestInstance()
+		instances[i].Alias = uuid.NewV4().String()
+		if i > 0 {
+			instances[i].ParentAlias = instances[i-1].Alias
+		}
+	}
+	// Write the chain of descendants to the source in reverse order
+	for i := len(instances) - 1; i >= 0; i-- {
+		assert.Nil(t, src.WriteInstance(instances[i]))
+	}
+	dst := &orderRecordingStore{Store: memory.NewStore(catalog)}
+	_, err := Copy(src, dst)
+	assert.Nil(t, err)
+	expectedOrder := make([]string, len(instances))
+	for i, instance := range instances {
+		expectedOrder[i] = instance.InstanceID
+	}
+	assert.Equal(t, expectedOrder, dst.instanceIDs)
+}
+
+func TestCopyRewrapsSecureValues(t *testing.T) {
+	srcCodec := getTestAESCodec(t, "AES256Key-32Characters1234567890")
+	dstCodec := getTestAESCodec(t, "AES256Key-32Characters0987654321")
+	catalog := getTestCatalog(t)
+	src := memory.NewStore(catalog)
+	dst := memory.NewStore(catalog)
+	instance := getTestInstance()
+	binding := getTestBinding(t, instance.InstanceID)
+	t.Run("write source", func(t *testing.T) {
+		useCodec(t, srcCodec)
+		assert.Nil(t, src.WriteInstance(instance))
+		assert.Nil(t, src.WriteBinding(binding))
+	})
+	t.Run("copy", func(t *testing.T) {
+		useCodec(t, rewrap.NewCodec(srcCodec, dstCodec))
+		_, err := Copy(src, dst)
+		assert.Nil(t, err)
+	})
+	t.Run("read destination", func(t *testing.T) {
+		useCodec(t, dstCodec)
+		retrievedBinding, ok, err := dst.GetBinding(binding.BindingID)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		assert.Equal(
+			t,
+			"foo",
+			retrievedBinding.BindingParameters.GetString(storetest.SecureParameter),
+		)
+		// The source remains readable only using its own codec
+		_, _, err = src.GetBinding(binding.BindingID)
+		assert.NotNil(t, err)
+	})
+}
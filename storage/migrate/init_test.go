@@ -0,0 +1,22 @@
+package migrate
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"github.com/barpilot/gosba/crypto"
+	"github.com/barpilot/gosba/crypto/fake"
+)
+
+// testCodec is the global codec. Tests change its behavior to emulate the
+// separate processes that take part in a migration, e.g. brokers configured
+// with different codecs and a migration process using a rewrap codec.
+var testCodec = fake.NewCodec().(*fake.Codec)
+
+func TestMain(m *testing.M) {
+	if err := crypto.InitializeGlobalCodec(testCodec); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(m.Run())
+}
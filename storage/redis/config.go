@@ -1,19 +1,72 @@
 package redis
 
+// Mode represents the topology of the Redis deployment the Redis-based
+// implementation of the Store interface connects to
+type Mode string
+
+const (
+	// ModeStandalone connects to a single Redis node at RedisHost:RedisPort
+	ModeStandalone Mode = "standalone"
+	// ModeSentinel connects to whichever node the Redis Sentinels at
+	// RedisSentinelAddresses report as the master of RedisSentinelMasterName
+	// and follows that master through failovers
+	ModeSentinel Mode = "sentinel"
+	// ModeCluster connects to the Redis Cluster that includes the nodes at
+	// RedisClusterAddresses. Since the store's transactions span multiple keys,
+	// all keys are hash tagged using RedisPrefix so they map to a single hash
+	// slot. RedisPrefix is therefore required and RedisDB must be 0 in this
+	// mode.
+	ModeCluster Mode = "cluster"
+)
+
 // Config represents configuration options for the Redis-based implementation
 // of the Store interface
 type Config struct {
-	RedisHost      string
-	RedisPort      int
-	RedisPassword  string
-	RedisDB        int
+	RedisMode Mode
+	// RedisHost and RedisPort are only used to connect in standalone mode
+	RedisHost               string
+	RedisPort               int
+	RedisSentinelAddresses  []string
+	RedisSentinelMasterName string
+	RedisClusterAddresses   []string
+	RedisPassword           string
+	RedisDB                 int
+	// RedisEnableTLS enables TLS for connections to all nodes (and sentinels).
+	// The remaining TLS options may only be set if it is true.
 	RedisEnableTLS bool
-	RedisPrefix    string
+	// RedisTLSCACertPath is the path to a PEM-encoded bundle of certificates of
+	// the CAs trusted to sign servers' certificates. If unset, the system's
+	// trusted CAs are used.
+	RedisTLSCACertPath string
+	// RedisTLSClientCertPath and RedisTLSClientKeyPath are the paths to the
+	// PEM-encoded certificate and key presented to servers that require mutual
+	// TLS. They must be set together.
+	RedisTLSClientCertPath string
+	RedisTLSClientKeyPath  string
+	// RedisTLSMinVersion is the minimum TLS version ("1.0", "1.1", "1.2", or
+	// "1.3") that is acceptable. If unset, Go's default minimum applies.
+	RedisTLSMinVersion string
+	// RedisTLSServerName is the name servers' certificates are verified
+	// against. It defaults to RedisHost in standalone mode and is required when
+	// TLS is used in sentinel or cluster mode.
+	RedisTLSServerName string
+	// RedisTLSInsecureSkipVerify disables verification of servers'
+	// certificates. This should never be enabled outside of development.
+	RedisTLSInsecureSkipVerify bool
+	RedisPrefix                string
+	// RedisMaxAuditEntries caps the number of audit entries retained. Once it
+	// is exceeded, the oldest entries are discarded. If it is zero, entries are
+	// retained indefinitely.
+	RedisMaxAuditEntries int
 }
 
 // NewConfigWithDefaults returns a Config object with default values already
 // applied. Callers are then free to set custom values for the remaining fields
 // and/or override default values.
 func NewConfigWithDefaults() Config {
-	return Config{RedisPort: 6379}
+	return Config{
+		RedisMode:            ModeStandalone,
+		RedisPort:            6379,
+		RedisMaxAuditEntries: 10000,
+	}
 }
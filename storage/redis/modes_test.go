@@ -0,0 +1,150 @@
+package redis
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/services/fake"
+	"github.com/barpilot/gosba/storage"
+	"github.com/barpilot/gosba/storage/storetest"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func getTestCatalog(t *testing.T) service.Catalog {
+	fakeModule, err := fake.New()
+	assert.Nil(t, err)
+	fakeCatalog, err := fakeModule.GetCatalog()
+	assert.Nil(t, err)
+	return fakeCatalog
+}
+
+func TestNewStoreRejectsIncompleteModeConfig(t *testing.T) {
+	testCases := map[string]func(*Config){
+		"unrecognized mode": func(config *Config) {
+			config.RedisMode = "bogus"
+		},
+		"sentinel mode without sentinels": func(config *Config) {
+			config.RedisMode = ModeSentinel
+			config.RedisSentinelMasterName = "foo"
+		},
+		"sentinel mode without master name": func(config *Config) {
+			config.RedisMode = ModeSentinel
+			config.RedisSentinelAddresses = []string{"localhost:26379"}
+		},
+		"cluster mode without nodes": func(config *Config) {
+			config.RedisMode = ModeCluster
+			config.RedisPrefix = "foo"
+		},
+		"cluster mode with non-zero db": func(config *Config) {
+			config.RedisMode = ModeCluster
+			config.RedisClusterAddresses = []string{"localhost:6379"}
+			config.RedisPrefix = "foo"
+			config.RedisDB = 1
+		},
+		"cluster mode without prefix": func(config *Config) {
+			config.RedisMode = ModeCluster
+			config.RedisClusterAddresses = []string{"localhost:6379"}
+		},
+	}
+	for name, configure := range testCases {
+		t.Run(name, func(t *testing.T) {
+			config := NewConfigWithDefaults()
+			configure(&config)
+			_, err := NewStore(getTestCatalog(t), config)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestSentinelMode(t *testing.T) {
+	master := newStandIn(t)
+	sentinel := newStandIn(t)
+	sentinel.masterAddr = master.addr()
+	config := NewConfigWithDefaults()
+	config.RedisMode = ModeSentinel
+	config.RedisSentinelAddresses = []string{sentinel.addr()}
+	config.RedisSentinelMasterName = "foo"
+	config.RedisPrefix = "bar"
+	str, err := NewStore(getTestCatalog(t), config)
+	assert.Nil(t, err)
+	testStore := str.(*store)
+	defer testStore.redisClient.Close() // nolint: errcheck
+	assert.Nil(t, testStore.TestConnection())
+	instance := getTestInstance()
+	err = testStore.WriteInstance(instance)
+	assert.Nil(t, err)
+	// The instance was written to the master the sentinel reported
+	assert.Equal(t, 1, len(master.getTransactions()))
+	assert.Empty(t, sentinel.getTransactions())
+	retrievedInstance, ok, err := testStore.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, instance.InstanceID, retrievedInstance.InstanceID)
+}
+
+func TestClusterModeKeepsTransactionsInOneSlot(t *testing.T) {
+	node := newStandIn(t)
+	config := NewConfigWithDefaults()
+	config.RedisMode = ModeCluster
+	config.RedisClusterAddresses = []string{node.addr()}
+	config.RedisPrefix = "foo"
+	str, err := NewStore(getTestCatalog(t), config)
+	assert.Nil(t, err)
+	testStore := str.(*store)
+	defer testStore.redisClient.Close() // nolint: errcheck
+	assert.Nil(t, testStore.TestConnection())
+
+	parent := getTestInstance()
+	parent.Alias = uuid.NewV4().String()
+	err = testStore.WriteInstance(parent)
+	assert.Nil(t, err)
+	child := getTestInstance()
+	child.Alias = uuid.NewV4().String()
+	child.ParentAlias = parent.Alias
+	err = testStore.WriteInstance(child)
+	assert.Nil(t, err)
+	childCount, err := testStore.GetInstanceChildCountByAlias(parent.Alias)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), childCount)
+	ok, err := testStore.DeleteInstance(child.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// Had the keys of any one write mapped to different hash slots, the cluster
+	// client would have split that write into multiple transactions
+	transactions := node.getTransactions()
+	assert.Equal(t, 3, len(transactions))
+	for _, keys := range transactions {
+		for _, key := range keys {
+			assert.True(t, strings.HasPrefix(key, "{foo}:"), key)
+		}
+	}
+	if len(transactions) == 3 {
+		// Instance, alias, parent's children, and instance list
+		assert.Equal(t, 4, len(transactions[1]))
+	}
+}
+
+func TestStoreConformance(t *testing.T) {
+	storetest.Run(
+		t,
+		func(t *testing.T, catalog service.Catalog) storage.Store {
+			config := NewConfigWithDefaults()
+			host, port, err := net.SplitHostPort(newStandIn(t).addr())
+			assert.Nil(t, err)
+			config.RedisHost = host
+			config.RedisPort, err = strconv.Atoi(port)
+			assert.Nil(t, err)
+			str, err := NewStore(catalog, config)
+			assert.Nil(t, err)
+			t.Cleanup(func() {
+				str.(*store).redisClient.Close() // nolint: errcheck
+			})
+			return str
+		},
+	)
+}
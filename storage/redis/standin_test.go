@@ -0,0 +1,419 @@
+package redis
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// standIn is a minimal, in-process stand-in for a Redis node that speaks
+// just enough of the protocol for the store and for the go-redis failover
+// and cluster clients. It can pose as a sentinel that reports another
+// stand-in as the master and as the only node of a cluster.
+type standIn struct {
+	listener net.Listener
+	// masterAddr, if set, is reported as the address of every master the
+	// stand-in is asked about as a sentinel. It must be changed using
+	// setMasterAddr once the stand-in is in use.
+	masterAddr string
+	mutex      sync.Mutex
+	strings    map[string]string
+	sets       map[string]map[string]struct{}
+	lists      map[string][]string
+	// expiries maps keys that expire to the times they expire at
+	expiries map[string]time.Time
+	// versions counts modifications of each key, so that transactions can
+	// detect modifications of the keys they watch
+	versions map[string]int
+	// transactions records the keys touched by each executed transaction
+	transactions [][]string
+	// subscribers maps channels to the connections subscribed to them
+	subscribers map[string][]*standInConn
+}
+
+// standInConn is a connection to a stand-in that can be written to by both
+// the goroutine serving it and publishers
+type standInConn struct {
+	net.Conn
+	mutex sync.Mutex
+}
+
+func (c *standInConn) write(reply string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	_, err := io.WriteString(c.Conn, reply)
+	return err
+}
+
+// standInKeyedCommands maps the names of commands the stand-in supports and
+// whose first argument is a key to whether they are read-only
+var standInKeyedCommands = map[string]bool{
+	"get":       true,
+	"set":       false,
+	"del":       false,
+	"sadd":      false,
+	"srem":      false,
+	"scard":     true,
+	"sismember": true,
+	"smembers":  true,
+	"rpush":     false,
+	"ltrim":     false,
+	"lrange":    true,
+}
+
+func newStandIn(t *testing.T) *standIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error starting redis stand-in: %s", err)
+	}
+	return startStandIn(t, listener)
+}
+
+// newTLSStandIn returns a stand-in that only accepts TLS connections
+// negotiated using the given configuration
+func newTLSStandIn(t *testing.T, tlsConfig *tls.Config) *standIn {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatalf("error starting redis stand-in: %s", err)
+	}
+	return startStandIn(t, listener)
+}
+
+func startStandIn(t *testing.T, listener net.Listener) *standIn {
+	s := &standIn{
+		listener:    listener,
+		strings:     map[string]string{},
+		sets:        map[string]map[string]struct{}{},
+		lists:       map[string][]string{},
+		expiries:    map[string]time.Time{},
+		versions:    map[string]int{},
+		subscribers: map[string][]*standInConn{},
+	}
+	go s.serve()
+	t.Cleanup(func() {
+		listener.Close() // nolint: errcheck
+	})
+	return s
+}
+
+func (s *standIn) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *standIn) setMasterAddr(addr string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.masterAddr = addr
+}
+
+func (s *standIn) hasSubscribers(channel string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.subscribers[channel]) > 0
+}
+
+// publish sends the given message to all connections subscribed to the
+// given channel
+func (s *standIn) publish(channel string, payload string) {
+	s.mutex.Lock()
+	subscribers := s.subscribers[channel]
+	s.mutex.Unlock()
+	message := "*3\r\n" + bulkString("message") + bulkString(channel) +
+		bulkString(payload)
+	for _, conn := range subscribers {
+		conn.write(message) // nolint: errcheck
+	}
+}
+
+func (s *standIn) getTransactions() [][]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.transactions
+}
+
+func (s *standIn) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *standIn) handle(netConn net.Conn) {
+	defer netConn.Close() // nolint: errcheck
+	conn := &standInConn{Conn: netConn}
+	reader := bufio.NewReader(conn)
+	var queued [][]string
+	inTransaction := false
+	// watched maps the keys watched by the connection to their versions at the
+	// time they were watched
+	watched := map[string]int{}
+	for {
+		args, err := readStandInCommand(reader)
+		if err != nil {
+			return
+		}
+		name := strings.ToLower(args[0])
+		var reply string
+		switch {
+		case name == "multi":
+			inTransaction = true
+			queued = nil
+			reply = "+OK\r\n"
+		case name == "watch":
+			s.mutex.Lock()
+			for _, key := range args[1:] {
+				watched[key] = s.versions[key]
+			}
+			s.mutex.Unlock()
+			reply = "+OK\r\n"
+		case name == "unwatch":
+			watched = map[string]int{}
+			reply = "+OK\r\n"
+		case name == "subscribe":
+			s.mutex.Lock()
+			s.subscribers[args[1]] = append(s.subscribers[args[1]], conn)
+			s.mutex.Unlock()
+			reply = "*3\r\n" + bulkString("subscribe") + bulkString(args[1]) +
+				":1\r\n"
+		case name == "exec":
+			reply = s.exec(queued, watched)
+			inTransaction = false
+			watched = map[string]int{}
+		case inTransaction:
+			queued = append(queued, args)
+			reply = "+QUEUED\r\n"
+		default:
+			reply = s.execute(args)
+		}
+		if err := conn.write(reply); err != nil {
+			return
+		}
+	}
+}
+
+// exec atomically executes the given queued commands, unless any of the
+// watched keys have been modified since they were watched
+func (s *standIn) exec(queued [][]string, watched map[string]int) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key, version := range watched {
+		if s.versions[key] != version {
+			return "*-1\r\n"
+		}
+	}
+	var keys []string
+	replies := make([]string, len(queued))
+	for i, queuedArgs := range queued {
+		keys = append(keys, queuedArgs[1])
+		replies[i] = s.executeLocked(queuedArgs)
+	}
+	s.transactions = append(s.transactions, keys)
+	return fmt.Sprintf("*%d\r\n%s", len(replies), strings.Join(replies, ""))
+}
+
+func (s *standIn) execute(args []string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.executeLocked(args)
+}
+
+// executeLocked executes a single command. The caller must hold the mutex.
+func (s *standIn) executeLocked(args []string) string {
+	name := strings.ToLower(args[0])
+	if _, ok := standInKeyedCommands[name]; ok {
+		if expires, ok := s.expiries[args[1]]; ok && time.Now().After(expires) {
+			delete(s.strings, args[1])
+			delete(s.expiries, args[1])
+		}
+	}
+	if readOnly, ok := standInKeyedCommands[name]; ok && !readOnly {
+		s.versions[args[1]]++
+	}
+	switch name {
+	case "ping":
+		return "+PONG\r\n"
+	case "auth", "select":
+		return "+OK\r\n"
+	case "command":
+		var infos []string
+		for command, readOnly := range standInKeyedCommands {
+			flag := "write"
+			if readOnly {
+				flag = "readonly"
+			}
+			infos = append(
+				infos,
+				"*6\r\n"+bulkString(command)+":-2\r\n*1\r\n"+bulkString(flag)+
+					":1\r\n:1\r\n:1\r\n",
+			)
+		}
+		return fmt.Sprintf("*%d\r\n%s", len(infos), strings.Join(infos, ""))
+	case "cluster":
+		host, port, _ := net.SplitHostPort(s.addr())
+		return "*1\r\n*3\r\n:0\r\n:16383\r\n*2\r\n" + bulkString(host) +
+			bulkString(port)
+	case "sentinel":
+		if strings.ToLower(args[1]) == "get-master-addr-by-name" {
+			host, port, _ := net.SplitHostPort(s.masterAddr)
+			return "*2\r\n" + bulkString(host) + bulkString(port)
+		}
+		return "*0\r\n"
+	case "get":
+		value, ok := s.strings[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulkString(value)
+	case "set":
+		s.strings[args[1]] = args[2]
+		delete(s.expiries, args[1])
+		// The only options the store uses set the key's time to live
+		if len(args) == 5 {
+			ttl, _ := strconv.Atoi(args[4])
+			unit := time.Second
+			if strings.ToLower(args[3]) == "px" {
+				unit = time.Millisecond
+			}
+			s.expiries[args[1]] = time.Now().Add(time.Duration(ttl) * unit)
+		}
+		return "+OK\r\n"
+	case "del":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := s.strings[key]; ok {
+				delete(s.strings, key)
+				deleted++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	case "sadd":
+		set, ok := s.sets[args[1]]
+		if !ok {
+			set = map[string]struct{}{}
+			s.sets[args[1]] = set
+		}
+		added := 0
+		for _, member := range args[2:] {
+			if _, ok := set[member]; !ok {
+				set[member] = struct{}{}
+				added++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", added)
+	case "srem":
+		removed := 0
+		for _, member := range args[2:] {
+			if _, ok := s.sets[args[1]][member]; ok {
+				delete(s.sets[args[1]], member)
+				removed++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", removed)
+	case "scard":
+		return fmt.Sprintf(":%d\r\n", len(s.sets[args[1]]))
+	case "sismember":
+		if _, ok := s.sets[args[1]][args[2]]; ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "smembers":
+		members := []string{}
+		for member := range s.sets[args[1]] {
+			members = append(members, bulkString(member))
+		}
+		return fmt.Sprintf("*%d\r\n%s", len(members), strings.Join(members, ""))
+	case "rpush":
+		s.lists[args[1]] = append(s.lists[args[1]], args[2:]...)
+		return fmt.Sprintf(":%d\r\n", len(s.lists[args[1]]))
+	case "ltrim":
+		list := s.lists[args[1]]
+		start, _ := strconv.Atoi(args[2])
+		stop, _ := strconv.Atoi(args[3])
+		// Negative indexes count from the end of the list
+		if start < 0 {
+			start += len(list)
+		}
+		if stop < 0 {
+			stop += len(list)
+		}
+		if start < 0 {
+			start = 0
+		}
+		if stop >= len(list) {
+			stop = len(list) - 1
+		}
+		if start > stop {
+			s.lists[args[1]] = nil
+		} else {
+			s.lists[args[1]] = list[start : stop+1]
+		}
+		return "+OK\r\n"
+	case "lrange":
+		// The store only ever retrieves whole lists
+		list := s.lists[args[1]]
+		values := make([]string, len(list))
+		for i, value := range list {
+			values[i] = bulkString(value)
+		}
+		return fmt.Sprintf("*%d\r\n%s", len(values), strings.Join(values, ""))
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+func bulkString(value string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+}
+
+// readStandInCommand reads a single command, which clients always send as an
+// array of bulk strings
+func readStandInCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := readStandInLine(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return nil, fmt.Errorf("unexpected line %q", line)
+	}
+	count, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, count)
+	for i := range args {
+		if line, err = readStandInLine(reader); err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("unexpected line %q", line)
+		}
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:length])
+	}
+	return args, nil
+}
+
+func readStandInLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
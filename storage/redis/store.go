@@ -1,21 +1,38 @@
 package redis
 
 import (
-	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
+	"strings"
+	"time"
 
+	"github.com/barpilot/gosba/audit"
+	"github.com/barpilot/gosba/crypto"
 	"github.com/barpilot/gosba/service"
 	"github.com/barpilot/gosba/storage"
 	"github.com/go-redis/redis"
 )
 
+// maxTxAttempts is the number of times a transaction is attempted before
+// giving up on it because watched keys keep being modified concurrently
+const maxTxAttempts = 50
+
 type store struct {
-	redisClient *redis.Client
+	redisClient redis.UniversalClient
 	catalog     service.Catalog
+	// codec encrypts and decrypts secure values, or is nil if the globally
+	// configured codec does
+	codec crypto.Codec
 
 	prefix       string
 	instanceList string
 	bindingList  string
+	auditList    string
+	// maxAuditEntries is the number of audit entries retained, or zero if
+	// entries are retained indefinitely
+	maxAuditEntries int
 }
 
 // NewStore returns a new Redis-based implementation of the Store interface
@@ -23,44 +40,155 @@ func NewStore(
 	catalog service.Catalog,
 	config Config,
 ) (storage.Store, error) {
-	redisOpts := &redis.Options{
-		Addr:       fmt.Sprintf("%s:%d", config.RedisHost, config.RedisPort),
-		Password:   config.RedisPassword,
-		DB:         config.RedisDB,
-		MaxRetries: 5,
-	}
-	if config.RedisEnableTLS {
-		redisOpts.TLSConfig = &tls.Config{
-			ServerName: config.RedisHost,
+	tlsConfig, err := getTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if config.RedisMaxAuditEntries < 0 {
+		return nil, errors.New("max audit entries must not be negative")
+	}
+	prefix := config.RedisPrefix
+	var redisClient redis.UniversalClient
+	switch config.RedisMode {
+	case "", ModeStandalone:
+		redisClient = redis.NewClient(&redis.Options{
+			Addr:       fmt.Sprintf("%s:%d", config.RedisHost, config.RedisPort),
+			Password:   config.RedisPassword,
+			DB:         config.RedisDB,
+			MaxRetries: 5,
+			TLSConfig:  tlsConfig,
+		})
+	case ModeSentinel:
+		if len(config.RedisSentinelAddresses) == 0 {
+			return nil, errors.New(
+				"at least one sentinel address is required in sentinel mode",
+			)
+		}
+		if config.RedisSentinelMasterName == "" {
+			return nil, errors.New("master name is required in sentinel mode")
+		}
+		if tlsConfig != nil {
+			redisClient = newTLSFailoverClient(config, tlsConfig)
+			break
+		}
+		redisClient = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    config.RedisSentinelMasterName,
+			SentinelAddrs: config.RedisSentinelAddresses,
+			Password:      config.RedisPassword,
+			DB:            config.RedisDB,
+			MaxRetries:    5,
+		})
+	case ModeCluster:
+		if len(config.RedisClusterAddresses) == 0 {
+			return nil, errors.New(
+				"at least one cluster node address is required in cluster mode",
+			)
+		}
+		if config.RedisDB != 0 {
+			return nil, errors.New("only database 0 can be used in cluster mode")
 		}
+		if config.RedisPrefix == "" {
+			return nil, errors.New("a prefix is required in cluster mode")
+		}
+		redisClient = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:      config.RedisClusterAddresses,
+			Password:   config.RedisPassword,
+			MaxRetries: 5,
+			TLSConfig:  tlsConfig,
+		})
+		// Wrapping the prefix in braces makes it the hash tag of every key, so
+		// all keys map to the same hash slot and transactions can span them
+		prefix = fmt.Sprintf("{%s}", config.RedisPrefix)
+	default:
+		return nil, fmt.Errorf(`unrecognized redis mode "%s"`, config.RedisMode)
 	}
 	return &store{
-		redisClient:  redis.NewClient(redisOpts),
-		catalog:      catalog,
-		prefix:       config.RedisPrefix,
-		instanceList: wrapKey(config.RedisPrefix, "instances"),
-		bindingList:  wrapKey(config.RedisPrefix, "bindings"),
+		redisClient:     redisClient,
+		catalog:         catalog,
+		prefix:          prefix,
+		instanceList:    wrapKey(prefix, "instances"),
+		bindingList:     wrapKey(prefix, "bindings"),
+		auditList:       wrapKey(prefix, "audit"),
+		maxAuditEntries: config.RedisMaxAuditEntries,
 	}, nil
 }
 
 func (s *store) WriteInstance(instance service.Instance) error {
+	if err := storage.ValidateParentAlias(instance); err != nil {
+		return err
+	}
 	key := s.getInstanceKey(instance.InstanceID)
-	json, err := instance.ToJSON()
+	json, err := instance.ToJSONWithCodec(s.codec)
 	if err != nil {
 		return err
 	}
-	pipeline := s.redisClient.TxPipeline()
-	pipeline.Set(key, json, 0)
+	watchedKeys := []string{key}
+	aliasKey := s.getInstanceAliasKey(instance.Alias)
 	if instance.Alias != "" {
-		aliasKey := s.getInstanceAliasKey(instance.Alias)
-		pipeline.Set(aliasKey, instance.InstanceID, 0)
+		watchedKeys = append(watchedKeys, aliasKey)
 	}
-	if instance.ParentAlias != "" {
-		parentAliasChildrenKey := s.getInstanceAliasChildrenKey(instance.ParentAlias)
-		pipeline.SAdd(parentAliasChildrenKey, instance.InstanceID)
+	err = s.watch(func(tx *redis.Tx) error {
+		previous, previousFound, err := getRawInstance(tx, key)
+		if err != nil {
+			return err
+		}
+		var aliasOwnerID string
+		if instance.Alias != "" {
+			if aliasOwnerID, err = getAliasOwnerID(tx, aliasKey); err != nil {
+				return err
+			}
+		}
+		ownsAlias := aliasOwnerID == "" || aliasOwnerID == instance.InstanceID
+		// Only a new claim on an alias is rejected. Data written before aliases
+		// were enforced to be unique may contain instances whose alias has since
+		// been claimed by another instance. Those must remain writable (e.g. so
+		// they can be deprovisioned), but they do not get the alias back.
+		if instance.Alias != "" && !ownsAlias &&
+			(!previousFound || previous.Alias != instance.Alias) {
+			return storage.NewAliasInUseError(instance.Alias, aliasOwnerID)
+		}
+		var previousAliasKey string
+		if previousFound && previous.Alias != "" &&
+			previous.Alias != instance.Alias {
+			previousAliasKey = s.getInstanceAliasKey(previous.Alias)
+			ownerID, err := getAliasOwnerID(tx, previousAliasKey)
+			if err != nil {
+				return err
+			}
+			if ownerID != instance.InstanceID {
+				// The old alias doesn't belong to this instance, so it isn't released
+				previousAliasKey = ""
+			}
+		}
+		_, err = tx.Pipelined(func(pipeline redis.Pipeliner) error {
+			pipeline.Set(key, json, 0)
+			if instance.Alias != "" && ownsAlias {
+				pipeline.Set(aliasKey, instance.InstanceID, 0)
+			}
+			if previousAliasKey != "" {
+				pipeline.Del(previousAliasKey)
+			}
+			if previousFound && previous.ParentAlias != "" &&
+				previous.ParentAlias != instance.ParentAlias {
+				pipeline.SRem(
+					s.getInstanceAliasChildrenKey(previous.ParentAlias),
+					instance.InstanceID,
+				)
+			}
+			if instance.ParentAlias != "" {
+				pipeline.SAdd(
+					s.getInstanceAliasChildrenKey(instance.ParentAlias),
+					instance.InstanceID,
+				)
+			}
+			pipeline.SAdd(s.instanceList, key)
+			return nil
+		})
+		return err
+	}, watchedKeys...)
+	if _, ok := err.(*storage.AliasInUseError); ok {
+		return err
 	}
-	pipeline.SAdd(s.instanceList, key)
-	_, err = pipeline.Exec()
 	if err != nil {
 		return fmt.Errorf(
 			`error writing instance "%s": %s`,
@@ -68,10 +196,75 @@ func (s *store) WriteInstance(instance service.Instance) error {
 			err,
 		)
 	}
+	return nil
+}
+
+// getAliasOwnerID returns the ID of the instance that has claimed the alias
+// with the given key, or an empty string if the alias is unclaimed
+func getAliasOwnerID(tx *redis.Tx, aliasKey string) (string, error) {
+	ownerID, err := tx.Get(aliasKey).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return ownerID, err
+}
+
+// watch executes the given function in a transaction that fails if any of the
+// given keys is modified by another client before the transaction commits.
+// Failed transactions are retried a limited number of times, after a short,
+// random delay that keeps concurrent writers from colliding repeatedly.
+func (s *store) watch(fn func(*redis.Tx) error, keys ...string) error {
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		if err = s.redisClient.Watch(fn, keys...); err != redis.TxFailedErr {
+			return err
+		}
+		jitter := rand.Int63n(int64(attempt) * int64(time.Millisecond))
+		time.Sleep(time.Duration(jitter))
+	}
 	return err
 }
 
+// getRawInstance retrieves the instance stored at the given key without
+// involving the catalog. Only fields that are not specific to the instance's
+// service, such as aliases, are available.
+func getRawInstance(
+	tx *redis.Tx,
+	key string,
+) (service.Instance, bool, error) {
+	bytes, err := tx.Get(key).Bytes()
+	if err == redis.Nil {
+		return service.Instance{}, false, nil
+	} else if err != nil {
+		return service.Instance{}, false, err
+	}
+	instance, err := service.NewInstanceFromJSON(bytes, nil, nil)
+	return instance, err == nil, err
+}
+
 func (s *store) GetInstance(instanceID string) (service.Instance, bool, error) {
+	instance, ok, err := s.GetInstanceWithoutParent(instanceID)
+	if err != nil || !ok || instance.ParentAlias == "" {
+		return instance, ok, err
+	}
+	parent, ok, err := s.GetInstanceByAlias(instance.ParentAlias)
+	if err != nil {
+		return instance, false, fmt.Errorf(
+			`error retrieving parent with alias "%s" for instance "%s": %s`,
+			instance.ParentAlias,
+			instance.InstanceID,
+			err,
+		)
+	}
+	if ok {
+		instance.Parent = &parent
+	}
+	return instance, true, nil
+}
+
+func (s *store) GetInstanceWithoutParent(
+	instanceID string,
+) (service.Instance, bool, error) {
 	key := s.getInstanceKey(instanceID)
 	strCmd := s.redisClient.Get(key)
 	if err := strCmd.Err(); err == redis.Nil {
@@ -107,76 +300,97 @@ func (s *store) GetInstance(instanceID string) (service.Instance, bool, error) {
 			)
 	}
 	pps := plan.GetSchemas().ServiceInstances.ProvisioningParametersSchema
-	instance, err = service.NewInstanceFromJSON(
+	instance, err = service.NewInstanceFromJSONWithCodec(
 		bytes,
 		svc.GetServiceManager().GetEmptyInstanceDetails(),
 		&pps,
+		s.codec,
 	)
 	instance.Service = svc
 	instance.Plan = plan
-	if instance.ParentAlias != "" {
-		parent, ok, err := s.GetInstanceByAlias(instance.ParentAlias)
-		if err != nil {
-			return instance, false, fmt.Errorf(
-				`error retrieving parent with alias "%s" for instance "%s"`,
-				instance.ParentAlias,
-				instance.InstanceID,
-			)
-		}
-		if ok {
-			instance.Parent = &parent
-		}
-	}
 	return instance, err == nil, err
 }
 
 func (s *store) GetInstanceByAlias(
 	alias string,
 ) (service.Instance, bool, error) {
+	instanceID, ok, err := s.getAliasedInstanceID(alias)
+	if err != nil || !ok {
+		return service.Instance{}, false, err
+	}
+	return s.GetInstance(instanceID)
+}
+
+func (s *store) GetInstanceByAliasWithoutParent(
+	alias string,
+) (service.Instance, bool, error) {
+	instanceID, ok, err := s.getAliasedInstanceID(alias)
+	if err != nil || !ok {
+		return service.Instance{}, false, err
+	}
+	return s.GetInstanceWithoutParent(instanceID)
+}
+
+// getAliasedInstanceID returns the id of the instance the given alias belongs
+// to
+func (s *store) getAliasedInstanceID(alias string) (string, bool, error) {
 	key := s.getInstanceAliasKey(alias)
 	strCmd := s.redisClient.Get(key)
 	if err := strCmd.Err(); err == redis.Nil {
-		return service.Instance{}, false, nil
+		return "", false, nil
 	} else if err != nil {
-		return service.Instance{}, false, err
+		return "", false, err
 	}
 	instanceID, err := strCmd.Result()
 	if err != nil {
-		return service.Instance{}, false, err
+		return "", false, err
 	}
-	return s.GetInstance(instanceID)
+	return instanceID, true, nil
 }
 
 func (s *store) DeleteInstance(instanceID string) (bool, error) {
-	instance, ok, err := s.GetInstance(instanceID)
-	if err != nil {
-		return false, err
-	}
-	if !ok {
-		return false, nil
-	}
 	key := s.getInstanceKey(instanceID)
-	pipeline := s.redisClient.TxPipeline()
-	pipeline.Del(key)
-
-	if instance.Alias != "" {
-		aliasKey := s.getInstanceAliasKey(instance.Alias)
-		pipeline.Del(aliasKey)
-	}
-	if instance.ParentAlias != "" {
-		parentAliasChildrenKey := s.getInstanceAliasChildrenKey(instance.ParentAlias)
-		pipeline.SRem(parentAliasChildrenKey, instance.InstanceID)
-	}
-	pipeline.SRem(s.instanceList, key)
-	_, err = pipeline.Exec()
+	var found bool
+	err := s.watch(func(tx *redis.Tx) error {
+		instance, ok, err := getRawInstance(tx, key)
+		if found = ok; err != nil || !ok {
+			return err
+		}
+		var aliasKey string
+		if instance.Alias != "" {
+			aliasKey = s.getInstanceAliasKey(instance.Alias)
+			if ownerID, err := tx.Get(aliasKey).Result(); err == redis.Nil ||
+				(err == nil && ownerID != instanceID) {
+				// The alias doesn't belong to this instance, so it isn't released
+				aliasKey = ""
+			} else if err != nil {
+				return err
+			}
+		}
+		_, err = tx.Pipelined(func(pipeline redis.Pipeliner) error {
+			pipeline.Del(key)
+			if aliasKey != "" {
+				pipeline.Del(aliasKey)
+			}
+			if instance.ParentAlias != "" {
+				pipeline.SRem(
+					s.getInstanceAliasChildrenKey(instance.ParentAlias),
+					instanceID,
+				)
+			}
+			pipeline.SRem(s.instanceList, key)
+			return nil
+		})
+		return err
+	}, key)
 	if err != nil {
 		return false, fmt.Errorf(
 			`error deleting instance "%s": %s`,
-			instance.InstanceID,
+			instanceID,
 			err,
 		)
 	}
-	return true, nil
+	return found, nil
 }
 
 func (s *store) GetInstanceChildCountByAlias(alias string) (int64, error) {
@@ -198,7 +412,7 @@ func (s *store) getInstanceAliasChildrenKey(alias string) string {
 
 func (s *store) WriteBinding(binding service.Binding) error {
 	key := s.getBindingKey(binding.BindingID)
-	json, err := binding.ToJSON()
+	json, err := binding.ToJSONWithCodec(s.codec)
 	if err != nil {
 		return err
 	}
@@ -240,10 +454,11 @@ func (s *store) GetBinding(bindingID string) (service.Binding, bool, error) {
 	// binding from the JSON
 	if ok {
 		bps := instance.Plan.GetSchemas().ServiceBindings.BindingParametersSchema
-		binding, err = service.NewBindingFromJSON(
+		binding, err = service.NewBindingFromJSONWithCodec(
 			bytes,
 			instance.Service.GetServiceManager().GetEmptyBindingDetails(),
 			&bps,
+			s.codec,
 		)
 	}
 	return binding, err == nil, err
@@ -276,6 +491,98 @@ func (s *store) getBindingKey(bindingID string) string {
 	return wrapKey(s.prefix, fmt.Sprintf("bindings:%s", bindingID))
 }
 
+func (s *store) AcquireLease(
+	name string,
+	holder string,
+	ttl time.Duration,
+) (bool, error) {
+	key := s.getLeaseKey(name)
+	var acquired bool
+	err := s.watch(func(tx *redis.Tx) error {
+		acquired = false
+		currentHolder, err := tx.Get(key).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if err == nil && currentHolder != holder {
+			return nil
+		}
+		// Redis removes the key, and with it the lease, once it expires
+		_, err = tx.Pipelined(func(pipeline redis.Pipeliner) error {
+			pipeline.Set(key, holder, ttl)
+			return nil
+		})
+		acquired = err == nil
+		return err
+	}, key)
+	if err != nil {
+		return false, fmt.Errorf(`error acquiring lease "%s": %s`, name, err)
+	}
+	return acquired, nil
+}
+
+func (s *store) getLeaseKey(name string) string {
+	return wrapKey(s.prefix, fmt.Sprintf("leases:%s", name))
+}
+
+func (s *store) GetInstanceIDs() ([]string, error) {
+	instanceKeys, err := s.redisClient.SMembers(s.instanceList).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving instance keys: %s", err)
+	}
+	return trimKeys(instanceKeys, s.getInstanceKey("")), nil
+}
+
+func (s *store) GetBindingIDs() ([]string, error) {
+	bindingKeys, err := s.redisClient.SMembers(s.bindingList).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving binding keys: %s", err)
+	}
+	return trimKeys(bindingKeys, s.getBindingKey("")), nil
+}
+
+func (s *store) WriteAuditEntry(entry audit.Entry) error {
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error marshaling audit entry: %s", err)
+	}
+	// The entry is appended and the oldest entries are discarded atomically, so
+	// the list never exceeds the configured size
+	_, err = s.redisClient.TxPipelined(func(pipeline redis.Pipeliner) error {
+		pipeline.RPush(s.auditList, entryJSON)
+		if s.maxAuditEntries > 0 {
+			pipeline.LTrim(s.auditList, -int64(s.maxAuditEntries), -1)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error writing audit entry: %s", err)
+	}
+	return nil
+}
+
+func (s *store) GetAuditEntries() ([]audit.Entry, error) {
+	entriesJSON, err := s.redisClient.LRange(s.auditList, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving audit entries: %s", err)
+	}
+	entries := make([]audit.Entry, len(entriesJSON))
+	for i, entryJSON := range entriesJSON {
+		if err := json.Unmarshal([]byte(entryJSON), &entries[i]); err != nil {
+			return nil, fmt.Errorf("error unmarshaling audit entry: %s", err)
+		}
+	}
+	return entries, nil
+}
+
+// WithCodec returns a store for the same Redis keys that encrypts and
+// decrypts secure values using the given codec
+func (s *store) WithCodec(codec crypto.Codec) (storage.Store, error) {
+	str := *s
+	str.codec = codec
+	return &str, nil
+}
+
 func (s *store) TestConnection() error {
 	return s.redisClient.Ping().Err()
 }
@@ -286,3 +593,12 @@ func wrapKey(prefix, key string) string {
 	}
 	return key
 }
+
+// trimKeys strips the given prefix from each of the given keys
+func trimKeys(keys []string, prefix string) []string {
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		ids[i] = strings.TrimPrefix(key, prefix)
+	}
+	return ids
+}
@@ -3,12 +3,16 @@ package redis
 import (
 	"fmt"
 	"log"
+	"net"
 	"net/url"
 	"strconv"
 	"testing"
+	"time"
 
+	"github.com/barpilot/gosba/audit"
 	"github.com/barpilot/gosba/service"
 	"github.com/barpilot/gosba/services/fake"
+	"github.com/barpilot/gosba/storage"
 	"github.com/go-redis/redis"
 	"github.com/ory/dockertest"
 	uuid "github.com/satori/go.uuid"
@@ -512,6 +516,37 @@ func (suite *StorageTestSuite) TestDeleteExistingBinding() {
 	assert.Equal(t, redis.Nil, strCmd.Err())
 }
 
+func (suite *StorageTestSuite) TestWriteAndGetAuditEntries() {
+	t := suite.T()
+	entries := []audit.Entry{
+		{
+			Timestamp:  time.Now().UTC().Round(time.Second),
+			Operation:  audit.OperationProvision,
+			InstanceID: uuid.NewV4().String(),
+			StatusCode: 202,
+			ParameterChanges: []audit.ParameterChange{
+				{
+					Name: "location",
+					New:  "eastus",
+				},
+			},
+		},
+		{
+			Timestamp:  time.Now().UTC().Round(time.Second),
+			Operation:  audit.OperationDeprovision,
+			InstanceID: uuid.NewV4().String(),
+			StatusCode: 410,
+		},
+	}
+	for _, entry := range entries {
+		err := suite.testStore.WriteAuditEntry(entry)
+		assert.Nil(t, err)
+	}
+	retrievedEntries, err := suite.testStore.GetAuditEntries()
+	assert.Nil(t, err)
+	assert.Equal(t, entries, retrievedEntries)
+}
+
 func (suite *StorageTestSuite) TestGetInstanceKey() {
 	t := suite.T()
 	const rawKey = "foo"
@@ -545,3 +580,72 @@ func getTestBinding() service.Binding {
 		StatusReason: "",
 	}
 }
+
+func TestInstanceWhoseAliasWasClaimedByAnotherRemainsWritable(t *testing.T) {
+	config := NewConfigWithDefaults()
+	host, port, err := net.SplitHostPort(newStandIn(t).addr())
+	assert.Nil(t, err)
+	config.RedisHost = host
+	config.RedisPort, err = strconv.Atoi(port)
+	assert.Nil(t, err)
+	str, err := NewStore(getTestCatalog(t), config)
+	assert.Nil(t, err)
+	testStore := str.(*store)
+	defer testStore.redisClient.Close() // nolint: errcheck
+	instance := getTestInstance()
+	instance.Alias = uuid.NewV4().String()
+	err = testStore.WriteInstance(instance)
+	assert.Nil(t, err)
+	// Before aliases were enforced to be unique, another instance could claim
+	// the same alias
+	ownerID := uuid.NewV4().String()
+	aliasKey := testStore.getInstanceAliasKey(instance.Alias)
+	err = testStore.redisClient.Set(aliasKey, ownerID, 0).Err()
+	assert.Nil(t, err)
+	instance.Status = service.InstanceStateDeprovisioning
+	err = testStore.WriteInstance(instance)
+	assert.Nil(t, err)
+	ok, err := testStore.DeleteInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	// The alias still belongs to the instance that claimed it
+	claimedBy, err := testStore.redisClient.Get(aliasKey).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, ownerID, claimedBy)
+	// New claims on the alias are still rejected
+	err = testStore.WriteInstance(service.Instance{
+		InstanceID: uuid.NewV4().String(),
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Alias:      instance.Alias,
+	})
+	assert.IsType(t, &storage.AliasInUseError{}, err)
+}
+
+func TestAuditEntriesAreTrimmed(t *testing.T) {
+	config := NewConfigWithDefaults()
+	host, port, err := net.SplitHostPort(newStandIn(t).addr())
+	assert.Nil(t, err)
+	config.RedisHost = host
+	config.RedisPort, err = strconv.Atoi(port)
+	assert.Nil(t, err)
+	config.RedisMaxAuditEntries = 2
+	str, err := NewStore(getTestCatalog(t), config)
+	assert.Nil(t, err)
+	testStore := str.(*store)
+	defer testStore.redisClient.Close() // nolint: errcheck
+	for _, instanceID := range []string{"foo", "bar", "bat"} {
+		err = testStore.WriteAuditEntry(audit.Entry{
+			Operation:  audit.OperationProvision,
+			InstanceID: instanceID,
+		})
+		assert.Nil(t, err)
+	}
+	entries, err := testStore.GetAuditEntries()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	if len(entries) == 2 {
+		assert.Equal(t, "bar", entries[0].InstanceID)
+		assert.Equal(t, "bat", entries[1].InstanceID)
+	}
+}
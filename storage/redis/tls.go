@@ -0,0 +1,263 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// getTLSConfig builds the TLS configuration used for all connections to
+// Redis, regardless of mode. It returns nil if TLS is not enabled.
+func getTLSConfig(config Config) (*tls.Config, error) {
+	if !config.RedisEnableTLS {
+		if config.RedisTLSCACertPath != "" ||
+			config.RedisTLSClientCertPath != "" ||
+			config.RedisTLSClientKeyPath != "" ||
+			config.RedisTLSMinVersion != "" ||
+			config.RedisTLSServerName != "" ||
+			config.RedisTLSInsecureSkipVerify {
+			return nil, errors.New(
+				"redis TLS options are set, but TLS is not enabled",
+			)
+		}
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         config.RedisTLSServerName,
+		InsecureSkipVerify: config.RedisTLSInsecureSkipVerify, // nolint: gosec
+	}
+	if tlsConfig.ServerName == "" {
+		if config.RedisMode == ModeSentinel || config.RedisMode == ModeCluster {
+			return nil, errors.New(
+				"a redis TLS server name is required in sentinel and cluster modes",
+			)
+		}
+		tlsConfig.ServerName = config.RedisHost
+	}
+	if config.RedisTLSCACertPath != "" {
+		caCertPEM, err := ioutil.ReadFile(config.RedisTLSCACertPath)
+		if err != nil {
+			return nil, fmt.Errorf(
+				`error reading redis CA certificate file "%s": %s`,
+				config.RedisTLSCACertPath,
+				err,
+			)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCertPEM) {
+			return nil, fmt.Errorf(
+				`redis CA certificate file "%s" contains no PEM-encoded certificates`,
+				config.RedisTLSCACertPath,
+			)
+		}
+	}
+	if (config.RedisTLSClientCertPath == "") !=
+		(config.RedisTLSClientKeyPath == "") {
+		return nil, errors.New(
+			"redis client certificate and key must be specified together",
+		)
+	}
+	if config.RedisTLSClientCertPath != "" {
+		clientCert, err := tls.LoadX509KeyPair(
+			config.RedisTLSClientCertPath,
+			config.RedisTLSClientKeyPath,
+		)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"error loading redis client certificate and key: %s",
+				err,
+			)
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+	if config.RedisTLSMinVersion != "" {
+		minVersion, ok := tlsVersions[config.RedisTLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf(
+				`unrecognized redis minimum TLS version "%s"; expected one of `+
+					`"1.0", "1.1", "1.2", or "1.3"`,
+				config.RedisTLSMinVersion,
+			)
+		}
+		tlsConfig.MinVersion = minVersion
+	}
+	return tlsConfig, nil
+}
+
+// tlsFailoverClient is a client that connects to whichever node the
+// configured sentinels report as the master, using TLS for connections to
+// sentinels and master alike. It is needed because the failover client of
+// go-redis v6 only applies its TLS configuration to connections to sentinels.
+// Like that client, it subscribes to the sentinels' notifications of
+// failovers and closes its connections to a master once it has been demoted,
+// so that commands are retried against the new master rather than being
+// rejected by a replica.
+type tlsFailoverClient struct {
+	*redis.Client
+	masterName string
+	sentinels  []*redis.SentinelClient
+	pubSubs    []*redis.PubSub
+	tlsConfig  *tls.Config
+	mutex      sync.Mutex
+	// conns tracks open connections to masters, so that they can be closed
+	// when the master they are connected to is demoted
+	conns map[*masterConn]struct{}
+}
+
+// masterConn is a connection to a master that stops being tracked by the
+// client that opened it once it is closed
+type masterConn struct {
+	net.Conn
+	client *tlsFailoverClient
+	addr   string
+}
+
+func newTLSFailoverClient(
+	config Config,
+	tlsConfig *tls.Config,
+) *tlsFailoverClient {
+	c := &tlsFailoverClient{
+		masterName: config.RedisSentinelMasterName,
+		tlsConfig:  tlsConfig,
+		conns:      map[*masterConn]struct{}{},
+	}
+	for _, sentinelAddr := range config.RedisSentinelAddresses {
+		sentinel := redis.NewSentinelClient(&redis.Options{
+			Addr:       sentinelAddr,
+			MaxRetries: 5,
+			TLSConfig:  tlsConfig,
+		})
+		// Subscribing without any channels doesn't connect to the sentinel, so
+		// an unreachable sentinel can't delay the client's creation
+		pubSub := sentinel.Subscribe()
+		c.sentinels = append(c.sentinels, sentinel)
+		c.pubSubs = append(c.pubSubs, pubSub)
+		go c.watchFailovers(pubSub)
+	}
+	c.Client = redis.NewClient(&redis.Options{
+		Dialer:     c.dial,
+		Password:   config.RedisPassword,
+		DB:         config.RedisDB,
+		MaxRetries: 5,
+	})
+	return c
+}
+
+// dial opens a connection to the master that is current at the time
+func (c *tlsFailoverClient) dial() (net.Conn, error) {
+	var err error
+	for _, sentinel := range c.sentinels {
+		var masterAddr []string
+		masterAddr, err = sentinel.GetMasterAddrByName(c.masterName).Result()
+		if err != nil {
+			continue
+		}
+		if len(masterAddr) != 2 {
+			err = fmt.Errorf("sentinel reported address %v", masterAddr)
+			continue
+		}
+		addr := net.JoinHostPort(masterAddr[0], masterAddr[1])
+		conn, err := tls.DialWithDialer(
+			&net.Dialer{
+				Timeout:   5 * time.Second,
+				KeepAlive: 5 * time.Minute,
+			},
+			"tcp",
+			addr,
+			c.tlsConfig,
+		)
+		if err != nil {
+			return nil, err
+		}
+		mConn := &masterConn{
+			Conn:   conn,
+			client: c,
+			addr:   addr,
+		}
+		c.mutex.Lock()
+		c.conns[mConn] = struct{}{}
+		c.mutex.Unlock()
+		return mConn, nil
+	}
+	return nil, fmt.Errorf(
+		`error finding master "%s" using sentinels: %s`,
+		c.masterName,
+		err,
+	)
+}
+
+// watchFailovers closes connections to demoted masters whenever the sentinel
+// behind the given subscription announces that a failover has completed. It
+// returns once the subscription is closed.
+func (c *tlsFailoverClient) watchFailovers(pubSub *redis.PubSub) {
+	// Errors are ignored because the subscription is retried while receiving
+	_ = pubSub.Subscribe("+switch-master")
+	for msg := range pubSub.Channel() {
+		// The payload is "<name> <old host> <old port> <new host> <new port>"
+		parts := strings.Split(msg.Payload, " ")
+		if len(parts) != 5 || parts[0] != c.masterName {
+			continue
+		}
+		masterAddr := net.JoinHostPort(parts[3], parts[4])
+		log.WithFields(log.Fields{
+			"master":     c.masterName,
+			"masterAddr": masterAddr,
+		}).Info("redis master changed; closing connections to former master")
+		c.closeConnsExcept(masterAddr)
+	}
+}
+
+// closeConnsExcept closes all tracked connections to masters other than the
+// one at the given address. The client's pool discards the closed connections
+// and retries commands that fail because of the closure.
+func (c *tlsFailoverClient) closeConnsExcept(masterAddr string) {
+	c.mutex.Lock()
+	var stale []*masterConn
+	for conn := range c.conns {
+		if conn.addr != masterAddr {
+			stale = append(stale, conn)
+		}
+	}
+	c.mutex.Unlock()
+	for _, conn := range stale {
+		conn.Close() // nolint: errcheck
+	}
+}
+
+func (c *tlsFailoverClient) untrack(conn *masterConn) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.conns, conn)
+}
+
+// Close closes the client, its subscriptions, and its sentinel clients
+func (c *tlsFailoverClient) Close() error {
+	for _, pubSub := range c.pubSubs {
+		pubSub.Close() // nolint: errcheck
+	}
+	for _, sentinel := range c.sentinels {
+		sentinel.Close() // nolint: errcheck
+	}
+	return c.Client.Close()
+}
+
+func (m *masterConn) Close() error {
+	m.client.untrack(m)
+	return m.Conn.Close()
+}
@@ -0,0 +1,300 @@
+package redis
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testTLSServerName = "redis.example.com"
+
+// testPKI is a throwaway CA along with a server certificate and a client
+// certificate it has signed. Everything is also written to PEM files.
+type testPKI struct {
+	caCertPool     *x509.CertPool
+	serverCert     tls.Certificate
+	caCertPath     string
+	clientCertPath string
+	clientKeyPath  string
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	dir, err := ioutil.TempDir("", "gosba")
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(dir) // nolint: errcheck
+	})
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caCertDER, err := x509.CreateCertificate(
+		rand.Reader,
+		caTemplate,
+		caTemplate,
+		&caKey.PublicKey,
+		caKey,
+	)
+	assert.Nil(t, err)
+	caCert, err := x509.ParseCertificate(caCertDER)
+	assert.Nil(t, err)
+	pki := testPKI{
+		caCertPool:     x509.NewCertPool(),
+		caCertPath:     filepath.Join(dir, "ca.crt"),
+		clientCertPath: filepath.Join(dir, "client.crt"),
+		clientKeyPath:  filepath.Join(dir, "client.key"),
+	}
+	pki.caCertPool.AddCert(caCert)
+	writeTestPEM(t, pki.caCertPath, "CERTIFICATE", caCertDER)
+	issue := func(serial int64, extKeyUsage x509.ExtKeyUsage) ([]byte, []byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.Nil(t, err)
+		certDER, err := x509.CreateCertificate(
+			rand.Reader,
+			&x509.Certificate{
+				SerialNumber: big.NewInt(serial),
+				Subject:      pkix.Name{CommonName: testTLSServerName},
+				DNSNames:     []string{testTLSServerName},
+				NotBefore:    time.Now().Add(-time.Hour),
+				NotAfter:     time.Now().Add(time.Hour),
+				KeyUsage:     x509.KeyUsageDigitalSignature,
+				ExtKeyUsage:  []x509.ExtKeyUsage{extKeyUsage},
+			},
+			caCert,
+			&key.PublicKey,
+			caKey,
+		)
+		assert.Nil(t, err)
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		assert.Nil(t, err)
+		return certDER, keyDER
+	}
+	serverCertDER, serverKeyDER := issue(2, x509.ExtKeyUsageServerAuth)
+	pki.serverCert, err = tls.X509KeyPair(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverCertDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: serverKeyDER}),
+	)
+	assert.Nil(t, err)
+	clientCertDER, clientKeyDER := issue(3, x509.ExtKeyUsageClientAuth)
+	writeTestPEM(t, pki.clientCertPath, "CERTIFICATE", clientCertDER)
+	writeTestPEM(t, pki.clientKeyPath, "EC PRIVATE KEY", clientKeyDER)
+	return pki
+}
+
+func writeTestPEM(t *testing.T, path string, blockType string, der []byte) {
+	err := ioutil.WriteFile(
+		path,
+		pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}),
+		0600,
+	)
+	assert.Nil(t, err)
+}
+
+// getServerTLSConfig returns configuration for stand-ins that require
+// clients to present a certificate signed by the test CA
+func (p testPKI) getServerTLSConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{p.serverCert},
+		ClientCAs:    p.caCertPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+}
+
+func (p testPKI) getClientConfig() Config {
+	config := NewConfigWithDefaults()
+	config.RedisEnableTLS = true
+	config.RedisTLSCACertPath = p.caCertPath
+	config.RedisTLSClientCertPath = p.clientCertPath
+	config.RedisTLSClientKeyPath = p.clientKeyPath
+	config.RedisTLSMinVersion = "1.2"
+	config.RedisTLSServerName = testTLSServerName
+	config.RedisPrefix = "foo"
+	return config
+}
+
+func TestGetTLSConfig(t *testing.T) {
+	pki := newTestPKI(t)
+	config := pki.getClientConfig()
+	config.RedisTLSServerName = ""
+	config.RedisHost = "localhost"
+	tlsConfig, err := getTLSConfig(config)
+	assert.Nil(t, err)
+	assert.Equal(t, "localhost", tlsConfig.ServerName)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.Equal(t, 1, len(tlsConfig.Certificates))
+	assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+
+	tlsConfig, err = getTLSConfig(NewConfigWithDefaults())
+	assert.Nil(t, err)
+	assert.Nil(t, tlsConfig)
+}
+
+func TestGetTLSConfigRejectsInvalidOptions(t *testing.T) {
+	pki := newTestPKI(t)
+	testCases := map[string]func(*Config){
+		"options without TLS enabled": func(config *Config) {
+			config.RedisEnableTLS = false
+		},
+		"nonexistent CA certificate file": func(config *Config) {
+			config.RedisTLSCACertPath = pki.caCertPath + ".bogus"
+		},
+		"CA certificate file without certificates": func(config *Config) {
+			config.RedisTLSCACertPath = pki.clientKeyPath
+		},
+		"client certificate without key": func(config *Config) {
+			config.RedisTLSClientKeyPath = ""
+		},
+		"mismatched client certificate and key": func(config *Config) {
+			config.RedisTLSClientKeyPath = pki.clientCertPath
+		},
+		"unrecognized minimum TLS version": func(config *Config) {
+			config.RedisTLSMinVersion = "2.0"
+		},
+		"sentinel mode without server name": func(config *Config) {
+			config.RedisMode = ModeSentinel
+			config.RedisSentinelAddresses = []string{"localhost:26379"}
+			config.RedisSentinelMasterName = "bar"
+			config.RedisTLSServerName = ""
+		},
+		"cluster mode without server name": func(config *Config) {
+			config.RedisMode = ModeCluster
+			config.RedisClusterAddresses = []string{"localhost:6379"}
+			config.RedisTLSServerName = ""
+		},
+	}
+	for name, configure := range testCases {
+		t.Run(name, func(t *testing.T) {
+			config := pki.getClientConfig()
+			configure(&config)
+			_, err := getTLSConfig(config)
+			assert.NotNil(t, err)
+			_, err = NewStore(getTestCatalog(t), config)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestTLSAppliesToAllModes(t *testing.T) {
+	pki := newTestPKI(t)
+	testCases := map[string]func(*testing.T, *Config){
+		"standalone": func(t *testing.T, config *Config) {
+			node := newTLSStandIn(t, pki.getServerTLSConfig())
+			host, port, err := net.SplitHostPort(node.addr())
+			assert.Nil(t, err)
+			config.RedisHost = host
+			config.RedisPort, err = strconv.Atoi(port)
+			assert.Nil(t, err)
+		},
+		"sentinel": func(t *testing.T, config *Config) {
+			master := newTLSStandIn(t, pki.getServerTLSConfig())
+			sentinel := newTLSStandIn(t, pki.getServerTLSConfig())
+			sentinel.masterAddr = master.addr()
+			config.RedisMode = ModeSentinel
+			config.RedisSentinelAddresses = []string{sentinel.addr()}
+			config.RedisSentinelMasterName = "bar"
+		},
+		"cluster": func(t *testing.T, config *Config) {
+			node := newTLSStandIn(t, pki.getServerTLSConfig())
+			config.RedisMode = ModeCluster
+			config.RedisClusterAddresses = []string{node.addr()}
+		},
+	}
+	for name, configure := range testCases {
+		t.Run(name, func(t *testing.T) {
+			config := pki.getClientConfig()
+			configure(t, &config)
+			str, err := NewStore(getTestCatalog(t), config)
+			assert.Nil(t, err)
+			testStore := str.(*store)
+			defer testStore.redisClient.Close() // nolint: errcheck
+			assert.Nil(t, testStore.TestConnection())
+		})
+	}
+}
+
+func TestTLSFailoverClientFollowsFailovers(t *testing.T) {
+	pki := newTestPKI(t)
+	oldMaster := newTLSStandIn(t, pki.getServerTLSConfig())
+	newMaster := newTLSStandIn(t, pki.getServerTLSConfig())
+	sentinel := newTLSStandIn(t, pki.getServerTLSConfig())
+	sentinel.setMasterAddr(oldMaster.addr())
+	config := pki.getClientConfig()
+	config.RedisMode = ModeSentinel
+	config.RedisSentinelAddresses = []string{sentinel.addr()}
+	config.RedisSentinelMasterName = "bar"
+	tlsConfig, err := getTLSConfig(config)
+	assert.Nil(t, err)
+	client := newTLSFailoverClient(config, tlsConfig)
+	defer client.Close() // nolint: errcheck
+
+	assert.Nil(t, client.Set("foo", "old", 0).Err())
+	assert.Equal(t, bulkString("old"), oldMaster.execute([]string{"get", "foo"}))
+	assert.Eventually(
+		t,
+		func() bool { return sentinel.hasSubscribers("+switch-master") },
+		5*time.Second,
+		10*time.Millisecond,
+	)
+
+	// Pooled connections to the old master must not be reused once the
+	// sentinel announces the failover
+	sentinel.setMasterAddr(newMaster.addr())
+	oldHost, oldPort, err := net.SplitHostPort(oldMaster.addr())
+	assert.Nil(t, err)
+	newHost, newPort, err := net.SplitHostPort(newMaster.addr())
+	assert.Nil(t, err)
+	sentinel.publish(
+		"+switch-master",
+		fmt.Sprintf("bar %s %s %s %s", oldHost, oldPort, newHost, newPort),
+	)
+	assert.Eventually(
+		t,
+		func() bool {
+			return client.Set("foo", "new", 0).Err() == nil &&
+				newMaster.execute([]string{"get", "foo"}) == bulkString("new")
+		},
+		5*time.Second,
+		10*time.Millisecond,
+	)
+}
+
+func TestTLSWithoutClientCertificateIsRejected(t *testing.T) {
+	pki := newTestPKI(t)
+	node := newTLSStandIn(t, pki.getServerTLSConfig())
+	host, port, err := net.SplitHostPort(node.addr())
+	assert.Nil(t, err)
+	config := pki.getClientConfig()
+	config.RedisTLSClientCertPath = ""
+	config.RedisTLSClientKeyPath = ""
+	config.RedisHost = host
+	config.RedisPort, err = strconv.Atoi(port)
+	assert.Nil(t, err)
+	str, err := NewStore(getTestCatalog(t), config)
+	assert.Nil(t, err)
+	testStore := str.(*store)
+	defer testStore.redisClient.Close() // nolint: errcheck
+	assert.NotNil(t, testStore.TestConnection())
+}
@@ -1,11 +1,26 @@
 package storage
 
-import "github.com/barpilot/gosba/service"
+import (
+	"time"
+
+	"github.com/barpilot/gosba/crypto"
+	"github.com/barpilot/gosba/service"
+)
 
 // Store is an interface to be implemented by types capable of handling
 // persistence for other broker-related types
 type Store interface {
-	// WriteInstance persists the given instance to the underlying storage
+	// WriteInstance persists the given instance to the underlying storage. An
+	// instance's alias is reserved for it until it is deleted; claiming an
+	// alias that belongs to a different instance, whether by writing a new
+	// instance or by changing an existing instance's alias, fails atomically
+	// with an *AliasInUseError. Instances persisted before aliases were unique
+	// whose alias has since been claimed by another instance can still be
+	// rewritten with that alias, but do not regain it. Writing an instance
+	// whose parent alias is its own alias fails with an
+	// *InvalidParentAliasError. Rewriting an instance with a different alias
+	// or parent alias releases the old alias or moves the instance to its new
+	// parent's children.
 	WriteInstance(instance service.Instance) error
 	// GetInstance retrieves a persisted instance from the underlying storage by
 	// instance id
@@ -16,7 +31,7 @@ type Store interface {
 	// GetInstanceChildCountByAlias returns the number of child instances
 	GetInstanceChildCountByAlias(alias string) (int64, error)
 	// DeleteInstance deletes a persisted instance from the underlying storage by
-	// instance id
+	// instance id, releasing its alias
 	DeleteInstance(instanceID string) (bool, error)
 	// WriteBinding persists the given binding to the underlying storage
 	WriteBinding(binding service.Binding) error
@@ -30,3 +45,57 @@ type Store interface {
 	// is one)
 	TestConnection() error
 }
+
+// Enumerator is an interface to be implemented by stores that can enumerate
+// everything they hold. It is optional, so that stores for which enumeration
+// is impractical can still implement Store.
+type Enumerator interface {
+	// GetInstanceIDs returns the ids of all persisted instances, in no
+	// particular order
+	GetInstanceIDs() ([]string, error)
+	// GetBindingIDs returns the ids of all persisted bindings, in no particular
+	// order
+	GetBindingIDs() ([]string, error)
+}
+
+// ParentlessReader is an interface to be implemented by stores that can
+// retrieve an instance without also retrieving its ancestors. It is optional;
+// decorators such as the caching store use it, where available, to resolve
+// ancestors themselves.
+type ParentlessReader interface {
+	// GetInstanceWithoutParent is equivalent to GetInstance, except that the
+	// retrieved instance's Parent is always nil
+	GetInstanceWithoutParent(instanceID string) (service.Instance, bool, error)
+	// GetInstanceByAliasWithoutParent is equivalent to GetInstanceByAlias,
+	// except that the retrieved instance's Parent is always nil
+	GetInstanceByAliasWithoutParent(
+		alias string,
+	) (service.Instance, bool, error)
+}
+
+// Cache is an interface to be implemented by stores that may serve reads
+// from a cache, i.e. reads that may be stale
+type Cache interface {
+	// Uncached returns the store that the cache reads through to, whose reads
+	// are never stale
+	Uncached() Store
+}
+
+// Leaser is an interface to be implemented by stores that can grant
+// exclusive, expiring leases, which replicas of a broker sharing the store use
+// to elect one of them to perform periodic work. It is optional.
+type Leaser interface {
+	// AcquireLease acquires or renews the named lease on behalf of the given
+	// holder for the given duration. It returns false, without error, if the
+	// lease is held by a different holder and has not yet expired.
+	AcquireLease(name string, holder string, ttl time.Duration) (bool, error)
+}
+
+// CodecStore is an interface to be implemented by stores that can encrypt and
+// decrypt secure values using a codec other than the globally configured one.
+// It is optional.
+type CodecStore interface {
+	// WithCodec returns a store for the same records that encrypts and
+	// decrypts secure values using the given codec
+	WithCodec(codec crypto.Codec) (Store, error)
+}
@@ -0,0 +1,53 @@
+package storetest
+
+import (
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/services/fake"
+)
+
+// SecureParameter is the name of a provisioning and binding parameter that
+// the plan in the catalog returned by NewCatalog marks as secure
+const SecureParameter = "password"
+
+// NewCatalog returns the catalog that Run passes to store factories. It offers
+// the fake service with a single plan whose schemas include a secure
+// parameter, so that suites can verify stores hand the correct schemas to
+// instances and bindings when they are unmarshaled.
+func NewCatalog() (service.Catalog, error) {
+	fakeModule, err := fake.New()
+	if err != nil {
+		return nil, err
+	}
+	parametersSchema := service.InputParametersSchema{
+		SecureProperties: []string{SecureParameter},
+		PropertySchemas: map[string]service.PropertySchema{
+			"someParameter": &service.StringPropertySchema{},
+			SecureParameter: &service.StringPropertySchema{},
+		},
+	}
+	return service.NewCatalog([]service.Service{
+		service.NewService(
+			service.ServiceProperties{
+				ID:          fake.ServiceID,
+				Name:        "fake",
+				Description: "Fake Service",
+				Bindable:    true,
+			},
+			fakeModule.ServiceManager,
+			service.NewPlan(service.PlanProperties{
+				ID:          fake.StandardPlanID,
+				Name:        "standard",
+				Description: "The ONLY sort of fake service-- one that's fake!",
+				Schemas: service.PlanSchemas{
+					ServiceInstances: service.InstanceSchemas{
+						ProvisioningParametersSchema: parametersSchema,
+						UpdatingParametersSchema:     parametersSchema,
+					},
+					ServiceBindings: service.BindingSchemas{
+						BindingParametersSchema: parametersSchema,
+					},
+				},
+			}),
+		),
+	}), nil
+}
@@ -0,0 +1,722 @@
+// Package storetest provides a conformance test suite for implementations of
+// storage.Store. Backends maintained in or outside of this repository can run
+// it from their own tests to verify they honor the same behavioral contract
+// as the stores that ship with the broker:
+//
+//	func TestStoreConformance(t *testing.T) {
+//		storetest.Run(
+//			t,
+//			func(t *testing.T, catalog service.Catalog) storage.Store {
+//				return mystore.NewStore(catalog)
+//			},
+//		)
+//	}
+//
+// Secure parameters are encrypted using the global codec, so callers must
+// initialize it using crypto.InitializeGlobalCodec before invoking Run,
+// typically from TestMain. Stores that implement storage.CodecStore are also
+// tested using a codec of their own.
+package storetest
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	fakeCrypto "github.com/barpilot/gosba/crypto/fake"
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/services/fake"
+	"github.com/barpilot/gosba/storage"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// StoreFactory returns a new, empty store that resolves services and plans
+// using the given catalog. Factories should register any cleanup the store
+// requires using t.Cleanup.
+type StoreFactory func(t *testing.T, catalog service.Catalog) storage.Store
+
+// concurrency is the number of goroutines used by concurrency tests
+const concurrency = 20
+
+var tests = map[string]func(*testing.T, storage.Store){
+	"instance round trip":                 testInstanceRoundTrip,
+	"alias resolution":                    testAliasResolution,
+	"parent hydration":                    testParentHydration,
+	"missing parent is not hydrated":      testMissingParentIsNotHydrated,
+	"instance parameters are decrypted":   testInstanceParametersAreDecrypted,
+	"child count is stable on rewrites":   testChildCountIsStableOnRewrites,
+	"child count decrements on deletion":  testChildCountDecrementsOnDeletion,
+	"instance deletion is idempotent":     testInstanceDeletionIsIdempotent,
+	"binding round trip":                  testBindingRoundTrip,
+	"binding parameters are decrypted":    testBindingParametersAreDecrypted,
+	"orphaned binding is retrievable":     testOrphanedBindingIsRetrievable,
+	"binding deletion is idempotent":      testBindingDeletionIsIdempotent,
+	"concurrent writes":                   testConcurrentWrites,
+	"concurrent rewrites of one instance": testConcurrentRewritesOfOneInstance,
+	"enumeration":                         testEnumeration,
+	"parentless reads":                    testParentlessReads,
+	"aliases are unique":                  testAliasesAreUnique,
+	"aliases are released on deletion":    testAliasesAreReleasedOnDeletion,
+	"aliases are released on rewrites":    testAliasesAreReleasedOnRewrites,
+	"children move with parent alias":     testChildrenMoveWithParentAlias,
+	"instance cannot be its own parent":   testInstanceCannotBeItsOwnParent,
+	"concurrent alias claims":             testConcurrentAliasClaims,
+	"leases are exclusive":                testLeasesAreExclusive,
+	"expired leases can be acquired":      testExpiredLeasesCanBeAcquired,
+	"secure values use the store's codec": testSecureValuesUseStoreCodec,
+}
+
+// Run runs the conformance suite against stores returned by the given
+// factory. Each test runs as a subtest of t against a fresh store. Tests of
+// optional interfaces, such as storage.Enumerator, are skipped for stores that
+// do not implement them.
+func Run(t *testing.T, newStore StoreFactory) {
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			catalog, err := NewCatalog()
+			if err != nil {
+				t.Fatalf("error building catalog: %s", err)
+			}
+			test(t, newStore(t, catalog))
+		})
+	}
+}
+
+func getTestInstance() service.Instance {
+	return service.Instance{
+		InstanceID: uuid.NewV4().String(),
+		ServiceID:  fake.ServiceID,
+		PlanID:     fake.StandardPlanID,
+		Status:     service.InstanceStateProvisioned,
+	}
+}
+
+func getTestBinding(instanceID string) service.Binding {
+	return service.Binding{
+		BindingID:  uuid.NewV4().String(),
+		InstanceID: instanceID,
+		ServiceID:  fake.ServiceID,
+		Status:     service.BindingStateBound,
+	}
+}
+
+// getTestParametersSchema returns the parameters schema of the only plan in
+// the catalog returned by NewCatalog
+func getTestParametersSchema(t *testing.T) *service.InputParametersSchema {
+	catalog, err := NewCatalog()
+	assert.Nil(t, err)
+	svc, _ := catalog.GetService(fake.ServiceID)
+	plan, _ := svc.GetPlan(fake.StandardPlanID)
+	schema := plan.GetSchemas().ServiceBindings.BindingParametersSchema
+	return &schema
+}
+
+func testInstanceRoundTrip(t *testing.T, store storage.Store) {
+	instance := getTestInstance()
+	_, ok, err := store.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, store.WriteInstance(instance))
+	retrievedInstance, ok, err := store.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, instance.InstanceID, retrievedInstance.InstanceID)
+	assert.Equal(t, instance.Status, retrievedInstance.Status)
+	assert.NotNil(t, retrievedInstance.Service)
+	assert.NotNil(t, retrievedInstance.Plan)
+	assert.Nil(t, retrievedInstance.Parent)
+	ok, err = store.DeleteInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	_, ok, err = store.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func testAliasResolution(t *testing.T, store storage.Store) {
+	instance := getTestInstance()
+	instance.Alias = uuid.NewV4().String()
+	_, ok, err := store.GetInstanceByAlias(instance.Alias)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, store.WriteInstance(instance))
+	retrievedInstance, ok, err := store.GetInstanceByAlias(instance.Alias)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, instance.InstanceID, retrievedInstance.InstanceID)
+	assert.NotNil(t, retrievedInstance.Service)
+	assert.NotNil(t, retrievedInstance.Plan)
+	_, err = store.DeleteInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	_, ok, err = store.GetInstanceByAlias(instance.Alias)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func testParentHydration(t *testing.T, store storage.Store) {
+	grandparent := getTestInstance()
+	grandparent.Alias = uuid.NewV4().String()
+	parent := getTestInstance()
+	parent.Alias = uuid.NewV4().String()
+	parent.ParentAlias = grandparent.Alias
+	child := getTestInstance()
+	child.ParentAlias = parent.Alias
+	for _, instance := range []service.Instance{grandparent, parent, child} {
+		assert.Nil(t, store.WriteInstance(instance))
+	}
+	retrievedChild, ok, err := store.GetInstance(child.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	// The entire chain of ancestors is hydrated
+	if assert.NotNil(t, retrievedChild.Parent) {
+		assert.Equal(t, parent.InstanceID, retrievedChild.Parent.InstanceID)
+		assert.NotNil(t, retrievedChild.Parent.Plan)
+		if assert.NotNil(t, retrievedChild.Parent.Parent) {
+			assert.Equal(
+				t,
+				grandparent.InstanceID,
+				retrievedChild.Parent.Parent.InstanceID,
+			)
+		}
+	}
+}
+
+func testMissingParentIsNotHydrated(t *testing.T, store storage.Store) {
+	child := getTestInstance()
+	child.ParentAlias = uuid.NewV4().String()
+	assert.Nil(t, store.WriteInstance(child))
+	retrievedChild, ok, err := store.GetInstance(child.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Nil(t, retrievedChild.Parent)
+	assert.Equal(t, child.ParentAlias, retrievedChild.ParentAlias)
+}
+
+func testInstanceParametersAreDecrypted(t *testing.T, store storage.Store) {
+	instance := getTestInstance()
+	instance.ProvisioningParameters = &service.ProvisioningParameters{
+		Parameters: service.Parameters{
+			Schema: getTestParametersSchema(t),
+			Data: map[string]interface{}{
+				"someParameter": "foo",
+				SecureParameter: "bar",
+			},
+		},
+	}
+	assert.Nil(t, store.WriteInstance(instance))
+	retrievedInstance, ok, err := store.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	if assert.NotNil(t, retrievedInstance.ProvisioningParameters) {
+		pp := retrievedInstance.ProvisioningParameters
+		assert.Equal(t, "foo", pp.GetString("someParameter"))
+		assert.Equal(t, "bar", pp.GetString(SecureParameter))
+	}
+}
+
+func testChildCountIsStableOnRewrites(t *testing.T, store storage.Store) {
+	parentAlias := uuid.NewV4().String()
+	child := getTestInstance()
+	child.ParentAlias = parentAlias
+	// Instances are rewritten every time their status changes; each rewrite
+	// must not count the child again
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, store.WriteInstance(child))
+	}
+	count, err := store.GetInstanceChildCountByAlias(parentAlias)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func testChildCountDecrementsOnDeletion(t *testing.T, store storage.Store) {
+	parentAlias := uuid.NewV4().String()
+	children := make([]service.Instance, 3)
+	for i := range children {
+		children[i] = getTestInstance()
+		children[i].ParentAlias = parentAlias
+		assert.Nil(t, store.WriteInstance(children[i]))
+		// Rewrites interleaved with other writes must not be counted either
+		assert.Nil(t, store.WriteInstance(children[i]))
+	}
+	for i, child := range children {
+		ok, err := store.DeleteInstance(child.InstanceID)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		count, err := store.GetInstanceChildCountByAlias(parentAlias)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(len(children)-i-1), count)
+	}
+}
+
+func testInstanceDeletionIsIdempotent(t *testing.T, store storage.Store) {
+	ok, err := store.DeleteInstance(uuid.NewV4().String())
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	parentAlias := uuid.NewV4().String()
+	children := make([]service.Instance, 2)
+	for i := range children {
+		children[i] = getTestInstance()
+		children[i].ParentAlias = parentAlias
+		assert.Nil(t, store.WriteInstance(children[i]))
+	}
+	ok, err = store.DeleteInstance(children[0].InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	// Deleting the same instance again reports that it wasn't found and
+	// doesn't uncount the remaining child
+	ok, err = store.DeleteInstance(children[0].InstanceID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	count, err := store.GetInstanceChildCountByAlias(parentAlias)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func testBindingRoundTrip(t *testing.T, store storage.Store) {
+	instance := getTestInstance()
+	assert.Nil(t, store.WriteInstance(instance))
+	binding := getTestBinding(instance.InstanceID)
+	_, ok, err := store.GetBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, store.WriteBinding(binding))
+	retrievedBinding, ok, err := store.GetBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, binding.BindingID, retrievedBinding.BindingID)
+	assert.Equal(t, binding.InstanceID, retrievedBinding.InstanceID)
+	assert.Equal(t, binding.Status, retrievedBinding.Status)
+	ok, err = store.DeleteBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	_, ok, err = store.GetBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func testBindingParametersAreDecrypted(t *testing.T, store storage.Store) {
+	instance := getTestInstance()
+	assert.Nil(t, store.WriteInstance(instance))
+	binding := getTestBinding(instance.InstanceID)
+	binding.BindingParameters = &service.BindingParameters{
+		Parameters: service.Parameters{
+			Schema: getTestParametersSchema(t),
+			Data: map[string]interface{}{
+				"someParameter": "foo",
+				SecureParameter: "bar",
+			},
+		},
+	}
+	assert.Nil(t, store.WriteBinding(binding))
+	// The binding can only be decrypted using the binding parameters schema of
+	// the plan of the instance it belongs to
+	retrievedBinding, ok, err := store.GetBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	if assert.NotNil(t, retrievedBinding.BindingParameters) {
+		bp := retrievedBinding.BindingParameters
+		assert.Equal(t, "foo", bp.GetString("someParameter"))
+		assert.Equal(t, "bar", bp.GetString(SecureParameter))
+	}
+}
+
+func testOrphanedBindingIsRetrievable(t *testing.T, store storage.Store) {
+	// Nothing prevents deprovisioning an instance that still has bindings, so
+	// bindings must remain retrievable, and thus deletable, without it
+	binding := getTestBinding(uuid.NewV4().String())
+	assert.Nil(t, store.WriteBinding(binding))
+	retrievedBinding, ok, err := store.GetBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, binding.BindingID, retrievedBinding.BindingID)
+	ok, err = store.DeleteBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func testBindingDeletionIsIdempotent(t *testing.T, store storage.Store) {
+	instance := getTestInstance()
+	assert.Nil(t, store.WriteInstance(instance))
+	binding := getTestBinding(instance.InstanceID)
+	assert.Nil(t, store.WriteBinding(binding))
+	ok, err := store.DeleteBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = store.DeleteBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func testConcurrentWrites(t *testing.T, store storage.Store) {
+	parentAlias := uuid.NewV4().String()
+	children := make([]service.Instance, concurrency)
+	for i := range children {
+		children[i] = getTestInstance()
+		children[i].ParentAlias = parentAlias
+	}
+	var wg sync.WaitGroup
+	for _, child := range children {
+		wg.Add(1)
+		go func(child service.Instance) {
+			defer wg.Done()
+			assert.Nil(t, store.WriteInstance(child))
+			binding := getTestBinding(child.InstanceID)
+			assert.Nil(t, store.WriteBinding(binding))
+			_, ok, err := store.GetBinding(binding.BindingID)
+			assert.Nil(t, err)
+			assert.True(t, ok)
+			_, err = store.GetInstanceChildCountByAlias(parentAlias)
+			assert.Nil(t, err)
+		}(child)
+	}
+	wg.Wait()
+	count, err := store.GetInstanceChildCountByAlias(parentAlias)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(concurrency), count)
+	for _, child := range children {
+		wg.Add(1)
+		go func(child service.Instance) {
+			defer wg.Done()
+			ok, err := store.DeleteInstance(child.InstanceID)
+			assert.Nil(t, err)
+			assert.True(t, ok)
+		}(child)
+	}
+	wg.Wait()
+	count, err = store.GetInstanceChildCountByAlias(parentAlias)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+}
+
+func testConcurrentRewritesOfOneInstance(
+	t *testing.T,
+	store storage.Store,
+) {
+	parent := getTestInstance()
+	parent.Alias = uuid.NewV4().String()
+	assert.Nil(t, store.WriteInstance(parent))
+	child := getTestInstance()
+	child.ParentAlias = parent.Alias
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, store.WriteInstance(child))
+			retrievedChild, ok, err := store.GetInstance(child.InstanceID)
+			assert.Nil(t, err)
+			assert.True(t, ok)
+			assert.NotNil(t, retrievedChild.Parent)
+		}()
+	}
+	wg.Wait()
+	count, err := store.GetInstanceChildCountByAlias(parent.Alias)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func testEnumeration(t *testing.T, store storage.Store) {
+	enumerator, ok := store.(storage.Enumerator)
+	if !ok {
+		t.Skip("store does not implement storage.Enumerator")
+	}
+	instanceIDs, err := enumerator.GetInstanceIDs()
+	assert.Nil(t, err)
+	assert.Empty(t, instanceIDs)
+	bindingIDs, err := enumerator.GetBindingIDs()
+	assert.Nil(t, err)
+	assert.Empty(t, bindingIDs)
+	instances := make([]service.Instance, 3)
+	expectedInstanceIDs := make([]string, len(instances))
+	expectedBindingIDs := make([]string, len(instances))
+	for i := range instances {
+		instances[i] = getTestInstance()
+		assert.Nil(t, store.WriteInstance(instances[i]))
+		binding := getTestBinding(instances[i].InstanceID)
+		assert.Nil(t, store.WriteBinding(binding))
+		expectedInstanceIDs[i] = instances[i].InstanceID
+		expectedBindingIDs[i] = binding.BindingID
+	}
+	instanceIDs, err = enumerator.GetInstanceIDs()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, expectedInstanceIDs, instanceIDs)
+	bindingIDs, err = enumerator.GetBindingIDs()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, expectedBindingIDs, bindingIDs)
+	_, err = store.DeleteInstance(instances[0].InstanceID)
+	assert.Nil(t, err)
+	_, err = store.DeleteBinding(expectedBindingIDs[0])
+	assert.Nil(t, err)
+	instanceIDs, err = enumerator.GetInstanceIDs()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, expectedInstanceIDs[1:], instanceIDs)
+	bindingIDs, err = enumerator.GetBindingIDs()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, expectedBindingIDs[1:], bindingIDs)
+}
+
+func testParentlessReads(t *testing.T, store storage.Store) {
+	reader, ok := store.(storage.ParentlessReader)
+	if !ok {
+		t.Skip("store does not implement storage.ParentlessReader")
+	}
+	parent := getTestInstance()
+	parent.Alias = uuid.NewV4().String()
+	child := getTestInstance()
+	child.Alias = uuid.NewV4().String()
+	child.ParentAlias = parent.Alias
+	for _, instance := range []service.Instance{parent, child} {
+		assert.Nil(t, store.WriteInstance(instance))
+	}
+	retrievedChild, ok, err := reader.GetInstanceWithoutParent(child.InstanceID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, child.InstanceID, retrievedChild.InstanceID)
+	assert.Equal(t, parent.Alias, retrievedChild.ParentAlias)
+	assert.NotNil(t, retrievedChild.Plan)
+	assert.Nil(t, retrievedChild.Parent)
+	retrievedChild, ok, err = reader.GetInstanceByAliasWithoutParent(child.Alias)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, child.InstanceID, retrievedChild.InstanceID)
+	assert.Nil(t, retrievedChild.Parent)
+	_, ok, err = reader.GetInstanceWithoutParent(uuid.NewV4().String())
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, ok, err = reader.GetInstanceByAliasWithoutParent(uuid.NewV4().String())
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func testAliasesAreUnique(t *testing.T, store storage.Store) {
+	instance := getTestInstance()
+	instance.Alias = uuid.NewV4().String()
+	assert.Nil(t, store.WriteInstance(instance))
+	// Rewriting the instance that holds the alias is fine
+	assert.Nil(t, store.WriteInstance(instance))
+	squatter := getTestInstance()
+	squatter.Alias = instance.Alias
+	squatter.ParentAlias = uuid.NewV4().String()
+	err := store.WriteInstance(squatter)
+	var aliasInUseErr *storage.AliasInUseError
+	if assert.True(t, errors.As(err, &aliasInUseErr)) {
+		assert.Equal(t, instance.Alias, aliasInUseErr.Alias)
+		assert.Equal(t, instance.InstanceID, aliasInUseErr.InstanceID)
+	}
+	// Nothing about the rejected instance was persisted
+	_, ok, err := store.GetInstance(squatter.InstanceID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	count, err := store.GetInstanceChildCountByAlias(squatter.ParentAlias)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+	retrievedInstance, ok, err := store.GetInstanceByAlias(instance.Alias)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, instance.InstanceID, retrievedInstance.InstanceID)
+}
+
+func testAliasesAreReleasedOnDeletion(t *testing.T, store storage.Store) {
+	instance := getTestInstance()
+	instance.Alias = uuid.NewV4().String()
+	assert.Nil(t, store.WriteInstance(instance))
+	_, err := store.DeleteInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	successor := getTestInstance()
+	successor.Alias = instance.Alias
+	assert.Nil(t, store.WriteInstance(successor))
+	retrievedInstance, ok, err := store.GetInstanceByAlias(instance.Alias)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, successor.InstanceID, retrievedInstance.InstanceID)
+}
+
+func testAliasesAreReleasedOnRewrites(t *testing.T, store storage.Store) {
+	instance := getTestInstance()
+	instance.Alias = uuid.NewV4().String()
+	assert.Nil(t, store.WriteInstance(instance))
+	oldAlias := instance.Alias
+	instance.Alias = uuid.NewV4().String()
+	assert.Nil(t, store.WriteInstance(instance))
+	_, ok, err := store.GetInstanceByAlias(oldAlias)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	retrievedInstance, ok, err := store.GetInstanceByAlias(instance.Alias)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, instance.InstanceID, retrievedInstance.InstanceID)
+	other := getTestInstance()
+	other.Alias = oldAlias
+	assert.Nil(t, store.WriteInstance(other))
+}
+
+func testChildrenMoveWithParentAlias(t *testing.T, store storage.Store) {
+	child := getTestInstance()
+	child.ParentAlias = uuid.NewV4().String()
+	assert.Nil(t, store.WriteInstance(child))
+	oldParentAlias := child.ParentAlias
+	child.ParentAlias = uuid.NewV4().String()
+	assert.Nil(t, store.WriteInstance(child))
+	count, err := store.GetInstanceChildCountByAlias(oldParentAlias)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+	count, err = store.GetInstanceChildCountByAlias(child.ParentAlias)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func testInstanceCannotBeItsOwnParent(t *testing.T, store storage.Store) {
+	instance := getTestInstance()
+	instance.Alias = uuid.NewV4().String()
+	instance.ParentAlias = instance.Alias
+	err := store.WriteInstance(instance)
+	var invalidParentAliasErr *storage.InvalidParentAliasError
+	assert.True(t, errors.As(err, &invalidParentAliasErr))
+	_, ok, err := store.GetInstance(instance.InstanceID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func testConcurrentAliasClaims(t *testing.T, store storage.Store) {
+	alias := uuid.NewV4().String()
+	results := make(chan error, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			instance := getTestInstance()
+			instance.Alias = alias
+			results <- store.WriteInstance(instance)
+		}()
+	}
+	wg.Wait()
+	close(results)
+	var claims int
+	for err := range results {
+		var aliasInUseErr *storage.AliasInUseError
+		if err == nil {
+			claims++
+		} else {
+			assert.True(t, errors.As(err, &aliasInUseErr))
+		}
+	}
+	assert.Equal(t, 1, claims)
+}
+
+func testLeasesAreExclusive(t *testing.T, store storage.Store) {
+	leaser, ok := store.(storage.Leaser)
+	if !ok {
+		t.Skip("store does not implement storage.Leaser")
+	}
+	name := uuid.NewV4().String()
+	acquired, err := leaser.AcquireLease(name, "foo", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	acquired, err = leaser.AcquireLease(name, "bar", time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, acquired)
+	// The holder can renew its lease
+	acquired, err = leaser.AcquireLease(name, "foo", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	// Leases are independent of one another
+	acquired, err = leaser.AcquireLease(uuid.NewV4().String(), "bar", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+}
+
+func testExpiredLeasesCanBeAcquired(t *testing.T, store storage.Store) {
+	leaser, ok := store.(storage.Leaser)
+	if !ok {
+		t.Skip("store does not implement storage.Leaser")
+	}
+	name := uuid.NewV4().String()
+	acquired, err := leaser.AcquireLease(name, "foo", 50*time.Millisecond)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	time.Sleep(100 * time.Millisecond)
+	acquired, err = leaser.AcquireLease(name, "bar", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+}
+
+// codecPrefix is prepended to secure values by the codec returned by
+// getTestCodec
+var codecPrefix = []byte("storetest:")
+
+// getTestCodec returns a codec that is distinguishable from any global codec.
+// It refuses to decrypt values it didn't encrypt.
+func getTestCodec() *fakeCrypto.Codec {
+	return &fakeCrypto.Codec{
+		EncryptBehavior: func(plaintext []byte) ([]byte, error) {
+			return append(append([]byte{}, codecPrefix...), plaintext...), nil
+		},
+		DecryptBehavior: func(ciphertext []byte) ([]byte, error) {
+			if !bytes.HasPrefix(ciphertext, codecPrefix) {
+				return nil, errors.New("value was not encrypted by this codec")
+			}
+			return ciphertext[len(codecPrefix):], nil
+		},
+	}
+}
+
+func testSecureValuesUseStoreCodec(t *testing.T, store storage.Store) {
+	codecStore, ok := store.(storage.CodecStore)
+	if !ok {
+		t.Skip("store does not implement storage.CodecStore")
+	}
+	storeWithCodec, err := codecStore.WithCodec(getTestCodec())
+	assert.Nil(t, err)
+	instance := getTestInstance()
+	instance.ProvisioningParameters = &service.ProvisioningParameters{
+		Parameters: service.Parameters{
+			Schema: getTestParametersSchema(t),
+			Data: map[string]interface{}{
+				SecureParameter: "foo",
+			},
+		},
+	}
+	assert.Nil(t, storeWithCodec.WriteInstance(instance))
+	binding := getTestBinding(instance.InstanceID)
+	binding.BindingParameters = &service.BindingParameters{
+		Parameters: service.Parameters{
+			Schema: getTestParametersSchema(t),
+			Data: map[string]interface{}{
+				SecureParameter: "bar",
+			},
+		},
+	}
+	assert.Nil(t, storeWithCodec.WriteBinding(binding))
+	retrievedInstance, ok, err := storeWithCodec.GetInstance(
+		instance.InstanceID,
+	)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	if assert.NotNil(t, retrievedInstance.ProvisioningParameters) {
+		pp := retrievedInstance.ProvisioningParameters
+		assert.Equal(t, "foo", pp.GetString(SecureParameter))
+	}
+	retrievedBinding, ok, err := storeWithCodec.GetBinding(binding.BindingID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	if assert.NotNil(t, retrievedBinding.BindingParameters) {
+		bp := retrievedBinding.BindingParameters
+		assert.Equal(t, "bar", bp.GetString(SecureParameter))
+	}
+	// The same records can't be decrypted using the global codec
+	retrievedInstance, ok, err = store.GetInstance(instance.InstanceID)
+	if err == nil && assert.True(t, ok) {
+		pp := retrievedInstance.ProvisioningParameters
+		assert.NotEqual(t, "foo", pp.GetString(SecureParameter))
+	}
+	retrievedBinding, ok, err = store.GetBinding(binding.BindingID)
+	if err == nil && assert.True(t, ok) {
+		bp := retrievedBinding.BindingParameters
+		assert.NotEqual(t, "bar", bp.GetString(SecureParameter))
+	}
+}
@@ -0,0 +1,56 @@
+package tenant
+
+import (
+	"context"
+
+	"github.com/deis/async"
+)
+
+// TaskArg is the name of the task argument that identifies the tenant on
+// whose behalf a task is executed
+const TaskArg = "tenant"
+
+type engine struct {
+	async.Engine
+	tenantName string
+}
+
+// NewEngine returns an implementation of async.Engine that submits every task
+// to the given, shared engine on behalf of the named tenant
+func NewEngine(sharedEngine async.Engine, tenantName string) async.Engine {
+	return &engine{
+		Engine:     sharedEngine,
+		tenantName: tenantName,
+	}
+}
+
+// SubmitTask submits a task, on behalf of the tenant, to the shared async
+// engine
+func (e *engine) SubmitTask(task async.Task) error {
+	SetTaskTenant(task, e.tenantName)
+	return e.Engine.SubmitTask(task)
+}
+
+// Run is a no-op that blocks until the context is canceled. The shared async
+// engine is run by whoever owns it.
+func (e *engine) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// GetTaskTenant returns the name of the tenant on whose behalf the given task
+// is executed. An empty string is returned for tasks that don't belong to any
+// particular tenant.
+func GetTaskTenant(task async.Task) string {
+	return task.GetArgs()[TaskArg]
+}
+
+// SetTaskTenant marks the given task as being executed on behalf of the named
+// tenant
+func SetTaskTenant(task async.Task, tenantName string) {
+	args := task.GetArgs()
+	if tenantName == "" || args == nil {
+		return
+	}
+	args[TaskArg] = tenantName
+}
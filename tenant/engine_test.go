@@ -0,0 +1,31 @@
+package tenant
+
+import (
+	"testing"
+
+	"github.com/deis/async"
+	fakeAsync "github.com/deis/async/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngineSubmitsTasksOnBehalfOfTenant(t *testing.T) {
+	sharedEngine := fakeAsync.NewEngine()
+	e := NewEngine(sharedEngine, "foo")
+	err := e.SubmitTask(
+		async.NewTask("bar", map[string]string{"instanceID": "baz"}),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(sharedEngine.SubmittedTasks))
+	for _, task := range sharedEngine.SubmittedTasks {
+		assert.Equal(t, "foo", GetTaskTenant(task))
+		assert.Equal(t, "baz", task.GetArgs()["instanceID"])
+	}
+}
+
+func TestSetTaskTenantWithoutTenant(t *testing.T) {
+	task := async.NewTask("bar", map[string]string{})
+	SetTaskTenant(task, "")
+	assert.Empty(t, GetTaskTenant(task))
+	_, ok := task.GetArgs()[TaskArg]
+	assert.False(t, ok)
+}
@@ -0,0 +1,48 @@
+package tenant
+
+import (
+	"errors"
+
+	"github.com/barpilot/gosba/crypto"
+	"github.com/barpilot/gosba/http/filter"
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/storage"
+)
+
+// Tenant represents one of several independent brokers hosted by a single
+// process. Each tenant has its own catalog, storage, codec, and filter chain
+// (e.g. its own credentials), while the async engine is shared among all
+// tenants.
+type Tenant struct {
+	// Name uniquely identifies the tenant. Unless Host is set, the tenant's OSB
+	// API is served beneath /tenants/{Name}.
+	Name string
+	// Host, if set, causes the tenant's OSB API to be served at the root of
+	// this host instead of beneath /tenants/{Name}
+	Host    string
+	Catalog service.Catalog
+	Store   storage.Store
+	// Codec, if set, encrypts and decrypts the secure values of the tenant's
+	// instances and bindings in place of the globally configured codec, so
+	// that no tenant can decrypt another tenant's secrets. The tenant's store
+	// must then implement storage.CodecStore, as all of this module's stores
+	// do.
+	Codec       crypto.Codec
+	FilterChain filter.Filter
+}
+
+// GetStore returns the tenant's store, which encrypts and decrypts secure
+// values using the tenant's codec, if it has one. Every invocation for a
+// tenant with a codec returns a new store for the same records.
+func (t Tenant) GetStore() (storage.Store, error) {
+	if t.Codec == nil {
+		return t.Store, nil
+	}
+	codecStore, ok := t.Store.(storage.CodecStore)
+	if !ok {
+		return nil, errors.New(
+			"the store does not support codecs other than the global codec",
+		)
+	}
+	return codecStore.WithCodec(t.Codec)
+}
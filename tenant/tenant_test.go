@@ -0,0 +1,44 @@
+package tenant
+
+import (
+	"testing"
+
+	"github.com/barpilot/gosba/crypto/noop"
+	"github.com/barpilot/gosba/service"
+	"github.com/barpilot/gosba/storage"
+	memoryStorage "github.com/barpilot/gosba/storage/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+// codeclessStore is a storage.Store that doesn't implement storage.CodecStore
+type codeclessStore struct {
+	storage.Store
+}
+
+func TestGetStoreWithoutCodec(t *testing.T) {
+	store := memoryStorage.NewStore(service.NewCatalog(nil))
+	tenantStore, err := Tenant{Store: store}.GetStore()
+	assert.Nil(t, err)
+	assert.Equal(t, store, tenantStore)
+}
+
+func TestGetStoreWithCodec(t *testing.T) {
+	store := memoryStorage.NewStore(service.NewCatalog(nil))
+	tenantStore, err := Tenant{
+		Store: store,
+		Codec: noop.NewCodec(),
+	}.GetStore()
+	assert.Nil(t, err)
+	assert.NotNil(t, tenantStore)
+	assert.NotEqual(t, store, tenantStore)
+}
+
+func TestGetStoreWithCodecAndCodeclessStore(t *testing.T) {
+	_, err := Tenant{
+		Store: codeclessStore{
+			Store: memoryStorage.NewStore(service.NewCatalog(nil)),
+		},
+		Codec: noop.NewCodec(),
+	}.GetStore()
+	assert.NotNil(t, err)
+}
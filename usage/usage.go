@@ -0,0 +1,61 @@
+package usage
+
+import (
+	"context"
+	"time"
+)
+
+// EventType represents the kind of change in usage an Event describes
+type EventType string
+
+const (
+	// EventTypeInstanceCreated indicates an instance finished provisioning and
+	// began accruing usage against its plan
+	EventTypeInstanceCreated EventType = "instance.created"
+	// EventTypePlanChanged indicates an instance finished updating to a
+	// different plan. Usage accrued against the previous plan up until this
+	// point and accrues against the new plan from this point on.
+	EventTypePlanChanged EventType = "instance.plan_changed"
+	// EventTypeInstanceDeleted indicates an instance finished deprovisioning
+	// and stopped accruing usage
+	EventTypeInstanceDeleted EventType = "instance.deleted"
+)
+
+// Event describes a change in the usage of a service instance. The time
+// between an instance's created and deleted events, divided at any plan
+// changed events, is the time the instance spent on each plan.
+type Event struct {
+	// ID uniquely identifies the event so that consumers can recognize events
+	// that are delivered more than once
+	ID        string    `json:"id"`
+	Type      EventType `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	// Tenant is the name of the tenant the instance belongs to. It is only set
+	// by brokers that serve multiple tenants.
+	Tenant     string `json:"tenant,omitempty"`
+	InstanceID string `json:"instanceId"`
+	ServiceID  string `json:"serviceId"`
+	PlanID     string `json:"planId"`
+	// PreviousPlanID is only set for plan changed events
+	PreviousPlanID string `json:"previousPlanId,omitempty"`
+}
+
+// Reporter is an interface to be implemented by types that relay usage events
+// to a consumer, such as a billing system
+type Reporter interface {
+	// Report relays the given event. Reporters are invoked by an async job,
+	// after the change in usage has been persisted. If an error is returned,
+	// the broker reports the event again later (see broker.Config.UsageRetry),
+	// so consumers may receive an event, identified by its ID, more than once.
+	// A failure to report an event never causes the operation the event
+	// describes to fail.
+	Report(context.Context, Event) error
+}
+
+// ReporterFunc adapts an ordinary function to the Reporter interface
+type ReporterFunc func(context.Context, Event) error
+
+// Report invokes the ReporterFunc
+func (r ReporterFunc) Report(ctx context.Context, event Event) error {
+	return r(ctx, event)
+}
@@ -0,0 +1,25 @@
+package webhook
+
+import (
+	lifecyclewebhook "github.com/barpilot/gosba/lifecycle/webhook"
+)
+
+// Config represents configuration options for the webhook-based implementation
+// of the usage.Reporter interface. Since each event is delivered before it is
+// reported, QueueSize does not apply.
+type Config struct {
+	lifecyclewebhook.Config
+}
+
+// NewConfigWithDefaults returns a Config object with default values already
+// applied. Callers are then free to set custom values for the remaining fields
+// and/or override default values.
+func NewConfigWithDefaults() Config {
+	config := Config{
+		Config: lifecyclewebhook.NewConfigWithDefaults(),
+	}
+	// Reporting an event blocks an async job, so only a few attempts are made.
+	// The broker reports the event again later if they all fail.
+	config.MaxAttempts = 3
+	return config
+}
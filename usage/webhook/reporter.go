@@ -0,0 +1,45 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	lifecyclewebhook "github.com/barpilot/gosba/lifecycle/webhook"
+	"github.com/barpilot/gosba/usage"
+)
+
+type reporter struct {
+	deliverer lifecyclewebhook.Deliverer
+}
+
+// NewReporter returns a new webhook-based implementation of the
+// usage.Reporter interface that delivers usage events to a webhook, such as a
+// billing system's. Deliveries are made and signed exactly as those of
+// lifecycle events are, so consumers can use lifecyclewebhook.VerifySignature
+// to authenticate them and the event ID header to recognize redeliveries.
+// Each event is delivered before Report returns, so that events the webhook
+// doesn't accept are reported again by the broker instead of being lost.
+func NewReporter(config Config) (usage.Reporter, error) {
+	deliverer, err := lifecyclewebhook.NewDeliverer(config.Config)
+	if err != nil {
+		return nil, err
+	}
+	return &reporter{
+		deliverer: deliverer,
+	}, nil
+}
+
+// Report delivers the given event. It blocks until the event has been
+// delivered or the configured maximum number of attempts has been made.
+func (r *reporter) Report(ctx context.Context, event usage.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error marshaling usage event: %s", err)
+	}
+	return r.deliverer.Deliver(ctx, lifecyclewebhook.Delivery{
+		ID:   event.ID,
+		Type: string(event.Type),
+		Body: body,
+	})
+}
@@ -0,0 +1,106 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	lifecyclewebhook "github.com/barpilot/gosba/lifecycle/webhook"
+	"github.com/barpilot/gosba/usage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReporterDeliversSignedEventsWithRetries(t *testing.T) {
+	secret := "foo"
+	const failures = 2
+	var mutex sync.Mutex
+	attempts := 0
+	delivered := []usage.Event{}
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			attempts++
+			if attempts <= failures {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			body, err := ioutil.ReadAll(r.Body)
+			assert.Nil(t, err)
+			assert.True(t, lifecyclewebhook.VerifySignature(
+				[]byte(secret),
+				body,
+				r.Header.Get(lifecyclewebhook.SignatureHeader),
+			))
+			event := usage.Event{}
+			assert.Nil(t, json.Unmarshal(body, &event))
+			assert.Equal(
+				t,
+				event.ID,
+				r.Header.Get(lifecyclewebhook.EventIDHeader),
+			)
+			w.WriteHeader(http.StatusNoContent)
+			delivered = append(delivered, event)
+		},
+	))
+	defer svr.Close()
+	config := NewConfigWithDefaults()
+	config.URL = svr.URL
+	config.Secret = secret
+	config.RetryDelay = time.Millisecond
+	reporter, err := NewReporter(config)
+	assert.Nil(t, err)
+	event := usage.Event{
+		ID:         "bar",
+		Type:       usage.EventTypeInstanceCreated,
+		Timestamp:  time.Now(),
+		InstanceID: "bat",
+		ServiceID:  "baz",
+		PlanID:     "qux",
+	}
+	// The event should have been delivered by the time Report returns
+	assert.Nil(t, reporter.Report(context.Background(), event))
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, failures+1, attempts)
+	assert.Equal(t, 1, len(delivered))
+	if len(delivered) == 1 {
+		assert.Equal(t, "bar", delivered[0].ID)
+		assert.Equal(t, "qux", delivered[0].PlanID)
+	}
+}
+
+func TestReporterReturnsErrorIfEventIsNotDelivered(t *testing.T) {
+	var mutex sync.Mutex
+	attempts := 0
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			attempts++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		},
+	))
+	defer svr.Close()
+	config := NewConfigWithDefaults()
+	config.URL = svr.URL
+	config.RetryDelay = time.Millisecond
+	reporter, err := NewReporter(config)
+	assert.Nil(t, err)
+	err = reporter.Report(
+		context.Background(),
+		usage.Event{
+			ID:   "foo",
+			Type: usage.EventTypeInstanceDeleted,
+		},
+	)
+	assert.NotNil(t, err)
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, config.MaxAttempts, attempts)
+}
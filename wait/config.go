@@ -0,0 +1,22 @@
+package wait
+
+// Config represents configuration options for how often, and for how long, the
+// broker waits on instances related to the one it is operating on
+type Config struct {
+	// Parent governs waiting on a parent instance to finish provisioning before
+	// provisioning a child instance
+	Parent Policy
+	// Children governs waiting on child instances to finish deprovisioning
+	// before deprovisioning a parent instance
+	Children Policy
+}
+
+// NewConfigWithDefaults returns a Config object with default values already
+// applied. Callers are then free to set custom values for the remaining fields
+// and/or override default values.
+func NewConfigWithDefaults() Config {
+	return Config{
+		Parent:   NewPolicyWithDefaults(),
+		Children: NewPolicyWithDefaults(),
+	}
+}
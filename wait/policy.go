@@ -0,0 +1,62 @@
+package wait
+
+import (
+	"math"
+	"time"
+)
+
+// Policy describes how often a condition the broker is waiting on is
+// re-checked and how long the broker waits before giving up. Intervals between
+// checks start at InitialInterval and grow by a factor of Multiplier with each
+// check, up to MaxInterval, if set. A MaxWait of zero means the broker waits
+// indefinitely.
+type Policy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	MaxWait         time.Duration
+}
+
+// NewPolicyWithDefaults returns a Policy object with default values already
+// applied. Callers are then free to set custom values for the remaining fields
+// and/or override default values.
+func NewPolicyWithDefaults() Policy {
+	return Policy{
+		InitialInterval: time.Minute,
+		MaxInterval:     time.Minute * 10,
+		Multiplier:      1.5,
+		MaxWait:         time.Hour * 24,
+	}
+}
+
+// GetInterval returns how long to wait before carrying out the given check.
+// Checks are numbered starting from zero.
+func (p Policy) GetInterval(check int) time.Duration {
+	interval := float64(p.InitialInterval)
+	if p.Multiplier > 1 && check > 0 {
+		interval *= math.Pow(p.Multiplier, float64(check))
+	}
+	if p.MaxInterval > 0 && interval > float64(p.MaxInterval) {
+		return p.MaxInterval
+	}
+	if interval <= 0 {
+		return time.Minute
+	}
+	// Without a MaxInterval, intervals keep growing and would eventually
+	// overflow a time.Duration
+	if interval >= math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(interval)
+}
+
+// GetDeadline returns the time after which the broker should stop waiting if
+// waiting began at the given time. If the policy does not limit how long the
+// broker waits, nil is returned.
+func (p Policy) GetDeadline(started time.Time) *time.Time {
+	if p.MaxWait <= 0 {
+		return nil
+	}
+	deadline := started.Add(p.MaxWait)
+	return &deadline
+}
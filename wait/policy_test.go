@@ -0,0 +1,49 @@
+package wait
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetIntervalBacksOff(t *testing.T) {
+	p := Policy{
+		InitialInterval: time.Second,
+		MaxInterval:     time.Second * 5,
+		Multiplier:      2,
+	}
+	assert.Equal(t, time.Second, p.GetInterval(0))
+	assert.Equal(t, time.Second*2, p.GetInterval(1))
+	assert.Equal(t, time.Second*4, p.GetInterval(2))
+	assert.Equal(t, time.Second*5, p.GetInterval(3))
+	assert.Equal(t, time.Second*5, p.GetInterval(10))
+}
+
+func TestGetIntervalWithoutBackoff(t *testing.T) {
+	p := Policy{
+		InitialInterval: time.Second * 30,
+	}
+	assert.Equal(t, time.Second*30, p.GetInterval(0))
+	assert.Equal(t, time.Second*30, p.GetInterval(5))
+}
+
+func TestGetIntervalWithoutMaxIntervalDoesNotOverflow(t *testing.T) {
+	p := Policy{
+		InitialInterval: time.Second,
+		Multiplier:      2,
+	}
+	assert.Equal(t, time.Duration(math.MaxInt64), p.GetInterval(100))
+	assert.Equal(t, time.Duration(math.MaxInt64), p.GetInterval(10000))
+}
+
+func TestGetDeadline(t *testing.T) {
+	started := time.Now()
+	p := Policy{MaxWait: time.Hour}
+	deadline := p.GetDeadline(started)
+	assert.NotNil(t, deadline)
+	assert.Equal(t, started.Add(time.Hour), *deadline)
+	p.MaxWait = 0
+	assert.Nil(t, p.GetDeadline(started))
+}
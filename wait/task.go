@@ -0,0 +1,37 @@
+package wait
+
+import (
+	"strconv"
+
+	"github.com/deis/async"
+)
+
+// NewCheckTask returns a new task that, after an interval determined by the
+// given policy, executes the named job to check whether the broker may stop
+// waiting on behalf of the given instance. Checks are numbered starting from
+// zero.
+func NewCheckTask(
+	jobName string,
+	instanceID string,
+	check int,
+	policy Policy,
+) async.Task {
+	return async.NewDelayedTask(
+		jobName,
+		map[string]string{
+			"instanceID": instanceID,
+			"check":      strconv.Itoa(check),
+		},
+		policy.GetInterval(check),
+	)
+}
+
+// GetCheck returns the number of the check carried out by the given task. Tasks
+// that do not carry a check number are treated as the first check.
+func GetCheck(task async.Task) int {
+	check, err := strconv.Atoi(task.GetArgs()["check"])
+	if err != nil {
+		return 0
+	}
+	return check
+}